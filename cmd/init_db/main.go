@@ -54,6 +54,19 @@ func main() {
 		&models.ImageTag{},
 		&models.Token{},
 		&models.PrivateFile{},
+		&models.ShareLink{},
+		&models.ShareAccessLog{},
+		&models.Job{},
+		&models.ImageVariant{},
+		&models.WatermarkSetting{},
+		&models.PrivateFolder{},
+		&models.RevokedToken{},
+		&models.UserTOTP{},
+		&models.RecoveryCode{},
+		&models.LoginAttempt{},
+		&models.UserIdentity{},
+		&models.OIDCAuthRequest{},
+		&models.Session{},
 	)
 
 	if err != nil {
@@ -16,15 +16,56 @@ type LogConfig struct {
 	Compress   bool   `mapstructure:"compress"`
 }
 
+// JWTKeyConfig JWT 签名密钥，密钥内容中的 ${ENV} 会被替换为环境变量
+type JWTKeyConfig struct {
+	ID         string `mapstructure:"id"`          // 写入令牌头部的 kid
+	Algorithm  string `mapstructure:"algorithm"`   // HS256、RS256 或 EdDSA
+	Secret     string `mapstructure:"secret"`      // HS256 密钥，至少 32 字节
+	PrivateKey string `mapstructure:"private_key"` // RS256/EdDSA 私钥，PEM 内容或文件路径
+	PublicKey  string `mapstructure:"public_key"`  // RS256/EdDSA 公钥，只用于验证的旧密钥可以只配置公钥
+}
+
+// TokenScopeConfig API 令牌范围，令牌以 <名称>:read 或 <名称>:write 申请，read 只允许 GET/HEAD 请求
+type TokenScopeConfig struct {
+	Permissions []string `mapstructure:"permissions"` // 范围内可以使用的权限，最终权限为与用户角色权限的交集
+	Paths       []string `mapstructure:"paths"`       // 范围内可以访问的路由前缀
+}
+
+// OIDCProviderConfig 单点登录的身份提供方，client_secret 中的 ${ENV} 会被替换为环境变量
+type OIDCProviderConfig struct {
+	ID                   string   `mapstructure:"id"`                     // 出现在登录地址中，如 /auth/oidc/{id}/login
+	Name                 string   `mapstructure:"name"`                   // 登录页面显示的名称
+	Issuer               string   `mapstructure:"issuer"`                 // 身份提供方地址，用于服务发现
+	ClientID             string   `mapstructure:"client_id"`              // 在身份提供方注册的客户端 ID
+	ClientSecret         string   `mapstructure:"client_secret"`          // 客户端密钥，公开客户端留空
+	RedirectURL          string   `mapstructure:"redirect_url"`           // 回调地址，为空时使用 {url.apiurl}/auth/oidc/{id}/callback
+	Scopes               []string `mapstructure:"scopes"`                 // 为空时使用 openid email profile
+	LinkByEmail          bool     `mapstructure:"link_by_email"`          // 首次登录时按邮箱关联已有账号（邮箱须经身份提供方验证）
+	AutoCreate           bool     `mapstructure:"auto_create"`            // 没有对应账号时自动创建
+	DefaultRole          string   `mapstructure:"default_role"`           // 自动创建的账号分配的角色
+	AllowedDomains       []string `mapstructure:"allowed_domains"`        // 只允许这些邮箱域名登录，为空时不限制
+	AllowUnverifiedEmail bool     `mapstructure:"allow_unverified_email"` // 身份提供方没有返回 email_verified 时也信任邮箱
+}
+
 type AppConfig struct {
 	App struct {
-		Port int
+		Port            int
+		TrustedProxies  []string `mapstructure:"trusted_proxies"`   // 反向代理的 IP 或网段，只有来自这些地址的请求才读取转发头
+		RemoteIPHeaders []string `mapstructure:"remote_ip_headers"` // 读取客户端 IP 的请求头，为空时使用 X-Forwarded-For 和 X-Real-IP
 	}
 
 	Upload struct {
-		Path           string `mapstructure:"path"`
-		ThumbnailsPath string `mapstructure:"thumbnails_path"`
-		MaxSize        int64  `mapstructure:"max_size"`
+		Path               string   `mapstructure:"path"`
+		ThumbnailsPath     string   `mapstructure:"thumbnails_path"`
+		MaxSize            int64    `mapstructure:"max_size"`
+		MaxPixels          int64    `mapstructure:"max_pixels"`           // 图片最大像素数，防御解压炸弹
+		ThumbnailSizes     []int    `mapstructure:"thumbnail_sizes"`      // 缩略图宽度列表（像素）
+		ThumbnailFormats   []string `mapstructure:"thumbnail_formats"`    // 额外生成的缩略图格式（webp/avif），另外总会生成一份兼容格式
+		AnimatedMaxWidth   int      `mapstructure:"animated_max_width"`   // 动图预览的最大宽度，更宽的尺寸只生成静态缩略图
+		AnimatedMaxFrames  int      `mapstructure:"animated_max_frames"`  // 动图预览最多保留的帧数
+		RemoteTimeout      int      `mapstructure:"remote_timeout"`       // URL 上传的下载超时（秒）
+		RemoteMaxRedirects int      `mapstructure:"remote_max_redirects"` // URL 上传最多跟随的重定向次数
+		RemoteAllowPrivate bool     `mapstructure:"remote_allow_private"` // URL 上传是否允许访问内网地址（仅限可信环境）
 	}
 
 	PrivateFiles struct {
@@ -33,6 +74,108 @@ type AppConfig struct {
 		AllowedTypes string `mapstructure:"allowed_types"`
 	} `mapstructure:"private_files"`
 
+	Scanner struct {
+		Enabled        bool   `mapstructure:"enabled"`         // 是否启用上传扫描
+		Type           string `mapstructure:"type"`            // 扫描器类型，目前支持 clamd
+		Network        string `mapstructure:"network"`         // tcp 或 unix
+		Address        string `mapstructure:"address"`         // 扫描服务地址
+		Timeout        int    `mapstructure:"timeout"`         // 扫描超时（秒）
+		FailOpen       bool   `mapstructure:"fail_open"`       // 扫描服务不可用时是否放行
+		QuarantinePath string `mapstructure:"quarantine_path"` // 隔离区存储路径
+	} `mapstructure:"scanner"`
+
+	S3 struct {
+		Enabled bool   `mapstructure:"enabled"` // 是否启用 S3 兼容接口（/s3）
+		Region  string `mapstructure:"region"`  // 签名使用的区域，为空时接受任意区域
+	} `mapstructure:"s3"`
+
+	WebDAV struct {
+		Enabled bool `mapstructure:"enabled"` // 是否启用 WebDAV 接口（/webdav）
+	} `mapstructure:"webdav"`
+
+	JWT struct {
+		SigningKey      string         `mapstructure:"signing_key"`       // 签发令牌使用的密钥 kid，其余密钥只用于验证
+		Issuer          string         `mapstructure:"issuer"`            // 令牌的 iss，为空时不写入也不校验
+		AccessTokenTTL  int            `mapstructure:"access_token_ttl"`  // 访问令牌有效期（秒）
+		RefreshTokenTTL int            `mapstructure:"refresh_token_ttl"` // 刷新令牌有效期（秒），每次刷新后重新计算
+		Keys            []JWTKeyConfig `mapstructure:"keys"`
+	} `mapstructure:"jwt"`
+
+	TwoFactor struct {
+		Issuer        string   `mapstructure:"issuer"`         // 验证器应用中显示的服务名称
+		RequiredRoles []string `mapstructure:"required_roles"` // 必须启用两步验证的角色，未启用前只能访问两步验证设置接口
+		ChallengeTTL  int      `mapstructure:"challenge_ttl"`  // 登录二次验证的有效期（秒）
+	} `mapstructure:"two_factor"`
+
+	LoginProtection struct {
+		Window           int `mapstructure:"window"`            // 统计登录失败次数的时间窗口（秒）
+		FreeAttempts     int `mapstructure:"free_attempts"`     // 账号连续失败这么多次之内不限制
+		IPFreeAttempts   int `mapstructure:"ip_free_attempts"`  // 同一 IP（所有账号合计）失败这么多次之内不限制
+		BaseDelay        int `mapstructure:"base_delay"`        // 超过上述次数后首次需要等待的时间（秒），之后每次失败翻倍
+		MaxDelay         int `mapstructure:"max_delay"`         // 等待时间上限（秒）
+		LockoutThreshold int `mapstructure:"lockout_threshold"` // 账号连续失败这么多次后临时锁定
+		LockoutDuration  int `mapstructure:"lockout_duration"`  // 锁定时长（秒），从最近一次失败开始计算
+		RetentionDays    int `mapstructure:"retention_days"`    // 登录记录保留天数
+	} `mapstructure:"login_protection"`
+
+	Account struct {
+		RequireEmailVerification bool     `mapstructure:"require_email_verification"` // 注册和修改邮箱后是否需要验证邮箱
+		UnverifiedPermissions    []string `mapstructure:"unverified_permissions"`     // 未验证邮箱的用户可以使用的权限（与角色权限取交集）
+		VerifyTokenTTL           int      `mapstructure:"verify_token_ttl"`           // 邮箱验证链接有效期（秒）
+		ResetTokenTTL            int      `mapstructure:"reset_token_ttl"`            // 重置密码链接有效期（秒）
+		ResendInterval           int      `mapstructure:"resend_interval"`            // 两次发送验证或重置邮件的最短间隔（秒）
+		VerifyURL                string   `mapstructure:"verify_url"`                 // 验证链接模板，{token} 替换为令牌
+		ResetURL                 string   `mapstructure:"reset_url"`                  // 重置密码链接模板，{token} 替换为令牌
+	} `mapstructure:"account"`
+
+	Mail struct {
+		Driver        string `mapstructure:"driver"`         // smtp、file 或 log
+		From          string `mapstructure:"from"`           // 发件人，如 "img_hosting <noreply@example.com>"
+		SiteName      string `mapstructure:"site_name"`      // 邮件中显示的站点名称
+		TemplatesPath string `mapstructure:"templates_path"` // 自定义邮件模板目录
+		OutboxPath    string `mapstructure:"outbox_path"`    // file 模式的发件箱目录
+		SMTP          struct {
+			Host       string `mapstructure:"host"`
+			Port       int    `mapstructure:"port"`
+			Username   string `mapstructure:"username"`
+			Password   string `mapstructure:"password"`
+			Encryption string `mapstructure:"encryption"` // none、starttls 或 tls
+			Timeout    int    `mapstructure:"timeout"`    // 秒
+		} `mapstructure:"smtp"`
+	} `mapstructure:"mail"`
+
+	OIDC struct {
+		FrontendURL string               `mapstructure:"frontend_url"` // 登录完成后跳转的前端地址，一次性登录码放在 # 之后；为空时回调直接返回令牌
+		StateTTL    int                  `mapstructure:"state_ttl"`    // 跳转到身份提供方后完成登录的时限（秒）
+		Providers   []OIDCProviderConfig `mapstructure:"providers"`
+	} `mapstructure:"oidc"`
+
+	Quota struct {
+		Default int64            `mapstructure:"default"` // 未配置角色时的默认配额（字节，0表示不限）
+		Roles   map[string]int64 `mapstructure:"roles"`   // 各角色的存储配额（字节，0表示不限）
+	} `mapstructure:"quota"`
+
+	Watermark struct {
+		Enabled         bool    `mapstructure:"enabled"`           // 用户未单独设置时是否添加水印
+		Type            string  `mapstructure:"type"`              // text 或 image
+		Text            string  `mapstructure:"text"`              // 文字水印内容
+		FontPath        string  `mapstructure:"font_path"`         // 字体文件，文字含中文时需要配置
+		Color           string  `mapstructure:"color"`             // 文字颜色 #RRGGBB 或 #RRGGBBAA
+		ImagePath       string  `mapstructure:"image_path"`        // 图片水印文件路径
+		Position        string  `mapstructure:"position"`          // top-left/top-right/bottom-left/bottom-right/center
+		Opacity         float64 `mapstructure:"opacity"`           // 不透明度 0~1
+		Scale           float64 `mapstructure:"scale"`             // 水印宽度占图片宽度的比例 0~1
+		MinWidth        int     `mapstructure:"min_width"`         // 窄于该宽度的缩略图不加水印
+		ApplyToOriginal bool    `mapstructure:"apply_to_original"` // 是否同时给保存的原图加水印
+	} `mapstructure:"watermark"`
+
+	Jobs struct {
+		Workers      int `mapstructure:"workers"`       // 后台任务 worker 数量
+		MaxAttempts  int `mapstructure:"max_attempts"`  // 任务最大尝试次数
+		PollInterval int `mapstructure:"poll_interval"` // 空闲时轮询间隔（秒）
+		RetryBackoff int `mapstructure:"retry_backoff"` // 首次重试等待时间（秒），之后按指数递增
+	} `mapstructure:"jobs"`
+
 	Database struct {
 		Host     string
 		Port     int
@@ -41,12 +184,15 @@ type AppConfig struct {
 	}
 
 	Url struct {
-		Imgurl string
+		Imgurl   string
+		Thumburl string // 缩略图访问地址前缀
+		Apiurl   string // API 对外访问地址，用于生成上传工具配置和删除链接，为空时使用请求的 Host
 	}
 
 	Permissions struct {
-		Routes map[string][]string `mapstructure:"routes"`
-		Roles  map[string][]string `mapstructure:"roles"`
+		Routes map[string][]string         `mapstructure:"routes"`
+		Roles  map[string][]string         `mapstructure:"roles"`
+		Scopes map[string]TokenScopeConfig `mapstructure:"scopes"` // API 令牌可以申请的范围
 	} `mapstructure:"permissions"`
 
 	Log LogConfig `mapstructure:"log"`
@@ -0,0 +1,147 @@
+package controllers
+
+import (
+	"errors"
+	"img_hosting/models"
+	"img_hosting/pkg/logger"
+	"img_hosting/services"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// AccountController 邮箱验证和找回密码
+type AccountController struct{}
+
+func NewAccountController() *AccountController {
+	return &AccountController{}
+}
+
+// ForgotPassword godoc
+// @Summary 找回密码
+// @Description 向邮箱发送重置密码链接。为避免泄露邮箱是否已注册，邮箱不存在时同样返回成功
+// @Tags 认证
+// @Accept json
+// @Produce json
+// @Param request body models.ForgotPasswordRequest true "邮箱"
+// @Success 200 {object} models.Response
+// @Failure 400 {object} models.Response
+// @Failure 503 {object} models.Response "未配置重置密码链接"
+// @Router /auth/password/forgot [post]
+func (ac *AccountController) ForgotPassword(c *gin.Context) {
+	var req models.ForgotPasswordRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "请输入有效的邮箱地址"})
+		return
+	}
+
+	if err := services.RequestPasswordReset(req.Email, c.ClientIP()); err != nil {
+		if errors.Is(err, services.ErrMailLinkUnavailable) {
+			c.JSON(http.StatusServiceUnavailable, gin.H{"error": "未开启找回密码"})
+			return
+		}
+		logger.GetLogger().WithError(err).Error("创建重置密码邮件失败")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "发送邮件失败，请稍后再试"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "如果邮箱已注册，重置密码的链接已发送到该邮箱"})
+}
+
+// ResetPassword godoc
+// @Summary 重置密码
+// @Description 使用邮件中的令牌设置新密码，链接只能使用一次。重置后所有设备需要重新登录
+// @Tags 认证
+// @Accept json
+// @Produce json
+// @Param request body models.ResetPasswordRequest true "令牌和新密码"
+// @Success 200 {object} models.Response
+// @Failure 400,403 {object} models.Response
+// @Router /auth/password/reset [post]
+func (ac *AccountController) ResetPassword(c *gin.Context) {
+	var req models.ResetPasswordRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "新密码需要 8-20 位，包含字母、数字和特殊字符"})
+		return
+	}
+
+	if err := services.ResetPassword(req.Token, req.NewPassword); err != nil {
+		switch {
+		case errors.Is(err, services.ErrResetTokenInvalid):
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		case errors.Is(err, services.ErrUserDisabled):
+			c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+		default:
+			logger.GetLogger().WithError(err).Error("重置密码失败")
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "重置密码失败"})
+		}
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "密码已重置，请使用新密码登录"})
+}
+
+// VerifyEmail godoc
+// @Summary 验证邮箱
+// @Description 使用邮件中的令牌验证邮箱。邮件中的链接为 GET 请求，令牌在查询参数 token 中；也可以 POST JSON
+// @Tags 认证
+// @Accept json
+// @Produce json
+// @Param token query string false "验证令牌（GET）"
+// @Param request body models.VerifyEmailRequest false "验证令牌（POST）"
+// @Success 200 {object} models.Response
+// @Failure 400 {object} models.Response
+// @Router /auth/verify-email [get]
+// @Router /auth/verify-email [post]
+func (ac *AccountController) VerifyEmail(c *gin.Context) {
+	token := c.Query("token")
+	if c.Request.Method == http.MethodPost {
+		var req models.VerifyEmailRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "缺少验证令牌"})
+			return
+		}
+		token = req.Token
+	}
+	if token == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "缺少验证令牌"})
+		return
+	}
+
+	if _, err := services.VerifyEmail(token); err != nil {
+		if errors.Is(err, services.ErrVerifyTokenInvalid) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		logger.GetLogger().WithError(err).Error("验证邮箱失败")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "验证邮箱失败"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "邮箱验证成功"})
+}
+
+// ResendVerification godoc
+// @Summary 重新发送验证邮件
+// @Description 给当前用户的邮箱重新发送验证邮件，之前的验证链接失效
+// @Tags 用户管理
+// @Produce json
+// @Security BearerAuth
+// @Success 200 {object} models.Response
+// @Failure 401,409,429,503 {object} models.Response
+// @Router /users/me/verify-email [post]
+func (ac *AccountController) ResendVerification(c *gin.Context) {
+	err := services.SendVerificationEmail(c.GetUint("user_id"))
+	if err != nil {
+		switch {
+		case errors.Is(err, services.ErrEmailAlreadyVerified):
+			c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		case errors.Is(err, services.ErrMailTooFrequent):
+			c.JSON(http.StatusTooManyRequests, gin.H{"error": err.Error()})
+		case errors.Is(err, services.ErrMailLinkUnavailable):
+			c.JSON(http.StatusServiceUnavailable, gin.H{"error": err.Error()})
+		default:
+			logger.GetLogger().WithError(err).Error("发送验证邮件失败")
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "发送验证邮件失败"})
+		}
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "验证邮件已发送"})
+}
@@ -1,11 +1,15 @@
 package controllers
 
 import (
+	"errors"
 	"fmt"
 	"img_hosting/middleware"
 	"img_hosting/models"
+	"img_hosting/pkg/logger"
 	"img_hosting/services"
 	"net/http"
+	"strconv"
+	"strings"
 
 	"github.com/gin-gonic/gin"
 )
@@ -30,14 +34,16 @@ func NewAuthController() *AuthController {
 
 // Login godoc
 // @Summary 用户登录
-// @Description 处理用户登录请求，返回JWT令牌
+// @Description 处理用户登录请求，返回JWT令牌。启用了两步验证的用户返回 two_factor_required 和 challenge_token，需要再调用 /auth/2fa/verify
 // @Tags 认证
 // @Accept json
 // @Produce json
 // @Param request body LoginRequest true "登录请求"
 // @Success 200 {object} models.Response{data=models.LoginResponse}
 // @Failure 400 {object} models.Response "无效的请求数据"
-// @Failure 401 {object} models.Response "认证失败"
+// @Failure 401 {object} models.Response "账号或密码错误"
+// @Failure 403 {object} models.Response "账号已被禁用"
+// @Failure 429 {object} models.Response "登录失败次数过多，需要等待 retry_after 秒"
 // @Router /auth/login [post]
 func (ac *AuthController) Login(c *gin.Context) {
 	fmt.Println("开始处理登录请求")
@@ -49,44 +55,224 @@ func (ac *AuthController) Login(c *gin.Context) {
 		return
 	}
 
-	fmt.Printf("登录请求原始数据: email=%s, password=%s, psd=%s\n",
-		loginReq.Email, loginReq.Password, loginReq.Psd)
-
 	// 优先使用 password 字段，如果为空则使用 psd 字段
 	password := loginReq.Password
 	if password == "" {
 		password = loginReq.Psd
-		fmt.Println("使用 psd 字段作为密码")
-	} else {
-		fmt.Println("使用 password 字段作为密码")
 	}
 
-	fmt.Printf("最终使用的密码: %s (长度: %d)\n", password, len(password))
+	user, err := ac.authService.Login(loginReq.Email, password, c.ClientIP(), c.GetHeader("User-Agent"))
+	if err != nil {
+		respondLoginError(c, err)
+		return
+	}
+
+	ac.completeLogin(c, user.UserID, user.Name)
+}
+
+// completeLogin 身份验证通过（密码或单点登录）后完成登录
+// 启用了两步验证时先返回验证凭证，验证通过后再签发令牌
+func (ac *AuthController) completeLogin(c *gin.Context, userID uint, userName string) {
+	enabled, err := services.TwoFactorEnabled(userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "登录失败"})
+		return
+	}
+	if enabled {
+		challenge, ttl, err := services.StartLoginChallenge(userID, c.ClientIP())
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "登录失败"})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{
+			"message":             "请输入两步验证码",
+			"two_factor_required": true,
+			"challenge_token":     challenge,
+			"expires_in":          int(ttl.Seconds()),
+		})
+		return
+	}
+
+	ac.respondLoginTokens(c, userID, userName)
+}
+
+// VerifyTwoFactor godoc
+// @Summary 登录两步验证
+// @Description 登录返回 two_factor_required 时，使用 challenge_token 和验证器的 6 位验证码（或恢复码）完成登录。验证码连续错误 5 次后需要重新登录
+// @Tags 认证
+// @Accept json
+// @Produce json
+// @Param request body models.TwoFactorLoginRequest true "两步验证请求"
+// @Success 200 {object} models.LoginResponse
+// @Failure 400 {object} models.Response "请求无效"
+// @Failure 401 {object} models.Response "验证码错误或验证已失效"
+// @Failure 403 {object} models.Response "账号已被禁用"
+// @Failure 429 {object} models.Response "验证失败次数过多，需要等待 retry_after 秒"
+// @Router /auth/2fa/verify [post]
+func (ac *AuthController) VerifyTwoFactor(c *gin.Context) {
+	var req models.TwoFactorLoginRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "缺少验证凭证或验证码"})
+		return
+	}
+
+	userID, err := services.VerifyLoginChallenge(req.ChallengeToken, req.Code, c.ClientIP(), c.GetHeader("User-Agent"))
+	if err != nil {
+		respondLoginError(c, err)
+		return
+	}
 
-	user, err := ac.authService.Login(loginReq.Email, password)
+	user, err := (&services.UserService{}).GetUserProfile(userID)
 	if err != nil {
-		fmt.Printf("登录失败: %v\n", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "登录失败"})
+		return
+	}
+	ac.respondLoginTokens(c, user.UserID, user.Name)
+}
+
+// respondLoginError 把登录失败的错误转换为响应，失败次数过多时返回 429 和 Retry-After
+func respondLoginError(c *gin.Context, err error) {
+	var throttled *services.LoginThrottledError
+	switch {
+	case errors.As(err, &throttled):
+		c.Header("Retry-After", strconv.Itoa(throttled.RetrySeconds()))
+		c.JSON(http.StatusTooManyRequests, gin.H{
+			"error":       err.Error(),
+			"retry_after": throttled.RetrySeconds(),
+			"locked":      throttled.Locked,
+		})
+	case errors.Is(err, services.ErrUserDisabled):
+		c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+	case errors.Is(err, services.ErrInvalidCredentials), errors.Is(err, services.ErrTwoFactorCodeInvalid),
+		errors.Is(err, services.ErrChallengeInvalid), errors.Is(err, services.ErrTwoFactorNotEnabled),
+		errors.Is(err, services.ErrUserNotFound):
 		c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+	default:
+		logger.GetLogger().WithError(err).Error("登录失败")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "登录失败"})
+	}
+}
+
+// respondLoginTokens 登录成功，签发访问令牌和刷新令牌
+func (ac *AuthController) respondLoginTokens(c *gin.Context, userID uint, userName string) {
+	// 每次登录创建一个会话，刷新令牌和访问令牌都属于这个会话
+	sessionID, refreshToken, err := services.IssueRefreshToken(userID, c.GetHeader("User-Agent"), c.ClientIP())
+	if err != nil {
+		fmt.Printf("生成刷新令牌失败: %v\n", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "生成令牌失败"})
 		return
 	}
 
 	// 生成 JWT token
-	token, err := middleware.GenerateJWT(user.UserID)
+	token, err := middleware.GenerateJWT(userID, sessionID)
 	if err != nil {
 		fmt.Printf("生成令牌失败: %v\n", err)
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "生成令牌失败"})
 		return
 	}
 
-	fmt.Printf("登录成功: userID=%d\n", user.UserID)
+	services.RecordLoginSuccess(userID, c.ClientIP(), c.GetHeader("User-Agent"))
+
+	// 角色要求两步验证但尚未启用时，令牌只能用于设置两步验证
+	setupRequired := errors.Is(services.CheckTwoFactorSetup(userID), services.ErrTwoFactorSetupRequired)
+	unverified, _ := services.IsEmailUnverified(userID)
+
+	fmt.Printf("登录成功: userID=%d\n", userID)
 	c.JSON(http.StatusOK, gin.H{
-		"message":   "登录成功",
-		"token":     token,
-		"user_id":   user.UserID,
-		"user_name": user.Name,
+		"message":                     "登录成功",
+		"token":                       token,
+		"refresh_token":               refreshToken,
+		"expires_in":                  int(middleware.AccessTokenTTL().Seconds()),
+		"user_id":                     userID,
+		"user_name":                   userName,
+		"two_factor_setup_required":   setupRequired,
+		"email_verification_required": unverified,
 	})
 }
 
+// Refresh godoc
+// @Summary 刷新访问令牌
+// @Description 使用刷新令牌换取新的访问令牌和刷新令牌，旧的刷新令牌随即失效。已使用过的刷新令牌再次使用时，该次登录签发的所有刷新令牌都会被撤销。所属会话已被撤销时返回 401
+// @Tags 认证
+// @Accept json
+// @Produce json
+// @Param request body models.RefreshTokenRequest true "刷新令牌"
+// @Success 200 {object} models.RefreshTokenResponse
+// @Failure 400 {object} models.Response "请求无效"
+// @Failure 401 {object} models.Response "刷新令牌无效、过期或已被使用"
+// @Failure 403 {object} models.Response "账号已被禁用"
+// @Router /auth/refresh [post]
+func (ac *AuthController) Refresh(c *gin.Context) {
+	var req models.RefreshTokenRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "缺少刷新令牌"})
+		return
+	}
+
+	userID, sessionID, refreshToken, err := services.RotateRefreshToken(req.RefreshToken, c.ClientIP())
+	if err != nil {
+		if errors.Is(err, services.ErrUserDisabled) {
+			c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+			return
+		}
+		if errors.Is(err, services.ErrRefreshTokenInvalid) || errors.Is(err, services.ErrRefreshTokenReused) {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+			return
+		}
+		logger.GetLogger().WithError(err).Error("刷新令牌失败")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "刷新令牌失败"})
+		return
+	}
+
+	token, err := middleware.GenerateJWT(userID, sessionID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "生成令牌失败"})
+		return
+	}
+
+	c.JSON(http.StatusOK, models.RefreshTokenResponse{
+		Token:        token,
+		RefreshToken: refreshToken,
+		ExpiresIn:    int(middleware.AccessTokenTTL().Seconds()),
+	})
+}
+
+// Logout godoc
+// @Summary 退出登录
+// @Description 撤销刷新令牌以及同一次登录轮换出的所有刷新令牌。请求头带有访问令牌时，该访问令牌同时失效
+// @Tags 认证
+// @Accept json
+// @Produce json
+// @Param request body models.RefreshTokenRequest true "刷新令牌"
+// @Success 200 {object} models.Response
+// @Failure 400 {object} models.Response "请求无效"
+// @Router /auth/logout [post]
+func (ac *AuthController) Logout(c *gin.Context) {
+	var req models.RefreshTokenRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "缺少刷新令牌"})
+		return
+	}
+
+	if err := services.RevokeRefreshToken(req.RefreshToken); err != nil {
+		logger.GetLogger().WithError(err).Error("撤销刷新令牌失败")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "退出登录失败"})
+		return
+	}
+
+	// 同时撤销当前的访问令牌，无效的访问令牌直接忽略
+	if strings.HasPrefix(c.GetHeader("Authorization"), "Bearer ") {
+		if claims, err := middleware.ParseAndValidateToken(c); err == nil && claims.ExpiresAt != nil {
+			if err := services.RevokeAccessToken(claims.ID, claims.UserID, claims.ExpiresAt.Time); err != nil {
+				logger.GetLogger().WithError(err).Error("撤销访问令牌失败")
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "退出登录失败"})
+				return
+			}
+		}
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "已退出登录"})
+}
+
 // Register godoc
 // @Summary 用户注册
 // @Description 处理新用户注册请求
@@ -116,8 +302,36 @@ func (ac *AuthController) Register(c *gin.Context) {
 	}
 
 	fmt.Printf("注册成功: userID=%d\n", user.UserID)
+
+	// 邮件发送失败不影响注册，用户可以稍后重新发送验证邮件
+	verificationRequired := user.Status == models.UserStatusUnverified
+	if verificationRequired {
+		if err := services.SendVerificationEmail(user.UserID); err != nil {
+			logger.GetLogger().WithError(err).WithField("user_id", user.UserID).Error("发送验证邮件失败")
+		}
+	}
+
 	c.JSON(http.StatusCreated, gin.H{
-		"message": "注册成功",
-		"user_id": user.UserID,
+		"message":                     "注册成功",
+		"user_id":                     user.UserID,
+		"email_verification_required": verificationRequired,
 	})
 }
+
+// JWKS godoc
+// @Summary 获取 JWT 公钥
+// @Description 返回验证登录令牌使用的公钥（JWKS 格式），只包含 RS256/EdDSA 密钥，HS256 密钥不会公开
+// @Tags 认证
+// @Produce json
+// @Success 200 {object} jwtkeys.JWKS
+// @Failure 500 {object} models.Response
+// @Router /.well-known/jwks.json [get]
+func (ac *AuthController) JWKS(c *gin.Context) {
+	jwks, err := middleware.JWKS()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "JWT 密钥配置错误"})
+		return
+	}
+	c.Header("Cache-Control", "public, max-age=300")
+	c.JSON(http.StatusOK, jwks)
+}
@@ -1,8 +1,11 @@
 package controllers
 
 import (
+	"errors"
 	"img_hosting/models"
+	"img_hosting/pkg/fetcher"
 	"img_hosting/pkg/logger"
+	"img_hosting/pkg/placeholder"
 	"img_hosting/services"
 	"net/http"
 	"strconv"
@@ -65,6 +68,10 @@ func (ic *ImageController) UploadImage(c *gin.Context) {
 			"filename": file.Filename,
 			"size":     file.Size,
 		}).Error("图片上传处理失败")
+		if errors.Is(err, services.ErrQuotaExceeded) {
+			c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": err.Error()})
+			return
+		}
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
@@ -81,6 +88,101 @@ func (ic *ImageController) UploadImage(c *gin.Context) {
 	})
 }
 
+// UploadImageFromURL godoc
+// @Summary 从URL上传图片
+// @Description 由服务器下载远程图片后保存，下载有大小、超时和重定向次数限制，禁止访问内网和回环地址
+// @Tags 图片管理
+// @Accept json
+// @Produce json
+// @Param request body models.URLUploadRequest true "远程图片地址"
+// @Security BearerAuth
+// @Success 200 {object} models.ImageUploadResponse
+// @Failure 400,401,413,502 {object} models.Response
+// @Router /images/upload-url [post]
+func (ic *ImageController) UploadImageFromURL(c *gin.Context) {
+	userID := c.GetUint("user_id")
+	logger := logger.GetLogger()
+
+	var req models.URLUploadRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "请提供图片URL"})
+		return
+	}
+
+	imageID, imageURL, err := services.UploadImageFromURL(c.Request.Context(), userID, req.URL, req.Description)
+	if err != nil {
+		logger.WithError(err).WithFields(logrus.Fields{
+			"user_id": userID,
+			"url":     req.URL,
+		}).Warn("URL上传失败")
+		switch {
+		case errors.Is(err, services.ErrQuotaExceeded), errors.Is(err, fetcher.ErrTooLarge):
+			c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": err.Error()})
+		case errors.Is(err, fetcher.ErrBadStatus), errors.Is(err, fetcher.ErrTooManyRedirect):
+			c.JSON(http.StatusBadGateway, gin.H{"error": err.Error()})
+		default:
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		}
+		return
+	}
+
+	c.JSON(http.StatusOK, models.ImageUploadResponse{
+		ImageID:  imageID,
+		ImageURL: imageURL,
+	})
+}
+
+// maxBase64UploadBody Base64 上传的请求体上限，10MB 图片编码后约 13.4MB，留出 JSON 字段的余量
+const maxBase64UploadBody = 16 << 20
+
+// UploadImageBase64 godoc
+// @Summary 上传Base64图片
+// @Description 上传 Base64 或 data URI 编码的图片（如剪贴板粘贴的截图），校验和处理流程与表单上传相同
+// @Tags 图片管理
+// @Accept json
+// @Produce json
+// @Param request body models.Base64UploadRequest true "图片数据"
+// @Security BearerAuth
+// @Success 200 {object} models.ImageUploadResponse
+// @Failure 400,401,413 {object} models.Response
+// @Router /images/upload-base64 [post]
+func (ic *ImageController) UploadImageBase64(c *gin.Context) {
+	userID := c.GetUint("user_id")
+	logger := logger.GetLogger()
+
+	c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, maxBase64UploadBody)
+
+	var req models.Base64UploadRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		var maxBytesErr *http.MaxBytesError
+		if errors.As(err, &maxBytesErr) {
+			c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": "文件大小超过限制"})
+			return
+		}
+		c.JSON(http.StatusBadRequest, gin.H{"error": "请提供图片数据"})
+		return
+	}
+
+	imageID, imageURL, err := services.UploadImageBase64(userID, req.Data, req.FileName, req.Description)
+	if err != nil {
+		logger.WithError(err).WithFields(logrus.Fields{
+			"user_id":  userID,
+			"filename": req.FileName,
+		}).Warn("Base64图片上传失败")
+		if errors.Is(err, services.ErrQuotaExceeded) {
+			c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, models.ImageUploadResponse{
+		ImageID:  imageID,
+		ImageURL: imageURL,
+	})
+}
+
 // GetImage godoc
 // @Summary 获取图片详情
 // @Description 获取指定图片的详细信息
@@ -107,6 +209,34 @@ func (ic *ImageController) GetImage(c *gin.Context) {
 	c.JSON(http.StatusOK, gin.H{"image": image})
 }
 
+// ServeThumbnail godoc
+// @Summary 获取缩略图
+// @Description 名称不带扩展名（如 {hash}_300）时根据 Accept 请求头返回 AVIF/WebP 或兼容格式，并设置 Vary: Accept；带扩展名时返回指定格式
+// @Tags 图片管理
+// @Produce image/webp,image/avif,image/jpeg,image/png,image/gif
+// @Param name path string true "缩略图名称"
+// @Param animated query bool false "动图是否返回动画预览，false 时返回静态首帧" default(true)
+// @Success 200 {file} binary
+// @Failure 404 {object} models.Response
+// @Router /thumbnails/{name} [get]
+func (ic *ImageController) ServeThumbnail(c *gin.Context) {
+	name := c.Param("name")
+
+	animated := c.DefaultQuery("animated", "true") != "false"
+
+	path, mimeType, err := services.ResolveThumbnail(name, c.GetHeader("Accept"), animated)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "缩略图不存在"})
+		return
+	}
+
+	// 同一地址会根据 Accept 返回不同格式，缓存需要区分
+	c.Header("Vary", "Accept")
+	c.Header("Content-Type", mimeType)
+	c.Header("Cache-Control", "public, max-age=31536000")
+	c.File(path)
+}
+
 // GetUserImages godoc
 // @Summary 获取当前用户的图片
 // @Description 获取当前登录用户的所有图片，支持分页
@@ -143,6 +273,7 @@ func (ic *ImageController) GetUserImages(c *gin.Context) {
 // @Tags 图片管理
 // @Produce json
 // @Param keyword query string true "搜索关键词"
+// @Param color query string false "主色分类(red/orange/yellow/green/cyan/blue/purple/pink/brown/white/gray/black)"
 // @Param page query int false "页码" default(1)
 // @Param page_size query int false "每页数量" default(10)
 // @Security BearerAuth
@@ -151,10 +282,16 @@ func (ic *ImageController) GetUserImages(c *gin.Context) {
 func (ic *ImageController) SearchImages(c *gin.Context) {
 	userID := c.GetUint("user_id")
 	keyword := c.Query("keyword")
+	color := c.Query("color")
 	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
 	pageSize, _ := strconv.Atoi(c.DefaultQuery("page_size", "10"))
 
-	images, total, err := services.SearchImages(userID, keyword, page, pageSize)
+	if color != "" && !placeholder.ValidFamily(color) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "无效的颜色分类"})
+		return
+	}
+
+	images, total, err := services.SearchImages(userID, keyword, color, page, pageSize)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "搜索图片失败"})
 		return
@@ -222,6 +359,16 @@ func (ic *ImageController) BatchUploadImages(c *gin.Context) {
 		return
 	}
 
+	// 先按整批大小检查存储配额，避免上传到一半才失败
+	var totalSize int64
+	for _, file := range files {
+		totalSize += file.Size
+	}
+	if err := services.CheckStorageQuota(userID, totalSize); err != nil {
+		c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": err.Error()})
+		return
+	}
+
 	// 获取描述信息
 	description := c.PostForm("description")
 
@@ -261,6 +408,7 @@ func (ic *ImageController) BatchUploadImages(c *gin.Context) {
 // @Description 获取系统中的所有图片（需要管理员权限）
 // @Tags 图片管理
 // @Produce json
+// @Param color query string false "主色分类(red/orange/yellow/green/cyan/blue/purple/pink/brown/white/gray/black)"
 // @Param page query int false "页码" default(1)
 // @Param page_size query int false "每页数量" default(10)
 // @Security BearerAuth
@@ -268,10 +416,16 @@ func (ic *ImageController) BatchUploadImages(c *gin.Context) {
 // @Failure 401,403 {object} models.Response
 // @Router /images [get]
 func (ic *ImageController) ListImages(c *gin.Context) {
+	color := c.Query("color")
 	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
 	pageSize, _ := strconv.Atoi(c.DefaultQuery("page_size", "10"))
 
-	images, total, err := services.ListAllImages(page, pageSize)
+	if color != "" && !placeholder.ValidFamily(color) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "无效的颜色分类"})
+		return
+	}
+
+	images, total, err := services.ListAllImages(color, page, pageSize)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "获取图片列表失败"})
 		return
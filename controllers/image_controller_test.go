@@ -0,0 +1,125 @@
+package controllers
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"image/png"
+	"img_hosting/dao"
+	"img_hosting/models"
+	"img_hosting/services"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestServeThumbnailNegotiation(t *testing.T) {
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, image.NewNRGBA(image.Rect(0, 0, 200, 100))); err != nil {
+		t.Fatal(err)
+	}
+	hash := fmt.Sprintf("serve-thumb-%d", time.Now().UnixNano())
+	imageID, err := dao.CreateImage(models.GetDB(), 1, "/uploads/"+hash, "a.png", ".png", hash, int64(buf.Len()), "image/png", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	variants, err := services.GenerateThumbnails(buf.Bytes(), hash, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := dao.ReplaceImageVariants(models.GetDB(), imageID, variants); err != nil {
+		t.Fatal(err)
+	}
+
+	r := gin.New()
+	r.GET("/thumbnails/:name", NewImageController().ServeThumbnail)
+
+	tests := []struct {
+		name   string
+		accept string
+		want   int
+		mime   string
+	}{
+		{hash + "_150", "image/webp,*/*", http.StatusOK, "image/webp"},
+		{hash + "_150", "image/png", http.StatusOK, "image/png"},
+		{hash + "_150.webp", "image/png", http.StatusOK, "image/webp"},
+		{hash + "_300", "image/webp", http.StatusNotFound, ""},
+	}
+	for _, tt := range tests {
+		req := httptest.NewRequest(http.MethodGet, "/thumbnails/"+tt.name, nil)
+		req.Header.Set("Accept", tt.accept)
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+
+		if w.Code != tt.want {
+			t.Errorf("%s: status = %d, want %d", tt.name, w.Code, tt.want)
+			continue
+		}
+		if tt.want != http.StatusOK {
+			continue
+		}
+		// 同一地址按 Accept 返回不同格式，必须带 Vary 避免缓存串格式
+		if got := w.Header().Get("Content-Type"); got != tt.mime || w.Header().Get("Vary") != "Accept" {
+			t.Errorf("%s (Accept %q): Content-Type = %s, Vary = %q", tt.name, tt.accept, got, w.Header().Get("Vary"))
+		}
+		if _, format, err := image.DecodeConfig(w.Body); err != nil || "image/"+format != tt.mime {
+			t.Errorf("%s: 响应内容格式 = %s, %v", tt.name, format, err)
+		}
+	}
+}
+
+func TestSearchImagesColorFilter(t *testing.T) {
+	r := gin.New()
+	ic := NewImageController()
+	r.GET("/images/search", func(c *gin.Context) { c.Set("user_id", uint(1)) }, ic.SearchImages)
+	r.GET("/images", ic.ListImages)
+
+	tests := []struct {
+		url  string
+		want int
+	}{
+		{"/images/search?keyword=a&color=red", http.StatusOK},
+		{"/images/search?keyword=a&color=magenta", http.StatusBadRequest},
+		{"/images/search?keyword=a&color=Red", http.StatusBadRequest},
+		{"/images?color=blue", http.StatusOK},
+		{"/images?color=rgb(0,0,255)", http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, tt.url, nil))
+		if w.Code != tt.want {
+			t.Errorf("%s: status = %d, want %d, body = %s", tt.url, w.Code, tt.want, w.Body.String())
+		}
+	}
+}
+
+func TestUploadImageBase64Errors(t *testing.T) {
+	r := gin.New()
+	r.POST("/images/upload-base64", func(c *gin.Context) { c.Set("user_id", uint(1)) }, NewImageController().UploadImageBase64)
+
+	tests := []struct {
+		name string
+		body string
+		want int
+	}{
+		{"缺少 data", `{"filename":"a.png"}`, http.StatusBadRequest},
+		{"不是 JSON", `data:image/png;base64,AAAA`, http.StatusBadRequest},
+		{"Base64 损坏", `{"data":"data:image/png;base64,iVBO*w0K"}`, http.StatusBadRequest},
+		{"不是图片", `{"data":"aGVsbG8gd29ybGQ=","filename":"a.png"}`, http.StatusBadRequest},
+		// 请求体超过上限时在读取阶段中止，不会解码整个内容
+		{"请求体过大", `{"data":"` + strings.Repeat("A", maxBase64UploadBody) + `"}`, http.StatusRequestEntityTooLarge},
+	}
+	for _, tt := range tests {
+		req := httptest.NewRequest(http.MethodPost, "/images/upload-base64", strings.NewReader(tt.body))
+		req.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		if w.Code != tt.want {
+			t.Errorf("%s: status = %d, want %d, body = %s", tt.name, w.Code, tt.want, w.Body.String())
+		}
+	}
+}
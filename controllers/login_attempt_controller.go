@@ -0,0 +1,89 @@
+package controllers
+
+import (
+	"img_hosting/dao"
+	"img_hosting/pkg/logger"
+	"img_hosting/services"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+// LoginAttemptController 登录记录审计和账号解锁
+type LoginAttemptController struct{}
+
+func NewLoginAttemptController() *LoginAttemptController {
+	return &LoginAttemptController{}
+}
+
+// ListLoginAttempts godoc
+// @Summary 获取登录记录
+// @Description 查询登录尝试记录（成功、失败、被限流等），按时间倒序（需要管理员权限）
+// @Tags 用户管理
+// @Produce json
+// @Param user_id query int false "用户ID"
+// @Param ip query string false "IP 地址"
+// @Param result query string false "结果：success/failure/two_factor_failure/throttled/locked/disabled/unlock"
+// @Param page query int false "页码" default(1)
+// @Param page_size query int false "每页数量" default(20)
+// @Security BearerAuth
+// @Success 200 {object} models.Response
+// @Failure 401,403,500 {object} models.Response
+// @Router /admin/login-attempts [get]
+func (lc *LoginAttemptController) ListLoginAttempts(c *gin.Context) {
+	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
+	pageSize, _ := strconv.Atoi(c.DefaultQuery("page_size", "20"))
+	if page < 1 {
+		page = 1
+	}
+	if pageSize < 1 || pageSize > 100 {
+		pageSize = 20
+	}
+
+	filter := dao.LoginAttemptFilter{
+		IPAddress: c.Query("ip"),
+		Result:    c.Query("result"),
+	}
+	if userID, err := strconv.ParseUint(c.Query("user_id"), 10, 32); err == nil {
+		filter.UserID = uint(userID)
+	}
+
+	attempts, total, err := services.ListLoginAttempts(filter, page, pageSize)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "获取登录记录失败"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"attempts":  attempts,
+		"total":     total,
+		"page":      page,
+		"page_size": pageSize,
+	})
+}
+
+// UnlockLogin godoc
+// @Summary 解除账号登录锁定
+// @Description 清零账号的登录失败次数，解除临时锁定（需要管理员权限）。同一 IP 的失败次数不受影响
+// @Tags 用户管理
+// @Produce json
+// @Param id path int true "用户ID"
+// @Security BearerAuth
+// @Success 200 {object} models.Response
+// @Failure 400,401,403,500 {object} models.Response
+// @Router /users/{id}/login-lock [delete]
+func (lc *LoginAttemptController) UnlockLogin(c *gin.Context) {
+	userID, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "无效的用户ID"})
+		return
+	}
+
+	if err := services.UnlockLogin(uint(userID), c.GetUint("user_id")); err != nil {
+		logger.GetLogger().WithError(err).Error("解除登录锁定失败")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "解除登录锁定失败"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "已解除登录锁定"})
+}
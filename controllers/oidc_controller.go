@@ -0,0 +1,220 @@
+package controllers
+
+import (
+	"crypto/subtle"
+	"errors"
+	"img_hosting/config"
+	"img_hosting/models"
+	"img_hosting/pkg/logger"
+	"img_hosting/pkg/oidc"
+	"img_hosting/services"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// oidcStateCookie 保存登录请求 state 的 Cookie，回调时校验，确保回调与发起登录的是同一个浏览器
+const (
+	oidcStateCookie     = "oidc_state"
+	oidcStateCookiePath = "/auth/oidc/"
+)
+
+// OIDCController OpenID Connect 单点登录
+type OIDCController struct {
+	authController *AuthController
+}
+
+func NewOIDCController() *OIDCController {
+	return &OIDCController{authController: NewAuthController()}
+}
+
+// ListProviders godoc
+// @Summary 获取单点登录方式
+// @Description 返回配置的 OIDC 身份提供方，前端据此显示登录按钮
+// @Tags 认证
+// @Produce json
+// @Success 200 {object} models.Response
+// @Router /auth/oidc/providers [get]
+func (oc *OIDCController) ListProviders(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{"providers": services.ListOIDCProviders()})
+}
+
+// Login godoc
+// @Summary 单点登录
+// @Description 跳转到身份提供方登录（授权码 + PKCE），登录后回到 /auth/oidc/{provider}/callback。state 同时保存在 Cookie oidc_state 中，回调时校验
+// @Tags 认证
+// @Param provider path string true "身份提供方 ID"
+// @Success 302 "跳转到身份提供方"
+// @Failure 404 {object} models.Response "身份提供方不存在"
+// @Failure 502 {object} models.Response "无法连接身份提供方"
+// @Router /auth/oidc/{provider}/login [get]
+func (oc *OIDCController) Login(c *gin.Context) {
+	authURL, state, err := services.StartOIDCLogin(c.Param("provider"), requestBaseURL(c), c.ClientIP())
+	if err != nil {
+		if errors.Is(err, services.ErrOIDCProviderNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+			return
+		}
+		logger.GetLogger().WithError(err).Error("开始单点登录失败")
+		c.JSON(http.StatusBadGateway, gin.H{"error": "无法连接身份提供方"})
+		return
+	}
+	// 身份提供方跳转回来是跨站的顶级导航，SameSite=Lax 的 Cookie 会被带上
+	c.SetSameSite(http.SameSiteLaxMode)
+	c.SetCookie(oidcStateCookie, state, int(services.OIDCStateTTL().Seconds()), oidcStateCookiePath, "",
+		strings.HasPrefix(requestBaseURL(c), "https://"), true)
+	c.Header("Cache-Control", "no-store")
+	c.Redirect(http.StatusFound, authURL)
+}
+
+// Callback godoc
+// @Summary 单点登录回调
+// @Description 身份提供方登录后跳转到这里，请求必须带有登录时设置的 oidc_state Cookie。配置了 oidc.frontend_url 时跳转到前端并在 # 之后携带 login_code（失败时为 error），否则直接返回与用户登录相同的响应
+// @Tags 认证
+// @Produce json
+// @Param provider path string true "身份提供方 ID"
+// @Param state query string true "登录请求的 state"
+// @Param code query string true "授权码"
+// @Success 200 {object} models.LoginResponse
+// @Success 302 "跳转到前端"
+// @Failure 400,401,403,404,500 {object} models.Response
+// @Router /auth/oidc/{provider}/callback [get]
+func (oc *OIDCController) Callback(c *gin.Context) {
+	// state 只能使用一次，无论成功与否都清除 Cookie
+	stateCookie, _ := c.Cookie(oidcStateCookie)
+	c.SetSameSite(http.SameSiteLaxMode)
+	c.SetCookie(oidcStateCookie, "", -1, oidcStateCookiePath, "", strings.HasPrefix(requestBaseURL(c), "https://"), true)
+
+	// 用户在身份提供方取消登录等情况
+	if errCode := c.Query("error"); errCode != "" {
+		message := c.Query("error_description")
+		if message == "" {
+			message = errCode
+		}
+		oc.fail(c, http.StatusUnauthorized, "单点登录失败: "+message)
+		return
+	}
+	state, code := c.Query("state"), c.Query("code")
+	if state == "" || code == "" {
+		oc.fail(c, http.StatusBadRequest, "缺少 state 或 code")
+		return
+	}
+	// 没有对应 Cookie 的回调不是由当前浏览器发起的，拒绝后可以防止把别人的登录结果用在当前浏览器（登录 CSRF）
+	if stateCookie == "" || subtle.ConstantTimeCompare([]byte(stateCookie), []byte(state)) != 1 {
+		logger.GetLogger().WithField("ip", c.ClientIP()).Warn("单点登录回调的 state 与 Cookie 不一致")
+		oc.fail(c, http.StatusBadRequest, services.ErrOIDCStateMismatch.Error())
+		return
+	}
+
+	user, err := services.FinishOIDCLogin(c.Param("provider"), state, code, c.ClientIP())
+	if err != nil {
+		var oauthErr *oidc.Error
+		switch {
+		case errors.Is(err, services.ErrOIDCProviderNotFound):
+			oc.fail(c, http.StatusNotFound, err.Error())
+		case errors.Is(err, services.ErrOIDCStateInvalid):
+			oc.fail(c, http.StatusBadRequest, err.Error())
+		case errors.Is(err, services.ErrUserDisabled), errors.Is(err, services.ErrOIDCEmailRequired),
+			errors.Is(err, services.ErrOIDCDomainNotAllowed), errors.Is(err, services.ErrOIDCAccountNotFound),
+			errors.Is(err, services.ErrOIDCEmailTaken), errors.Is(err, services.ErrOIDCLinkUnverified):
+			oc.fail(c, http.StatusForbidden, err.Error())
+		case errors.As(err, &oauthErr), errors.Is(err, oidc.ErrInvalidIDToken), errors.Is(err, oidc.ErrNoIDToken):
+			logger.GetLogger().WithError(err).Warn("单点登录验证失败")
+			oc.fail(c, http.StatusUnauthorized, "单点登录验证失败，请重新登录")
+		default:
+			logger.GetLogger().WithError(err).Error("单点登录失败")
+			oc.fail(c, http.StatusInternalServerError, "单点登录失败")
+		}
+		return
+	}
+
+	frontendURL := config.GetConfig().OIDC.FrontendURL
+	if frontendURL == "" {
+		oc.authController.completeLogin(c, user.UserID, user.Name)
+		return
+	}
+	loginCode, err := services.CreateOIDCLoginCode(user.UserID, c.ClientIP())
+	if err != nil {
+		logger.GetLogger().WithError(err).Error("生成单点登录码失败")
+		oc.fail(c, http.StatusInternalServerError, "单点登录失败")
+		return
+	}
+	c.Header("Cache-Control", "no-store")
+	c.Redirect(http.StatusFound, frontendRedirect(frontendURL, url.Values{"login_code": {loginCode}}))
+}
+
+// Exchange godoc
+// @Summary 单点登录换取令牌
+// @Description 前端使用回调跳转中的一次性 login_code 换取令牌，响应与用户登录相同。登录码 1 分钟内有效，只能使用一次
+// @Tags 认证
+// @Accept json
+// @Produce json
+// @Param request body models.OIDCExchangeRequest true "登录码"
+// @Success 200 {object} models.LoginResponse
+// @Failure 400,401,403 {object} models.Response
+// @Router /auth/oidc/exchange [post]
+func (oc *OIDCController) Exchange(c *gin.Context) {
+	var req models.OIDCExchangeRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "缺少登录码"})
+		return
+	}
+
+	userID, err := services.ExchangeOIDCLoginCode(req.LoginCode)
+	if err != nil {
+		switch {
+		case errors.Is(err, services.ErrOIDCLoginCodeInvalid):
+			c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+		case errors.Is(err, services.ErrUserDisabled):
+			c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "登录失败"})
+		}
+		return
+	}
+
+	user, err := (&services.UserService{}).GetUserProfile(userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "登录失败"})
+		return
+	}
+	oc.authController.completeLogin(c, user.UserID, user.Name)
+}
+
+// ListIdentities godoc
+// @Summary 获取关联的单点登录身份
+// @Description 获取当前用户关联的 OIDC 身份
+// @Tags 用户管理
+// @Produce json
+// @Security BearerAuth
+// @Success 200 {object} models.Response
+// @Failure 401 {object} models.Response
+// @Router /users/me/identities [get]
+func (oc *OIDCController) ListIdentities(c *gin.Context) {
+	identities, err := services.ListUserIdentities(c.GetUint("user_id"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "获取关联身份失败"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"identities": identities})
+}
+
+// fail 单点登录失败；配置了前端地址时跳转到前端显示错误，否则返回 JSON
+func (oc *OIDCController) fail(c *gin.Context, status int, message string) {
+	if frontendURL := config.GetConfig().OIDC.FrontendURL; frontendURL != "" {
+		c.Redirect(http.StatusFound, frontendRedirect(frontendURL, url.Values{"error": {message}}))
+		return
+	}
+	c.JSON(status, gin.H{"error": message})
+}
+
+// frontendRedirect 把参数放在前端地址的 # 之后，不会出现在服务器日志和 Referer 中
+func frontendRedirect(frontendURL string, params url.Values) string {
+	sep := "#"
+	if strings.Contains(frontendURL, "#") {
+		sep = "&"
+	}
+	return frontendURL + sep + params.Encode()
+}
@@ -0,0 +1,69 @@
+package controllers
+
+import (
+	"encoding/json"
+	"fmt"
+	"img_hosting/config"
+	"img_hosting/pkg/logger"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestMain(m *testing.M) {
+	config.LoadConfig()
+	dir, err := os.MkdirTemp("", "img_hosting-controllers-*")
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+	if err := os.Chdir(dir); err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+	logger.Init()
+	gin.SetMode(gin.TestMode)
+
+	code := m.Run()
+	os.RemoveAll(dir)
+	os.Exit(code)
+}
+
+func TestOIDCCallbackRequiresStateCookie(t *testing.T) {
+	r := gin.New()
+	r.GET("/auth/oidc/:provider/callback", NewOIDCController().Callback)
+
+	tests := []struct {
+		name   string
+		cookie string
+	}{
+		{"没有 Cookie", ""},
+		{"Cookie 与 state 不一致", "other-state"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/auth/oidc/mock/callback?state=attacker-state&code=attacker-code", nil)
+			if tt.cookie != "" {
+				req.AddCookie(&http.Cookie{Name: oidcStateCookie, Value: tt.cookie})
+			}
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, req)
+
+			if w.Code != http.StatusBadRequest {
+				t.Fatalf("status = %d, body = %s", w.Code, w.Body.String())
+			}
+			var resp map[string]string
+			json.Unmarshal(w.Body.Bytes(), &resp)
+			if !strings.Contains(resp["error"], "当前浏览器") {
+				t.Errorf("error = %q", resp["error"])
+			}
+			if cookie := w.Header().Get("Set-Cookie"); !strings.HasPrefix(cookie, oidcStateCookie+"=;") || !strings.Contains(cookie, "Max-Age=0") {
+				t.Errorf("回调后应清除 state Cookie，Set-Cookie = %q", cookie)
+			}
+		})
+	}
+}
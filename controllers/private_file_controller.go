@@ -1,6 +1,7 @@
 package controllers
 
 import (
+	"errors"
 	"fmt"
 	"img_hosting/dao"
 	"img_hosting/models"
@@ -59,6 +60,14 @@ func (pfc *PrivateFileController) UploadFile(c *gin.Context) {
 	// 上传文件
 	privateFile, err := services.UploadPrivateFile(file, userID, isEncrypted, password)
 	if err != nil {
+		if errors.Is(err, services.ErrFileQuarantined) {
+			c.JSON(http.StatusUnprocessableEntity, gin.H{"error": err.Error()})
+			return
+		}
+		if errors.Is(err, services.ErrQuotaExceeded) {
+			c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": err.Error()})
+			return
+		}
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
@@ -0,0 +1,99 @@
+package controllers
+
+import (
+	"img_hosting/services"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+// QuarantineController 隔离区管理控制器
+type QuarantineController struct{}
+
+func NewQuarantineController() *QuarantineController {
+	return &QuarantineController{}
+}
+
+// ListQuarantined godoc
+// @Summary 获取隔离文件列表
+// @Description 获取所有因命中恶意特征而被隔离的文件（需要管理员权限）
+// @Tags 隔离区管理
+// @Produce json
+// @Param page query int false "页码" default(1)
+// @Param page_size query int false "每页数量" default(10)
+// @Security BearerAuth
+// @Success 200 {object} models.Response{data=models.FileListResponse}
+// @Failure 401,403,500 {object} models.Response
+// @Router /admin/quarantine [get]
+func (qc *QuarantineController) ListQuarantined(c *gin.Context) {
+	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
+	pageSize, _ := strconv.Atoi(c.DefaultQuery("page_size", "10"))
+
+	files, total, err := services.ListQuarantinedFiles(page, pageSize)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "获取隔离文件列表失败"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"files":     files,
+		"total":     total,
+		"page":      page,
+		"page_size": pageSize,
+	})
+}
+
+// ReleaseQuarantined godoc
+// @Summary 放行隔离文件
+// @Description 确认为误报后将文件移出隔离区，文件恢复为正常状态（需要管理员权限）
+// @Tags 隔离区管理
+// @Produce json
+// @Param id path int true "文件ID"
+// @Security BearerAuth
+// @Success 200 {object} models.Response{data=models.PrivateFile}
+// @Failure 400,404 {object} models.Response
+// @Router /admin/quarantine/{id}/release [post]
+func (qc *QuarantineController) ReleaseQuarantined(c *gin.Context) {
+	fileID, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "无效的文件ID"})
+		return
+	}
+
+	file, err := services.ReleaseQuarantinedFile(uint(fileID), c.GetUint("user_id"))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "文件已放行",
+		"file":    file,
+	})
+}
+
+// DeleteQuarantined godoc
+// @Summary 删除隔离文件
+// @Description 永久删除隔离区中的文件（需要管理员权限）
+// @Tags 隔离区管理
+// @Produce json
+// @Param id path int true "文件ID"
+// @Security BearerAuth
+// @Success 200 {object} models.Response
+// @Failure 400,404 {object} models.Response
+// @Router /admin/quarantine/{id} [delete]
+func (qc *QuarantineController) DeleteQuarantined(c *gin.Context) {
+	fileID, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "无效的文件ID"})
+		return
+	}
+
+	if err := services.DeleteQuarantinedFile(uint(fileID)); err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "隔离文件已删除"})
+}
@@ -0,0 +1,378 @@
+package controllers
+
+import (
+	"encoding/base64"
+	"errors"
+	"img_hosting/config"
+	"img_hosting/models"
+	"img_hosting/pkg/logger"
+	"img_hosting/pkg/sigv4"
+	"img_hosting/services"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sirupsen/logrus"
+)
+
+// S3Controller S3 兼容接口，支持 PutObject、GetObject、HeadObject、DeleteObject 和 ListObjects(V2)
+// 使用 SigV4 签名认证，访问密钥 ID 为 API 令牌的 access_key_id，私有密钥为令牌本身
+type S3Controller struct {
+	userService *services.UserService
+}
+
+func NewS3Controller() *S3Controller {
+	return &S3Controller{userService: &services.UserService{}}
+}
+
+// s3TimeFormat S3 响应中的时间格式
+const s3TimeFormat = "2006-01-02T15:04:05.000Z"
+
+// s3DefaultMaxKeys 列出对象时每页的默认和最大数量
+const s3DefaultMaxKeys = 1000
+
+// errS3NotImplemented 不支持的 S3 操作
+var errS3NotImplemented = errors.New("不支持该操作")
+
+// s3UnsupportedSubresources 不支持的 bucket/对象子资源（分片上传、ACL、版本等）
+var s3UnsupportedSubresources = []string{
+	"uploads", "uploadId", "versions", "versioning", "acl", "policy", "cors", "lifecycle",
+	"tagging", "website", "logging", "notification", "encryption", "delete",
+}
+
+// Handle godoc
+// @Summary S3 兼容接口
+// @Description 路径格式为 /s3/{bucket}/{key}，bucket 为 images（图片）或 private（私人文件）。使用 AWS SigV4 签名认证，详见 API 文档
+// @Tags S3
+// @Produce xml
+// @Param path path string true "bucket 和对象键"
+// @Success 200 "对象内容或 XML 响应"
+// @Failure 400,403,404,409,501 {object} models.S3Error
+// @Router /s3/{path} [get]
+// @Router /s3/{path} [head]
+// @Router /s3/{path} [put]
+// @Router /s3/{path} [delete]
+func (sc *S3Controller) Handle(c *gin.Context) {
+	bucket, key := splitS3Path(c.Param("path"))
+
+	token, auth, err := authenticateS3(c)
+	if err != nil {
+		logger.GetLogger().WithError(err).WithFields(logrus.Fields{
+			"method": c.Request.Method,
+			"path":   c.Request.URL.Path,
+		}).Warn("S3 签名校验失败")
+		writeS3Error(c, err, http.StatusForbidden)
+		return
+	}
+	userID := token.UserID
+
+	// 设置了范围的令牌只能访问范围内的 bucket，未设置范围的旧令牌不受限制
+	if scopes := services.ParseScopes(token.Scopes); bucket != "" && len(scopes) > 0 &&
+		!services.TokenScopeAllows(scopes, services.S3BucketScope(bucket), c.Request.Method) {
+		writeS3Error(c, services.ErrS3AccessDenied, http.StatusForbidden)
+		return
+	}
+
+	for _, sub := range s3UnsupportedSubresources {
+		if c.Request.URL.Query().Has(sub) {
+			writeS3Error(c, errS3NotImplemented, http.StatusNotImplemented)
+			return
+		}
+	}
+
+	switch {
+	case bucket == "":
+		if c.Request.Method != http.MethodGet {
+			writeS3Error(c, errS3NotImplemented, http.StatusNotImplemented)
+			return
+		}
+		sc.listBuckets(c, userID)
+	case key == "":
+		sc.handleBucket(c, userID, bucket)
+	default:
+		sc.handleObject(c, userID, auth, bucket, key)
+	}
+}
+
+// handleBucket 处理 bucket 级别的请求
+func (sc *S3Controller) handleBucket(c *gin.Context, userID uint, bucket string) {
+	if !services.IsS3Bucket(bucket) {
+		writeS3Error(c, services.ErrS3NoSuchBucket, http.StatusNotFound)
+		return
+	}
+
+	switch c.Request.Method {
+	case http.MethodGet:
+		if c.Request.URL.Query().Has("location") {
+			c.XML(http.StatusOK, models.S3LocationConstraint{
+				Xmlns:  models.S3Namespace,
+				Region: config.GetConfig().S3.Region,
+			})
+			return
+		}
+		sc.listObjects(c, userID, bucket)
+	case http.MethodHead:
+		c.Status(http.StatusOK)
+	case http.MethodPut:
+		// bucket 是固定的，创建已有的 bucket 视为成功，方便 rclone 等工具
+		c.Status(http.StatusOK)
+	default:
+		writeS3Error(c, errS3NotImplemented, http.StatusNotImplemented)
+	}
+}
+
+// handleObject 处理对象级别的请求
+func (sc *S3Controller) handleObject(c *gin.Context, userID uint, auth *sigv4.Result, bucket, key string) {
+	switch c.Request.Method {
+	case http.MethodGet, http.MethodHead:
+		obj, err := services.GetS3Object(userID, bucket, key)
+		if err != nil {
+			writeS3Error(c, err, http.StatusInternalServerError)
+			return
+		}
+		file, err := os.Open(obj.Path)
+		if err != nil {
+			writeS3Error(c, services.ErrS3NoSuchKey, http.StatusNotFound)
+			return
+		}
+		defer file.Close()
+
+		c.Header("ETag", `"`+obj.ETag+`"`)
+		if obj.ContentType != "" {
+			c.Header("Content-Type", obj.ContentType)
+		}
+		http.ServeContent(c.Writer, c.Request, "", obj.LastModified, file)
+
+	case http.MethodPut:
+		if c.GetHeader("X-Amz-Copy-Source") != "" {
+			writeS3Error(c, errS3NotImplemented, http.StatusNotImplemented)
+			return
+		}
+		body, err := auth.Body(c.Request.Body)
+		if err != nil {
+			writeS3Error(c, err, http.StatusBadRequest)
+			return
+		}
+		obj, err := services.PutS3Object(userID, bucket, key, body)
+		if err != nil {
+			logger.GetLogger().WithError(err).WithFields(logrus.Fields{
+				"user_id": userID,
+				"bucket":  bucket,
+				"key":     key,
+			}).Warn("S3 上传对象失败")
+			writeS3Error(c, err, http.StatusBadRequest)
+			return
+		}
+		c.Header("ETag", `"`+obj.ETag+`"`)
+		c.Status(http.StatusOK)
+
+	case http.MethodDelete:
+		if err := services.DeleteS3Object(userID, bucket, key); err != nil {
+			writeS3Error(c, err, http.StatusInternalServerError)
+			return
+		}
+		c.Status(http.StatusNoContent)
+
+	default:
+		writeS3Error(c, errS3NotImplemented, http.StatusNotImplemented)
+	}
+}
+
+// listBuckets ListBuckets
+func (sc *S3Controller) listBuckets(c *gin.Context, userID uint) {
+	owner := models.S3Owner{ID: strconv.FormatUint(uint64(userID), 10)}
+	created := time.Unix(0, 0)
+	if user, err := sc.userService.GetUserProfile(userID); err == nil {
+		owner.DisplayName = user.Name
+		created = user.CreatedAt
+	}
+
+	result := models.S3ListAllMyBucketsResult{Xmlns: models.S3Namespace, Owner: owner}
+	for _, name := range services.S3Buckets() {
+		result.Buckets = append(result.Buckets, models.S3Bucket{
+			Name:         name,
+			CreationDate: created.UTC().Format(s3TimeFormat),
+		})
+	}
+	c.XML(http.StatusOK, result)
+}
+
+// listObjects ListObjects（V1）和 ListObjectsV2，list-type=2 时为 V2
+func (sc *S3Controller) listObjects(c *gin.Context, userID uint, bucket string) {
+	query := c.Request.URL.Query()
+	v2 := query.Get("list-type") == "2"
+
+	maxKeys := s3DefaultMaxKeys
+	if v := query.Get("max-keys"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 0 {
+			writeS3ErrorCode(c, http.StatusBadRequest, "InvalidArgument", "max-keys 必须是非负整数")
+			return
+		}
+		maxKeys = min(n, s3DefaultMaxKeys)
+	}
+
+	opts := services.S3ListOptions{
+		Prefix:    query.Get("prefix"),
+		Delimiter: query.Get("delimiter"),
+		MaxKeys:   maxKeys,
+	}
+	continuationToken := query.Get("continuation-token")
+	switch {
+	case !v2:
+		opts.StartAfter = query.Get("marker")
+	case continuationToken != "":
+		marker, err := base64.RawURLEncoding.DecodeString(continuationToken)
+		if err != nil {
+			writeS3ErrorCode(c, http.StatusBadRequest, "InvalidArgument", "无效的 continuation-token")
+			return
+		}
+		opts.StartAfter = string(marker)
+	default:
+		opts.StartAfter = query.Get("start-after")
+	}
+
+	result, err := services.ListS3Objects(userID, bucket, opts)
+	if err != nil {
+		writeS3Error(c, err, http.StatusInternalServerError)
+		return
+	}
+
+	// encoding-type=url 时对键和前缀进行 URL 编码，客户端会自动解码
+	encode := func(s string) string { return s }
+	encodingType := ""
+	if query.Get("encoding-type") == "url" {
+		encode = func(s string) string {
+			if s == "" {
+				return s
+			}
+			return sigv4.EncodePath(s)
+		}
+		encodingType = "url"
+	}
+
+	contents := make([]models.S3ObjectInfo, 0, len(result.Objects))
+	for _, obj := range result.Objects {
+		contents = append(contents, models.S3ObjectInfo{
+			Key:          encode(obj.Key),
+			LastModified: obj.LastModified.UTC().Format(s3TimeFormat),
+			ETag:         `"` + obj.ETag + `"`,
+			Size:         obj.Size,
+			StorageClass: "STANDARD",
+		})
+	}
+	prefixes := make([]models.S3CommonPrefix, 0, len(result.CommonPrefixes))
+	for _, prefix := range result.CommonPrefixes {
+		prefixes = append(prefixes, models.S3CommonPrefix{Prefix: encode(prefix)})
+	}
+
+	if v2 {
+		resp := models.S3ListBucketResultV2{
+			Xmlns:             models.S3Namespace,
+			Name:              bucket,
+			Prefix:            encode(opts.Prefix),
+			StartAfter:        encode(query.Get("start-after")),
+			ContinuationToken: continuationToken,
+			KeyCount:          len(contents) + len(prefixes),
+			Delimiter:         encode(opts.Delimiter),
+			MaxKeys:           maxKeys,
+			EncodingType:      encodingType,
+			IsTruncated:       result.IsTruncated,
+			Contents:          contents,
+			CommonPrefixes:    prefixes,
+		}
+		if result.IsTruncated {
+			resp.NextContinuationToken = base64.RawURLEncoding.EncodeToString([]byte(result.NextMarker))
+		}
+		c.XML(http.StatusOK, resp)
+		return
+	}
+
+	c.XML(http.StatusOK, models.S3ListBucketResult{
+		Xmlns:          models.S3Namespace,
+		Name:           bucket,
+		Prefix:         encode(opts.Prefix),
+		Marker:         encode(opts.StartAfter),
+		NextMarker:     encode(result.NextMarker),
+		Delimiter:      encode(opts.Delimiter),
+		MaxKeys:        maxKeys,
+		EncodingType:   encodingType,
+		IsTruncated:    result.IsTruncated,
+		Contents:       contents,
+		CommonPrefixes: prefixes,
+	})
+}
+
+// authenticateS3 校验 SigV4 签名，返回访问密钥对应的令牌
+func authenticateS3(c *gin.Context) (*models.Token, *sigv4.Result, error) {
+	var token *models.Token
+	result, err := sigv4.Verify(c.Request, func(accessKeyID string) (string, error) {
+		t, err := services.LookupS3Credential(accessKeyID)
+		if err != nil {
+			return "", err
+		}
+		token = t
+		return t.Token, nil
+	}, time.Now())
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if region := config.GetConfig().S3.Region; region != "" && result.Region != region {
+		return nil, nil, &sigv4.Error{Code: "AuthorizationHeaderMalformed", Message: "签名区域应为 " + region}
+	}
+	return token, result, nil
+}
+
+// splitS3Path 把 /bucket/key 拆分为 bucket 和对象键
+func splitS3Path(p string) (string, string) {
+	bucket, key, _ := strings.Cut(strings.TrimPrefix(p, "/"), "/")
+	return bucket, key
+}
+
+// writeS3Error 把错误转换为 S3 的 XML 错误响应，无法识别的错误使用 fallbackStatus
+func writeS3Error(c *gin.Context, err error, fallbackStatus int) {
+	var sigErr *sigv4.Error
+	switch {
+	case errors.As(err, &sigErr):
+		status := http.StatusForbidden
+		switch sigErr.Code {
+		case "AuthorizationHeaderMalformed", "XAmzContentSHA256Mismatch", "IncompleteBody":
+			status = http.StatusBadRequest
+		case "NotImplemented":
+			status = http.StatusNotImplemented
+		}
+		writeS3ErrorCode(c, status, sigErr.Code, sigErr.Message)
+	case errors.Is(err, services.ErrS3NoSuchBucket):
+		writeS3ErrorCode(c, http.StatusNotFound, "NoSuchBucket", err.Error())
+	case errors.Is(err, services.ErrS3NoSuchKey):
+		writeS3ErrorCode(c, http.StatusNotFound, "NoSuchKey", err.Error())
+	case errors.Is(err, services.ErrS3InvalidKey):
+		writeS3ErrorCode(c, http.StatusBadRequest, "InvalidArgument", err.Error())
+	case errors.Is(err, services.ErrS3TooLarge):
+		writeS3ErrorCode(c, http.StatusBadRequest, "EntityTooLarge", err.Error())
+	case errors.Is(err, services.ErrS3AccessDenied), errors.Is(err, services.ErrS3Encrypted),
+		errors.Is(err, services.ErrFileQuarantined), errors.Is(err, services.ErrQuotaExceeded):
+		writeS3ErrorCode(c, http.StatusForbidden, "AccessDenied", err.Error())
+	case errors.Is(err, services.ErrImageExists), errors.Is(err, services.ErrPrivateFileExists):
+		writeS3ErrorCode(c, http.StatusConflict, "ObjectAlreadyExists", err.Error())
+	case errors.Is(err, errS3NotImplemented):
+		writeS3ErrorCode(c, http.StatusNotImplemented, "NotImplemented", err.Error())
+	case fallbackStatus >= http.StatusInternalServerError:
+		writeS3ErrorCode(c, fallbackStatus, "InternalError", err.Error())
+	default:
+		writeS3ErrorCode(c, fallbackStatus, "InvalidRequest", err.Error())
+	}
+}
+
+// writeS3ErrorCode 输出 S3 的 XML 错误响应
+func writeS3ErrorCode(c *gin.Context, status int, code, message string) {
+	c.XML(status, models.S3Error{
+		Code:     code,
+		Message:  message,
+		Resource: c.Request.URL.Path,
+	})
+}
@@ -0,0 +1,81 @@
+package controllers
+
+import (
+	"errors"
+	"img_hosting/pkg/logger"
+	"img_hosting/services"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// SessionController 登录会话（设备）管理
+type SessionController struct{}
+
+func NewSessionController() *SessionController {
+	return &SessionController{}
+}
+
+// ListSessions godoc
+// @Summary 获取登录设备
+// @Description 获取当前用户所有有效的登录会话，包括设备、登录 IP 和最近使用时间，current 为 true 的是当前请求使用的会话
+// @Tags 用户管理
+// @Produce json
+// @Security BearerAuth
+// @Success 200 {object} models.Response{data=[]services.SessionInfo}
+// @Failure 401 {object} models.Response
+// @Router /users/me/sessions [get]
+func (sc *SessionController) ListSessions(c *gin.Context) {
+	sessions, err := services.ListSessions(c.GetUint("user_id"), c.GetString("session_id"))
+	if err != nil {
+		logger.GetLogger().WithError(err).Error("获取登录会话失败")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "获取登录设备失败"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"sessions": sessions})
+}
+
+// RevokeSession godoc
+// @Summary 退出指定设备
+// @Description 撤销当前用户的一个登录会话，该会话的刷新令牌和访问令牌立即失效。可以撤销当前会话，效果等同于退出登录
+// @Tags 用户管理
+// @Produce json
+// @Param id path string true "会话ID"
+// @Security BearerAuth
+// @Success 200 {object} models.Response
+// @Failure 401,404 {object} models.Response
+// @Router /users/me/sessions/{id} [delete]
+func (sc *SessionController) RevokeSession(c *gin.Context) {
+	if err := services.RevokeSession(c.GetUint("user_id"), c.Param("id")); err != nil {
+		if errors.Is(err, services.ErrSessionNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+			return
+		}
+		logger.GetLogger().WithError(err).Error("撤销登录会话失败")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "退出设备失败"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "已退出该设备"})
+}
+
+// RevokeOtherSessions godoc
+// @Summary 退出其他设备
+// @Description 撤销当前会话之外的所有登录会话，个人 API 令牌不受影响。使用 API 令牌调用时撤销全部登录会话
+// @Tags 用户管理
+// @Produce json
+// @Security BearerAuth
+// @Success 200 {object} models.Response
+// @Failure 401 {object} models.Response
+// @Router /users/me/sessions [delete]
+func (sc *SessionController) RevokeOtherSessions(c *gin.Context) {
+	count, err := services.RevokeOtherSessions(c.GetUint("user_id"), c.GetString("session_id"))
+	if err != nil {
+		logger.GetLogger().WithError(err).Error("撤销其他登录会话失败")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "退出其他设备失败"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"message": "已退出其他设备",
+		"revoked": count,
+	})
+}
@@ -0,0 +1,185 @@
+package controllers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"img_hosting/models"
+	"img_hosting/services"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// sessionTestRouter 注册会话接口，用请求头模拟 JWT 中间件设置的 user_id 和 session_id
+func sessionTestRouter() *gin.Engine {
+	r := gin.New()
+	r.Use(func(c *gin.Context) {
+		var userID uint
+		fmt.Sscan(c.GetHeader("X-Test-User"), &userID)
+		c.Set("user_id", userID)
+		c.Set("session_id", c.GetHeader("X-Test-Session"))
+	})
+	sc := NewSessionController()
+	r.GET("/users/me/sessions", sc.ListSessions)
+	r.DELETE("/users/me/sessions", sc.RevokeOtherSessions)
+	r.DELETE("/users/me/sessions/:id", sc.RevokeSession)
+	return r
+}
+
+// createSessionUser 创建用户并登录 n 次，返回用户 ID、会话 ID 和对应的刷新令牌
+func createSessionUser(t *testing.T, n int) (uint, []string, []string) {
+	t.Helper()
+	seq := time.Now().UnixNano()
+	user := &models.UserInfo{
+		Name:   fmt.Sprintf("session_user_%d", seq),
+		Email:  fmt.Sprintf("session%d@example.com", seq),
+		Status: models.UserStatusActive,
+	}
+	if err := models.GetDB().Create(user).Error; err != nil {
+		t.Fatal(err)
+	}
+	var sessionIDs, refreshTokens []string
+	for i := 0; i < n; i++ {
+		userAgent := "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/120.0 Safari/537.36"
+		sessionID, refreshToken, err := services.IssueRefreshToken(user.UserID, userAgent, fmt.Sprintf("192.0.2.%d", i+1))
+		if err != nil {
+			t.Fatal(err)
+		}
+		sessionIDs = append(sessionIDs, sessionID)
+		refreshTokens = append(refreshTokens, refreshToken)
+	}
+	return user.UserID, sessionIDs, refreshTokens
+}
+
+func doSessionRequest(r *gin.Engine, method, path string, userID uint, sessionID string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, path, nil)
+	req.Header.Set("X-Test-User", fmt.Sprint(userID))
+	req.Header.Set("X-Test-Session", sessionID)
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	return w
+}
+
+// listSessions 调用列表接口，返回会话 ID 到是否为当前会话的映射
+func listSessions(t *testing.T, r *gin.Engine, userID uint, sessionID string) map[string]bool {
+	t.Helper()
+	w := doSessionRequest(r, http.MethodGet, "/users/me/sessions", userID, sessionID)
+	if w.Code != http.StatusOK {
+		t.Fatalf("获取会话列表: status = %d, body = %s", w.Code, w.Body.String())
+	}
+	var resp struct {
+		Sessions []services.SessionInfo `json:"sessions"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatal(err)
+	}
+	result := make(map[string]bool)
+	for _, s := range resp.Sessions {
+		if s.UserID != userID || s.Device == "" {
+			t.Errorf("会话 %s: user_id = %d, device = %q", s.ID, s.UserID, s.Device)
+		}
+		result[s.ID] = s.Current
+	}
+	return result
+}
+
+func TestListSessions(t *testing.T) {
+	r := sessionTestRouter()
+	userID, sessions, _ := createSessionUser(t, 2)
+	otherID, otherSessions, _ := createSessionUser(t, 1)
+
+	got := listSessions(t, r, userID, sessions[0])
+	if len(got) != 2 || !got[sessions[0]] || got[sessions[1]] {
+		t.Errorf("会话列表 = %v", got)
+	}
+	if _, ok := got[otherSessions[0]]; ok {
+		t.Error("不应返回其他用户的会话")
+	}
+
+	// 使用 API 令牌访问时没有当前会话
+	for id, current := range listSessions(t, r, otherID, "") {
+		if current {
+			t.Errorf("没有会话 ID 时 %s 不应标记为当前会话", id)
+		}
+	}
+}
+
+func TestRevokeSession(t *testing.T) {
+	r := sessionTestRouter()
+	userID, sessions, refreshTokens := createSessionUser(t, 2)
+	otherID, otherSessions, _ := createSessionUser(t, 1)
+
+	tests := []struct {
+		name string
+		id   string
+		want int
+	}{
+		{"其他用户的会话", otherSessions[0], http.StatusNotFound},
+		{"不存在的会话", "no-such-session", http.StatusNotFound},
+		{"自己的其他会话", sessions[1], http.StatusOK},
+		{"已撤销的会话", sessions[1], http.StatusNotFound},
+	}
+	for _, tt := range tests {
+		if w := doSessionRequest(r, http.MethodDelete, "/users/me/sessions/"+tt.id, userID, sessions[0]); w.Code != tt.want {
+			t.Errorf("%s: status = %d, want %d, body = %s", tt.name, w.Code, tt.want, w.Body.String())
+		}
+	}
+
+	// 被撤销会话的刷新令牌和访问令牌立即失效，其他会话不受影响
+	if _, _, _, err := services.RotateRefreshToken(refreshTokens[1], "192.0.2.2"); err == nil {
+		t.Error("被撤销会话的刷新令牌应失效")
+	}
+	if err := services.ValidateAccessToken(userID, "", sessions[1], time.Now()); !errors.Is(err, services.ErrSessionRevoked) {
+		t.Errorf("被撤销会话的访问令牌应失效，got %v", err)
+	}
+	if err := services.ValidateAccessToken(userID, "", sessions[0], time.Now()); err != nil {
+		t.Errorf("当前会话的访问令牌应仍然有效，got %v", err)
+	}
+	if got := listSessions(t, r, userID, sessions[0]); len(got) != 1 || !got[sessions[0]] {
+		t.Errorf("撤销后的会话列表 = %v", got)
+	}
+	if got := listSessions(t, r, otherID, ""); len(got) != 1 {
+		t.Errorf("其他用户的会话不应被撤销: %v", got)
+	}
+}
+
+func TestRevokeOtherSessions(t *testing.T) {
+	r := sessionTestRouter()
+	userID, sessions, refreshTokens := createSessionUser(t, 3)
+
+	w := doSessionRequest(r, http.MethodDelete, "/users/me/sessions", userID, sessions[0])
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d, body = %s", w.Code, w.Body.String())
+	}
+	var resp struct {
+		Revoked int `json:"revoked"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil || resp.Revoked != 2 {
+		t.Errorf("revoked = %d, %v", resp.Revoked, err)
+	}
+
+	// 当前会话仍可刷新，其他会话的刷新令牌失效
+	if _, _, _, err := services.RotateRefreshToken(refreshTokens[0], "192.0.2.1"); err != nil {
+		t.Errorf("当前会话应仍然有效，got %v", err)
+	}
+	for _, token := range refreshTokens[1:] {
+		if _, _, _, err := services.RotateRefreshToken(token, "192.0.2.1"); err == nil {
+			t.Error("其他会话的刷新令牌应失效")
+		}
+	}
+	if got := listSessions(t, r, userID, sessions[0]); len(got) != 1 || !got[sessions[0]] {
+		t.Errorf("撤销后的会话列表 = %v", got)
+	}
+
+	// 没有当前会话（API 令牌）时撤销全部
+	if w := doSessionRequest(r, http.MethodDelete, "/users/me/sessions", userID, ""); w.Code != http.StatusOK {
+		t.Fatalf("status = %d", w.Code)
+	}
+	if got := listSessions(t, r, userID, ""); len(got) != 0 {
+		t.Errorf("应撤销全部会话，got %v", got)
+	}
+}
@@ -0,0 +1,260 @@
+package controllers
+
+import (
+	"errors"
+	"fmt"
+	"img_hosting/services"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
+)
+
+// CreateShareLinkRequest 创建分享链接请求
+type CreateShareLinkRequest struct {
+	FilePassword string     `json:"file_password" example:"your-file-password"` // 加密文件的密码
+	Password     string     `json:"password" example:"share-password"`          // 分享访问密码(可选)
+	ExpiresAt    *time.Time `json:"expires_at" example:"2030-01-01T00:00:00Z"`  // 过期时间(可选)
+	MaxDownloads int64      `json:"max_downloads" example:"10"`                 // 最大下载次数(0表示不限)
+}
+
+// SharePasswordRequest 访问设置了密码的分享链接，可以是 JSON 或表单
+type SharePasswordRequest struct {
+	Password string `json:"password" form:"password" example:"share-password"` // 分享密码
+}
+
+// ShareLinkController 分享链接控制器
+type ShareLinkController struct{}
+
+func NewShareLinkController() *ShareLinkController {
+	return &ShareLinkController{}
+}
+
+// CreateShareLink godoc
+// @Summary 创建分享链接
+// @Description 为私人文件创建分享链接，可设置访问密码、过期时间和下载次数上限
+// @Tags 文件分享
+// @Accept json
+// @Produce json
+// @Param id path int true "文件ID"
+// @Param request body CreateShareLinkRequest true "分享设置"
+// @Security BearerAuth
+// @Success 200 {object} models.Response{data=models.ShareLink}
+// @Failure 400 {object} models.Response
+// @Router /private-files/{id}/shares [post]
+func (sc *ShareLinkController) CreateShareLink(c *gin.Context) {
+	userID := c.GetUint("user_id")
+	fileID, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "无效的文件ID"})
+		return
+	}
+
+	var req CreateShareLinkRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "无效的请求数据"})
+		return
+	}
+
+	link, err := services.CreateShareLink(userID, services.CreateShareLinkInput{
+		FileID:       uint(fileID),
+		FilePassword: req.FilePassword,
+		Password:     req.Password,
+		ExpiresAt:    req.ExpiresAt,
+		MaxDownloads: req.MaxDownloads,
+	})
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message":   "分享链接创建成功",
+		"share":     link,
+		"share_url": "/s/" + link.Slug,
+	})
+}
+
+// ListFileShareLinks godoc
+// @Summary 获取文件的分享链接
+// @Description 获取指定私人文件的所有分享链接
+// @Tags 文件分享
+// @Produce json
+// @Param id path int true "文件ID"
+// @Security BearerAuth
+// @Success 200 {object} models.Response{data=[]models.ShareLink}
+// @Failure 400,500 {object} models.Response
+// @Router /private-files/{id}/shares [get]
+func (sc *ShareLinkController) ListFileShareLinks(c *gin.Context) {
+	userID := c.GetUint("user_id")
+	fileID, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "无效的文件ID"})
+		return
+	}
+
+	links, err := services.ListShareLinks(userID, uint(fileID))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "获取分享链接失败"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"shares": links})
+}
+
+// ListShareLinks godoc
+// @Summary 获取我的分享链接
+// @Description 获取当前用户创建的所有分享链接
+// @Tags 文件分享
+// @Produce json
+// @Security BearerAuth
+// @Success 200 {object} models.Response{data=[]models.ShareLink}
+// @Failure 500 {object} models.Response
+// @Router /shares [get]
+func (sc *ShareLinkController) ListShareLinks(c *gin.Context) {
+	userID := c.GetUint("user_id")
+
+	links, err := services.ListShareLinks(userID, 0)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "获取分享链接失败"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"shares": links})
+}
+
+// RevokeShareLink godoc
+// @Summary 撤销分享链接
+// @Description 撤销指定的分享链接，撤销后链接立即失效
+// @Tags 文件分享
+// @Produce json
+// @Param id path int true "分享链接ID"
+// @Security BearerAuth
+// @Success 200 {object} models.Response
+// @Failure 400,404 {object} models.Response
+// @Router /shares/{id} [delete]
+func (sc *ShareLinkController) RevokeShareLink(c *gin.Context) {
+	userID := c.GetUint("user_id")
+	linkID, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "无效的分享链接ID"})
+		return
+	}
+
+	if err := services.RevokeShareLink(userID, uint(linkID)); err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "分享链接已撤销"})
+}
+
+// GetShareAccessLogs godoc
+// @Summary 获取分享链接访问记录
+// @Description 获取指定分享链接最近的访问记录
+// @Tags 文件分享
+// @Produce json
+// @Param id path int true "分享链接ID"
+// @Param limit query int false "返回条数" default(50)
+// @Security BearerAuth
+// @Success 200 {object} models.Response{data=[]models.ShareAccessLog}
+// @Failure 400,404 {object} models.Response
+// @Router /shares/{id}/logs [get]
+func (sc *ShareLinkController) GetShareAccessLogs(c *gin.Context) {
+	userID := c.GetUint("user_id")
+	linkID, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "无效的分享链接ID"})
+		return
+	}
+
+	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "50"))
+	if limit <= 0 || limit > 500 {
+		limit = 50
+	}
+
+	logs, err := services.GetShareAccessLogs(userID, uint(linkID), limit)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"logs": logs})
+}
+
+// DownloadShared godoc
+// @Summary 通过分享链接下载文件
+// @Description 无需登录，通过分享链接下载文件；设置了密码的链接需通过 X-Share-Password 头或 POST 请求体提供密码，不接受查询参数（会出现在访问日志和浏览器历史中）。
+// @Description 同一 IP 输错密码次数过多时返回 429，等待时间按 login_protection 配置计算
+// @Tags 文件分享
+// @Accept json,x-www-form-urlencoded
+// @Produce octet-stream
+// @Param slug path string true "分享链接标识"
+// @Param X-Share-Password header string false "分享密码"
+// @Param request body SharePasswordRequest false "分享密码（仅 POST）"
+// @Success 200 {file} file
+// @Failure 401,404,410,429 {object} models.Response
+// @Router /s/{slug} [get]
+// @Router /s/{slug} [post]
+func (sc *ShareLinkController) DownloadShared(c *gin.Context) {
+	file, filePath, isTemp, err := services.OpenShareLink(c.Param("slug"), sharePassword(c), c.ClientIP(), c.Request.UserAgent())
+	if err != nil {
+		var throttled *services.SharePasswordThrottledError
+		switch {
+		case errors.As(err, &throttled):
+			c.Header("Retry-After", strconv.Itoa(throttled.RetrySeconds()))
+			c.JSON(http.StatusTooManyRequests, gin.H{
+				"error":       err.Error(),
+				"retry_after": throttled.RetrySeconds(),
+			})
+		case errors.Is(err, services.ErrShareNotFound):
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		case errors.Is(err, services.ErrSharePassword):
+			c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+		case errors.Is(err, services.ErrShareRevoked),
+			errors.Is(err, services.ErrShareExpired),
+			errors.Is(err, services.ErrShareLimitReached):
+			c.JSON(http.StatusGone, gin.H{"error": err.Error()})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "获取分享文件失败"})
+		}
+		return
+	}
+	if isTemp {
+		defer os.RemoveAll(filepath.Dir(filePath))
+	}
+
+	fileInfo, err := os.Stat(filePath)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "无法获取文件信息"})
+		return
+	}
+
+	c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=%s", url.QueryEscape(file.FileName)))
+	c.Header("Content-Type", file.FileType)
+	c.Header("Content-Length", fmt.Sprintf("%d", fileInfo.Size()))
+	c.File(filePath)
+}
+
+// sharePassword 从 X-Share-Password 头或 POST 请求体中读取分享密码
+// 表单只读取请求体（PostForm），查询参数中的 password 会被忽略
+func sharePassword(c *gin.Context) string {
+	if password := c.GetHeader("X-Share-Password"); password != "" {
+		return password
+	}
+	if c.Request.Method != http.MethodPost {
+		return ""
+	}
+	var req SharePasswordRequest
+	if c.ContentType() == binding.MIMEJSON {
+		_ = c.ShouldBindJSON(&req)
+	} else {
+		_ = c.ShouldBindWith(&req, binding.FormPost)
+	}
+	return req.Password
+}
@@ -0,0 +1,114 @@
+package controllers
+
+import (
+	"bytes"
+	"fmt"
+	"img_hosting/models"
+	"img_hosting/services"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+var testShareSeq int
+
+// createTestShareLink 创建一个密码为 s3cret 的分享链接
+func createTestShareLink(t *testing.T) *models.ShareLink {
+	t.Helper()
+	testShareSeq++
+	user := &models.UserInfo{
+		Name:   fmt.Sprintf("share_user_%d", testShareSeq),
+		Email:  fmt.Sprintf("share%d@example.com", testShareSeq),
+		Status: models.UserStatusActive,
+	}
+	if err := models.GetDB().Create(user).Error; err != nil {
+		t.Fatal(err)
+	}
+	content := []byte("shared notes")
+	file, err := services.UploadPrivateFileReader(user.UserID, "notes.txt", bytes.NewReader(content), int64(len(content)), false, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	link, err := services.CreateShareLink(user.UserID, services.CreateShareLinkInput{FileID: file.ID, Password: "s3cret"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return link
+}
+
+func TestDownloadSharedPasswordSource(t *testing.T) {
+	link := createTestShareLink(t)
+	r := gin.New()
+	sc := NewShareLinkController()
+	r.GET("/s/:slug", sc.DownloadShared)
+	r.POST("/s/:slug", sc.DownloadShared)
+
+	tests := []struct {
+		name        string
+		method      string
+		query       string
+		contentType string
+		body        string
+		header      string
+		want        int
+	}{
+		{"请求头", http.MethodGet, "", "", "", "s3cret", http.StatusOK},
+		{"JSON 请求体", http.MethodPost, "", "application/json", `{"password":"s3cret"}`, "", http.StatusOK},
+		{"表单请求体", http.MethodPost, "", "application/x-www-form-urlencoded", "password=s3cret", "", http.StatusOK},
+		{"GET 查询参数", http.MethodGet, "?password=s3cret", "", "", "", http.StatusUnauthorized},
+		{"POST 查询参数", http.MethodPost, "?password=s3cret", "application/x-www-form-urlencoded", "", "", http.StatusUnauthorized},
+		{"密码错误", http.MethodPost, "", "application/json", `{"password":"wrong"}`, "", http.StatusUnauthorized},
+	}
+	for i, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(tt.method, "/s/"+url.PathEscape(link.Slug)+tt.query, strings.NewReader(tt.body))
+			// 每个用例使用不同的 IP，密码错误不会触发限流
+			req.RemoteAddr = fmt.Sprintf("192.0.2.%d:1234", i+1)
+			if tt.contentType != "" {
+				req.Header.Set("Content-Type", tt.contentType)
+			}
+			if tt.header != "" {
+				req.Header.Set("X-Share-Password", tt.header)
+			}
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, req)
+
+			if w.Code != tt.want {
+				t.Errorf("status = %d, want %d, body = %s", w.Code, tt.want, w.Body.String())
+			}
+		})
+	}
+}
+
+func TestDownloadSharedThrottled(t *testing.T) {
+	link := createTestShareLink(t)
+	r := gin.New()
+	r.POST("/s/:slug", NewShareLinkController().DownloadShared)
+
+	download := func(password string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/s/"+url.PathEscape(link.Slug), strings.NewReader(url.Values{"password": {password}}.Encode()))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		req.RemoteAddr = fmt.Sprintf("198.51.100.%d:1234", link.ID%256)
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w
+	}
+
+	// 按默认配置，免等待次数用完后返回 429 和 Retry-After
+	var w *httptest.ResponseRecorder
+	for i := 0; i < 20; i++ {
+		if w = download("wrong"); w.Code != http.StatusUnauthorized {
+			break
+		}
+	}
+	if w.Code != http.StatusTooManyRequests || w.Header().Get("Retry-After") == "" {
+		t.Fatalf("status = %d, Retry-After = %q, body = %s", w.Code, w.Header().Get("Retry-After"), w.Body.String())
+	}
+	if w := download("s3cret"); w.Code != http.StatusTooManyRequests {
+		t.Errorf("限流期间密码正确也应返回 429，got %d", w.Code)
+	}
+}
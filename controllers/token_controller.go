@@ -1,6 +1,7 @@
 package controllers
 
 import (
+	"errors"
 	"fmt"
 	"img_hosting/services"
 	"net/http"
@@ -10,8 +11,8 @@ import (
 
 // TokenCreateRequest 创建令牌请求
 type TokenCreateRequest struct {
-	DeviceID  string `json:"device_id"`
-	IPAddress string `json:"ip_address"`
+	DeviceID string   `json:"device_id"`
+	Scopes   []string `json:"scopes" binding:"required,min=1" example:"images:write,files:read"` // 令牌可以访问的范围
 }
 
 // TokenController 处理 token 相关的请求
@@ -19,7 +20,7 @@ type TokenController struct{}
 
 // CreateToken godoc
 // @Summary 创建新的访问令牌
-// @Description 为当前用户创建一个新的访问令牌
+// @Description 为当前用户创建一个新的访问令牌，令牌只能访问 scopes 中的接口，权限不超过用户角色的权限。只能使用登录令牌创建
 // @Tags 令牌管理
 // @Accept json
 // @Produce json
@@ -40,8 +41,10 @@ func (tc *TokenController) CreateToken(c *gin.Context) {
 		return
 	}
 
+	// 记录发起请求的客户端 IP，不使用请求体中的值
+	ipAddress := c.ClientIP()
 	fmt.Printf("创建令牌请求: deviceID=%s, ipAddress=%s\n",
-		req.DeviceID, req.IPAddress)
+		req.DeviceID, ipAddress)
 
 	userID := c.GetUint("user_id")
 
@@ -50,8 +53,12 @@ func (tc *TokenController) CreateToken(c *gin.Context) {
 		req.DeviceID = c.GetHeader("Device-ID")
 	}
 
-	token, err := services.CreateToken(userID, req.DeviceID, req.IPAddress)
+	token, err := services.CreateToken(userID, req.DeviceID, ipAddress, req.Scopes)
 	if err != nil {
+		if errors.Is(err, services.ErrInvalidScope) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "创建 token 失败"})
 		return
 	}
@@ -102,6 +109,8 @@ func (tc *TokenController) RevokeToken(c *gin.Context) {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "撤销 token 失败"})
 		return
 	}
+	// 令牌验证接口的缓存同时失效
+	ClearTokenCache(tokenStr)
 
 	c.JSON(http.StatusOK, gin.H{"message": "token 已撤销"})
 }
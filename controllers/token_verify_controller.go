@@ -116,6 +116,13 @@ func (tc *TokenVerifyController) VerifyToken(c *gin.Context) {
 		cachedUser, userExists := tokenCache[token]
 		cacheMutex.RUnlock()
 
+		// 用户被封禁或删除后缓存立即失效（用户状态有单独的短期缓存）
+		if hasAccess && userExists && services.CheckUserActive(cachedUser.UserID) != nil {
+			ClearTokenCache(token)
+			c.Status(http.StatusUnauthorized)
+			return
+		}
+
 		if hasAccess && userExists {
 			// 使用缓存的权限和用户信息
 			c.JSON(http.StatusOK, gin.H{
@@ -0,0 +1,208 @@
+package controllers
+
+import (
+	"errors"
+	"img_hosting/models"
+	"img_hosting/pkg/logger"
+	"img_hosting/services"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+// TwoFactorController 两步验证（TOTP）设置
+type TwoFactorController struct{}
+
+func NewTwoFactorController() *TwoFactorController {
+	return &TwoFactorController{}
+}
+
+// GetStatus godoc
+// @Summary 获取两步验证状态
+// @Description 获取当前用户是否已启用两步验证、角色是否要求启用以及剩余恢复码数量
+// @Tags 两步验证
+// @Produce json
+// @Security BearerAuth
+// @Success 200 {object} services.TwoFactorStatus
+// @Failure 401 {object} models.Response
+// @Router /users/me/2fa [get]
+func (tc *TwoFactorController) GetStatus(c *gin.Context) {
+	status, err := services.GetTwoFactorStatus(c.GetUint("user_id"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "获取两步验证状态失败"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"two_factor": status})
+}
+
+// BeginTOTP godoc
+// @Summary 开始绑定验证器
+// @Description 生成 TOTP 密钥，返回密钥和 otpauth 链接；二维码可通过 /users/me/2fa/totp/qr 获取。调用验证接口后才会启用
+// @Tags 两步验证
+// @Produce json
+// @Security BearerAuth
+// @Success 200 {object} services.TOTPEnrollment
+// @Failure 401,409 {object} models.Response
+// @Router /users/me/2fa/totp [post]
+func (tc *TwoFactorController) BeginTOTP(c *gin.Context) {
+	enrollment, err := services.BeginTOTPEnrollment(c.GetUint("user_id"))
+	if err != nil {
+		if errors.Is(err, services.ErrTwoFactorAlreadyEnabled) {
+			c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+			return
+		}
+		logger.GetLogger().WithError(err).Error("生成两步验证密钥失败")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "生成两步验证密钥失败"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"secret":      enrollment.Secret,
+		"otpauth_url": enrollment.OtpauthURL,
+		"qr_code_url": "/users/me/2fa/totp/qr",
+	})
+}
+
+// TOTPQRCode godoc
+// @Summary 获取验证器二维码
+// @Description 返回正在绑定的 TOTP 密钥的二维码图片，启用后不再提供
+// @Tags 两步验证
+// @Produce png
+// @Security BearerAuth
+// @Success 200 {file} file "二维码 PNG"
+// @Failure 401,404 {object} models.Response
+// @Router /users/me/2fa/totp/qr [get]
+func (tc *TwoFactorController) TOTPQRCode(c *gin.Context) {
+	png, err := services.TOTPQRCode(c.GetUint("user_id"))
+	if err != nil {
+		if errors.Is(err, services.ErrTwoFactorNotPending) {
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "生成二维码失败"})
+		return
+	}
+	c.Header("Cache-Control", "no-store")
+	c.Data(http.StatusOK, "image/png", png)
+}
+
+// ConfirmTOTP godoc
+// @Summary 启用两步验证
+// @Description 输入验证器生成的验证码完成绑定，返回 10 个恢复码。恢复码只显示这一次，每个只能使用一次
+// @Tags 两步验证
+// @Accept json
+// @Produce json
+// @Param request body models.TwoFactorCodeRequest true "验证码"
+// @Security BearerAuth
+// @Success 200 {object} models.Response
+// @Failure 400,401 {object} models.Response
+// @Router /users/me/2fa/totp/verify [post]
+func (tc *TwoFactorController) ConfirmTOTP(c *gin.Context) {
+	var req models.TwoFactorCodeRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "缺少验证码"})
+		return
+	}
+
+	codes, err := services.ConfirmTOTPEnrollment(c.GetUint("user_id"), req.Code)
+	if err != nil {
+		respondTwoFactorError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"message":        "两步验证已启用",
+		"recovery_codes": codes,
+	})
+}
+
+// DisableTOTP godoc
+// @Summary 关闭两步验证
+// @Description 使用验证码或恢复码关闭两步验证。角色要求启用两步验证时不能关闭
+// @Tags 两步验证
+// @Accept json
+// @Produce json
+// @Param request body models.TwoFactorCodeRequest true "验证码或恢复码"
+// @Security BearerAuth
+// @Success 200 {object} models.Response
+// @Failure 400,401,403 {object} models.Response
+// @Router /users/me/2fa/totp [delete]
+func (tc *TwoFactorController) DisableTOTP(c *gin.Context) {
+	var req models.TwoFactorCodeRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "缺少验证码"})
+		return
+	}
+
+	if err := services.DisableTOTP(c.GetUint("user_id"), req.Code); err != nil {
+		respondTwoFactorError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "两步验证已关闭"})
+}
+
+// RegenerateRecoveryCodes godoc
+// @Summary 重新生成恢复码
+// @Description 使用验证码或恢复码重新生成 10 个恢复码，旧的恢复码全部失效
+// @Tags 两步验证
+// @Accept json
+// @Produce json
+// @Param request body models.TwoFactorCodeRequest true "验证码或恢复码"
+// @Security BearerAuth
+// @Success 200 {object} models.Response
+// @Failure 400,401 {object} models.Response
+// @Router /users/me/2fa/recovery-codes [post]
+func (tc *TwoFactorController) RegenerateRecoveryCodes(c *gin.Context) {
+	var req models.TwoFactorCodeRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "缺少验证码"})
+		return
+	}
+
+	codes, err := services.RegenerateRecoveryCodes(c.GetUint("user_id"), req.Code)
+	if err != nil {
+		respondTwoFactorError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"recovery_codes": codes})
+}
+
+// ResetUserTwoFactor godoc
+// @Summary 重置用户的两步验证
+// @Description 管理员关闭指定用户的两步验证并删除恢复码，用于用户丢失验证器和恢复码的情况
+// @Tags 两步验证
+// @Produce json
+// @Param id path int true "用户ID"
+// @Security BearerAuth
+// @Success 200 {object} models.Response
+// @Failure 400,401,403 {object} models.Response
+// @Router /users/{id}/2fa [delete]
+func (tc *TwoFactorController) ResetUserTwoFactor(c *gin.Context) {
+	userID, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "无效的用户ID"})
+		return
+	}
+
+	if err := services.ResetTwoFactor(uint(userID)); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "重置两步验证失败"})
+		return
+	}
+	logger.GetLogger().WithField("operator_id", c.GetUint("user_id")).
+		WithField("user_id", userID).Info("重置用户两步验证")
+	c.JSON(http.StatusOK, gin.H{"message": "两步验证已重置"})
+}
+
+// respondTwoFactorError 把两步验证的错误转换为响应
+func respondTwoFactorError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, services.ErrTwoFactorCodeInvalid):
+		c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+	case errors.Is(err, services.ErrTwoFactorRequired):
+		c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+	case errors.Is(err, services.ErrTwoFactorNotEnabled), errors.Is(err, services.ErrTwoFactorNotPending):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	default:
+		logger.GetLogger().WithError(err).Error("两步验证操作失败")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "两步验证操作失败"})
+	}
+}
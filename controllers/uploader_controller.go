@@ -0,0 +1,198 @@
+package controllers
+
+import (
+	"errors"
+	"fmt"
+	"img_hosting/middleware"
+	"img_hosting/models"
+	"img_hosting/pkg/logger"
+	"img_hosting/services"
+	"mime/multipart"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sirupsen/logrus"
+)
+
+// UploaderController ShareX、PicGo、Typora 等第三方上传工具的兼容接口
+type UploaderController struct{}
+
+func NewUploaderController() *UploaderController {
+	return &UploaderController{}
+}
+
+// uploaderFileFields 依次尝试的文件字段名，兼容不同工具的默认设置
+var uploaderFileFields = []string{"file", "image", "smfile"}
+
+// deleteConfirmPage 删除链接的确认页面，避免链接被预览或预取时误删图片
+const deleteConfirmPage = `<!DOCTYPE html>
+<html lang="zh-CN">
+<head><meta charset="utf-8"><title>删除图片</title></head>
+<body>
+<p>确定要删除这张图片吗？删除后无法恢复。</p>
+<form method="post"><button type="submit">删除</button></form>
+</body>
+</html>`
+
+// Upload godoc
+// @Summary 上传工具上传图片
+// @Description 供 ShareX、PicGo、Typora 等工具使用，通过个人 API 令牌认证，响应中包含图片地址和删除链接。format=text 时只返回图片地址
+// @Tags 上传工具
+// @Accept multipart/form-data
+// @Produce json
+// @Param file formData file true "图片文件（也可使用 image 或 smfile 字段）"
+// @Param description formData string false "图片描述"
+// @Param format query string false "响应格式：json（默认）或 text"
+// @Param Authorization header string true "Bearer API令牌"
+// @Success 200 {object} models.UploaderResponse
+// @Failure 400,401,403,413 {object} models.UploaderResponse
+// @Router /api/upload [post]
+func (uc *UploaderController) Upload(c *gin.Context) {
+	userID := c.GetUint("user_id")
+	logger := logger.GetLogger()
+
+	file := uploaderFormFile(c)
+	if file == nil {
+		c.JSON(http.StatusBadRequest, models.UploaderResponse{Message: "请选择要上传的图片"})
+		return
+	}
+
+	result, err := services.UploadImageForUploader(userID, file, c.PostForm("description"))
+	if err != nil {
+		logger.WithError(err).WithFields(logrus.Fields{
+			"user_id":  userID,
+			"filename": file.Filename,
+		}).Warn("上传工具上传失败")
+		status := http.StatusBadRequest
+		if errors.Is(err, services.ErrQuotaExceeded) {
+			status = http.StatusRequestEntityTooLarge
+		}
+		c.JSON(status, models.UploaderResponse{Message: err.Error()})
+		return
+	}
+
+	if c.Query("format") == "text" {
+		c.String(http.StatusOK, result.ImageURL)
+		return
+	}
+
+	deleteURL := services.UploaderDeleteURL(services.UploaderBaseURL(requestBaseURL(c)), result.DeleteKey)
+	c.JSON(http.StatusOK, models.UploaderResponse{
+		Success:   true,
+		Message:   "上传成功",
+		URL:       result.ImageURL,
+		DeleteURL: deleteURL,
+		Data: &models.UploaderImage{
+			ImageID:   result.ImageID,
+			URL:       result.ImageURL,
+			DeleteURL: deleteURL,
+			FileName:  file.Filename,
+			Markdown:  fmt.Sprintf("![%s](%s)", file.Filename, result.ImageURL),
+		},
+	})
+}
+
+// ConfirmDelete godoc
+// @Summary 删除链接确认页
+// @Description 在浏览器中打开删除链接时显示确认页面，确认后以 POST 提交删除
+// @Tags 上传工具
+// @Produce html
+// @Param key path string true "删除链接密钥"
+// @Success 200 {string} string "确认页面"
+// @Router /api/delete/{key} [get]
+func (uc *UploaderController) ConfirmDelete(c *gin.Context) {
+	c.Data(http.StatusOK, "text/html; charset=utf-8", []byte(deleteConfirmPage))
+}
+
+// DeleteByKey godoc
+// @Summary 通过删除链接删除图片
+// @Description 使用上传时返回的删除链接删除图片，不需要登录
+// @Tags 上传工具
+// @Produce json
+// @Param key path string true "删除链接密钥"
+// @Success 200 {object} models.Response
+// @Failure 404,500 {object} models.Response
+// @Router /api/delete/{key} [post]
+// @Router /api/delete/{key} [delete]
+func (uc *UploaderController) DeleteByKey(c *gin.Context) {
+	err := services.DeleteImageByKey(c.Param("key"))
+	fromForm := c.ContentType() == "application/x-www-form-urlencoded"
+
+	status, message := http.StatusOK, "图片已删除"
+	if err != nil {
+		status, message = http.StatusInternalServerError, "删除图片失败"
+		if errors.Is(err, services.ErrDeleteKeyNotFound) {
+			status, message = http.StatusNotFound, err.Error()
+		}
+	}
+
+	// 确认页面提交的表单返回页面，其他客户端返回 JSON
+	if fromForm {
+		c.Data(status, "text/html; charset=utf-8", []byte("<!DOCTYPE html><meta charset=\"utf-8\"><p>"+message+"</p>"))
+		return
+	}
+	if err != nil {
+		c.JSON(status, gin.H{"error": message})
+		return
+	}
+	c.JSON(status, gin.H{"message": message})
+}
+
+// ShareXConfig godoc
+// @Summary 下载 ShareX 配置
+// @Description 生成当前用户的 ShareX 自定义上传器配置（.sxcu），每次下载都会创建一个新的 API 令牌（有效期一年，可在令牌管理中撤销）
+// @Tags 上传工具
+// @Produce json
+// @Security BearerAuth
+// @Success 200 {object} services.ShareXConfig
+// @Failure 401,500 {object} models.Response
+// @Router /api/uploaders/sharex [get]
+func (uc *UploaderController) ShareXConfig(c *gin.Context) {
+	token, err := services.CreateUploaderToken(c.GetUint("user_id"), "sharex", c.ClientIP())
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "创建 token 失败"})
+		return
+	}
+
+	cfg := services.BuildShareXConfig(services.UploaderBaseURL(requestBaseURL(c)), token.Token)
+	c.Header("Content-Disposition", `attachment; filename="img_hosting.sxcu"`)
+	c.IndentedJSON(http.StatusOK, cfg)
+}
+
+// PicGoConfig godoc
+// @Summary 获取 PicGo 配置
+// @Description 生成 picgo-plugin-web-uploader 插件的配置，Typora 通过 PicGo 上传时同样适用。每次获取都会创建一个新的 API 令牌（有效期一年，可在令牌管理中撤销）
+// @Tags 上传工具
+// @Produce json
+// @Security BearerAuth
+// @Success 200 {object} map[string]interface{}
+// @Failure 401,500 {object} models.Response
+// @Router /api/uploaders/picgo [get]
+func (uc *UploaderController) PicGoConfig(c *gin.Context) {
+	token, err := services.CreateUploaderToken(c.GetUint("user_id"), "picgo", c.ClientIP())
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "创建 token 失败"})
+		return
+	}
+
+	c.IndentedJSON(http.StatusOK, services.BuildPicGoConfig(services.UploaderBaseURL(requestBaseURL(c)), token.Token))
+}
+
+// uploaderFormFile 按 uploaderFileFields 的顺序获取上传的文件
+func uploaderFormFile(c *gin.Context) *multipart.FileHeader {
+	for _, field := range uploaderFileFields {
+		if file, err := c.FormFile(field); err == nil {
+			return file
+		}
+	}
+	return nil
+}
+
+// requestBaseURL 根据请求的协议和 Host 拼接访问地址，只有可信代理转发的请求才读取 X-Forwarded-Proto
+func requestBaseURL(c *gin.Context) string {
+	scheme := "http"
+	if c.Request.TLS != nil || (middleware.FromTrustedProxy(c) && c.GetHeader("X-Forwarded-Proto") == "https") {
+		scheme = "https"
+	}
+	return scheme + "://" + c.Request.Host
+}
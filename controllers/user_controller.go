@@ -1,8 +1,11 @@
 package controllers
 
 import (
+	"errors"
 	"fmt"
+	"img_hosting/middleware"
 	"img_hosting/models"
+	"img_hosting/pkg/logger"
 	"img_hosting/services"
 	"net/http"
 	"strconv"
@@ -77,6 +80,7 @@ type UpdateProfileRequest struct {
 // @Security BearerAuth
 // @Success 200 {object} models.Response
 // @Failure 400,401 {object} models.Response
+// @Failure 409 {object} models.Response "邮箱已被其他账号使用"
 // @Router /users/profile [put]
 func (uc *UserController) UpdateProfile(c *gin.Context) {
 	userID := c.GetUint("user_id")
@@ -87,12 +91,27 @@ func (uc *UserController) UpdateProfile(c *gin.Context) {
 		return
 	}
 
-	if err := uc.userService.UpdateUserProfile(userID, updates); err != nil {
+	reverify, err := uc.userService.UpdateUserProfile(userID, updates)
+	if err != nil {
+		if errors.Is(err, services.ErrEmailTaken) {
+			c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+			return
+		}
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "更新用户信息失败"})
 		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{"message": "用户信息更新成功"})
+	// 修改了邮箱，给新邮箱发送验证邮件
+	if reverify {
+		if err := services.SendVerificationEmail(userID); err != nil {
+			logger.GetLogger().WithError(err).WithField("user_id", userID).Error("发送验证邮件失败")
+		}
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message":                     "用户信息更新成功",
+		"email_verification_required": reverify,
+	})
 }
 
 // ListUsersResponse 用户列表响应
@@ -246,6 +265,109 @@ func (uc *UserController) ManageRoles(c *gin.Context) {
 	})
 }
 
+// GetStorageUsage godoc
+// @Summary 获取存储用量
+// @Description 获取当前用户的存储用量和配额，按图片和私人文件分类统计
+// @Tags 用户管理
+// @Produce json
+// @Security BearerAuth
+// @Success 200 {object} models.Response{data=models.StorageUsage}
+// @Failure 401,500 {object} models.Response
+// @Router /users/me/usage [get]
+func (uc *UserController) GetStorageUsage(c *gin.Context) {
+	userID := c.GetUint("user_id")
+
+	usage, err := services.GetStorageUsage(userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "获取存储用量失败"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"usage": usage})
+}
+
+// ChangePassword godoc
+// @Summary 修改密码
+// @Description 修改当前用户的密码。成功后所有设备的登录立即失效，响应中返回当前设备的新令牌。只能使用登录令牌调用
+// @Tags 用户管理
+// @Accept json
+// @Produce json
+// @Param request body models.ChangePasswordRequest true "修改密码请求"
+// @Security BearerAuth
+// @Success 200 {object} models.RefreshTokenResponse
+// @Failure 400,401 {object} models.Response
+// @Router /users/me/password [put]
+func (uc *UserController) ChangePassword(c *gin.Context) {
+	userID := c.GetUint("user_id")
+
+	var req models.ChangePasswordRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "新密码需要 8-20 位，包含字母、数字和特殊字符"})
+		return
+	}
+
+	if err := uc.userService.ChangePassword(userID, req.OldPassword, req.NewPassword); err != nil {
+		if errors.Is(err, services.ErrWrongPassword) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "修改密码失败"})
+		return
+	}
+
+	// 旧的登录已全部失效，为当前设备签发新令牌
+	sessionID, refreshToken, err := services.IssueRefreshToken(userID, c.GetHeader("User-Agent"), c.ClientIP())
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "生成令牌失败"})
+		return
+	}
+	token, err := middleware.GenerateJWT(userID, sessionID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "生成令牌失败"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message":       "密码已修改",
+		"token":         token,
+		"refresh_token": refreshToken,
+		"expires_in":    int(middleware.AccessTokenTTL().Seconds()),
+	})
+}
+
+// UpdateQuota godoc
+// @Summary 设置用户存储配额
+// @Description 为指定用户设置个人存储配额（字节，0表示不限），quota 为空时恢复使用角色配额
+// @Tags 用户管理
+// @Accept json
+// @Produce json
+// @Param id path int true "用户ID"
+// @Param request body models.QuotaUpdateRequest true "配额设置"
+// @Security BearerAuth
+// @Success 200 {object} models.Response
+// @Failure 400,401,403 {object} models.Response
+// @Router /users/{id}/quota [put]
+func (uc *UserController) UpdateQuota(c *gin.Context) {
+	userID, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "无效的用户ID"})
+		return
+	}
+
+	var req models.QuotaUpdateRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "无效的请求数据"})
+		return
+	}
+
+	if err := services.SetUserQuota(uint(userID), req.Quota); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "存储配额已更新"})
+}
+
 // GetRoles godoc
 // @Summary 获取用户角色
 // @Description 获取指定用户的所有角色
@@ -0,0 +1,83 @@
+package controllers
+
+import (
+	"img_hosting/models"
+	"img_hosting/services"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// WatermarkController 水印设置控制器
+type WatermarkController struct{}
+
+func NewWatermarkController() *WatermarkController {
+	return &WatermarkController{}
+}
+
+// GetWatermark godoc
+// @Summary 获取水印设置
+// @Description 获取当前用户的默认水印设置，未单独设置时返回全局设置（is_default 为 true）
+// @Tags 水印设置
+// @Produce json
+// @Security BearerAuth
+// @Success 200 {object} models.Response{data=models.WatermarkSetting}
+// @Failure 401,500 {object} models.Response
+// @Router /users/me/watermark [get]
+func (wc *WatermarkController) GetWatermark(c *gin.Context) {
+	setting, err := services.GetWatermarkSetting(c.GetUint("user_id"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "获取水印设置失败"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"watermark": setting})
+}
+
+// UpdateWatermark godoc
+// @Summary 更新水印设置
+// @Description 设置当前用户上传图片的默认水印，水印有变化时已上传图片的缩略图会在后台重新生成
+// @Tags 水印设置
+// @Accept json
+// @Produce json
+// @Param request body models.WatermarkSettingRequest true "水印设置"
+// @Security BearerAuth
+// @Success 200 {object} models.Response{data=models.WatermarkSetting}
+// @Failure 400,401 {object} models.Response
+// @Router /users/me/watermark [put]
+func (wc *WatermarkController) UpdateWatermark(c *gin.Context) {
+	var req models.WatermarkSettingRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "无效的请求数据"})
+		return
+	}
+
+	setting, err := services.SaveWatermarkSetting(c.GetUint("user_id"), &req)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message":   "水印设置已更新",
+		"watermark": setting,
+	})
+}
+
+// DeleteWatermark godoc
+// @Summary 重置水印设置
+// @Description 删除当前用户的水印设置，恢复使用全局设置，水印有变化时已上传图片的缩略图会在后台重新生成
+// @Tags 水印设置
+// @Produce json
+// @Security BearerAuth
+// @Success 200 {object} models.Response
+// @Failure 401,500 {object} models.Response
+// @Router /users/me/watermark [delete]
+func (wc *WatermarkController) DeleteWatermark(c *gin.Context) {
+	if err := services.DeleteWatermarkSetting(c.GetUint("user_id")); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "重置水印设置失败"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "已恢复使用全局水印设置"})
+}
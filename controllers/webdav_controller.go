@@ -0,0 +1,108 @@
+package controllers
+
+import (
+	"img_hosting/pkg/logger"
+	"img_hosting/services"
+	"net/http"
+	"strings"
+	"sync"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sirupsen/logrus"
+	"golang.org/x/net/webdav"
+)
+
+// webdavPrefix WebDAV 接口的路径前缀
+const webdavPrefix = "/webdav"
+
+// WebDAVController 以 WebDAV 协议访问私人文件，可以在系统中挂载为网络驱动器
+// 使用 API 令牌认证：Basic 认证的密码为令牌（用户名任意），或使用 Authorization: Bearer
+type WebDAVController struct {
+	tokenService *services.TokenService
+
+	mu    sync.Mutex
+	locks map[uint]webdav.LockSystem // 每个用户独立的锁，避免不同用户的相同路径互相影响
+}
+
+func NewWebDAVController() *WebDAVController {
+	return &WebDAVController{
+		tokenService: services.NewTokenService(),
+		locks:        make(map[uint]webdav.LockSystem),
+	}
+}
+
+// Handle godoc
+// @Summary WebDAV 接口
+// @Description 以 WebDAV 协议访问私人文件，支持 PROPFIND、GET、PUT、DELETE、MKCOL、MOVE。使用 Basic 认证，密码为 API 令牌
+// @Tags WebDAV
+// @Param path path string true "文件或目录路径"
+// @Success 200 "文件内容"
+// @Success 201 "已创建"
+// @Success 207 "PROPFIND 结果"
+// @Failure 401 "未认证"
+// @Router /webdav/{path} [get]
+// @Router /webdav/{path} [put]
+// @Router /webdav/{path} [delete]
+func (wc *WebDAVController) Handle(c *gin.Context) {
+	userID, scopes, ok := wc.authenticate(c)
+	if !ok {
+		c.Header("WWW-Authenticate", `Basic realm="img_hosting WebDAV", charset="UTF-8"`)
+		c.String(http.StatusUnauthorized, "需要使用 API 令牌认证")
+		return
+	}
+
+	// 设置了范围的令牌需要 files 范围，只读范围只能浏览和下载
+	if len(scopes) > 0 && !services.TokenScopeAllows(scopes, services.ScopeFiles, c.Request.Method) {
+		c.String(http.StatusForbidden, "令牌范围不足")
+		return
+	}
+
+	handler := &webdav.Handler{
+		Prefix:     webdavPrefix,
+		FileSystem: services.NewWebDAVFileSystem(userID),
+		LockSystem: wc.lockSystem(userID),
+		Logger: func(r *http.Request, err error) {
+			if err != nil {
+				logger.GetLogger().WithError(err).WithFields(logrus.Fields{
+					"user_id": userID,
+					"method":  r.Method,
+					"path":    r.URL.Path,
+				}).Warn("WebDAV 请求失败")
+			}
+		},
+	}
+	handler.ServeHTTP(c.Writer, services.TrackWebDAVUpload(c.Request))
+}
+
+// authenticate 从 Basic 认证的密码或 Bearer 请求头中读取 API 令牌并校验，返回用户ID和令牌范围
+func (wc *WebDAVController) authenticate(c *gin.Context) (uint, []string, bool) {
+	token := ""
+	if _, password, ok := c.Request.BasicAuth(); ok {
+		token = password
+	} else if authHeader := c.GetHeader("Authorization"); len(authHeader) > 7 && strings.EqualFold(authHeader[:7], "Bearer ") {
+		token = strings.TrimSpace(authHeader[7:])
+	}
+	if token == "" {
+		return 0, nil, false
+	}
+
+	user, tokenModel, err := wc.tokenService.Authenticate(token)
+	if err != nil {
+		logger.GetLogger().WithError(err).WithField("path", c.Request.URL.Path).Warn("WebDAV 令牌认证失败")
+		return 0, nil, false
+	}
+	return user.UserID, services.ParseScopes(tokenModel.Scopes), true
+}
+
+// lockSystem 返回用户的锁（保存在内存中，重启后失效）
+func (wc *WebDAVController) lockSystem(userID uint) webdav.LockSystem {
+	wc.mu.Lock()
+	defer wc.mu.Unlock()
+
+	ls, ok := wc.locks[userID]
+	if !ok {
+		ls = webdav.NewMemLS()
+		wc.locks[userID] = ls
+	}
+	return ls
+}
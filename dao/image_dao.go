@@ -8,7 +8,7 @@ import (
 )
 
 // CreateImage 创建新图片记录
-func CreateImage(db *gorm.DB, userID uint, imageURL, imageName, imageExtension, hashImage string, imageSize int64, imageType string) (uint, error) {
+func CreateImage(db *gorm.DB, userID uint, imageURL, imageName, imageExtension, hashImage string, imageSize int64, imageType, description string) (uint, error) {
 	image := models.Image{
 		UserID:        userID,
 		ImageURL:      imageURL,
@@ -17,6 +17,8 @@ func CreateImage(db *gorm.DB, userID uint, imageURL, imageName, imageExtension,
 		HashImage:     hashImage,
 		ImageSize:     imageSize,
 		ImageType:     imageType,
+		Description:   description,
+		Status:        models.ImageStatusProcessing,
 	}
 
 	result := db.Create(&image)
@@ -28,10 +30,67 @@ func CreateImage(db *gorm.DB, userID uint, imageURL, imageName, imageExtension,
 	return image.ImageID, nil
 }
 
+// UpdateImageStatus 更新图片处理状态
+func UpdateImageStatus(db *gorm.DB, imageID uint, status string) error {
+	return db.Model(&models.Image{}).Where("image_id = ?", imageID).Update("status", status).Error
+}
+
+// UpdateImageAnimation 记录动图的帧数和时长
+func UpdateImageAnimation(db *gorm.DB, imageID uint, frameCount, duration int) error {
+	return db.Model(&models.Image{}).Where("image_id = ?", imageID).Updates(map[string]interface{}{
+		"animated":    frameCount > 1,
+		"frame_count": frameCount,
+		"duration":    duration,
+	}).Error
+}
+
+// MarkImageWatermarked 记录原图已加水印
+func MarkImageWatermarked(db *gorm.DB, imageID uint) error {
+	return db.Model(&models.Image{}).Where("image_id = ?", imageID).Update("watermarked", true).Error
+}
+
+// ListImageIDsWithoutWatermarkedOriginal 获取用户原图未加水印的所有图片ID
+func ListImageIDsWithoutWatermarkedOriginal(db *gorm.DB, userID uint) ([]uint, error) {
+	var ids []uint
+	err := db.Model(&models.Image{}).
+		Where("user_id = ? AND watermarked = ?", userID, false).
+		Order("image_id").
+		Pluck("image_id", &ids).Error
+	return ids, err
+}
+
+// UpdateImagePlaceholder 保存图片尺寸、BlurHash 和颜色信息
+func UpdateImagePlaceholder(db *gorm.DB, imageID uint, width, height int, blurHash, averageColor, dominantColor, colorFamily string) error {
+	return db.Model(&models.Image{}).Where("image_id = ?", imageID).Updates(map[string]interface{}{
+		"width":          width,
+		"height":         height,
+		"blur_hash":      blurHash,
+		"average_color":  averageColor,
+		"dominant_color": dominantColor,
+		"color_family":   colorFamily,
+	}).Error
+}
+
+// SetImageDeleteKeyHash 保存图片删除链接密钥的哈希
+func SetImageDeleteKeyHash(db *gorm.DB, imageID uint, deleteKeyHash string) error {
+	return db.Model(&models.Image{}).Where("image_id = ?", imageID).Update("delete_key_hash", deleteKeyHash).Error
+}
+
+// GetImageByDeleteKeyHash 根据删除链接密钥的哈希获取图片
+func GetImageByDeleteKeyHash(db *gorm.DB, deleteKeyHash string) (*models.Image, error) {
+	var image models.Image
+	if err := db.Where("delete_key_hash = ?", deleteKeyHash).First(&image).Error; err != nil {
+		return nil, err
+	}
+	return &image, nil
+}
+
 // GetImageByID 根据ID获取图片
 func GetImageByID(db *gorm.DB, imageID uint) (*models.Image, error) {
 	var image models.Image
-	result := db.Preload("Tags").First(&image, imageID)
+	result := db.Preload("Tags").Preload("Variants", func(db *gorm.DB) *gorm.DB {
+		return db.Order("width ASC")
+	}).First(&image, imageID)
 	if result.Error != nil {
 		return nil, result.Error
 	}
@@ -64,12 +123,17 @@ func GetImagesByUserID(db *gorm.DB, userID uint, page, pageSize int) ([]models.I
 }
 
 // SearchImages 搜索图片
-func SearchImages(db *gorm.DB, userID uint, keyword string, page, pageSize int) ([]models.Image, int64, error) {
+func SearchImages(db *gorm.DB, userID uint, keyword, colorFamily string, page, pageSize int) ([]models.Image, int64, error) {
 	var images []models.Image
 	var total int64
 
 	query := db.Model(&models.Image{}).Where("user_id = ?", userID)
 
+	// 按主色分类筛选
+	if colorFamily != "" {
+		query = query.Where("color_family = ?", colorFamily)
+	}
+
 	// 如果有关键词，添加搜索条件
 	if keyword != "" {
 		query = query.Where("image_name LIKE ? OR description LIKE ?",
@@ -113,7 +177,12 @@ func DeleteImage(db *gorm.DB, imageID, userID uint) error {
 			return err
 		}
 
-		// 3. 删除图片记录
+		// 3. 删除缩略图记录
+		if err := tx.Where("image_id = ?", imageID).Delete(&models.ImageVariant{}).Error; err != nil {
+			return err
+		}
+
+		// 4. 删除图片记录
 		if err := tx.Delete(&image).Error; err != nil {
 			return err
 		}
@@ -137,16 +206,21 @@ func CheckImageExists(db *gorm.DB, hashImage string) (bool, error) {
 }
 
 // ListAllImages 获取所有图片（管理员用）
-func ListAllImages(db *gorm.DB, page, pageSize int) ([]models.Image, int64, error) {
+func ListAllImages(db *gorm.DB, colorFamily string, page, pageSize int) ([]models.Image, int64, error) {
 	var images []models.Image
 	var total int64
 
-	if err := db.Model(&models.Image{}).Count(&total).Error; err != nil {
+	query := db.Model(&models.Image{})
+	if colorFamily != "" {
+		query = query.Where("color_family = ?", colorFamily)
+	}
+
+	if err := query.Count(&total).Error; err != nil {
 		return nil, 0, err
 	}
 
 	offset := (page - 1) * pageSize
-	result := db.Preload("Tags").
+	result := query.Preload("Tags").
 		Offset(offset).
 		Limit(pageSize).
 		Find(&images)
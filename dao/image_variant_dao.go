@@ -0,0 +1,48 @@
+package dao
+
+import (
+	"img_hosting/models"
+
+	"gorm.io/gorm"
+)
+
+// ReplaceImageVariants 用新生成的缩略图记录替换图片原有的记录
+func ReplaceImageVariants(db *gorm.DB, imageID uint, variants []models.ImageVariant) error {
+	return db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("image_id = ?", imageID).Delete(&models.ImageVariant{}).Error; err != nil {
+			return err
+		}
+		if len(variants) == 0 {
+			return nil
+		}
+		for i := range variants {
+			variants[i].ImageID = imageID
+		}
+		return tx.Create(&variants).Error
+	})
+}
+
+// ListImageVariants 获取图片的所有缩略图，按宽度升序
+func ListImageVariants(db *gorm.DB, imageID uint) ([]models.ImageVariant, error) {
+	var variants []models.ImageVariant
+	err := db.Where("image_id = ?", imageID).Order("width ASC").Find(&variants).Error
+	return variants, err
+}
+
+// GetImageVariantByFileName 根据文件名获取缩略图
+func GetImageVariantByFileName(db *gorm.DB, fileName string) (*models.ImageVariant, error) {
+	var variant models.ImageVariant
+	if err := db.Where("file_name = ?", fileName).First(&variant).Error; err != nil {
+		return nil, err
+	}
+	return &variant, nil
+}
+
+// ListImageVariantsByHash 根据图片哈希和宽度获取该尺寸的所有格式
+func ListImageVariantsByHash(db *gorm.DB, hashImage string, width int) ([]models.ImageVariant, error) {
+	var variants []models.ImageVariant
+	err := db.Joins("JOIN images ON images.image_id = image_variants.image_id").
+		Where("images.hash_image = ? AND image_variants.width = ?", hashImage, width).
+		Find(&variants).Error
+	return variants, err
+}
@@ -0,0 +1,111 @@
+package dao
+
+import (
+	"errors"
+	"img_hosting/models"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// CreateJob 创建后台任务
+func CreateJob(db *gorm.DB, job *models.Job) error {
+	return db.Create(job).Error
+}
+
+// GetJobByID 通过ID获取任务
+func GetJobByID(db *gorm.DB, jobID uint) (*models.Job, error) {
+	var job models.Job
+	if err := db.First(&job, jobID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, errors.New("任务不存在")
+		}
+		return nil, err
+	}
+	return &job, nil
+}
+
+// ClaimNextJob 领取一个到期的待执行任务，没有可执行任务时返回 nil
+// 通过带状态条件的更新实现乐观锁，多个 worker 并发领取时只有一个会成功
+func ClaimNextJob(db *gorm.DB, now time.Time) (*models.Job, error) {
+	for i := 0; i < 3; i++ {
+		var job models.Job
+		err := db.Where("status = ? AND run_at <= ?", models.JobStatusPending, now).
+			Order("run_at ASC, id ASC").
+			First(&job).Error
+		if err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return nil, nil
+			}
+			return nil, err
+		}
+
+		result := db.Model(&models.Job{}).
+			Where("id = ? AND status = ?", job.ID, models.JobStatusPending).
+			Updates(map[string]interface{}{
+				"status":    models.JobStatusRunning,
+				"attempts":  gorm.Expr("attempts + ?", 1),
+				"locked_at": now,
+			})
+		if result.Error != nil {
+			return nil, result.Error
+		}
+		if result.RowsAffected == 1 {
+			job.Status = models.JobStatusRunning
+			job.Attempts++
+			job.LockedAt = &now
+			return &job, nil
+		}
+		// 已被其他 worker 领取，重新查找
+	}
+	return nil, nil
+}
+
+// MarkJobDone 标记任务完成
+func MarkJobDone(db *gorm.DB, jobID uint) error {
+	return db.Model(&models.Job{}).
+		Where("id = ?", jobID).
+		Updates(map[string]interface{}{
+			"status":     models.JobStatusDone,
+			"last_error": "",
+		}).Error
+}
+
+// RescheduleJob 任务执行失败后重新排队，在 runAt 之后再次执行
+func RescheduleJob(db *gorm.DB, jobID uint, runAt time.Time, lastError string) error {
+	return db.Model(&models.Job{}).
+		Where("id = ?", jobID).
+		Updates(map[string]interface{}{
+			"status":     models.JobStatusPending,
+			"run_at":     runAt,
+			"last_error": lastError,
+		}).Error
+}
+
+// MarkJobFailed 标记任务最终失败
+func MarkJobFailed(db *gorm.DB, jobID uint, lastError string) error {
+	return db.Model(&models.Job{}).
+		Where("id = ?", jobID).
+		Updates(map[string]interface{}{
+			"status":     models.JobStatusFailed,
+			"last_error": lastError,
+		}).Error
+}
+
+// ResetRunningJobs 把上次进程退出时仍处于执行中的任务恢复为待执行
+func ResetRunningJobs(db *gorm.DB) (int64, error) {
+	result := db.Model(&models.Job{}).
+		Where("status = ?", models.JobStatusRunning).
+		Updates(map[string]interface{}{
+			"status": models.JobStatusPending,
+			"run_at": time.Now(),
+		})
+	return result.RowsAffected, result.Error
+}
+
+// ClearJobPayload 清空任务参数，参数中含有一次性链接等敏感信息时，任务结束后不再保留
+func ClearJobPayload(db *gorm.DB, jobID uint) error {
+	return db.Model(&models.Job{}).
+		Where("id = ?", jobID).
+		Update("payload", "").Error
+}
@@ -0,0 +1,101 @@
+package dao
+
+import (
+	"errors"
+	"img_hosting/models"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// 计入限流的失败结果
+var loginFailureResults = []string{models.LoginResultFailure, models.LoginResultTwoFactorFailure}
+
+// LoginAttemptFilter 登录记录查询条件，零值表示不限
+type LoginAttemptFilter struct {
+	UserID    uint
+	IPAddress string
+	Result    string
+}
+
+// CreateLoginAttempt 保存登录尝试记录
+func CreateLoginAttempt(db *gorm.DB, attempt *models.LoginAttempt) error {
+	return db.Create(attempt).Error
+}
+
+// GetUserLoginFailures 统计账号在 since 之后的登录失败次数和最近一次失败时间
+func GetUserLoginFailures(db *gorm.DB, userID uint, since time.Time) (int64, time.Time, error) {
+	return loginFailureStats(db.Where("user_id = ?", userID), since)
+}
+
+// GetIdentifierLoginFailures 统计不存在的账号（按登录名）在 since 之后的登录失败次数
+func GetIdentifierLoginFailures(db *gorm.DB, identifier string, since time.Time) (int64, time.Time, error) {
+	return loginFailureStats(db.Where("user_id IS NULL AND identifier = ?", identifier), since)
+}
+
+// GetIPLoginFailures 统计 IP 在 since 之后的登录失败次数（所有账号合计）
+func GetIPLoginFailures(db *gorm.DB, ip string, since time.Time) (int64, time.Time, error) {
+	return loginFailureStats(db.Where("ip_address = ?", ip), since)
+}
+
+func loginFailureStats(query *gorm.DB, since time.Time) (int64, time.Time, error) {
+	query = query.Model(&models.LoginAttempt{}).
+		Where("result IN ? AND created_at > ?", loginFailureResults, since)
+
+	var count int64
+	if err := query.Session(&gorm.Session{}).Count(&count).Error; err != nil {
+		return 0, time.Time{}, err
+	}
+	if count == 0 {
+		return 0, time.Time{}, nil
+	}
+	var last models.LoginAttempt
+	if err := query.Order("created_at DESC").Limit(1).Find(&last).Error; err != nil {
+		return 0, time.Time{}, err
+	}
+	return count, last.CreatedAt, nil
+}
+
+// GetLastLoginReset 获取账号最近一次登录成功或解除锁定的时间，失败次数从这之后开始计算
+func GetLastLoginReset(db *gorm.DB, userID uint) (time.Time, error) {
+	var attempt models.LoginAttempt
+	err := db.Where("user_id = ? AND result IN ?", userID, []string{models.LoginResultSuccess, models.LoginResultUnlock}).
+		Order("created_at DESC").
+		Limit(1).
+		Find(&attempt).Error
+	return attempt.CreatedAt, err
+}
+
+// ListLoginAttempts 分页查询登录记录，按时间倒序
+func ListLoginAttempts(db *gorm.DB, filter LoginAttemptFilter, page, pageSize int) ([]models.LoginAttempt, int64, error) {
+	var attempts []models.LoginAttempt
+	var total int64
+
+	query := db.Model(&models.LoginAttempt{})
+	if filter.UserID != 0 {
+		query = query.Where("user_id = ?", filter.UserID)
+	}
+	if filter.IPAddress != "" {
+		query = query.Where("ip_address = ?", filter.IPAddress)
+	}
+	if filter.Result != "" {
+		query = query.Where("result = ?", filter.Result)
+	}
+
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+	err := query.Order("created_at DESC").
+		Offset((page - 1) * pageSize).
+		Limit(pageSize).
+		Find(&attempts).Error
+	if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, 0, err
+	}
+	return attempts, total, nil
+}
+
+// DeleteLoginAttemptsBefore 删除 before 之前的登录记录
+func DeleteLoginAttemptsBefore(db *gorm.DB, before time.Time) error {
+	return db.Where("created_at < ?", before).Delete(&models.LoginAttempt{}).Error
+}
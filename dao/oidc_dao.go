@@ -0,0 +1,81 @@
+package dao
+
+import (
+	"errors"
+	"img_hosting/models"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// CreateOIDCAuthRequest 保存跳转到身份提供方之前的登录请求
+func CreateOIDCAuthRequest(db *gorm.DB, req *models.OIDCAuthRequest) error {
+	return db.Create(req).Error
+}
+
+// TakeOIDCAuthRequest 按 state 哈希取出登录请求并删除，每个 state 只能使用一次；不存在时返回 nil
+func TakeOIDCAuthRequest(db *gorm.DB, stateHash string) (*models.OIDCAuthRequest, error) {
+	var req models.OIDCAuthRequest
+	err := db.Where("state = ?", stateHash).First(&req).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	// 并发的回调请求只有一个能删除成功
+	result := db.Where("state = ?", stateHash).Delete(&models.OIDCAuthRequest{})
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	if result.RowsAffected != 1 {
+		return nil, nil
+	}
+	return &req, nil
+}
+
+// DeleteExpiredOIDCAuthRequests 删除已过期、没有完成的登录请求
+func DeleteExpiredOIDCAuthRequests(db *gorm.DB, now time.Time) error {
+	return db.Where("expires_at < ?", now).Delete(&models.OIDCAuthRequest{}).Error
+}
+
+// GetUserIdentity 按身份提供方和 sub 获取关联的外部身份，不存在时返回 nil
+func GetUserIdentity(db *gorm.DB, provider, subject string) (*models.UserIdentity, error) {
+	var identity models.UserIdentity
+	err := db.Where("provider = ? AND subject = ?", provider, subject).First(&identity).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &identity, nil
+}
+
+// CreateUserIdentity 关联外部身份
+func CreateUserIdentity(db *gorm.DB, identity *models.UserIdentity) error {
+	return db.Create(identity).Error
+}
+
+// TouchUserIdentity 更新外部身份的邮箱和最近登录时间
+func TouchUserIdentity(db *gorm.DB, id uint, email string) error {
+	return db.Model(&models.UserIdentity{}).
+		Where("id = ?", id).
+		Updates(map[string]interface{}{
+			"email":         email,
+			"last_login_at": time.Now(),
+		}).Error
+}
+
+// DeleteUserIdentity 删除外部身份的关联
+func DeleteUserIdentity(db *gorm.DB, id uint) error {
+	return db.Delete(&models.UserIdentity{}, id).Error
+}
+
+// ListUserIdentities 获取用户关联的所有外部身份
+func ListUserIdentities(db *gorm.DB, userID uint) ([]models.UserIdentity, error) {
+	var identities []models.UserIdentity
+	err := db.Where("user_id = ?", userID).Order("id").Find(&identities).Error
+	return identities, err
+}
@@ -3,6 +3,7 @@ package dao
 import (
 	"errors"
 	"img_hosting/models"
+	"unicode/utf8"
 
 	"gorm.io/gorm"
 )
@@ -111,3 +112,94 @@ func SearchPrivateFiles(db *gorm.DB, userID uint, keyword string, page, pageSize
 
 	return files, total, err
 }
+
+// GetActivePrivateFile 通过ID获取正常状态的私人文件（不校验所属用户，供分享链接使用）
+func GetActivePrivateFile(db *gorm.DB, fileID uint) (*models.PrivateFile, error) {
+	var file models.PrivateFile
+	err := db.Where("id = ? AND status = ?", fileID, models.FileStatusActive).First(&file).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, errors.New("文件不存在")
+		}
+		return nil, err
+	}
+	return &file, nil
+}
+
+// GetPrivateFileByStatus 通过ID和状态获取私人文件（不校验所属用户，供管理员使用）
+func GetPrivateFileByStatus(db *gorm.DB, fileID uint, status string) (*models.PrivateFile, error) {
+	var file models.PrivateFile
+	err := db.Where("id = ? AND status = ?", fileID, status).First(&file).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, errors.New("文件不存在")
+		}
+		return nil, err
+	}
+	return &file, nil
+}
+
+// ListPrivateFilesByStatus 按状态分页获取所有用户的私人文件
+func ListPrivateFilesByStatus(db *gorm.DB, status string, page, pageSize int) ([]models.PrivateFile, int64, error) {
+	var files []models.PrivateFile
+	var total int64
+
+	query := db.Model(&models.PrivateFile{}).Where("status = ?", status)
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+
+	offset := (page - 1) * pageSize
+	err := query.Order("created_at DESC").
+		Offset(offset).
+		Limit(pageSize).
+		Find(&files).Error
+
+	return files, total, err
+}
+
+// UpdatePrivateFileScan 更新私人文件的扫描状态和存储位置
+func UpdatePrivateFileScan(db *gorm.DB, file *models.PrivateFile) error {
+	return db.Model(file).Updates(map[string]interface{}{
+		"status":       file.Status,
+		"scan_status":  file.ScanStatus,
+		"scan_result":  file.ScanResult,
+		"scanned_at":   file.ScannedAt,
+		"storage_path": file.StoragePath,
+	}).Error
+}
+
+// GetLatestPrivateFileByKeyPrefix 获取对象键以 prefix 开头的正常状态文件中最近修改的一个，
+// 用于判断隐含的目录是否存在；prefix 为空时匹配所有文件，没有时返回 nil
+func GetLatestPrivateFileByKeyPrefix(db *gorm.DB, userID uint, prefix string) (*models.PrivateFile, error) {
+	var file models.PrivateFile
+	query := db.Where("user_id = ? AND status = ?", userID, models.FileStatusActive)
+	if prefix != "" {
+		query = query.Where("SUBSTR(object_key, 1, ?) = ?", utf8.RuneCountInString(prefix), prefix)
+	}
+	err := query.Order("updated_at DESC").First(&file).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &file, nil
+}
+
+// ListPrivateFilesByKeyPrefix 获取对象键以 prefix 开头的正常状态文件
+func ListPrivateFilesByKeyPrefix(db *gorm.DB, userID uint, prefix string) ([]models.PrivateFile, error) {
+	var files []models.PrivateFile
+	err := db.Where("user_id = ? AND status = ?", userID, models.FileStatusActive).
+		Where("SUBSTR(object_key, 1, ?) = ?", utf8.RuneCountInString(prefix), prefix).
+		Find(&files).Error
+	return files, err
+}
+
+// RenamePrivateFileObject 修改私人文件的对象键和文件名
+func RenamePrivateFileObject(db *gorm.DB, fileID uint, key, fileName string) error {
+	return db.Model(&models.PrivateFile{}).Where("id = ?", fileID).Updates(map[string]interface{}{
+		"object_key": key,
+		"file_name":  fileName,
+	}).Error
+}
@@ -0,0 +1,57 @@
+package dao
+
+import (
+	"errors"
+	"img_hosting/models"
+	"unicode/utf8"
+
+	"gorm.io/gorm"
+)
+
+// CreatePrivateFolder 创建目录记录
+func CreatePrivateFolder(db *gorm.DB, folder *models.PrivateFolder) error {
+	return db.Create(folder).Error
+}
+
+// GetPrivateFolder 获取用户创建的目录，不存在时返回 nil
+func GetPrivateFolder(db *gorm.DB, userID uint, folderPath string) (*models.PrivateFolder, error) {
+	var folder models.PrivateFolder
+	err := db.Where("user_id = ? AND path = ?", userID, folderPath).First(&folder).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &folder, nil
+}
+
+// ListUserPrivateFolders 获取用户创建的所有目录
+func ListUserPrivateFolders(db *gorm.DB, userID uint) ([]models.PrivateFolder, error) {
+	var folders []models.PrivateFolder
+	err := db.Where("user_id = ?", userID).Find(&folders).Error
+	return folders, err
+}
+
+// ListPrivateFolderTree 获取目录本身及其下的所有子目录
+func ListPrivateFolderTree(db *gorm.DB, userID uint, folderPath string) ([]models.PrivateFolder, error) {
+	var folders []models.PrivateFolder
+	prefix := folderPath + "/"
+	err := db.Where("user_id = ?", userID).
+		Where("path = ? OR SUBSTR(path, 1, ?) = ?", folderPath, utf8.RuneCountInString(prefix), prefix).
+		Find(&folders).Error
+	return folders, err
+}
+
+// UpdatePrivateFolderPath 修改目录路径
+func UpdatePrivateFolderPath(db *gorm.DB, folderID uint, folderPath string) error {
+	return db.Model(&models.PrivateFolder{}).Where("id = ?", folderID).Update("path", folderPath).Error
+}
+
+// DeletePrivateFolderTree 删除目录本身及其下的所有子目录记录
+func DeletePrivateFolderTree(db *gorm.DB, userID uint, folderPath string) error {
+	prefix := folderPath + "/"
+	return db.Where("user_id = ?", userID).
+		Where("path = ? OR SUBSTR(path, 1, ?) = ?", folderPath, utf8.RuneCountInString(prefix), prefix).
+		Delete(&models.PrivateFolder{}).Error
+}
@@ -0,0 +1,34 @@
+package dao
+
+import (
+	"img_hosting/models"
+
+	"gorm.io/gorm"
+)
+
+// SumImageUsage 统计用户图片的数量和总大小
+func SumImageUsage(db *gorm.DB, userID uint) (models.UsageBreakdown, error) {
+	var usage models.UsageBreakdown
+	err := db.Model(&models.Image{}).
+		Select("COUNT(*) AS count, COALESCE(SUM(image_size), 0) AS bytes").
+		Where("user_id = ?", userID).
+		Scan(&usage).Error
+	return usage, err
+}
+
+// SumPrivateFileUsage 统计用户私人文件的数量和总大小（含隔离区文件）
+func SumPrivateFileUsage(db *gorm.DB, userID uint) (models.UsageBreakdown, error) {
+	var usage models.UsageBreakdown
+	err := db.Model(&models.PrivateFile{}).
+		Select("COUNT(*) AS count, COALESCE(SUM(file_size), 0) AS bytes").
+		Where("user_id = ?", userID).
+		Scan(&usage).Error
+	return usage, err
+}
+
+// UpdateUserQuota 更新用户的个人存储配额，quota 为 nil 时恢复使用角色配额
+func UpdateUserQuota(db *gorm.DB, userID uint, quota *int64) error {
+	return db.Model(&models.UserInfo{}).
+		Where("user_id = ?", userID).
+		Update("storage_quota", quota).Error
+}
@@ -0,0 +1,26 @@
+package dao
+
+import (
+	"img_hosting/models"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// CreateRevokedToken 记录已撤销的访问令牌，重复撤销时不做处理
+func CreateRevokedToken(db *gorm.DB, revoked *models.RevokedToken) error {
+	return db.Clauses(clause.OnConflict{DoNothing: true}).Create(revoked).Error
+}
+
+// IsTokenRevoked 判断访问令牌是否已被撤销
+func IsTokenRevoked(db *gorm.DB, jti string) (bool, error) {
+	var count int64
+	err := db.Model(&models.RevokedToken{}).Where("jti = ?", jti).Count(&count).Error
+	return count > 0, err
+}
+
+// CleanExpiredRevokedTokens 删除已过期令牌的撤销记录，过期的令牌本身已无法通过验证
+func CleanExpiredRevokedTokens(db *gorm.DB) error {
+	return db.Where("expires_at < ?", time.Now()).Delete(&models.RevokedToken{}).Error
+}
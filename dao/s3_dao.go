@@ -0,0 +1,75 @@
+package dao
+
+import (
+	"errors"
+	"img_hosting/models"
+
+	"gorm.io/gorm"
+)
+
+// ListUserImageObjects 获取用户的所有图片，用于 S3 接口列出对象
+func ListUserImageObjects(db *gorm.DB, userID uint) ([]models.Image, error) {
+	var images []models.Image
+	err := db.Where("user_id = ?", userID).Find(&images).Error
+	return images, err
+}
+
+// GetImageObject 按对象键获取用户的图片；没有设置对象键的图片使用 哈希+扩展名 作为对象键
+// hash 和 ext 为对象键按 哈希+扩展名 解析出的值，不符合该格式时传空字符串
+// 找不到时返回 nil
+func GetImageObject(db *gorm.DB, userID uint, key, hash, ext string) (*models.Image, error) {
+	var image models.Image
+	query := db.Where("user_id = ? AND object_key = ?", userID, key)
+	if hash != "" {
+		query = db.Where("user_id = ?", userID).Where(
+			db.Where("object_key = ?", key).
+				Or("(object_key = '' OR object_key IS NULL) AND hash_image = ? AND imageextenion = ?", hash, ext),
+		)
+	}
+	err := query.First(&image).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &image, nil
+}
+
+// SetImageObjectKey 保存图片的 S3 对象键
+func SetImageObjectKey(db *gorm.DB, imageID uint, key string) error {
+	return db.Model(&models.Image{}).Where("image_id = ?", imageID).Update("object_key", key).Error
+}
+
+// ListUserPrivateFileObjects 获取用户的所有正常状态的私人文件，用于 S3 接口列出对象
+func ListUserPrivateFileObjects(db *gorm.DB, userID uint) ([]models.PrivateFile, error) {
+	var files []models.PrivateFile
+	err := db.Where("user_id = ? AND status = ?", userID, models.FileStatusActive).Find(&files).Error
+	return files, err
+}
+
+// GetPrivateFileObject 按对象键获取用户的私人文件，规则与 GetImageObject 相同
+// 扩展名保存在文件名中，所以 哈希+扩展名 只按哈希匹配后再由调用方核对扩展名
+func GetPrivateFileObject(db *gorm.DB, userID uint, key, hash string) (*models.PrivateFile, error) {
+	var file models.PrivateFile
+	query := db.Where("user_id = ? AND status = ? AND object_key = ?", userID, models.FileStatusActive, key)
+	if hash != "" {
+		query = db.Where("user_id = ? AND status = ?", userID, models.FileStatusActive).Where(
+			db.Where("object_key = ?", key).
+				Or("(object_key = '' OR object_key IS NULL) AND file_hash = ?", hash),
+		)
+	}
+	err := query.First(&file).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &file, nil
+}
+
+// SetPrivateFileObjectKey 保存私人文件的 S3 对象键
+func SetPrivateFileObjectKey(db *gorm.DB, fileID uint, key string) error {
+	return db.Model(&models.PrivateFile{}).Where("id = ?", fileID).Update("object_key", key).Error
+}
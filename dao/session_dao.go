@@ -0,0 +1,78 @@
+package dao
+
+import (
+	"errors"
+	"img_hosting/models"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// CreateSession 创建登录会话
+func CreateSession(db *gorm.DB, session *models.Session) error {
+	return db.Create(session).Error
+}
+
+// GetSession 获取会话，不存在时返回 nil
+func GetSession(db *gorm.DB, sessionID string) (*models.Session, error) {
+	var session models.Session
+	err := db.Where("id = ?", sessionID).First(&session).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &session, nil
+}
+
+// ListActiveSessions 获取用户未撤销且未过期的会话，最近使用的在前
+func ListActiveSessions(db *gorm.DB, userID uint, now time.Time) ([]models.Session, error) {
+	var sessions []models.Session
+	err := db.Where("user_id = ? AND revoked_at IS NULL AND expires_at > ?", userID, now).
+		Order("last_used_at DESC").
+		Find(&sessions).Error
+	return sessions, err
+}
+
+// TouchSession 更新会话的最近使用时间和 IP，expiresAt 不为零时同时延长过期时间
+func TouchSession(db *gorm.DB, sessionID, ip string, usedAt, expiresAt time.Time) error {
+	updates := map[string]interface{}{
+		"last_used_at": usedAt,
+		"last_ip":      ip,
+	}
+	if !expiresAt.IsZero() {
+		updates["expires_at"] = expiresAt
+	}
+	return db.Model(&models.Session{}).
+		Where("id = ? AND revoked_at IS NULL", sessionID).
+		Updates(updates).Error
+}
+
+// RevokeSession 撤销会话，返回是否撤销成功（会话不存在或已撤销时为 false）
+func RevokeSession(db *gorm.DB, sessionID string) (bool, error) {
+	result := db.Model(&models.Session{}).
+		Where("id = ? AND revoked_at IS NULL", sessionID).
+		Update("revoked_at", time.Now())
+	return result.RowsAffected == 1, result.Error
+}
+
+// RevokeUserSessionsExcept 撤销用户除 exceptID 之外的所有会话，返回被撤销的会话 ID
+func RevokeUserSessionsExcept(db *gorm.DB, userID uint, exceptID string) ([]string, error) {
+	var ids []string
+	err := db.Model(&models.Session{}).
+		Where("user_id = ? AND revoked_at IS NULL AND id <> ?", userID, exceptID).
+		Pluck("id", &ids).Error
+	if err != nil || len(ids) == 0 {
+		return ids, err
+	}
+	err = db.Model(&models.Session{}).
+		Where("id IN ? AND revoked_at IS NULL", ids).
+		Update("revoked_at", time.Now()).Error
+	return ids, err
+}
+
+// DeleteExpiredSessions 删除过期时间早于 before 的会话
+func DeleteExpiredSessions(db *gorm.DB, before time.Time) error {
+	return db.Where("expires_at < ?", before).Delete(&models.Session{}).Error
+}
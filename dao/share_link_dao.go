@@ -0,0 +1,120 @@
+package dao
+
+import (
+	"errors"
+	"img_hosting/models"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// CreateShareLink 创建分享链接
+func CreateShareLink(db *gorm.DB, link *models.ShareLink) error {
+	return db.Create(link).Error
+}
+
+// GetShareLinkBySlug 通过短链标识获取分享链接
+func GetShareLinkBySlug(db *gorm.DB, slug string) (*models.ShareLink, error) {
+	var link models.ShareLink
+	err := db.Where("slug = ?", slug).First(&link).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, errors.New("分享链接不存在")
+		}
+		return nil, err
+	}
+	return &link, nil
+}
+
+// GetShareLinkByID 通过ID获取用户的分享链接
+func GetShareLinkByID(db *gorm.DB, linkID, userID uint) (*models.ShareLink, error) {
+	var link models.ShareLink
+	err := db.Where("id = ? AND user_id = ?", linkID, userID).First(&link).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, errors.New("分享链接不存在或无权访问")
+		}
+		return nil, err
+	}
+	return &link, nil
+}
+
+// ListShareLinks 获取用户的分享链接，fileID 为 0 时返回全部
+func ListShareLinks(db *gorm.DB, userID, fileID uint) ([]models.ShareLink, error) {
+	var links []models.ShareLink
+	query := db.Where("user_id = ?", userID)
+	if fileID != 0 {
+		query = query.Where("file_id = ?", fileID)
+	}
+	err := query.Order("created_at DESC").Find(&links).Error
+	return links, err
+}
+
+// RevokeShareLink 撤销分享链接
+func RevokeShareLink(db *gorm.DB, linkID, userID uint) error {
+	result := db.Model(&models.ShareLink{}).
+		Where("id = ? AND user_id = ?", linkID, userID).
+		Update("status", models.ShareLinkStatusRevoked)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return errors.New("分享链接不存在或无权操作")
+	}
+	return nil
+}
+
+// IncrementShareDownloadCount 在未超过下载上限时增加下载次数，返回是否成功占用一次下载
+func IncrementShareDownloadCount(db *gorm.DB, linkID uint) (bool, error) {
+	result := db.Model(&models.ShareLink{}).
+		Where("id = ? AND (max_downloads = 0 OR download_count < max_downloads)", linkID).
+		UpdateColumn("download_count", gorm.Expr("download_count + ?", 1))
+	if result.Error != nil {
+		return false, result.Error
+	}
+	return result.RowsAffected > 0, nil
+}
+
+// CreateShareAccessLog 记录分享链接访问
+func CreateShareAccessLog(db *gorm.DB, log *models.ShareAccessLog) error {
+	return db.Create(log).Error
+}
+
+// GetSharePasswordFailures 统计 IP 在 since 之后访问分享链接时密码错误的次数和最近一次的时间
+// 该 IP 访问成功后重新计数
+func GetSharePasswordFailures(db *gorm.DB, linkID uint, ip string, since time.Time) (int64, time.Time, error) {
+	query := db.Model(&models.ShareAccessLog{}).Where("share_link_id = ? AND ip_address = ?", linkID, ip)
+
+	var success models.ShareAccessLog
+	if err := query.Session(&gorm.Session{}).Where("result = ?", models.ShareAccessSuccess).
+		Order("created_at DESC").Limit(1).Find(&success).Error; err != nil {
+		return 0, time.Time{}, err
+	}
+	if success.CreatedAt.After(since) {
+		since = success.CreatedAt
+	}
+
+	query = query.Where("result = ? AND created_at > ?", models.ShareAccessBadPassword, since)
+	var count int64
+	if err := query.Session(&gorm.Session{}).Count(&count).Error; err != nil {
+		return 0, time.Time{}, err
+	}
+	if count == 0 {
+		return 0, time.Time{}, nil
+	}
+	var last models.ShareAccessLog
+	if err := query.Order("created_at DESC").Limit(1).Find(&last).Error; err != nil {
+		return 0, time.Time{}, err
+	}
+	return count, last.CreatedAt, nil
+}
+
+// ListShareAccessLogs 获取分享链接的访问记录
+func ListShareAccessLogs(db *gorm.DB, linkID uint, limit int) ([]models.ShareAccessLog, error) {
+	var logs []models.ShareAccessLog
+	err := db.Where("share_link_id = ?", linkID).
+		Order("created_at DESC").
+		Limit(limit).
+		Find(&logs).Error
+	return logs, err
+}
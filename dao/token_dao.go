@@ -8,15 +8,18 @@ import (
 )
 
 // CreateToken 创建新的 token
-func CreateToken(db *gorm.DB, token string, userID uint, expiresAt time.Time, deviceID, ipAddress string) error {
+func CreateToken(db *gorm.DB, token string, userID uint, expiresAt time.Time, deviceID, ipAddress, accessKeyID, scopes string) error {
 	tokenModel := models.Token{
-		Token:      token,
-		UserID:     userID,
-		ExpiresAt:  expiresAt,
-		DeviceID:   deviceID,
-		IPAddress:  ipAddress,
-		Status:     "active",
-		LastUsedAt: time.Now(),
+		Token:       token,
+		UserID:      userID,
+		ExpiresAt:   expiresAt,
+		DeviceID:    deviceID,
+		IPAddress:   ipAddress,
+		Status:      "active",
+		LastUsedAt:  time.Now(),
+		AccessKeyID: accessKeyID,
+		TokenType:   models.TokenTypeAPI,
+		Scopes:      scopes,
 	}
 	return db.Create(&tokenModel).Error
 }
@@ -24,17 +27,34 @@ func CreateToken(db *gorm.DB, token string, userID uint, expiresAt time.Time, de
 // GetTokenByString 通过 token 字符串获取 token
 func GetTokenByString(db *gorm.DB, token string) (*models.Token, error) {
 	var tokenModel models.Token
-	err := db.Where("token = ? AND status = ?", token, "active").First(&tokenModel).Error
+	err := db.Where("token = ? AND status = ? AND token_type = ?", token, "active", models.TokenTypeAPI).First(&tokenModel).Error
 	if err != nil {
 		return nil, err
 	}
 	return &tokenModel, nil
 }
 
-// ListUserTokens 获取用户的所有 token
+// GetTokenByAccessKey 通过 S3 访问密钥 ID 获取有效的 token
+func GetTokenByAccessKey(db *gorm.DB, accessKeyID string) (*models.Token, error) {
+	var tokenModel models.Token
+	err := db.Where("access_key_id = ? AND status = ? AND token_type = ?", accessKeyID, "active", models.TokenTypeAPI).First(&tokenModel).Error
+	if err != nil {
+		return nil, err
+	}
+	return &tokenModel, nil
+}
+
+// SetTokenAccessKey 为 token 设置 S3 访问密钥 ID
+func SetTokenAccessKey(db *gorm.DB, token, accessKeyID string) error {
+	return db.Model(&models.Token{}).
+		Where("token = ?", token).
+		Update("access_key_id", accessKeyID).Error
+}
+
+// ListUserTokens 获取用户的所有 API token（不包括刷新令牌）
 func ListUserTokens(db *gorm.DB, userID uint) ([]models.Token, error) {
 	var tokens []models.Token
-	err := db.Where("user_id = ?", userID).Find(&tokens).Error
+	err := db.Where("user_id = ? AND token_type = ?", userID, models.TokenTypeAPI).Find(&tokens).Error
 	return tokens, err
 }
 
@@ -58,3 +78,129 @@ func CleanExpiredTokens(db *gorm.DB) error {
 		Or("status = ?", "expired").
 		Delete(&models.Token{}).Error
 }
+
+// CreateRefreshToken 保存刷新令牌，token.Token 为令牌的哈希
+func CreateRefreshToken(db *gorm.DB, token *models.Token) error {
+	token.TokenType = models.TokenTypeRefresh
+	return db.Create(token).Error
+}
+
+// GetRefreshToken 通过哈希获取刷新令牌（任意状态）
+func GetRefreshToken(db *gorm.DB, tokenHash string) (*models.Token, error) {
+	var tokenModel models.Token
+	err := db.Where("token = ? AND token_type = ?", tokenHash, models.TokenTypeRefresh).First(&tokenModel).Error
+	if err != nil {
+		return nil, err
+	}
+	return &tokenModel, nil
+}
+
+// MarkRefreshTokenRotated 把有效的刷新令牌标记为已轮换，返回是否成功
+// 令牌已被并发请求轮换时返回 false
+func MarkRefreshTokenRotated(db *gorm.DB, tokenHash string) (bool, error) {
+	result := db.Model(&models.Token{}).
+		Where("token = ? AND token_type = ? AND status = ?", tokenHash, models.TokenTypeRefresh, models.TokenStatusActive).
+		Updates(map[string]interface{}{
+			"status":       models.TokenStatusRotated,
+			"last_used_at": time.Now(),
+		})
+	return result.RowsAffected == 1, result.Error
+}
+
+// CreateChallengeToken 保存登录的两步验证凭证，token.Token 为凭证的哈希
+func CreateChallengeToken(db *gorm.DB, token *models.Token) error {
+	token.TokenType = models.TokenTypeChallenge
+	return db.Create(token).Error
+}
+
+// GetChallengeToken 通过哈希获取有效的两步验证凭证
+func GetChallengeToken(db *gorm.DB, tokenHash string) (*models.Token, error) {
+	var tokenModel models.Token
+	err := db.Where("token = ? AND token_type = ? AND status = ?", tokenHash, models.TokenTypeChallenge, models.TokenStatusActive).
+		First(&tokenModel).Error
+	if err != nil {
+		return nil, err
+	}
+	return &tokenModel, nil
+}
+
+// IncrementTokenAttempts 记录一次两步验证失败，失败次数达到 maxAttempts 时凭证失效
+func IncrementTokenAttempts(db *gorm.DB, tokenHash string, maxAttempts int) error {
+	return db.Model(&models.Token{}).
+		Where("token = ?", tokenHash).
+		Updates(map[string]interface{}{
+			"attempts": gorm.Expr("attempts + 1"),
+			"status":   gorm.Expr("CASE WHEN attempts + 1 >= ? THEN ? ELSE status END", maxAttempts, models.TokenStatusRevoked),
+		}).Error
+}
+
+// ConsumeChallengeToken 两步验证通过后使凭证失效，返回是否成功（并发请求只有一个能成功）
+func ConsumeChallengeToken(db *gorm.DB, tokenHash string) (bool, error) {
+	result := db.Model(&models.Token{}).
+		Where("token = ? AND token_type = ? AND status = ?", tokenHash, models.TokenTypeChallenge, models.TokenStatusActive).
+		Updates(map[string]interface{}{
+			"status":       models.TokenStatusInactive,
+			"last_used_at": time.Now(),
+		})
+	return result.RowsAffected == 1, result.Error
+}
+
+// RevokeUserRefreshTokens 撤销用户所有登录的刷新令牌
+func RevokeUserRefreshTokens(db *gorm.DB, userID uint) error {
+	return db.Model(&models.Token{}).
+		Where("user_id = ? AND token_type = ? AND status = ?", userID, models.TokenTypeRefresh, models.TokenStatusActive).
+		Update("status", models.TokenStatusRevoked).Error
+}
+
+// RevokeTokenFamily 撤销同一次登录轮换出的所有刷新令牌
+func RevokeTokenFamily(db *gorm.DB, familyID string) error {
+	return db.Model(&models.Token{}).
+		Where("family_id = ? AND token_type = ?", familyID, models.TokenTypeRefresh).
+		Update("status", models.TokenStatusRevoked).Error
+}
+
+// CreateOneTimeToken 保存邮件链接中的一次性令牌，token.Token 为令牌的哈希
+func CreateOneTimeToken(db *gorm.DB, token *models.Token, tokenType string) error {
+	token.TokenType = tokenType
+	return db.Create(token).Error
+}
+
+// GetOneTimeToken 通过哈希获取未使用的一次性令牌
+func GetOneTimeToken(db *gorm.DB, tokenHash, tokenType string) (*models.Token, error) {
+	var tokenModel models.Token
+	err := db.Where("token = ? AND token_type = ? AND status = ?", tokenHash, tokenType, models.TokenStatusActive).
+		First(&tokenModel).Error
+	if err != nil {
+		return nil, err
+	}
+	return &tokenModel, nil
+}
+
+// ConsumeOneTimeToken 使用一次性令牌，返回是否成功（并发请求只有一个能成功）
+func ConsumeOneTimeToken(db *gorm.DB, tokenHash, tokenType string) (bool, error) {
+	result := db.Model(&models.Token{}).
+		Where("token = ? AND token_type = ? AND status = ?", tokenHash, tokenType, models.TokenStatusActive).
+		Updates(map[string]interface{}{
+			"status":       models.TokenStatusInactive,
+			"last_used_at": time.Now(),
+		})
+	return result.RowsAffected == 1, result.Error
+}
+
+// RevokeUserTokensByType 撤销用户某一类型的所有令牌，如重新发送验证邮件后旧链接失效
+func RevokeUserTokensByType(db *gorm.DB, userID uint, tokenType string) error {
+	return db.Model(&models.Token{}).
+		Where("user_id = ? AND token_type = ? AND status = ?", userID, tokenType, models.TokenStatusActive).
+		Update("status", models.TokenStatusRevoked).Error
+}
+
+// GetLatestTokenCreatedAt 获取用户最近一次创建某类型令牌的时间，没有时返回零值
+func GetLatestTokenCreatedAt(db *gorm.DB, userID uint, tokenType string) (time.Time, error) {
+	var tokenModel models.Token
+	err := db.Select("created_at").
+		Where("user_id = ? AND token_type = ?", userID, tokenType).
+		Order("created_at DESC").
+		Limit(1).
+		Find(&tokenModel).Error
+	return tokenModel.CreatedAt, err
+}
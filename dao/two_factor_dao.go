@@ -0,0 +1,87 @@
+package dao
+
+import (
+	"errors"
+	"img_hosting/models"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// GetUserTOTP 获取用户的 TOTP 设置，不存在时返回 nil
+func GetUserTOTP(db *gorm.DB, userID uint) (*models.UserTOTP, error) {
+	var totp models.UserTOTP
+	err := db.Where("user_id = ?", userID).First(&totp).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &totp, nil
+}
+
+// SaveUserTOTP 保存 TOTP 设置，已存在时覆盖
+func SaveUserTOTP(db *gorm.DB, totp *models.UserTOTP) error {
+	return db.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "user_id"}},
+		DoUpdates: clause.AssignmentColumns([]string{"secret", "enabled", "last_used_step", "updated_at"}),
+	}).Create(totp).Error
+}
+
+// UseTOTPStep 记录已使用的验证码时间步，时间步不大于上次使用的时间步时返回 false（防止验证码被重放）
+func UseTOTPStep(db *gorm.DB, userID uint, step int64) (bool, error) {
+	result := db.Model(&models.UserTOTP{}).
+		Where("user_id = ? AND last_used_step < ?", userID, step).
+		Update("last_used_step", step)
+	return result.RowsAffected == 1, result.Error
+}
+
+// EnableUserTOTP 启用 TOTP
+func EnableUserTOTP(db *gorm.DB, userID uint) error {
+	return db.Model(&models.UserTOTP{}).
+		Where("user_id = ?", userID).
+		Update("enabled", true).Error
+}
+
+// DeleteUserTOTP 删除用户的 TOTP 设置和恢复码
+func DeleteUserTOTP(db *gorm.DB, userID uint) error {
+	return db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("user_id = ?", userID).Delete(&models.RecoveryCode{}).Error; err != nil {
+			return err
+		}
+		return tx.Where("user_id = ?", userID).Delete(&models.UserTOTP{}).Error
+	})
+}
+
+// ReplaceRecoveryCodes 用新的恢复码替换用户的所有恢复码
+func ReplaceRecoveryCodes(db *gorm.DB, userID uint, codeHashes []string) error {
+	return db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("user_id = ?", userID).Delete(&models.RecoveryCode{}).Error; err != nil {
+			return err
+		}
+		codes := make([]models.RecoveryCode, 0, len(codeHashes))
+		for _, hash := range codeHashes {
+			codes = append(codes, models.RecoveryCode{UserID: userID, CodeHash: hash})
+		}
+		return tx.Create(&codes).Error
+	})
+}
+
+// UseRecoveryCode 使用一个未使用的恢复码，恢复码不存在或已使用时返回 false
+func UseRecoveryCode(db *gorm.DB, userID uint, codeHash string) (bool, error) {
+	result := db.Model(&models.RecoveryCode{}).
+		Where("user_id = ? AND code_hash = ? AND used_at IS NULL", userID, codeHash).
+		Update("used_at", time.Now())
+	return result.RowsAffected == 1, result.Error
+}
+
+// CountUnusedRecoveryCodes 统计剩余可用的恢复码数量
+func CountUnusedRecoveryCodes(db *gorm.DB, userID uint) (int64, error) {
+	var count int64
+	err := db.Model(&models.RecoveryCode{}).
+		Where("user_id = ? AND used_at IS NULL", userID).
+		Count(&count).Error
+	return count, err
+}
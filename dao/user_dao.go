@@ -72,6 +72,20 @@ func UpdateUserStatus(db *gorm.DB, userID uint, status string) error {
 		Update("status", status).Error
 }
 
+// UpdateUserPassword 更新用户密码哈希
+func UpdateUserPassword(db *gorm.DB, userID uint, passwordHash string) error {
+	return db.Model(&models.UserInfo{}).
+		Where("user_id = ?", userID).
+		Update("psd", passwordHash).Error
+}
+
+// UpdateTokensValidAfter 使用户在 validAfter 之前签发的登录令牌失效
+func UpdateTokensValidAfter(db *gorm.DB, userID uint, validAfter time.Time) error {
+	return db.Model(&models.UserInfo{}).
+		Where("user_id = ?", userID).
+		Update("tokens_valid_after", validAfter).Error
+}
+
 // DeleteUser 删除用户及其关联数据
 func DeleteUser(db *gorm.DB, userID uint) error {
 	return db.Transaction(func(tx *gorm.DB) error {
@@ -146,6 +160,15 @@ func AssignRoleToUser(db *gorm.DB, userID uint, roleID uint) error {
 		userID, roleID).Error
 }
 
+// GetRoleByName 按名称获取角色
+func GetRoleByName(db *gorm.DB, roleName string) (*models.Roles, error) {
+	var role models.Roles
+	if err := db.Where("role_name = ?", roleName).First(&role).Error; err != nil {
+		return nil, err
+	}
+	return &role, nil
+}
+
 // RemoveRoleFromUser 移除用户的角色
 func RemoveRoleFromUser(db *gorm.DB, userID uint, roleID uint) error {
 	return db.Exec("DELETE FROM user_roles WHERE user_id = ? AND role_id = ?",
@@ -182,3 +205,20 @@ func UpdateLoginInfo(db *gorm.DB, userID uint, ip string) error {
 	fmt.Printf("更新登录信息成功: 影响行数=%d\n", result.RowsAffected)
 	return nil
 }
+
+// MarkEmailVerified 标记邮箱已验证，未验证状态的用户同时恢复为正常状态
+func MarkEmailVerified(db *gorm.DB, userID uint, verifiedAt time.Time) error {
+	return db.Model(&models.UserInfo{}).
+		Where("user_id = ?", userID).
+		Updates(map[string]interface{}{
+			"email_verified_at": verifiedAt,
+			"status":            gorm.Expr("CASE WHEN status = ? THEN ? ELSE status END", models.UserStatusUnverified, models.UserStatusActive),
+		}).Error
+}
+
+// ClearEmailVerified 清除邮箱验证时间，用户修改邮箱后使用
+func ClearEmailVerified(db *gorm.DB, userID uint) error {
+	return db.Model(&models.UserInfo{}).
+		Where("user_id = ?", userID).
+		Update("email_verified_at", nil).Error
+}
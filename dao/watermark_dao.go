@@ -0,0 +1,33 @@
+package dao
+
+import (
+	"img_hosting/models"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// GetWatermarkSetting 获取用户的水印设置
+func GetWatermarkSetting(db *gorm.DB, userID uint) (*models.WatermarkSetting, error) {
+	var setting models.WatermarkSetting
+	if err := db.Where("user_id = ?", userID).First(&setting).Error; err != nil {
+		return nil, err
+	}
+	return &setting, nil
+}
+
+// SaveWatermarkSetting 创建或更新用户的水印设置
+func SaveWatermarkSetting(db *gorm.DB, setting *models.WatermarkSetting) error {
+	return db.Clauses(clause.OnConflict{
+		Columns: []clause.Column{{Name: "user_id"}},
+		DoUpdates: clause.AssignmentColumns([]string{
+			"enabled", "type", "text", "color", "image_id", "position",
+			"opacity", "scale", "apply_to_original", "updated_at",
+		}),
+	}).Create(setting).Error
+}
+
+// DeleteWatermarkSetting 删除用户的水印设置，恢复使用全局设置
+func DeleteWatermarkSetting(db *gorm.DB, userID uint) error {
+	return db.Where("user_id = ?", userID).Delete(&models.WatermarkSetting{}).Error
+}
@@ -1,9 +1,11 @@
 package main
 
 import (
+	"context"
 	"fmt"
 	"img_hosting/config"
 	"img_hosting/dao"
+	"img_hosting/middleware"
 	"img_hosting/models"
 	"img_hosting/pkg/logger"
 	"img_hosting/routes"
@@ -79,6 +81,20 @@ func main() {
 	//日志初始化
 	logger.Init()
 	log := logger.GetLogger()
+
+	// 加载 JWT 签名密钥，配置有误时直接退出
+	if err := middleware.InitJWTKeys(); err != nil {
+		log.Fatalf("加载 JWT 密钥失败: %v", err)
+	}
+
+	// 邮件中的链接只能使用配置的地址，要求验证邮箱但无法生成验证链接时直接退出
+	if err := services.CheckAccountConfig(); err != nil {
+		log.Fatalf("账号邮件配置错误: %v", err)
+	}
+
+	// 启动后台任务 worker（缩略图生成等）
+	services.StartJobWorkers(context.Background())
+
 	router := gin.Default()
 
 	// CORS middleware configuration
@@ -0,0 +1,58 @@
+package middleware
+
+import (
+	"img_hosting/pkg/logger"
+	"img_hosting/services"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// APITokenMiddleware 使用个人 API 令牌（models.Token）认证，供 ShareX、PicGo 等上传工具使用
+// 令牌只能放在 Authorization: Bearer 或 X-API-Token 请求头中。查询参数会出现在访问日志、
+// 代理日志和 Referer 中，而令牌长期有效，所以不接受 token 查询参数
+func APITokenMiddleware() gin.HandlerFunc {
+	tokenService := services.NewTokenService()
+
+	return func(c *gin.Context) {
+		log := logger.GetLogger().WithField("ip", c.ClientIP())
+
+		tokenStr := apiTokenFromRequest(c)
+		if tokenStr == "" {
+			message := "缺少API令牌"
+			if c.Query("token") != "" {
+				message = "API令牌不能放在查询参数中，请使用 Authorization 或 X-API-Token 请求头"
+			}
+			c.JSON(http.StatusUnauthorized, gin.H{"success": false, "message": message})
+			c.Abort()
+			return
+		}
+
+		user, token, err := tokenService.Authenticate(tokenStr)
+		if err != nil {
+			log.WithError(err).WithField("path", c.FullPath()).Warn("API令牌认证失败")
+			c.JSON(http.StatusUnauthorized, gin.H{"success": false, "message": "无效的API令牌"})
+			c.Abort()
+			return
+		}
+
+		// 设置了范围的令牌交给 PermissionMiddleware 与角色权限取交集
+		if scopes := services.ParseScopes(token.Scopes); len(scopes) > 0 {
+			c.Set(ContextTokenScopes, scopes)
+		}
+		c.Set("user_id", user.UserID)
+		c.Next()
+	}
+}
+
+// apiTokenFromRequest 从请求头中读取 API 令牌
+func apiTokenFromRequest(c *gin.Context) string {
+	if authHeader := c.GetHeader("Authorization"); len(authHeader) > 7 && strings.EqualFold(authHeader[:7], "Bearer ") {
+		return strings.TrimSpace(authHeader[7:])
+	}
+	if token := c.GetHeader("X-API-Token"); token != "" {
+		return strings.TrimSpace(token)
+	}
+	return ""
+}
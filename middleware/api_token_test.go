@@ -0,0 +1,51 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestAPITokenFromRequest(t *testing.T) {
+	tests := []struct {
+		name    string
+		target  string
+		headers map[string]string
+		want    string
+	}{
+		{"Bearer", "/api/upload", map[string]string{"Authorization": "Bearer abc"}, "abc"},
+		{"大小写不敏感的 Bearer", "/api/upload", map[string]string{"Authorization": "bearer  abc "}, "abc"},
+		{"X-API-Token", "/api/upload", map[string]string{"X-API-Token": " abc "}, "abc"},
+		{"Authorization 优先", "/api/upload", map[string]string{"Authorization": "Bearer abc", "X-API-Token": "def"}, "abc"},
+		{"非 Bearer 认证", "/api/upload", map[string]string{"Authorization": "Basic abc"}, ""},
+		{"查询参数不被接受", "/api/upload?token=abc", nil, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, _ := gin.CreateTestContext(httptest.NewRecorder())
+			c.Request = httptest.NewRequest(http.MethodPost, tt.target, nil)
+			for k, v := range tt.headers {
+				c.Request.Header.Set(k, v)
+			}
+			if got := apiTokenFromRequest(c); got != tt.want {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestAPITokenMiddlewareRejectsQueryToken(t *testing.T) {
+	r := gin.New()
+	r.POST("/api/upload", APITokenMiddleware(), func(c *gin.Context) {
+		c.String(http.StatusOK, "ok")
+	})
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/api/upload?token=abc", nil))
+	if w.Code != http.StatusUnauthorized || !strings.Contains(w.Body.String(), "请求头") {
+		t.Errorf("status = %d, body = %s", w.Code, w.Body.String())
+	}
+}
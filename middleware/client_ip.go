@@ -0,0 +1,80 @@
+package middleware
+
+import (
+	"fmt"
+	"img_hosting/config"
+	"net"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// defaultRemoteIPHeaders 未配置时读取客户端 IP 的请求头
+var defaultRemoteIPHeaders = []string{"X-Forwarded-For", "X-Real-IP"}
+
+// trustedProxyNets 可信反向代理的网段，ConfigureTrustedProxies 之后只读
+var trustedProxyNets []*net.IPNet
+
+// ConfigureTrustedProxies 按配置设置可信的反向代理
+// 只有直接连接的地址属于可信代理时，c.ClientIP() 才会读取转发头，否则使用连接的 IP，避免客户端伪造 IP 绕过登录限制
+func ConfigureTrustedProxies(r *gin.Engine) error {
+	cfg := config.GetConfig().App
+
+	// 未配置代理时 proxies 为 nil，gin 不信任任何转发头
+	var proxies []string
+	var nets []*net.IPNet
+	for _, proxy := range cfg.TrustedProxies {
+		proxy = strings.TrimSpace(proxy)
+		ipNet, err := parseProxyNet(proxy)
+		if err != nil {
+			return err
+		}
+		proxies = append(proxies, proxy)
+		nets = append(nets, ipNet)
+	}
+	if err := r.SetTrustedProxies(proxies); err != nil {
+		return err
+	}
+	r.ForwardedByClientIP = true
+	r.RemoteIPHeaders = defaultRemoteIPHeaders
+	if len(cfg.RemoteIPHeaders) > 0 {
+		r.RemoteIPHeaders = cfg.RemoteIPHeaders
+	}
+
+	trustedProxyNets = nets
+	return nil
+}
+
+// FromTrustedProxy 请求是否由可信的反向代理转发，可信时才能使用 X-Forwarded-Proto 等转发头
+func FromTrustedProxy(c *gin.Context) bool {
+	ip := net.ParseIP(c.RemoteIP())
+	if ip == nil {
+		return false
+	}
+	for _, ipNet := range trustedProxyNets {
+		if ipNet.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// parseProxyNet 解析代理地址，单个 IP 视为只包含该地址的网段
+func parseProxyNet(proxy string) (*net.IPNet, error) {
+	if !strings.Contains(proxy, "/") {
+		ip := net.ParseIP(proxy)
+		if ip == nil {
+			return nil, fmt.Errorf("无效的代理地址 %q", proxy)
+		}
+		bits := 128
+		if ip.To4() != nil {
+			ip, bits = ip.To4(), 32
+		}
+		return &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)}, nil
+	}
+	_, ipNet, err := net.ParseCIDR(proxy)
+	if err != nil {
+		return nil, fmt.Errorf("无效的代理网段 %q: %w", proxy, err)
+	}
+	return ipNet, nil
+}
@@ -0,0 +1,110 @@
+package middleware
+
+import (
+	"img_hosting/config"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+// clientIPEngine 按给定的代理配置创建路由，/ip 返回 c.ClientIP() 和 FromTrustedProxy 的结果
+func clientIPEngine(t *testing.T, proxies, headers []string) *gin.Engine {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+	cfg := config.GetConfig()
+	oldProxies, oldHeaders, oldNets := cfg.App.TrustedProxies, cfg.App.RemoteIPHeaders, trustedProxyNets
+	cfg.App.TrustedProxies, cfg.App.RemoteIPHeaders = proxies, headers
+	t.Cleanup(func() {
+		cfg.App.TrustedProxies, cfg.App.RemoteIPHeaders, trustedProxyNets = oldProxies, oldHeaders, oldNets
+	})
+
+	r := gin.New()
+	if err := ConfigureTrustedProxies(r); err != nil {
+		t.Fatal(err)
+	}
+	r.GET("/ip", func(c *gin.Context) {
+		c.String(http.StatusOK, c.ClientIP()+" "+strconv.FormatBool(FromTrustedProxy(c)))
+	})
+	return r
+}
+
+func resolveClientIP(r *gin.Engine, remoteAddr string, headers map[string]string) string {
+	req := httptest.NewRequest(http.MethodGet, "/ip", nil)
+	req.RemoteAddr = remoteAddr
+	for k, v := range headers {
+		req.Header.Set(k, v)
+	}
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	return w.Body.String()
+}
+
+func TestClientIPWithoutTrustedProxies(t *testing.T) {
+	r := clientIPEngine(t, nil, nil)
+
+	// 未配置代理时转发头一律忽略，客户端不能伪造 IP
+	got := resolveClientIP(r, "198.51.100.7:4321", map[string]string{
+		"X-Forwarded-For": "203.0.113.1",
+		"X-Real-IP":       "203.0.113.2",
+	})
+	if got != "198.51.100.7 false" {
+		t.Errorf("got %q", got)
+	}
+}
+
+func TestClientIPFromTrustedProxy(t *testing.T) {
+	r := clientIPEngine(t, []string{"10.0.0.0/8", " 192.0.2.10 ", "2001:db8::1"}, nil)
+
+	tests := []struct {
+		name       string
+		remoteAddr string
+		headers    map[string]string
+		want       string
+	}{
+		{"可信代理转发的 X-Forwarded-For", "10.1.2.3:80", map[string]string{"X-Forwarded-For": "203.0.113.5"}, "203.0.113.5 true"},
+		{"单个 IP 的代理", "192.0.2.10:80", map[string]string{"X-Forwarded-For": "203.0.113.5"}, "203.0.113.5 true"},
+		{"IPv6 代理", "[2001:db8::1]:80", map[string]string{"X-Forwarded-For": "203.0.113.5"}, "203.0.113.5 true"},
+		{"没有 X-Forwarded-For 时使用 X-Real-IP", "10.1.2.3:80", map[string]string{"X-Real-IP": "203.0.113.6"}, "203.0.113.6 true"},
+		{"跳过链路中的可信代理", "10.1.2.3:80", map[string]string{"X-Forwarded-For": "203.0.113.7, 10.9.9.9"}, "203.0.113.7 true"},
+		{"客户端伪造的地址在最左侧，取最右侧的不可信地址", "10.1.2.3:80", map[string]string{"X-Forwarded-For": "1.1.1.1, 203.0.113.8"}, "203.0.113.8 true"},
+		{"不可信的连接忽略转发头", "198.51.100.7:80", map[string]string{"X-Forwarded-For": "203.0.113.5"}, "198.51.100.7 false"},
+		{"网段外的相邻地址", "192.0.2.11:80", map[string]string{"X-Forwarded-For": "203.0.113.5"}, "192.0.2.11 false"},
+		{"没有转发头时使用代理地址", "10.1.2.3:80", nil, "10.1.2.3 true"},
+		{"转发头无效时使用代理地址", "10.1.2.3:80", map[string]string{"X-Forwarded-For": "not-an-ip"}, "10.1.2.3 true"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := resolveClientIP(r, tt.remoteAddr, tt.headers); got != tt.want {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestClientIPCustomHeader(t *testing.T) {
+	r := clientIPEngine(t, []string{"10.0.0.1"}, []string{"CF-Connecting-IP"})
+
+	headers := map[string]string{"CF-Connecting-IP": "203.0.113.9", "X-Forwarded-For": "203.0.113.1"}
+	if got := resolveClientIP(r, "10.0.0.1:80", headers); got != "203.0.113.9 true" {
+		t.Errorf("应只读取配置的请求头，got %q", got)
+	}
+	if got := resolveClientIP(r, "10.0.0.2:80", headers); got != "10.0.0.2 false" {
+		t.Errorf("不可信的连接应忽略请求头，got %q", got)
+	}
+}
+
+func TestConfigureTrustedProxiesInvalid(t *testing.T) {
+	cfg := config.GetConfig()
+	old := cfg.App.TrustedProxies
+	t.Cleanup(func() { cfg.App.TrustedProxies = old })
+
+	for _, proxy := range []string{"not-an-ip", "10.0.0.0/33", ""} {
+		cfg.App.TrustedProxies = []string{proxy}
+		if err := ConfigureTrustedProxies(gin.New()); err == nil {
+			t.Errorf("%q 应返回错误", proxy)
+		}
+	}
+}
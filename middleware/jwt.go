@@ -1,49 +1,165 @@
 package middleware
 
 import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
 	"fmt"
+	"img_hosting/config"
+	"img_hosting/pkg/jwtkeys"
 	"img_hosting/pkg/logger"
+	"img_hosting/services"
 	"net/http"
+	"os"
 	"strings"
+	"sync"
 	"time"
 
-	"github.com/dgrijalva/jwt-go"
 	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/sirupsen/logrus"
 )
 
-// Define a secret key for signing the JWT tokens
-var jwtKey = []byte("my_secret_key")
-
 // Claims defines the structure for JWT claims
 type Claims struct {
-	UserID uint `json:"user_id"`
-	jwt.StandardClaims
+	UserID    uint   `json:"user_id"`
+	SessionID string `json:"sid,omitempty"` // 登录会话 ID，撤销会话时该会话签发的令牌一起失效
+	jwt.RegisteredClaims
+}
+
+var (
+	jwtKeys     *jwtkeys.KeySet
+	jwtKeysErr  error
+	jwtKeysOnce sync.Once
+)
+
+func init() {
+	// iat/exp 精确到毫秒，撤销登录时可以准确区分撤销前后签发的令牌
+	jwt.TimePrecision = time.Millisecond
+}
+
+// defaultAccessTokenTTL 未配置时访问令牌的有效期
+const defaultAccessTokenTTL = 15 * time.Minute
+
+// AccessTokenTTL 访问令牌的有效期
+func AccessTokenTTL() time.Duration {
+	if ttl := config.GetConfig().JWT.AccessTokenTTL; ttl > 0 {
+		return time.Duration(ttl) * time.Second
+	}
+	return defaultAccessTokenTTL
+}
+
+// InitJWTKeys 加载配置中的 JWT 密钥，启动时调用以便尽早发现配置错误
+func InitJWTKeys() error {
+	_, err := getJWTKeys()
+	return err
+}
+
+// JWKS 返回用于验证令牌的公钥集合
+func JWKS() (jwtkeys.JWKS, error) {
+	keys, err := getJWTKeys()
+	if err != nil {
+		return jwtkeys.JWKS{}, err
+	}
+	return keys.JWKS(), nil
+}
+
+func getJWTKeys() (*jwtkeys.KeySet, error) {
+	jwtKeysOnce.Do(func() {
+		jwtKeys, jwtKeysErr = loadJWTKeys()
+	})
+	return jwtKeys, jwtKeysErr
+}
+
+// loadJWTKeys 读取配置中的密钥；签发密钥为 HS256 且没有配置密钥时生成临时密钥
+func loadJWTKeys() (*jwtkeys.KeySet, error) {
+	cfg := config.GetConfig().JWT
+	log := logger.GetLogger()
+
+	specs := make([]jwtkeys.Spec, 0, len(cfg.Keys))
+	for _, keyCfg := range cfg.Keys {
+		spec := jwtkeys.Spec{
+			ID:        keyCfg.ID,
+			Algorithm: keyCfg.Algorithm,
+			Secret:    []byte(os.ExpandEnv(keyCfg.Secret)),
+		}
+		var err error
+		if spec.PrivateKeyPEM, err = readKeyMaterial(keyCfg.PrivateKey); err != nil {
+			return nil, fmt.Errorf("读取密钥 %q 的私钥失败: %w", keyCfg.ID, err)
+		}
+		if spec.PublicKeyPEM, err = readKeyMaterial(keyCfg.PublicKey); err != nil {
+			return nil, fmt.Errorf("读取密钥 %q 的公钥失败: %w", keyCfg.ID, err)
+		}
+
+		if keyCfg.ID == cfg.SigningKey && spec.Algorithm == jwtkeys.AlgHS256 && len(spec.Secret) == 0 {
+			spec.Secret = make([]byte, jwtkeys.MinSecretLength)
+			if _, err := rand.Read(spec.Secret); err != nil {
+				return nil, err
+			}
+			log.WithField("kid", keyCfg.ID).Warn("未配置 JWT 密钥，使用临时生成的密钥，重启后已签发的令牌将失效")
+		}
+		specs = append(specs, spec)
+	}
+
+	keys, err := jwtkeys.New(specs, cfg.SigningKey)
+	if err != nil {
+		return nil, err
+	}
+	log.WithField("kid", keys.SigningKeyID()).Info("JWT 密钥加载完成")
+	return keys, nil
+}
+
+// readKeyMaterial 读取 PEM 密钥，值可以是 PEM 内容或文件路径，支持 ${ENV} 引用环境变量
+func readKeyMaterial(value string) ([]byte, error) {
+	value = strings.TrimSpace(os.ExpandEnv(value))
+	if value == "" {
+		return nil, nil
+	}
+	if strings.HasPrefix(value, "-----BEGIN") {
+		return []byte(value), nil
+	}
+	return os.ReadFile(value)
 }
 
 // GenerateJWT generates a JWT token for a given username
-func GenerateJWT(userID uint) (string, error) {
+// sessionID 为刷新令牌所属的登录会话
+func GenerateJWT(userID uint, sessionID string) (string, error) {
 	fmt.Printf("开始生成JWT令牌: userID=%d\n", userID)
 
-	// Set expiration time for the token
-	expirationTime := time.Now().Add(30 * 24 * time.Hour)
+	keys, err := getJWTKeys()
+	if err != nil {
+		return "", err
+	}
+
+	// jti 用于退出登录时单独撤销令牌
+	jtiBytes := make([]byte, 16)
+	if _, err := rand.Read(jtiBytes); err != nil {
+		return "", err
+	}
+	jti := hex.EncodeToString(jtiBytes)
+
+	// 访问令牌有效期较短，过期后使用刷新令牌换取
+	now := time.Now()
+	expirationTime := now.Add(AccessTokenTTL())
 	claims := &Claims{
-		UserID: userID,
-		StandardClaims: jwt.StandardClaims{
-			ExpiresAt: expirationTime.Unix(),
+		UserID:    userID,
+		SessionID: sessionID,
+		RegisteredClaims: jwt.RegisteredClaims{
+			ID:        jti,
+			Issuer:    config.GetConfig().JWT.Issuer,
+			IssuedAt:  jwt.NewNumericDate(now),
+			ExpiresAt: jwt.NewNumericDate(expirationTime),
 		},
 	}
 
-	// Create the token with the specified claims
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-
-	// Sign the token with the secret key
-	tokenString, err := token.SignedString(jwtKey)
+	// 使用当前签发密钥签名，kid 写入令牌头部
+	tokenString, err := keys.Sign(claims)
 	if err != nil {
 		fmt.Printf("生成JWT令牌失败: %v\n", err)
 		return "", err
 	}
 
-	fmt.Printf("JWT令牌生成成功: token=%s\n", tokenString)
+	fmt.Printf("JWT令牌生成成功: userID=%d\n", userID)
 	return tokenString, nil
 }
 
@@ -62,16 +178,21 @@ var ExcludedPaths = map[string]bool{
 	"/favicon.ico":               true,
 }
 
-// AuthMiddleware is a middleware for JWT authentication
+// ContextTokenScopes 使用 API 令牌认证时，令牌范围保存在上下文中的键
+const ContextTokenScopes = "token_scopes"
+
+// AuthMiddleware 认证中间件，接受登录获得的 JWT 或个人 API 令牌
+// API 令牌只能访问令牌范围覆盖的接口，具体权限由 PermissionMiddleware 与角色权限取交集
 func AuthMiddleware() gin.HandlerFunc {
+	tokenService := services.NewTokenService()
+
 	return func(c *gin.Context) {
-		log := logger.GetLogger()
+		log := logger.GetLogger().WithField("ip", c.ClientIP())
 		path := c.FullPath()
 		fmt.Printf("当前访问路径: %s\n", path)
 
 		// 验证 Authorization header
 		authHeader := c.GetHeader("Authorization")
-		fmt.Printf("Authorization头: %s\n", authHeader)
 
 		if authHeader == "" {
 			fmt.Println("缺少认证信息")
@@ -88,6 +209,39 @@ func AuthMiddleware() gin.HandlerFunc {
 			return
 		}
 
+		// JWT 由三段组成，其余视为个人 API 令牌
+		if strings.Count(parts[1], ".") != 2 {
+			user, token, err := tokenService.Authenticate(parts[1])
+			if err != nil {
+				log.WithError(err).WithField("path", path).Warn("API令牌认证失败")
+				if errors.Is(err, services.ErrUserDisabled) {
+					c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+				} else {
+					c.JSON(http.StatusUnauthorized, gin.H{"error": "无效的 token"})
+				}
+				c.Abort()
+				return
+			}
+
+			// 未设置范围的旧令牌只能用于上传工具、S3 和 WebDAV
+			scopes := services.ParseScopes(token.Scopes)
+			if !services.TokenScopeAllowsPath(scopes, path, c.Request.Method) {
+				c.JSON(http.StatusForbidden, gin.H{"error": "令牌范围不足"})
+				c.Abort()
+				return
+			}
+
+			if !checkTwoFactorSetup(c, user.UserID, path) {
+				return
+			}
+
+			c.Set("user_id", user.UserID)
+			c.Set(ContextTokenScopes, scopes)
+			log.WithField("user_id", user.UserID).Info("API令牌认证成功")
+			c.Next()
+			return
+		}
+
 		claims, err := ParseAndValidateToken(c)
 		if err != nil {
 			c.JSON(http.StatusUnauthorized, gin.H{"error": "无效的 token"})
@@ -95,38 +249,91 @@ func AuthMiddleware() gin.HandlerFunc {
 			return
 		}
 
+		// 签名有效的令牌还需要检查用户状态和撤销记录，封禁、删除、修改密码后立即失效
+		var issuedAt time.Time
+		if claims.IssuedAt != nil {
+			issuedAt = claims.IssuedAt.Time
+		}
+		if err := services.ValidateAccessToken(claims.UserID, claims.ID, claims.SessionID, issuedAt); err != nil {
+			abortInvalidSession(c, claims.UserID, err)
+			return
+		}
+
+		if !checkTwoFactorSetup(c, claims.UserID, path) {
+			return
+		}
+
 		// 设置用户信息到上下文
 		c.Set("user_id", claims.UserID)
+		if claims.SessionID != "" {
+			c.Set("session_id", claims.SessionID)
+			services.TouchSession(claims.SessionID, c.ClientIP())
+		}
 		log.WithField("user_id", claims.UserID).Info("用户认证成功")
 
 		c.Next()
 	}
 }
 
-func validateToken(tokenString string) (*jwt.Token, error) {
-	return jwt.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
-		return jwtKey, nil
-	})
+// abortInvalidSession 登录令牌已失效：用户被封禁时返回 403，其余情况返回 401
+func abortInvalidSession(c *gin.Context, userID uint, err error) {
+	logger.GetLogger().WithError(err).WithFields(logrus.Fields{
+		"user_id": userID,
+		"ip":      c.ClientIP(),
+	}).Warn("登录令牌已失效")
+	switch {
+	case errors.Is(err, services.ErrUserDisabled):
+		c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+	case errors.Is(err, services.ErrUserNotFound), errors.Is(err, services.ErrSessionRevoked):
+		c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "认证失败"})
+	}
+	c.Abort()
+}
+
+// checkTwoFactorSetup 角色要求两步验证但用户尚未启用时，只允许访问两步验证设置接口
+func checkTwoFactorSetup(c *gin.Context, userID uint, path string) bool {
+	err := services.CheckTwoFactorSetup(userID)
+	if err == nil || strings.HasPrefix(path, "/users/me/2fa") {
+		return true
+	}
+	if errors.Is(err, services.ErrTwoFactorSetupRequired) {
+		c.JSON(http.StatusForbidden, gin.H{
+			"error":                     err.Error(),
+			"two_factor_setup_required": true,
+		})
+	} else {
+		logger.GetLogger().WithError(err).WithField("user_id", userID).Error("检查两步验证状态失败")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "认证失败"})
+	}
+	c.Abort()
+	return false
 }
 
 // ParseAndValidateToken parses and validates the JWT token from the request header
 func ParseAndValidateToken(c *gin.Context) (*Claims, error) {
 	authHeader := c.GetHeader("Authorization")
-	fmt.Printf("验证令牌 - Authorization头: %s\n", authHeader)
-
 	if authHeader == "" {
 		return nil, fmt.Errorf("authorization header is missing")
 	}
 
 	tokenString := strings.Split(authHeader, " ")[1]
-	fmt.Printf("验证令牌 - 令牌字符串: %s\n", tokenString)
 
-	token, err := jwt.ParseWithClaims(tokenString, &Claims{}, func(token *jwt.Token) (interface{}, error) {
-		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
-			return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
-		}
-		return jwtKey, nil
-	})
+	keys, err := getJWTKeys()
+	if err != nil {
+		return nil, err
+	}
+
+	// 只接受已配置密钥的算法，按 kid 选择验证密钥
+	options := []jwt.ParserOption{
+		jwt.WithValidMethods(keys.Algorithms()),
+		jwt.WithExpirationRequired(),
+	}
+	if issuer := config.GetConfig().JWT.Issuer; issuer != "" {
+		options = append(options, jwt.WithIssuer(issuer))
+	}
+	token, err := jwt.ParseWithClaims(tokenString, &Claims{}, keys.Keyfunc, options...)
 
 	if err != nil {
 		fmt.Printf("令牌解析失败: %v\n", err)
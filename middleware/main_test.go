@@ -0,0 +1,31 @@
+package middleware
+
+import (
+	"fmt"
+	"img_hosting/config"
+	"img_hosting/pkg/logger"
+	"os"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+// TestMain 在临时目录中运行测试，日志和数据库都写在临时目录
+func TestMain(m *testing.M) {
+	config.LoadConfig()
+	dir, err := os.MkdirTemp("", "img_hosting-middleware-*")
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+	if err := os.Chdir(dir); err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+	logger.Init()
+	gin.SetMode(gin.TestMode)
+
+	code := m.Run()
+	os.RemoveAll(dir)
+	os.Exit(code)
+}
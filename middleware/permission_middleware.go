@@ -81,6 +81,38 @@ func PermissionMiddleware() gin.HandlerFunc {
 			}
 		}
 
+		// 未验证邮箱的用户只有部分权限
+		missing, err := services.UnverifiedMissingPermission(userID.(uint), requiredPermissions)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "权限检查失败"})
+			c.Abort()
+			return
+		}
+		if missing != "" {
+			c.JSON(http.StatusForbidden, gin.H{
+				"error":                       "请先验证邮箱",
+				"required_permission":         missing,
+				"email_verification_required": true,
+			})
+			c.Abort()
+			return
+		}
+
+		// API 令牌的权限为令牌范围与角色权限的交集
+		if scopes, ok := c.Get(ContextTokenScopes); ok {
+			granted := services.TokenScopePermissions(scopes.([]string), method)
+			for _, perm := range requiredPermissions {
+				if !granted[perm] {
+					c.JSON(http.StatusForbidden, gin.H{
+						"error":               "令牌范围不足",
+						"required_permission": perm,
+					})
+					c.Abort()
+					return
+				}
+			}
+		}
+
 		c.Next()
 	}
 }
@@ -0,0 +1,19 @@
+package models
+
+import (
+	"time"
+)
+
+// ImageVariant 图片的衍生尺寸（缩略图），每个配置的宽度生成一条记录
+type ImageVariant struct {
+	ID        uint      `gorm:"primaryKey" json:"id"`
+	ImageID   uint      `gorm:"not null;index" json:"image_id"` // 所属图片
+	Width     int       `json:"width"`                          // 宽度（像素）
+	Height    int       `json:"height"`                         // 高度（像素）
+	Animated  bool      `gorm:"default:false" json:"animated"`  // 是否为动图预览
+	Format    string    `gorm:"size:20" json:"format"`          // 文件格式(webp/avif/jpeg/png)
+	FileName  string    `gorm:"size:255;index" json:"-"`        // 缩略图目录下的文件名
+	URL       string    `json:"url"`                            // 访问地址
+	Size      int64     `json:"size"`                           // 文件大小（字节）
+	CreatedAt time.Time `json:"created_at"`
+}
@@ -6,19 +6,41 @@ import (
 
 // Image 图片结构体
 type Image struct {
-	ImageID       uint      `gorm:"primaryKey" json:"id"`
-	UserID        uint      `gorm:"not null" json:"user_id"` // 用户名
-	ImageURL      string    `json:"image_url"`               // 图片存储路径或URL
-	ImageName     string    `json:"image_name"`              // 图片名称
-	Imageextenion string    `json:"image_extenion"`          // 图片扩展名
-	HashImage     string    `json:"hash_image"`              //图片哈希名
-	ImageSize     int64     `json:"image_size"`              // 图片大小（字节）
-	ImageType     string    `json:"image_type"`              // 图片格式
-	UploadTime    time.Time `gorm:"autoCreateTime"`          // 上传时间
-	Description   string    `json:"description"`             // 图片描述（可选）
-	Tags          []Tag     `gorm:"many2many:image_tags;foreignKey:ImageID;joinForeignKey:ImageID;references:TagID;joinReferences:TagID;constraint:OnDelete:CASCADE"`
+	ImageID       uint           `gorm:"primaryKey" json:"id"`
+	UserID        uint           `gorm:"not null" json:"user_id"`                                                                     // 用户名
+	ImageURL      string         `json:"image_url"`                                                                                   // 图片存储路径或URL
+	ImageName     string         `json:"image_name"`                                                                                  // 图片名称
+	Imageextenion string         `json:"image_extenion"`                                                                              // 图片扩展名
+	HashImage     string         `json:"hash_image"`                                                                                  //图片哈希名
+	ImageSize     int64          `json:"image_size"`                                                                                  // 图片大小（字节）
+	ImageType     string         `json:"image_type"`                                                                                  // 图片格式
+	UploadTime    time.Time      `gorm:"autoCreateTime"`                                                                              // 上传时间
+	Description   string         `json:"description"`                                                                                 // 图片描述（可选）
+	Width         int            `gorm:"default:0" json:"width"`                                                                      // 宽度（像素）
+	Height        int            `gorm:"default:0" json:"height"`                                                                     // 高度（像素）
+	BlurHash      string         `gorm:"size:64" json:"blurhash"`                                                                     // BlurHash 占位图
+	AverageColor  string         `gorm:"size:7" json:"average_color"`                                                                 // 平均色 #RRGGBB
+	DominantColor string         `gorm:"size:7" json:"dominant_color"`                                                                // 主色 #RRGGBB
+	ColorFamily   string         `gorm:"size:20;index" json:"color_family"`                                                           // 主色分类，用于按颜色筛选
+	Animated      bool           `gorm:"default:false" json:"animated"`                                                               // 是否为动图
+	FrameCount    int            `gorm:"default:0" json:"frame_count,omitempty"`                                                      // 动图帧数
+	Duration      int            `gorm:"default:0" json:"duration,omitempty"`                                                         // 动图播放一遍的时长（毫秒）
+	Watermarked   bool           `gorm:"default:false" json:"watermarked"`                                                            // 原图是否已加水印
+	Status        string         `gorm:"size:20;default:'ready'" json:"status"`                                                       // 处理状态：processing/ready/failed
+	DeleteKeyHash string         `gorm:"size:64;index" json:"-"`                                                                      // 删除链接密钥的 SHA-256，第三方上传工具上传时生成
+	ObjectKey     string         `gorm:"size:512;index" json:"object_key,omitempty"`                                                  // 通过 S3 接口上传时的对象键
+	Variants      []ImageVariant `gorm:"foreignKey:ImageID;references:ImageID;constraint:OnDelete:CASCADE" json:"variants,omitempty"` // 缩略图尺寸
+	Srcset        string         `gorm:"-" json:"srcset,omitempty"`                                                                   // 可直接用于 <img srcset> 的字符串
+	Tags          []Tag          `gorm:"many2many:image_tags;foreignKey:ImageID;joinForeignKey:ImageID;references:TagID;joinReferences:TagID;constraint:OnDelete:CASCADE"`
 }
 
+// 图片处理状态
+const (
+	ImageStatusProcessing = "processing" // 缩略图等衍生文件生成中
+	ImageStatusReady      = "ready"      // 处理完成
+	ImageStatusFailed     = "failed"     // 处理失败（原图仍可访问）
+)
+
 type ImageResult struct {
 	Images []Image `json:"images"`
 	Total  int     `json:"total"`
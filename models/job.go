@@ -0,0 +1,28 @@
+package models
+
+import (
+	"time"
+)
+
+// Job 后台任务，持久化到数据库，服务重启后可继续执行
+type Job struct {
+	ID          uint       `gorm:"primaryKey" json:"id"`
+	Type        string     `gorm:"size:64;not null;index" json:"type"`            // 任务类型
+	Payload     string     `gorm:"type:text" json:"payload"`                      // 任务参数(JSON)
+	Status      string     `gorm:"size:20;default:'pending';index" json:"status"` // 状态(pending/running/done/failed)
+	Attempts    int        `gorm:"default:0" json:"attempts"`                     // 已执行次数
+	MaxAttempts int        `gorm:"default:3" json:"max_attempts"`                 // 最大执行次数
+	RunAt       time.Time  `gorm:"index" json:"run_at"`                           // 下次可执行时间
+	LockedAt    *time.Time `json:"locked_at"`                                     // 开始执行时间
+	LastError   string     `gorm:"type:text" json:"last_error"`                   // 最近一次错误
+	CreatedAt   time.Time  `json:"created_at"`
+	UpdatedAt   time.Time  `json:"updated_at"`
+}
+
+// JobStatus 定义任务状态常量
+const (
+	JobStatusPending = "pending" // 等待执行
+	JobStatusRunning = "running" // 执行中
+	JobStatusDone    = "done"    // 已完成
+	JobStatusFailed  = "failed"  // 重试耗尽后失败
+)
@@ -0,0 +1,27 @@
+package models
+
+import (
+	"time"
+)
+
+// LoginAttempt 登录尝试记录，用于登录限流和安全审计
+type LoginAttempt struct {
+	ID         uint      `gorm:"primaryKey" json:"id"`
+	UserID     *uint     `gorm:"index" json:"user_id"`                      // 账号不存在时为空
+	Identifier string    `gorm:"type:varchar(255);index" json:"identifier"` // 登录时填写的邮箱或用户名（小写）
+	IPAddress  string    `gorm:"type:varchar(64);index" json:"ip_address"`
+	UserAgent  string    `gorm:"type:varchar(255)" json:"user_agent"`
+	Result     string    `gorm:"type:varchar(20);index" json:"result"`
+	CreatedAt  time.Time `gorm:"index" json:"created_at"`
+}
+
+// LoginResult 登录尝试的结果
+const (
+	LoginResultSuccess          = "success"            // 登录成功，账号的失败次数清零
+	LoginResultFailure          = "failure"            // 账号不存在或密码错误
+	LoginResultTwoFactorFailure = "two_factor_failure" // 两步验证码错误
+	LoginResultThrottled        = "throttled"          // 失败次数过多，请求被拒绝
+	LoginResultLocked           = "locked"             // 账号已被临时锁定，请求被拒绝
+	LoginResultDisabled         = "disabled"           // 密码正确但账号已被禁用
+	LoginResultUnlock           = "unlock"             // 管理员解除锁定，账号的失败次数清零
+)
@@ -0,0 +1,31 @@
+package models
+
+import "time"
+
+// UserIdentity 用户关联的外部身份（OIDC 身份提供方的账号），同一身份只能关联一个用户
+type UserIdentity struct {
+	ID          uint      `gorm:"primaryKey" json:"id"`
+	UserID      uint      `gorm:"not null;index" json:"user_id"`
+	Provider    string    `gorm:"type:varchar(64);not null;uniqueIndex:idx_identity_provider_subject" json:"provider"` // 配置中的身份提供方 ID
+	Subject     string    `gorm:"type:varchar(255);not null;uniqueIndex:idx_identity_provider_subject" json:"subject"` // ID 令牌中的 sub
+	Email       string    `gorm:"type:varchar(255)" json:"email"`
+	LastLoginAt time.Time `json:"last_login_at"`
+	CreatedAt   time.Time `json:"created_at"`
+}
+
+// OIDCAuthRequest 跳转到身份提供方之前保存的登录请求，回调时按 state 取出并删除
+type OIDCAuthRequest struct {
+	State        string    `gorm:"primaryKey;type:varchar(64)" json:"-"` // state 的哈希
+	Provider     string    `gorm:"type:varchar(64);not null" json:"provider"`
+	Nonce        string    `gorm:"type:varchar(64);not null" json:"-"`
+	CodeVerifier string    `gorm:"type:varchar(128);not null" json:"-"` // PKCE 验证码
+	RedirectURI  string    `gorm:"type:varchar(500);not null" json:"redirect_uri"`
+	IPAddress    string    `gorm:"type:varchar(64)" json:"ip_address"`
+	ExpiresAt    time.Time `gorm:"not null;index" json:"expires_at"`
+	CreatedAt    time.Time `json:"created_at"`
+}
+
+// TableName 指定表名
+func (OIDCAuthRequest) TableName() string {
+	return "oidc_auth_requests"
+}
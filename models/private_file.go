@@ -9,16 +9,20 @@ import (
 // PrivateFile 私人文件模型
 type PrivateFile struct {
 	ID          uint           `gorm:"primaryKey" json:"id"`
-	UserID      uint           `gorm:"not null;index" json:"user_id"`          // 所属用户
-	FileName    string         `gorm:"size:255;not null" json:"file_name"`     // 文件名
-	FileHash    string         `gorm:"size:64;not null" json:"file_hash"`      // 文件哈希值
-	FileSize    int64          `gorm:"not null" json:"file_size"`              // 文件大小(字节)
-	FileType    string         `gorm:"size:50" json:"file_type"`               // 文件类型(MIME类型)
-	StoragePath string         `gorm:"size:512;not null" json:"storage_path"`  // 存储路径
-	IsEncrypted bool           `gorm:"default:false" json:"is_encrypted"`      // 是否加密
-	Password    string         `gorm:"size:255" json:"-"`                      // 加密密码(如果有)
-	ViewCount   int64          `gorm:"default:0" json:"view_count"`            // 查看次数
-	Status      string         `gorm:"size:20;default:'active'" json:"status"` // 文件状态(active/deleted)
+	UserID      uint           `gorm:"not null;index" json:"user_id"`              // 所属用户
+	FileName    string         `gorm:"size:255;not null" json:"file_name"`         // 文件名
+	FileHash    string         `gorm:"size:64;not null" json:"file_hash"`          // 文件哈希值
+	FileSize    int64          `gorm:"not null" json:"file_size"`                  // 文件大小(字节)
+	FileType    string         `gorm:"size:50" json:"file_type"`                   // 文件类型(MIME类型)
+	StoragePath string         `gorm:"size:512;not null" json:"storage_path"`      // 存储路径
+	IsEncrypted bool           `gorm:"default:false" json:"is_encrypted"`          // 是否加密
+	Password    string         `gorm:"size:255" json:"-"`                          // 加密密码(如果有)
+	ViewCount   int64          `gorm:"default:0" json:"view_count"`                // 查看次数
+	Status      string         `gorm:"size:20;default:'active'" json:"status"`     // 文件状态(active/deleted/quarantined)
+	ScanStatus  string         `gorm:"size:20" json:"scan_status"`                 // 扫描状态(clean/infected/error/skipped/released)
+	ScanResult  string         `gorm:"size:255" json:"scan_result"`                // 扫描结果(命中的特征名或错误信息)
+	ScannedAt   *time.Time     `json:"scanned_at"`                                 // 扫描时间
+	ObjectKey   string         `gorm:"size:512;index" json:"object_key,omitempty"` // 通过 S3 接口上传时的对象键
 	CreatedAt   time.Time      `json:"created_at"`
 	UpdatedAt   time.Time      `json:"updated_at"`
 	DeletedAt   gorm.DeletedAt `gorm:"index" json:"-"` // 软删除
@@ -28,8 +32,18 @@ type PrivateFile struct {
 
 // FileStatus 定义文件状态常量
 const (
-	FileStatusActive  = "active"  // 正常
-	FileStatusDeleted = "deleted" // 已删除
+	FileStatusActive      = "active"      // 正常
+	FileStatusDeleted     = "deleted"     // 已删除
+	FileStatusQuarantined = "quarantined" // 已隔离
+)
+
+// ScanStatus 定义文件扫描状态常量
+const (
+	ScanStatusClean    = "clean"    // 未发现威胁
+	ScanStatusInfected = "infected" // 发现恶意内容
+	ScanStatusError    = "error"    // 扫描失败（fail_open 时放行）
+	ScanStatusSkipped  = "skipped"  // 未启用扫描
+	ScanStatusReleased = "released" // 管理员已从隔离区放行
 )
 
 // BeforeCreate 创建前的钩子
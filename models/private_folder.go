@@ -0,0 +1,12 @@
+package models
+
+import "time"
+
+// PrivateFolder 私人文件的目录
+// 目录通常由文件的对象键隐含（如 docs/a.pdf 隐含 docs），通过 WebDAV 创建的空目录需要单独保存
+type PrivateFolder struct {
+	ID        uint      `gorm:"primaryKey" json:"id"`
+	UserID    uint      `gorm:"not null;uniqueIndex:idx_user_folder_path" json:"user_id"`
+	Path      string    `gorm:"size:512;not null;uniqueIndex:idx_user_folder_path" json:"path"` // 目录路径，不以 / 开头和结尾
+	CreatedAt time.Time `json:"created_at"`
+}
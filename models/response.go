@@ -20,6 +20,38 @@ type ImageUploadResponse struct {
 	ImageURL string `json:"image_url" example:"http://example.com/images/1.jpg"`
 }
 
+// URLUploadRequest 从远程 URL 上传图片的请求
+type URLUploadRequest struct {
+	URL         string `json:"url" binding:"required" example:"https://example.com/picture.jpg"`
+	Description string `json:"description" example:"图片描述"`
+}
+
+// Base64UploadRequest 上传 Base64 或 data URI 编码图片的请求，例如粘贴的截图
+type Base64UploadRequest struct {
+	Data        string `json:"data" binding:"required" example:"data:image/png;base64,iVBORw0KGgo..."`
+	FileName    string `json:"filename" example:"screenshot.png"`
+	Description string `json:"description" example:"图片描述"`
+}
+
+// UploaderResponse ShareX、PicGo 等第三方上传工具使用的上传响应
+// url 同时放在顶层和 data 中，兼容只能读取固定 JSON 路径的工具
+type UploaderResponse struct {
+	Success   bool           `json:"success" example:"true"`
+	Message   string         `json:"message" example:"上传成功"`
+	URL       string         `json:"url,omitempty" example:"http://example.com/images/1.jpg"`
+	DeleteURL string         `json:"delete_url,omitempty" example:"http://example.com/api/delete/abc"`
+	Data      *UploaderImage `json:"data,omitempty"`
+}
+
+// UploaderImage 上传工具响应中的图片信息
+type UploaderImage struct {
+	ImageID   uint   `json:"id" example:"1"`
+	URL       string `json:"url" example:"http://example.com/images/1.jpg"`
+	DeleteURL string `json:"delete_url" example:"http://example.com/api/delete/abc"`
+	FileName  string `json:"filename" example:"screenshot.png"`
+	Markdown  string `json:"markdown" example:"![screenshot.png](http://example.com/images/1.jpg)"`
+}
+
 // BatchUploadResponse 批量上传响应
 type BatchUploadResponse struct {
 	Message      string                `json:"message" example:"批量上传完成"`
@@ -86,9 +118,57 @@ type LoginRequest struct {
 
 // LoginResponse 登录响应
 type LoginResponse struct {
-	Token    string `json:"token" example:"eyJhbGciOiJIUzI1NiIs..."`
-	UserID   uint   `json:"user_id" example:"1"`
-	UserName string `json:"user_name" example:"张三"`
+	Token        string `json:"token" example:"eyJhbGciOiJIUzI1NiIs..."`
+	RefreshToken string `json:"refresh_token" example:"Q2hhbmdlTWU..."`
+	ExpiresIn    int    `json:"expires_in" example:"900"` // 访问令牌有效期（秒）
+	UserID       uint   `json:"user_id" example:"1"`
+	UserName     string `json:"user_name" example:"张三"`
+
+	TwoFactorSetupRequired bool `json:"two_factor_setup_required" example:"false"` // 角色要求两步验证但尚未启用，令牌只能用于设置两步验证
+}
+
+// TwoFactorLoginRequest 登录两步验证请求，code 为 6 位验证码或恢复码
+type TwoFactorLoginRequest struct {
+	ChallengeToken string `json:"challenge_token" binding:"required"`
+	Code           string `json:"code" binding:"required" example:"123456"`
+}
+
+// TwoFactorCodeRequest 需要验证码的两步验证操作，code 为 6 位验证码或恢复码
+type TwoFactorCodeRequest struct {
+	Code string `json:"code" binding:"required" example:"123456"`
+}
+
+// ForgotPasswordRequest 找回密码请求
+type ForgotPasswordRequest struct {
+	Email string `json:"email" binding:"required,email" example:"user@example.com"`
+}
+
+// ResetPasswordRequest 通过邮件中的令牌重置密码
+type ResetPasswordRequest struct {
+	Token       string `json:"token" binding:"required"`
+	NewPassword string `json:"new_password" binding:"required,password"`
+}
+
+// VerifyEmailRequest 验证邮箱请求
+type VerifyEmailRequest struct {
+	Token string `json:"token" binding:"required"`
+}
+
+// OIDCExchangeRequest 用单点登录回调跳转中的一次性登录码换取令牌
+type OIDCExchangeRequest struct {
+	LoginCode string `json:"login_code" binding:"required"`
+}
+
+// RefreshTokenRequest 刷新令牌和退出登录请求
+type RefreshTokenRequest struct {
+	RefreshToken string `json:"refresh_token" binding:"required"`
+}
+
+// RefreshTokenResponse 刷新令牌响应
+type RefreshTokenResponse struct {
+	Token        string `json:"token" example:"eyJhbGciOiJIUzI1NiIs..."`
+	RefreshToken string `json:"refresh_token" example:"Q2hhbmdlTWU..."`
+	ExpiresIn    int    `json:"expires_in" example:"900"`
 }
 
 // RegisterResponse 注册响应
@@ -97,6 +177,33 @@ type RegisterResponse struct {
 	Status string `json:"status" example:"success"`
 }
 
+// UsageBreakdown 某类文件的存储占用
+type UsageBreakdown struct {
+	Count int64 `json:"count" example:"12"`
+	Bytes int64 `json:"bytes" example:"1048576"`
+}
+
+// StorageUsage 用户存储用量
+type StorageUsage struct {
+	Used         int64          `json:"used" example:"2097152"`
+	Quota        int64          `json:"quota" example:"1073741824"`
+	Remaining    int64          `json:"remaining" example:"1071644672"`
+	Unlimited    bool           `json:"unlimited" example:"false"`
+	Images       UsageBreakdown `json:"images"`
+	PrivateFiles UsageBreakdown `json:"private_files"`
+}
+
+// QuotaUpdateRequest 配额更新请求，quota 为空表示恢复使用角色配额
+type QuotaUpdateRequest struct {
+	Quota *int64 `json:"quota" example:"1073741824"`
+}
+
+// ChangePasswordRequest 修改密码请求
+type ChangePasswordRequest struct {
+	OldPassword string `json:"old_password" binding:"required"`
+	NewPassword string `json:"new_password" binding:"required,password"`
+}
+
 // PermissionResponse 权限响应
 type PermissionResponse struct {
 	Name        string `json:"name" example:"create_post"`
@@ -0,0 +1,11 @@
+package models
+
+import "time"
+
+// RevokedToken 已撤销的访问令牌（JWT），按令牌的 jti 记录，令牌过期后记录可以清理
+type RevokedToken struct {
+	JTI       string    `gorm:"primaryKey;type:varchar(64)" json:"jti"`
+	UserID    uint      `gorm:"not null;index" json:"user_id"`
+	ExpiresAt time.Time `gorm:"not null;index" json:"expires_at"`
+	CreatedAt time.Time `json:"created_at"`
+}
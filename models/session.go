@@ -0,0 +1,17 @@
+package models
+
+import "time"
+
+// Session 一次登录（设备），ID 同时作为刷新令牌的 FamilyID 和访问令牌的 sid
+type Session struct {
+	ID         string     `gorm:"primaryKey;type:varchar(32)" json:"id"`
+	UserID     uint       `gorm:"not null;index" json:"user_id"`
+	UserAgent  string     `gorm:"type:varchar(255)" json:"user_agent"`
+	Device     string     `gorm:"type:varchar(100)" json:"device"`    // 由 User-Agent 识别的设备名称，如 "Chrome on Windows"
+	IPAddress  string     `gorm:"type:varchar(64)" json:"ip_address"` // 登录时的 IP
+	LastIP     string     `gorm:"type:varchar(64)" json:"last_ip"`    // 最近一次使用时的 IP
+	LastUsedAt time.Time  `json:"last_used_at"`                       // 最近一次使用访问令牌或刷新令牌的时间（精确到分钟）
+	ExpiresAt  time.Time  `gorm:"not null;index" json:"expires_at"`   // 刷新令牌过期时间，每次刷新后延长
+	RevokedAt  *time.Time `gorm:"index" json:"revoked_at,omitempty"`  // 退出登录或被撤销的时间
+	CreatedAt  time.Time  `json:"created_at"`
+}
@@ -0,0 +1,50 @@
+package models
+
+import (
+	"time"
+)
+
+// ShareLink 私人文件分享链接
+type ShareLink struct {
+	ID            uint       `gorm:"primaryKey" json:"id"`
+	Slug          string     `gorm:"size:64;uniqueIndex;not null" json:"slug"` // 随机短链标识
+	FileID        uint       `gorm:"not null;index" json:"file_id"`            // 分享的文件
+	UserID        uint       `gorm:"not null;index" json:"user_id"`            // 分享者
+	Password      string     `gorm:"size:255" json:"-"`                        // 访问密码哈希(可选)
+	HasPassword   bool       `gorm:"default:false" json:"has_password"`        // 是否需要密码
+	ExpiresAt     *time.Time `json:"expires_at"`                               // 过期时间(为空表示永不过期)
+	MaxDownloads  int64      `gorm:"default:0" json:"max_downloads"`           // 最大下载次数(0表示不限)
+	DownloadCount int64      `gorm:"default:0" json:"download_count"`          // 已下载次数
+	Status        string     `gorm:"size:20;default:'active'" json:"status"`   // 状态(active/revoked)
+	CreatedAt     time.Time  `json:"created_at"`
+	UpdatedAt     time.Time  `json:"updated_at"`
+
+	File PrivateFile `gorm:"foreignKey:FileID;constraint:OnDelete:CASCADE" json:"-"` // 关联文件
+}
+
+// ShareLinkStatus 定义分享链接状态常量
+const (
+	ShareLinkStatusActive  = "active"  // 有效
+	ShareLinkStatusRevoked = "revoked" // 已撤销
+)
+
+// ShareAccessLog 分享链接访问记录
+type ShareAccessLog struct {
+	ID          uint      `gorm:"primaryKey" json:"id"`
+	ShareLinkID uint      `gorm:"not null;index" json:"share_link_id"`
+	IPAddress   string    `gorm:"size:64" json:"ip_address"`
+	UserAgent   string    `gorm:"size:512" json:"user_agent"`
+	Result      string    `gorm:"size:32" json:"result"` // 访问结果(success/expired/revoked/limit_reached/bad_password/throttled)
+	CreatedAt   time.Time `json:"created_at"`
+}
+
+// ShareAccessResult 定义访问结果常量
+const (
+	ShareAccessSuccess      = "success"
+	ShareAccessExpired      = "expired"
+	ShareAccessRevoked      = "revoked"
+	ShareAccessLimitReached = "limit_reached"
+	ShareAccessBadPassword  = "bad_password"
+	ShareAccessFileMissing  = "file_missing"
+	ShareAccessThrottled    = "throttled" // 密码错误次数过多，未校验密码
+)
@@ -21,7 +21,8 @@ func GetDB() *gorm.DB {
 		// 添加 SQLite 优化配置
 		dsn := "test.db?_busy_timeout=5000&_journal_mode=WAL&_synchronous=NORMAL"
 		db, err = gorm.Open(sqlite.Open(dsn), &gorm.Config{
-			PrepareStmt: true,
+			PrepareStmt:    true,
+			TranslateError: true, // 唯一索引冲突返回 gorm.ErrDuplicatedKey
 		})
 		if err != nil {
 			log.Fatalf("failed to connect database: %v", err)
@@ -52,10 +53,58 @@ func GetDB() *gorm.DB {
 			&File{},
 
 			&PrivateFile{},
+			&ShareLink{},
+			&ShareAccessLog{},
+			&Job{},
+			&ImageVariant{},
+			&WatermarkSetting{},
+			&PrivateFolder{},
+			&RevokedToken{},
+			&UserTOTP{},
+			&RecoveryCode{},
+			&LoginAttempt{},
+			&UserIdentity{},
+			&OIDCAuthRequest{},
+			&Session{},
 		)
 		if err != nil {
 			log.Printf("数据库迁移失败: %v", err)
 		}
+		if err := migrateUserEmailIndex(db); err != nil {
+			log.Printf("创建用户邮箱唯一索引失败: %v", err)
+		}
 	})
 	return db
 }
+
+// userEmailIndex 用户邮箱的唯一索引，已删除的用户和空邮箱不参与
+const userEmailIndex = "idx_user_infos_email_unique"
+
+// migrateUserEmailIndex 给用户邮箱加唯一索引
+// 旧数据中已有重复邮箱时不创建索引，只记录重复的邮箱，管理员修改后重启即可
+func migrateUserEmailIndex(db *gorm.DB) error {
+	if db.Migrator().HasIndex(&UserInfo{}, userEmailIndex) {
+		return nil
+	}
+
+	var duplicates []string
+	err := db.Model(&UserInfo{}).
+		Where("email <> ''").
+		Group("email").
+		Having("COUNT(*) > 1").
+		Pluck("email", &duplicates).Error
+	if err != nil {
+		return err
+	}
+	if len(duplicates) > 0 {
+		log.Printf("以下邮箱被多个用户使用，修改后重启才会创建唯一索引: %v", duplicates)
+		return nil
+	}
+
+	stmt := &gorm.Statement{DB: db}
+	if err := stmt.Parse(&UserInfo{}); err != nil {
+		return err
+	}
+	return db.Exec("CREATE UNIQUE INDEX IF NOT EXISTS " + userEmailIndex + " ON " + stmt.Schema.Table +
+		" (email) WHERE deleted_at IS NULL AND email <> ''").Error
+}
@@ -5,16 +5,21 @@ import (
 )
 
 type Token struct {
-	Token      string    `gorm:"primaryKey;type:varchar(255)" json:"token"`
-	UserID     uint      `gorm:"not null;index" json:"user_id"`
-	ExpiresAt  time.Time `gorm:"not null" json:"expires_at"`
-	CreatedAt  time.Time `gorm:"autoCreateTime" json:"created_at"`
-	UpdatedAt  time.Time `gorm:"autoUpdateTime" json:"updated_at"`
-	DeviceID   string    `gorm:"type:varchar(255)" json:"device_id"`
-	IPAddress  string    `gorm:"type:varchar(255)" json:"ip_address"`
-	Status     string    `gorm:"type:varchar(20);default:'active'" json:"status"` // active, inactive, expired, revoked
-	LastUsedAt time.Time `json:"last_used_at"`
-	User       UserInfo  `gorm:"foreignKey:UserID;references:UserID" json:"-"`
+	Token       string    `gorm:"primaryKey;type:varchar(255)" json:"token"`
+	UserID      uint      `gorm:"not null;index" json:"user_id"`
+	ExpiresAt   time.Time `gorm:"not null" json:"expires_at"`
+	CreatedAt   time.Time `gorm:"autoCreateTime" json:"created_at"`
+	UpdatedAt   time.Time `gorm:"autoUpdateTime" json:"updated_at"`
+	DeviceID    string    `gorm:"type:varchar(255)" json:"device_id"`
+	IPAddress   string    `gorm:"type:varchar(255)" json:"ip_address"`
+	Status      string    `gorm:"type:varchar(20);default:'active'" json:"status"` // active, inactive, expired, revoked, rotated
+	LastUsedAt  time.Time `json:"last_used_at"`
+	AccessKeyID string    `gorm:"type:varchar(32);index" json:"access_key_id"`   // S3 接口的访问密钥 ID，令牌本身作为私有密钥
+	TokenType   string    `gorm:"type:varchar(20);default:'api';index" json:"-"` // api: API 令牌；refresh: 登录的刷新令牌（Token 字段保存哈希）
+	FamilyID    string    `gorm:"type:varchar(64);index" json:"-"`               // 刷新令牌所属的登录，轮换出的令牌共用同一个 FamilyID
+	Scopes      string    `gorm:"type:varchar(500)" json:"scopes"`               // API 令牌的范围，空格分隔，如 "images:write files:read"
+	Attempts    int       `gorm:"default:0" json:"-"`                            // 登录二次验证的失败次数
+	User        UserInfo  `gorm:"foreignKey:UserID;references:UserID" json:"-"`
 }
 
 // TokenStatus 定义可能的令牌状态
@@ -23,4 +28,15 @@ const (
 	TokenStatusInactive = "inactive"
 	TokenStatusExpired  = "expired"
 	TokenStatusRevoked  = "revoked"
+	TokenStatusRotated  = "rotated" // 刷新令牌已换发新令牌，再次使用视为泄露
+)
+
+// TokenType 定义令牌类型
+const (
+	TokenTypeAPI           = "api"
+	TokenTypeRefresh       = "refresh"
+	TokenTypeChallenge     = "mfa_challenge"  // 密码验证通过、等待两步验证的登录（Token 字段保存哈希）
+	TokenTypeEmailVerify   = "email_verify"   // 邮件中的邮箱验证链接（Token 字段保存哈希）
+	TokenTypePasswordReset = "password_reset" // 邮件中的重置密码链接（Token 字段保存哈希）
+	TokenTypeOIDCLogin     = "oidc_login"     // 单点登录回调跳转到前端时携带的一次性登录码（Token 字段保存哈希）
 )
@@ -0,0 +1,22 @@
+package models
+
+import "time"
+
+// UserTOTP 用户的 TOTP 两步验证设置，Enabled 为 false 时表示正在绑定、尚未验证
+type UserTOTP struct {
+	UserID       uint      `gorm:"primaryKey" json:"user_id"`
+	Secret       string    `gorm:"type:varchar(64);not null" json:"-"` // base32 编码的密钥
+	Enabled      bool      `gorm:"default:false" json:"enabled"`
+	LastUsedStep int64     `gorm:"default:0" json:"-"` // 最近一次使用的验证码时间步，同一验证码不能重复使用
+	CreatedAt    time.Time `json:"created_at"`
+	UpdatedAt    time.Time `json:"updated_at"`
+}
+
+// RecoveryCode 两步验证的恢复码，只保存哈希，每个恢复码只能使用一次
+type RecoveryCode struct {
+	ID        uint       `gorm:"primaryKey" json:"id"`
+	UserID    uint       `gorm:"not null;index" json:"user_id"`
+	CodeHash  string     `gorm:"type:varchar(64);not null;index" json:"-"`
+	UsedAt    *time.Time `json:"used_at"`
+	CreatedAt time.Time  `json:"created_at"`
+}
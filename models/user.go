@@ -20,19 +20,22 @@ type UserLoginInput struct {
 }
 
 type UserInfo struct {
-	UserID      uint           `gorm:"primaryKey;column:user_id" json:"user_id"`
-	Name        string         `gorm:"column:name" json:"name"`
-	Email       string         `gorm:"column:email" json:"email"`
-	Password    string         `gorm:"column:psd" json:"-"`
-	Phone       string         `gorm:"column:phone" json:"phone"`
-	Age         int            `gorm:"column:age" json:"age"`
-	Status      string         `gorm:"column:status" json:"status"`
-	LastLoginAt time.Time      `gorm:"column:last_login_at" json:"last_login_at"`
-	LastLoginIP string         `gorm:"column:last_login_ip" json:"last_login_ip"`
-	CreatedAt   time.Time      `gorm:"column:created_at" json:"created_at"`
-	UpdatedAt   time.Time      `gorm:"column:updated_at" json:"updated_at"`
-	DeletedAt   gorm.DeletedAt `gorm:"column:deleted_at" json:"-"`
-	Roles       []Roles        `gorm:"many2many:user_roles;foreignKey:UserID;joinForeignKey:UserID;References:RoleID;joinReferences:RoleID;constraint:OnDelete:CASCADE" json:"roles"`
+	UserID           uint           `gorm:"primaryKey;column:user_id" json:"user_id"`
+	Name             string         `gorm:"column:name" json:"name"`
+	Email            string         `gorm:"column:email" json:"email"` // 未删除的用户之间唯一，索引见 migrateUserEmailIndex
+	Password         string         `gorm:"column:psd" json:"-"`
+	Phone            string         `gorm:"column:phone" json:"phone"`
+	Age              int            `gorm:"column:age" json:"age"`
+	Status           string         `gorm:"column:status" json:"status"`
+	LastLoginAt      time.Time      `gorm:"column:last_login_at" json:"last_login_at"`
+	LastLoginIP      string         `gorm:"column:last_login_ip" json:"last_login_ip"`
+	StorageQuota     *int64         `gorm:"column:storage_quota" json:"storage_quota"` // 个人存储配额(字节)，为空时使用角色配额，0表示不限
+	TokensValidAfter *time.Time     `gorm:"column:tokens_valid_after" json:"-"`        // 早于该时间签发的登录令牌失效（封禁、修改密码时更新）
+	EmailVerifiedAt  *time.Time     `gorm:"column:email_verified_at" json:"email_verified_at"`
+	CreatedAt        time.Time      `gorm:"column:created_at" json:"created_at"`
+	UpdatedAt        time.Time      `gorm:"column:updated_at" json:"updated_at"`
+	DeletedAt        gorm.DeletedAt `gorm:"column:deleted_at" json:"-"`
+	Roles            []Roles        `gorm:"many2many:user_roles;foreignKey:UserID;joinForeignKey:UserID;References:RoleID;joinReferences:RoleID;constraint:OnDelete:CASCADE" json:"roles"`
 }
 
 // UserStatus 用户状态常量
@@ -40,4 +43,6 @@ const (
 	UserStatusActive   = "active"
 	UserStatusInactive = "inactive"
 	UserStatusBanned   = "banned"
+	// UserStatusUnverified 邮箱尚未验证，只有 account.unverified_permissions 中的权限
+	UserStatusUnverified = "unverified"
 )
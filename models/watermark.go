@@ -0,0 +1,36 @@
+package models
+
+import (
+	"time"
+)
+
+// WatermarkSetting 用户的默认水印设置，未设置时使用配置文件中的全局设置
+type WatermarkSetting struct {
+	ID              uint      `gorm:"primaryKey" json:"id"`
+	UserID          uint      `gorm:"uniqueIndex;not null" json:"user_id"`
+	Enabled         bool      `json:"enabled"`                 // 是否添加水印
+	Type            string    `gorm:"size:20" json:"type"`     // text 或 image
+	Text            string    `gorm:"size:255" json:"text"`    // 文字水印内容
+	Color           string    `gorm:"size:20" json:"color"`    // 文字颜色
+	ImageID         uint      `json:"image_id,omitempty"`      // 用作图片水印的图片（必须属于该用户）
+	Position        string    `gorm:"size:20" json:"position"` // 水印位置
+	Opacity         float64   `json:"opacity"`                 // 不透明度 0~1
+	Scale           float64   `json:"scale"`                   // 水印宽度占图片宽度的比例
+	ApplyToOriginal bool      `json:"apply_to_original"`       // 是否同时给保存的原图加水印
+	IsDefault       bool      `gorm:"-" json:"is_default"`     // 是否为全局默认设置（用户尚未单独设置）
+	CreatedAt       time.Time `json:"created_at"`
+	UpdatedAt       time.Time `json:"updated_at"`
+}
+
+// WatermarkSettingRequest 水印设置请求
+type WatermarkSettingRequest struct {
+	Enabled         bool    `json:"enabled" example:"true"`
+	Type            string  `json:"type" example:"text"`
+	Text            string  `json:"text" example:"© my team"`
+	Color           string  `json:"color" example:"#FFFFFF"`
+	ImageID         uint    `json:"image_id" example:"0"`
+	Position        string  `json:"position" example:"bottom-right"`
+	Opacity         float64 `json:"opacity" example:"0.5"`
+	Scale           float64 `json:"scale" example:"0.2"`
+	ApplyToOriginal bool    `json:"apply_to_original" example:"false"`
+}
@@ -0,0 +1,95 @@
+package animation
+
+import (
+	"bytes"
+	"errors"
+	"image"
+)
+
+// ErrNotAnimated 图片不是动图（或只有一帧）
+var ErrNotAnimated = errors.New("不是动图")
+
+// ErrBadAnimation 动图数据损坏
+var ErrBadAnimation = errors.New("动图数据无效")
+
+// ErrTooLarge 动图画布超过像素上限
+var ErrTooLarge = errors.New("动图尺寸超过限制")
+
+// Animation 解码后的动图，每一帧都是合成好的完整画布
+type Animation struct {
+	Width       int           // 画布宽度
+	Height      int           // 画布高度
+	Frames      []image.Image // 已解码的帧（可能因帧数或像素上限被截断）
+	Delays      []int         // 每帧显示时间（毫秒），与 Frames 一一对应
+	LoopCount   int           // 循环次数，0 表示无限循环
+	TotalFrames int           // 原图的总帧数
+	Duration    int           // 原图播放一遍的总时长（毫秒）
+}
+
+// Info 动图元数据
+type Info struct {
+	Width       int
+	Height      int
+	TotalFrames int
+	Duration    int   // 毫秒
+	FramePixels int64 // 所有帧的像素面积之和，用于防御多帧解压炸弹
+}
+
+// Limits 解码限制，防止帧数过多的动图耗尽内存
+type Limits struct {
+	MaxFrames int   // 最多解码的帧数，0 表示不限
+	MaxPixels int64 // 所有已解码帧的像素总和上限，0 表示不限
+}
+
+// allow 判断是否还能继续解码下一帧
+func (l Limits) allow(decoded, width, height int) bool {
+	if l.MaxFrames > 0 && decoded >= l.MaxFrames {
+		return false
+	}
+	if l.MaxPixels > 0 && int64(decoded+1)*int64(width)*int64(height) > l.MaxPixels {
+		return false
+	}
+	return true
+}
+
+// allowCanvas 判断画布是否在像素上限内，画布在解码前分配，必须先于分配检查
+func (l Limits) allowCanvas(width, height int) bool {
+	return l.MaxPixels <= 0 || int64(width)*int64(height) <= l.MaxPixels
+}
+
+// IsAnimated 快速判断数据是否为多帧 GIF 或动画 WebP
+func IsAnimated(data []byte) bool {
+	info, err := Probe(data)
+	return err == nil && info.TotalFrames > 1
+}
+
+// Probe 读取动图元数据而不合成帧
+func Probe(data []byte) (*Info, error) {
+	switch {
+	case isGIF(data):
+		return probeGIF(data)
+	case isWebP(data):
+		return probeWebP(data)
+	}
+	return nil, ErrNotAnimated
+}
+
+// Decode 解码动图，至少返回第一帧；不是 GIF 动图或动画 WebP 时返回 ErrNotAnimated，画布超过 limits.MaxPixels 时返回 ErrTooLarge
+// 只有一帧的动画 WebP 也会正常返回，调用方可根据 TotalFrames 判断是否真正是动图
+func Decode(data []byte, limits Limits) (*Animation, error) {
+	switch {
+	case isGIF(data):
+		return decodeGIF(data, limits)
+	case isWebP(data):
+		return decodeWebP(data, limits)
+	}
+	return nil, ErrNotAnimated
+}
+
+func isGIF(data []byte) bool {
+	return bytes.HasPrefix(data, []byte("GIF87a")) || bytes.HasPrefix(data, []byte("GIF89a"))
+}
+
+func isWebP(data []byte) bool {
+	return len(data) >= 12 && string(data[0:4]) == "RIFF" && string(data[8:12]) == "WEBP"
+}
@@ -0,0 +1,309 @@
+package animation
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"image"
+	"image/color"
+	"image/color/palette"
+	"image/gif"
+	"image/png"
+	"testing"
+
+	"github.com/HugoSmits86/nativewebp"
+)
+
+// testFrames 生成 n 帧 w x h 的纯色图片
+func testFrames(n, w, h int) []image.Image {
+	frames := make([]image.Image, n)
+	for i := range frames {
+		img := image.NewNRGBA(image.Rect(0, 0, w, h))
+		c := color.NRGBA{R: uint8(40 * i), G: 0x80, B: 0xFF, A: 0xFF}
+		for p := 0; p < len(img.Pix); p += 4 {
+			img.Pix[p], img.Pix[p+1], img.Pix[p+2], img.Pix[p+3] = c.R, c.G, c.B, c.A
+		}
+		frames[i] = img
+	}
+	return frames
+}
+
+// testGIF 编码 n 帧、每帧 100ms 的 GIF 动图
+func testGIF(t *testing.T, n, w, h int) []byte {
+	t.Helper()
+	g := &gif.GIF{LoopCount: 0}
+	for _, frame := range testFrames(n, w, h) {
+		p := image.NewPaletted(frame.Bounds(), palette.Plan9)
+		for y := 0; y < h; y++ {
+			for x := 0; x < w; x++ {
+				p.Set(x, y, frame.At(x, y))
+			}
+		}
+		g.Image = append(g.Image, p)
+		g.Delay = append(g.Delay, 10)
+	}
+	var buf bytes.Buffer
+	if err := gif.EncodeAll(&buf, g); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+// testWebP 编码 n 帧、每帧 100ms、循环 3 次的动画 WebP
+func testWebP(t *testing.T, n, w, h int) []byte {
+	t.Helper()
+	anim := &nativewebp.Animation{
+		Images:    testFrames(n, w, h),
+		Durations: make([]uint, n),
+		Disposals: make([]uint, n),
+		LoopCount: 3,
+	}
+	for i := range anim.Durations {
+		anim.Durations[i] = 100
+	}
+	var buf bytes.Buffer
+	if err := nativewebp.EncodeAll(&buf, anim, nil); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+// webpChunkOffset 返回动画 WebP 中第一个 id 数据块的位置
+func webpChunkOffset(t *testing.T, data []byte, id string) int {
+	t.Helper()
+	for pos := 12; pos+8 <= len(data); {
+		if string(data[pos:pos+4]) == id {
+			return pos
+		}
+		size := int(binary.LittleEndian.Uint32(data[pos+4 : pos+8]))
+		pos += 8 + size + size&1
+	}
+	t.Fatalf("找不到 %s 数据块", id)
+	return 0
+}
+
+func TestDecode(t *testing.T) {
+	tests := []struct {
+		name string
+		data []byte
+		loop int
+	}{
+		{"GIF", testGIF(t, 3, 8, 6), 0},
+		{"WebP", testWebP(t, 3, 8, 6), 3},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if !IsAnimated(tt.data) {
+				t.Fatal("应识别为动图")
+			}
+			info, err := Probe(tt.data)
+			if err != nil {
+				t.Fatal(err)
+			}
+			want := Info{Width: 8, Height: 6, TotalFrames: 3, Duration: 300, FramePixels: 3 * 8 * 6}
+			if *info != want {
+				t.Errorf("Probe = %+v, want %+v", *info, want)
+			}
+
+			anim, err := Decode(tt.data, Limits{})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if anim.Width != 8 || anim.Height != 6 || anim.TotalFrames != 3 || anim.Duration != 300 || anim.LoopCount != tt.loop {
+				t.Errorf("Decode = %+v", anim)
+			}
+			if len(anim.Frames) != 3 || len(anim.Delays) != 3 {
+				t.Fatalf("应解码 3 帧，got %d", len(anim.Frames))
+			}
+			if got := anim.Frames[0].Bounds(); got != image.Rect(0, 0, 8, 6) {
+				t.Errorf("帧尺寸 = %v", got)
+			}
+		})
+	}
+}
+
+func TestDecodeLimits(t *testing.T) {
+	for name, data := range map[string][]byte{
+		"GIF":  testGIF(t, 5, 4, 4),
+		"WebP": testWebP(t, 5, 4, 4),
+	} {
+		t.Run(name, func(t *testing.T) {
+			tests := []struct {
+				limits Limits
+				want   int
+			}{
+				{Limits{MaxFrames: 2}, 2},
+				{Limits{MaxPixels: 3 * 16}, 3},
+				{Limits{MaxFrames: 4, MaxPixels: 2 * 16}, 2},
+				{Limits{MaxFrames: 10}, 5},
+			}
+			for _, tt := range tests {
+				anim, err := Decode(data, tt.limits)
+				if err != nil {
+					t.Fatalf("%+v: %v", tt.limits, err)
+				}
+				// 超出限制的帧不解码，但仍计入总帧数和总时长
+				if len(anim.Frames) != tt.want || len(anim.Delays) != tt.want {
+					t.Errorf("%+v: 解码了 %d 帧, want %d", tt.limits, len(anim.Frames), tt.want)
+				}
+				if anim.TotalFrames != 5 || anim.Duration != 500 {
+					t.Errorf("%+v: TotalFrames = %d, Duration = %d", tt.limits, anim.TotalFrames, anim.Duration)
+				}
+			}
+
+			// 画布本身超过像素上限时不分配内存
+			if _, err := Decode(data, Limits{MaxPixels: 15}); !errors.Is(err, ErrTooLarge) {
+				t.Errorf("画布超过上限应返回 ErrTooLarge，got %v", err)
+			}
+		})
+	}
+}
+
+func TestDecodeHugeCanvas(t *testing.T) {
+	// GIF 逻辑屏幕 65535x65535，实际帧只有 2x2
+	data := testGIF(t, 2, 2, 2)
+	binary.LittleEndian.PutUint16(data[6:8], 0xFFFF)
+	binary.LittleEndian.PutUint16(data[8:10], 0xFFFF)
+	if info, err := Probe(data); err != nil || info.Width != 0xFFFF || info.FramePixels != 8 {
+		t.Errorf("Probe = %+v, %v", info, err)
+	}
+	if _, err := Decode(data, Limits{MaxPixels: 50000000}); !errors.Is(err, ErrTooLarge) {
+		t.Errorf("GIF 画布过大应返回 ErrTooLarge，got %v", err)
+	}
+
+	// WebP 画布 2^24 x 2^24
+	data = testWebP(t, 2, 2, 2)
+	vp8x := webpChunkOffset(t, data, "VP8X") + 8
+	putUint24(data[vp8x+4:vp8x+7], 1<<24-1)
+	putUint24(data[vp8x+7:vp8x+10], 1<<24-1)
+	if info, err := Probe(data); err != nil || info.Width != 1<<24 || info.FramePixels != 8 {
+		t.Errorf("Probe = %+v, %v", info, err)
+	}
+	if _, err := Decode(data, Limits{MaxPixels: 50000000}); !errors.Is(err, ErrTooLarge) {
+		t.Errorf("WebP 画布过大应返回 ErrTooLarge，got %v", err)
+	}
+}
+
+func TestNotAnimated(t *testing.T) {
+	var pngData, webpData bytes.Buffer
+	frame := testFrames(1, 4, 4)[0]
+	if err := png.Encode(&pngData, frame); err != nil {
+		t.Fatal(err)
+	}
+	if err := nativewebp.Encode(&webpData, frame, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name string
+		data []byte
+	}{
+		{"空数据", nil},
+		{"非图片", []byte("hello, world")},
+		{"PNG", pngData.Bytes()},
+		{"静态 WebP", webpData.Bytes()},
+		{"单帧 GIF", testGIF(t, 1, 4, 4)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if IsAnimated(tt.data) {
+				t.Error("不应识别为动图")
+			}
+			if _, err := Decode(tt.data, Limits{}); !errors.Is(err, ErrNotAnimated) {
+				t.Errorf("Decode 应返回 ErrNotAnimated，got %v", err)
+			}
+		})
+	}
+}
+
+func TestMalformedWebP(t *testing.T) {
+	tests := []struct {
+		name   string
+		mutate func(data []byte) []byte
+	}{
+		{"ANMF 长度超出文件", func(data []byte) []byte {
+			pos := webpChunkOffset(t, data, "ANMF")
+			binary.LittleEndian.PutUint32(data[pos+4:pos+8], 0xFFFFFFF0)
+			return data
+		}},
+		{"ANMF 长度不足帧头", func(data []byte) []byte {
+			pos := webpChunkOffset(t, data, "ANMF")
+			binary.LittleEndian.PutUint32(data[pos+4:pos+8], 8)
+			return data
+		}},
+		{"ANMF 内的帧数据长度超出数据块", func(data []byte) []byte {
+			pos := webpChunkOffset(t, data, "ANMF") + 8 + 16
+			binary.LittleEndian.PutUint32(data[pos+4:pos+8], 0x7FFFFFFF)
+			return data
+		}},
+		{"ANIM 长度不足", func(data []byte) []byte {
+			pos := webpChunkOffset(t, data, "ANIM")
+			binary.LittleEndian.PutUint32(data[pos+4:pos+8], 2)
+			return data
+		}},
+		{"没有帧", func(data []byte) []byte {
+			return data[:webpChunkOffset(t, data, "ANMF")]
+		}},
+		{"帧数据损坏", func(data []byte) []byte {
+			pos := webpChunkOffset(t, data, "ANMF") + 8 + 16
+			copy(data[pos:pos+4], "XXXX")
+			return data
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data := tt.mutate(testWebP(t, 2, 4, 4))
+			if _, err := Decode(data, Limits{}); !errors.Is(err, ErrBadAnimation) {
+				t.Errorf("Decode 应返回 ErrBadAnimation，got %v", err)
+			}
+		})
+	}
+
+	// RIFF 头中的长度大于实际数据时按实际数据解析
+	data := testWebP(t, 2, 4, 4)
+	binary.LittleEndian.PutUint32(data[4:8], 0xFFFFFFFF)
+	if anim, err := Decode(data, Limits{}); err != nil || len(anim.Frames) != 2 {
+		t.Errorf("RIFF 长度过大: %+v, %v", anim, err)
+	}
+}
+
+func TestMalformedGIF(t *testing.T) {
+	data := testGIF(t, 2, 4, 4)
+
+	// 未知的数据块类型
+	bad := append([]byte{}, data...)
+	bad[len(bad)-1] = 0x99
+	if _, err := Probe(bad); !errors.Is(err, ErrBadAnimation) {
+		t.Errorf("未知数据块应返回 ErrBadAnimation，got %v", err)
+	}
+
+	// 子块长度超出文件
+	bad = append(append([]byte{}, data[:len(data)-1]...), 0x21, 0xFE, 0xFF, 'x')
+	if _, err := Probe(bad); !errors.Is(err, ErrBadAnimation) {
+		t.Errorf("子块长度超出文件应返回 ErrBadAnimation，got %v", err)
+	}
+	if _, err := Decode(bad, Limits{}); !errors.Is(err, ErrBadAnimation) {
+		t.Errorf("Decode 应返回 ErrBadAnimation，got %v", err)
+	}
+}
+
+func TestTruncatedInput(t *testing.T) {
+	for name, data := range map[string][]byte{
+		"GIF":  testGIF(t, 3, 4, 4),
+		"WebP": testWebP(t, 3, 4, 4),
+	} {
+		t.Run(name, func(t *testing.T) {
+			// 任意位置截断都不能 panic，也不能返回超出原图的帧数
+			for n := 0; n < len(data); n++ {
+				truncated := data[:n]
+				if info, err := Probe(truncated); err == nil && info.TotalFrames > 3 {
+					t.Fatalf("截断到 %d 字节: Probe = %+v", n, info)
+				}
+				anim, err := Decode(truncated, Limits{})
+				if err == nil && (anim.TotalFrames > 3 || len(anim.Frames) > 3) {
+					t.Fatalf("截断到 %d 字节: Decode = %+v", n, anim)
+				}
+			}
+		})
+	}
+}
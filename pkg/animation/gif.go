@@ -0,0 +1,167 @@
+package animation
+
+import (
+	"bytes"
+	"encoding/binary"
+	"image"
+	"image/draw"
+	"image/gif"
+)
+
+// gifDelay 将 GIF 的帧延迟（1/100 秒）转换为毫秒
+// 与浏览器一致，小于等于 10ms 的延迟按 100ms 处理
+func gifDelay(delay int) int {
+	if delay <= 1 {
+		return 100
+	}
+	return delay * 10
+}
+
+// probeGIF 扫描 GIF 数据块统计帧数、时长和帧面积，不解压图像数据
+func probeGIF(data []byte) (*Info, error) {
+	if len(data) < 13 {
+		return nil, ErrBadAnimation
+	}
+	info := &Info{
+		Width:  int(binary.LittleEndian.Uint16(data[6:8])),
+		Height: int(binary.LittleEndian.Uint16(data[8:10])),
+	}
+
+	pos := 13
+	delay := 0 // 图形控制扩展中的延迟，作用于紧随其后的一帧
+	if flags := data[10]; flags&0x80 != 0 {
+		pos += 3 << ((flags & 0x07) + 1)
+	}
+
+	for pos < len(data) {
+		switch data[pos] {
+		case 0x21: // 扩展块
+			if pos+2 > len(data) {
+				return nil, ErrBadAnimation
+			}
+			label := data[pos+1]
+			pos += 2
+			if label == 0xF9 && pos+5 <= len(data) && data[pos] == 4 {
+				delay = int(binary.LittleEndian.Uint16(data[pos+2 : pos+4]))
+			}
+			next, err := skipSubBlocks(data, pos)
+			if err != nil {
+				return nil, err
+			}
+			pos = next
+		case 0x2C: // 图像描述符
+			if pos+10 > len(data) {
+				return nil, ErrBadAnimation
+			}
+			width := int64(binary.LittleEndian.Uint16(data[pos+5 : pos+7]))
+			height := int64(binary.LittleEndian.Uint16(data[pos+7 : pos+9]))
+			flags := data[pos+9]
+			pos += 10
+			if flags&0x80 != 0 {
+				pos += 3 << ((flags & 0x07) + 1)
+			}
+			pos++ // LZW 最小码长
+			next, err := skipSubBlocks(data, pos)
+			if err != nil {
+				return nil, err
+			}
+			pos = next
+			info.TotalFrames++
+			info.Duration += gifDelay(delay)
+			delay = 0
+			info.FramePixels += width * height
+		case 0x3B: // 结束符
+			return info, nil
+		default:
+			return nil, ErrBadAnimation
+		}
+	}
+	// 缺少结束符的文件很常见，按已读到的内容返回
+	return info, nil
+}
+
+// skipSubBlocks 跳过以 0 长度块结尾的子块序列，返回下一个数据块的位置
+func skipSubBlocks(data []byte, pos int) (int, error) {
+	for {
+		if pos >= len(data) {
+			return 0, ErrBadAnimation
+		}
+		size := int(data[pos])
+		pos++
+		if size == 0 {
+			return pos, nil
+		}
+		pos += size
+	}
+}
+
+func decodeGIF(data []byte, limits Limits) (*Animation, error) {
+	g, err := gif.DecodeAll(bytes.NewReader(data))
+	if err != nil {
+		return nil, ErrBadAnimation
+	}
+	if len(g.Image) < 2 {
+		return nil, ErrNotAnimated
+	}
+
+	width, height := g.Config.Width, g.Config.Height
+	if width == 0 || height == 0 {
+		bounds := g.Image[0].Bounds()
+		width, height = bounds.Max.X, bounds.Max.Y
+	}
+
+	anim := &Animation{
+		Width:       width,
+		Height:      height,
+		TotalFrames: len(g.Image),
+		LoopCount:   g.LoopCount,
+	}
+	// gif 包中 -1 表示只播放一次
+	if g.LoopCount < 0 {
+		anim.LoopCount = 1
+	}
+
+	if !limits.allowCanvas(width, height) {
+		return nil, ErrTooLarge
+	}
+
+	canvasRect := image.Rect(0, 0, width, height)
+	canvas := image.NewNRGBA(canvasRect)
+	var previous *image.NRGBA
+
+	for i, frame := range g.Image {
+		delay := gifDelay(g.Delay[i])
+		anim.Duration += delay
+		if !limits.allow(len(anim.Frames), width, height) {
+			continue
+		}
+
+		disposal := byte(0)
+		if i < len(g.Disposal) {
+			disposal = g.Disposal[i]
+		}
+		if disposal == gif.DisposalPrevious {
+			previous = cloneNRGBA(canvas)
+		}
+
+		draw.Draw(canvas, frame.Bounds(), frame, frame.Bounds().Min, draw.Over)
+		anim.Frames = append(anim.Frames, cloneNRGBA(canvas))
+		anim.Delays = append(anim.Delays, delay)
+
+		switch disposal {
+		case gif.DisposalBackground:
+			draw.Draw(canvas, frame.Bounds(), image.Transparent, image.Point{}, draw.Src)
+		case gif.DisposalPrevious:
+			if previous != nil {
+				canvas = previous
+			}
+		}
+	}
+	return anim, nil
+}
+
+func cloneNRGBA(src *image.NRGBA) *image.NRGBA {
+	dst := image.NewNRGBA(src.Rect)
+	copy(dst.Pix, src.Pix)
+	return dst
+}
@@ -0,0 +1,223 @@
+package animation
+
+import (
+	"bytes"
+	"encoding/binary"
+	"image"
+	"image/draw"
+
+	"golang.org/x/image/webp"
+)
+
+// webpChunk RIFF 容器中的一个数据块
+type webpChunk struct {
+	id   string
+	data []byte
+}
+
+// webpFrame ANMF 数据块中的一帧
+type webpFrame struct {
+	x, y          int
+	width, height int
+	duration      int  // 毫秒
+	noBlend       bool // true 时直接覆盖，不做 alpha 混合
+	dispose       bool // true 时显示后将帧区域清空
+	payload       []webpChunk
+}
+
+// webpAnimation 动画 WebP 的结构信息
+type webpAnimation struct {
+	width, height int
+	loopCount     int
+	frames        []webpFrame
+}
+
+// readChunks 读取 RIFF 数据块序列，块长度为奇数时有 1 字节填充
+func readChunks(data []byte) ([]webpChunk, error) {
+	var chunks []webpChunk
+	for len(data) >= 8 {
+		size := binary.LittleEndian.Uint32(data[4:8])
+		if uint64(size) > uint64(len(data)-8) {
+			return nil, ErrBadAnimation
+		}
+		chunks = append(chunks, webpChunk{id: string(data[0:4]), data: data[8 : 8+size]})
+		next := 8 + int(size) + int(size&1)
+		if next > len(data) {
+			break
+		}
+		data = data[next:]
+	}
+	return chunks, nil
+}
+
+func uint24(b []byte) int {
+	return int(b[0]) | int(b[1])<<8 | int(b[2])<<16
+}
+
+// parseWebP 解析动画 WebP 的 VP8X、ANIM 和 ANMF 数据块
+func parseWebP(data []byte) (*webpAnimation, error) {
+	if len(data) < 12 {
+		return nil, ErrBadAnimation
+	}
+	riffSize := int(binary.LittleEndian.Uint32(data[4:8]))
+	if riffSize+8 < len(data) && riffSize >= 4 {
+		data = data[:riffSize+8]
+	}
+	chunks, err := readChunks(data[12:])
+	if err != nil {
+		return nil, err
+	}
+	if len(chunks) == 0 || chunks[0].id != "VP8X" || len(chunks[0].data) < 10 {
+		return nil, ErrNotAnimated
+	}
+
+	const animationBit = 1 << 1
+	vp8x := chunks[0].data
+	if vp8x[0]&animationBit == 0 {
+		return nil, ErrNotAnimated
+	}
+
+	anim := &webpAnimation{
+		width:  uint24(vp8x[4:7]) + 1,
+		height: uint24(vp8x[7:10]) + 1,
+	}
+	for _, chunk := range chunks[1:] {
+		switch chunk.id {
+		case "ANIM":
+			if len(chunk.data) < 6 {
+				return nil, ErrBadAnimation
+			}
+			anim.loopCount = int(binary.LittleEndian.Uint16(chunk.data[4:6]))
+		case "ANMF":
+			if len(chunk.data) < 16 {
+				return nil, ErrBadAnimation
+			}
+			payload, err := readChunks(chunk.data[16:])
+			if err != nil {
+				return nil, err
+			}
+			flags := chunk.data[15]
+			anim.frames = append(anim.frames, webpFrame{
+				x:        uint24(chunk.data[0:3]) * 2,
+				y:        uint24(chunk.data[3:6]) * 2,
+				width:    uint24(chunk.data[6:9]) + 1,
+				height:   uint24(chunk.data[9:12]) + 1,
+				duration: uint24(chunk.data[12:15]),
+				noBlend:  flags&0x02 != 0,
+				dispose:  flags&0x01 != 0,
+				payload:  payload,
+			})
+		}
+	}
+	if len(anim.frames) == 0 {
+		return nil, ErrBadAnimation
+	}
+	return anim, nil
+}
+
+// decodeWebPFrame 把 ANMF 中的帧数据重新封装为独立的 WebP 文件后解码
+func decodeWebPFrame(frame webpFrame) (image.Image, error) {
+	var alph, bitstream *webpChunk
+	for i := range frame.payload {
+		switch frame.payload[i].id {
+		case "ALPH":
+			alph = &frame.payload[i]
+		case "VP8 ", "VP8L":
+			bitstream = &frame.payload[i]
+		}
+	}
+	if bitstream == nil {
+		return nil, ErrBadAnimation
+	}
+
+	var body bytes.Buffer
+	body.WriteString("WEBP")
+	if alph != nil && bitstream.id == "VP8 " {
+		vp8x := make([]byte, 10)
+		vp8x[0] = 1 << 4 // alpha
+		putUint24(vp8x[4:7], frame.width-1)
+		putUint24(vp8x[7:10], frame.height-1)
+		writeChunk(&body, "VP8X", vp8x)
+		writeChunk(&body, "ALPH", alph.data)
+	}
+	writeChunk(&body, bitstream.id, bitstream.data)
+
+	var file bytes.Buffer
+	file.WriteString("RIFF")
+	binary.Write(&file, binary.LittleEndian, uint32(body.Len()))
+	file.Write(body.Bytes())
+
+	return webp.Decode(&file)
+}
+
+func writeChunk(buf *bytes.Buffer, id string, data []byte) {
+	buf.WriteString(id)
+	binary.Write(buf, binary.LittleEndian, uint32(len(data)))
+	buf.Write(data)
+	if len(data)&1 == 1 {
+		buf.WriteByte(0)
+	}
+}
+
+func putUint24(b []byte, v int) {
+	b[0] = byte(v)
+	b[1] = byte(v >> 8)
+	b[2] = byte(v >> 16)
+}
+
+func probeWebP(data []byte) (*Info, error) {
+	anim, err := parseWebP(data)
+	if err != nil {
+		return nil, err
+	}
+	info := &Info{Width: anim.width, Height: anim.height, TotalFrames: len(anim.frames)}
+	for _, f := range anim.frames {
+		info.Duration += f.duration
+		info.FramePixels += int64(f.width) * int64(f.height)
+	}
+	return info, nil
+}
+
+func decodeWebP(data []byte, limits Limits) (*Animation, error) {
+	parsed, err := parseWebP(data)
+	if err != nil {
+		return nil, err
+	}
+	// VP8X 中的画布尺寸最大可达 2^24，不检查会在解码任何一帧之前耗尽内存
+	if !limits.allowCanvas(parsed.width, parsed.height) {
+		return nil, ErrTooLarge
+	}
+	anim := &Animation{
+		Width:       parsed.width,
+		Height:      parsed.height,
+		LoopCount:   parsed.loopCount,
+		TotalFrames: len(parsed.frames),
+	}
+
+	canvas := image.NewNRGBA(image.Rect(0, 0, parsed.width, parsed.height))
+	for _, frame := range parsed.frames {
+		anim.Duration += frame.duration
+		if !limits.allow(len(anim.Frames), parsed.width, parsed.height) {
+			continue
+		}
+
+		img, err := decodeWebPFrame(frame)
+		if err != nil {
+			return nil, ErrBadAnimation
+		}
+
+		rect := image.Rect(frame.x, frame.y, frame.x+frame.width, frame.y+frame.height).Intersect(canvas.Rect)
+		op := draw.Over
+		if frame.noBlend {
+			op = draw.Src
+		}
+		draw.Draw(canvas, rect, img, img.Bounds().Min, op)
+		anim.Frames = append(anim.Frames, cloneNRGBA(canvas))
+		anim.Delays = append(anim.Delays, frame.duration)
+
+		if frame.dispose {
+			draw.Draw(canvas, rect, image.Transparent, image.Point{}, draw.Src)
+		}
+	}
+	return anim, nil
+}
@@ -0,0 +1,105 @@
+package cache
+
+import (
+	"sync"
+	"time"
+)
+
+// authCacheTTL 认证状态的缓存时间，多实例部署时其他实例的封禁、撤销在该时间内生效
+const authCacheTTL = 30 * time.Second
+
+// UserAuthState 每次认证时检查的用户状态
+type UserAuthState struct {
+	Exists           bool      // 用户是否存在（未被删除）
+	Status           string    // 用户状态
+	TokensValidAfter time.Time // 早于该时间签发的登录令牌失效
+
+	TwoFactorSetupRequired bool // 角色要求两步验证但用户尚未启用
+}
+
+type userAuthEntry struct {
+	state     UserAuthState
+	expiresAt time.Time
+}
+
+type revokedEntry struct {
+	revoked   bool
+	expiresAt time.Time
+}
+
+var (
+	userAuthCache       = make(map[uint]userAuthEntry)
+	revokedTokenCache   = make(map[string]revokedEntry)
+	revokedSessionCache = make(map[string]revokedEntry)
+	authCacheMutex      = &sync.RWMutex{}
+)
+
+func GetUserAuthState(userID uint) (UserAuthState, bool) {
+	authCacheMutex.RLock()
+	entry, exists := userAuthCache[userID]
+	authCacheMutex.RUnlock()
+	if !exists || time.Now().After(entry.expiresAt) {
+		return UserAuthState{}, false
+	}
+	return entry.state, true
+}
+
+func SetUserAuthState(userID uint, state UserAuthState) {
+	authCacheMutex.Lock()
+	userAuthCache[userID] = userAuthEntry{state: state, expiresAt: time.Now().Add(authCacheTTL)}
+	authCacheMutex.Unlock()
+}
+
+func ClearUserAuthState(userID uint) {
+	authCacheMutex.Lock()
+	delete(userAuthCache, userID)
+	authCacheMutex.Unlock()
+}
+
+// GetTokenRevoked 返回缓存的访问令牌撤销状态
+func GetTokenRevoked(jti string) (bool, bool) {
+	authCacheMutex.RLock()
+	entry, exists := revokedTokenCache[jti]
+	authCacheMutex.RUnlock()
+	if !exists || time.Now().After(entry.expiresAt) {
+		return false, false
+	}
+	return entry.revoked, true
+}
+
+func SetTokenRevoked(jti string, revoked bool) {
+	authCacheMutex.Lock()
+	setRevoked(revokedTokenCache, jti, revoked)
+	authCacheMutex.Unlock()
+}
+
+// GetSessionRevoked 返回缓存的登录会话撤销状态
+func GetSessionRevoked(sessionID string) (bool, bool) {
+	authCacheMutex.RLock()
+	entry, exists := revokedSessionCache[sessionID]
+	authCacheMutex.RUnlock()
+	if !exists || time.Now().After(entry.expiresAt) {
+		return false, false
+	}
+	return entry.revoked, true
+}
+
+func SetSessionRevoked(sessionID string, revoked bool) {
+	authCacheMutex.Lock()
+	setRevoked(revokedSessionCache, sessionID, revoked)
+	authCacheMutex.Unlock()
+}
+
+// setRevoked 调用方需持有写锁
+func setRevoked(entries map[string]revokedEntry, key string, revoked bool) {
+	now := time.Now()
+	// 顺便清理过期的缓存项，避免令牌数量增长后占用过多内存
+	if len(entries) > 10000 {
+		for k, entry := range entries {
+			if now.After(entry.expiresAt) {
+				delete(entries, k)
+			}
+		}
+	}
+	entries[key] = revokedEntry{revoked: revoked, expiresAt: now.Add(authCacheTTL)}
+}
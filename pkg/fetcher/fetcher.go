@@ -0,0 +1,234 @@
+package fetcher
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net"
+	"net/http"
+	"net/netip"
+	"net/url"
+	"path"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// 默认限制
+const (
+	DefaultTimeout      = 15 * time.Second
+	DefaultMaxRedirects = 3
+	DefaultMaxSize      = 10 << 20
+	userAgent           = "img_hosting-fetcher/1.0"
+)
+
+var (
+	ErrInvalidURL      = errors.New("无效的URL，只支持 http 和 https")
+	ErrBlockedAddress  = errors.New("禁止访问内网或保留地址")
+	ErrTooManyRedirect = errors.New("重定向次数过多")
+	ErrTooLarge        = errors.New("远程文件超过大小限制")
+	ErrBadStatus       = errors.New("远程服务器返回错误状态")
+)
+
+// Result 下载结果
+type Result struct {
+	Data        []byte
+	FileName    string // 从 Content-Disposition 或 URL 路径推断的文件名
+	ContentType string // 远程服务器声明的类型，仅供参考
+	FinalURL    string // 跟随重定向后的最终地址
+}
+
+// Fetcher 服务端下载远程文件，内置 SSRF 防护
+// 地址检查在建立连接时针对实际解析出的 IP 进行，DNS 重绑定也无法绕过
+type Fetcher struct {
+	MaxSize      int64         // 最大下载字节数
+	Timeout      time.Duration // 整个请求（含重定向和读取）的超时时间
+	MaxRedirects int           // 最多跟随的重定向次数
+	AllowPrivate bool          // 是否允许访问内网地址，仅用于测试或可信环境
+
+	blocked    func(netip.Addr) bool // 地址检查函数，为空时使用 IsBlocked
+	clientOnce sync.Once
+	client     *http.Client
+}
+
+// New 创建下载器，参数为 0 时使用默认值
+func New(maxSize int64, timeout time.Duration, maxRedirects int) *Fetcher {
+	if maxSize <= 0 {
+		maxSize = DefaultMaxSize
+	}
+	if timeout <= 0 {
+		timeout = DefaultTimeout
+	}
+	if maxRedirects < 0 {
+		maxRedirects = DefaultMaxRedirects
+	}
+	return &Fetcher{MaxSize: maxSize, Timeout: timeout, MaxRedirects: maxRedirects}
+}
+
+// httpClient 返回 HTTP 客户端，首次请求时创建，可以被多个请求并发使用
+// 应在开始下载前设置好各字段，下载过程中修改字段是不安全的
+func (f *Fetcher) httpClient() *http.Client {
+	f.clientOnce.Do(f.initClient)
+	return f.client
+}
+
+// initClient 创建带地址检查的 HTTP 客户端
+func (f *Fetcher) initClient() {
+	dialer := &net.Dialer{
+		Timeout: f.Timeout,
+		Control: func(network, address string, _ syscall.RawConn) error {
+			if f.AllowPrivate {
+				return nil
+			}
+			host, _, err := net.SplitHostPort(address)
+			if err != nil {
+				return err
+			}
+			addr, err := netip.ParseAddr(host)
+			if err != nil || f.isBlocked(addr) {
+				return fmt.Errorf("%w: %s", ErrBlockedAddress, host)
+			}
+			return nil
+		},
+	}
+
+	transport := &http.Transport{
+		// 不使用环境变量中的代理，否则连接检查的是代理地址
+		Proxy:                 nil,
+		DialContext:           dialer.DialContext,
+		TLSHandshakeTimeout:   f.Timeout,
+		ResponseHeaderTimeout: f.Timeout,
+		MaxIdleConns:          10,
+		IdleConnTimeout:       30 * time.Second,
+	}
+
+	f.client = &http.Client{
+		Transport: transport,
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			if len(via) > f.MaxRedirects {
+				return ErrTooManyRedirect
+			}
+			if req.URL.Scheme != "http" && req.URL.Scheme != "https" {
+				return ErrInvalidURL
+			}
+			return nil
+		},
+	}
+}
+
+// isBlocked 检查建立连接的目标地址
+func (f *Fetcher) isBlocked(addr netip.Addr) bool {
+	if f.blocked != nil {
+		return f.blocked(addr)
+	}
+	return IsBlocked(addr)
+}
+
+// Fetch 下载远程文件
+func (f *Fetcher) Fetch(ctx context.Context, rawURL string) (*Result, error) {
+	u, err := url.Parse(strings.TrimSpace(rawURL))
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return nil, ErrInvalidURL
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, f.Timeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u.String(), nil)
+	if err != nil {
+		return nil, ErrInvalidURL
+	}
+	req.Header.Set("User-Agent", userAgent)
+	req.Header.Set("Accept", "image/*")
+
+	resp, err := f.httpClient().Do(req)
+	if err != nil {
+		switch {
+		case errors.Is(err, ErrBlockedAddress):
+			return nil, ErrBlockedAddress
+		case errors.Is(err, ErrTooManyRedirect):
+			return nil, ErrTooManyRedirect
+		case errors.Is(err, ErrInvalidURL):
+			return nil, ErrInvalidURL
+		}
+		return nil, fmt.Errorf("下载远程文件失败: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("%w: %d", ErrBadStatus, resp.StatusCode)
+	}
+	if resp.ContentLength > f.MaxSize {
+		return nil, ErrTooLarge
+	}
+
+	// 多读一个字节用于判断是否超限，服务器可能不返回或谎报 Content-Length
+	data, err := io.ReadAll(io.LimitReader(resp.Body, f.MaxSize+1))
+	if err != nil {
+		return nil, fmt.Errorf("读取远程文件失败: %w", err)
+	}
+	if int64(len(data)) > f.MaxSize {
+		return nil, ErrTooLarge
+	}
+
+	return &Result{
+		Data:        data,
+		FileName:    fileName(resp),
+		ContentType: resp.Header.Get("Content-Type"),
+		FinalURL:    resp.Request.URL.String(),
+	}, nil
+}
+
+// fileName 优先使用 Content-Disposition 中的文件名，其次使用最终 URL 的路径
+func fileName(resp *http.Response) string {
+	if cd := resp.Header.Get("Content-Disposition"); cd != "" {
+		if _, params, err := mime.ParseMediaType(cd); err == nil && params["filename"] != "" {
+			return path.Base(params["filename"])
+		}
+	}
+	name := path.Base(resp.Request.URL.Path)
+	if name == "/" || name == "." {
+		return ""
+	}
+	if unescaped, err := url.PathUnescape(name); err == nil {
+		name = unescaped
+	}
+	return name
+}
+
+// blockedPrefixes 除 netip 自带判断外需要额外屏蔽的保留网段
+var blockedPrefixes = []netip.Prefix{
+	netip.MustParsePrefix("0.0.0.0/8"),      // 本网络
+	netip.MustParsePrefix("100.64.0.0/10"),  // 运营商级 NAT
+	netip.MustParsePrefix("192.0.0.0/24"),   // IETF 协议分配
+	netip.MustParsePrefix("198.18.0.0/15"),  // 基准测试
+	netip.MustParsePrefix("240.0.0.0/4"),    // 保留
+	netip.MustParsePrefix("64:ff9b::/96"),   // NAT64
+	netip.MustParsePrefix("64:ff9b:1::/48"), // 本地 NAT64
+	netip.MustParsePrefix("2001:db8::/32"),  // 文档
+	netip.MustParsePrefix("fec0::/10"),      // 已废弃的站点本地地址
+}
+
+// IsBlocked 判断地址是否为回环、内网、链路本地、组播或其他保留地址
+func IsBlocked(addr netip.Addr) bool {
+	addr = addr.Unmap()
+	if !addr.IsValid() ||
+		addr.IsLoopback() ||
+		addr.IsPrivate() ||
+		addr.IsLinkLocalUnicast() ||
+		addr.IsLinkLocalMulticast() ||
+		addr.IsInterfaceLocalMulticast() ||
+		addr.IsMulticast() ||
+		addr.IsUnspecified() {
+		return true
+	}
+	for _, prefix := range blockedPrefixes {
+		if prefix.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
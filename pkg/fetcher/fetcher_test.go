@@ -0,0 +1,308 @@
+package fetcher
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// newTestFetcher 创建允许访问 httptest 服务器的下载器
+func newTestFetcher() *Fetcher {
+	f := New(1024, 5*time.Second, 2)
+	f.AllowPrivate = true
+	return f
+}
+
+func TestFetch(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("User-Agent") != userAgent {
+			t.Errorf("User-Agent = %q", r.Header.Get("User-Agent"))
+		}
+		w.Header().Set("Content-Type", "image/png")
+		w.Header().Set("Content-Disposition", `attachment; filename="../cat.png"`)
+		w.Write([]byte("png data"))
+	}))
+	defer srv.Close()
+
+	result, err := newTestFetcher().Fetch(context.Background(), srv.URL+"/images/x")
+	if err != nil {
+		t.Fatalf("下载失败: %v", err)
+	}
+	if string(result.Data) != "png data" || result.ContentType != "image/png" || result.FileName != "cat.png" {
+		t.Errorf("结果 = %+v", result)
+	}
+}
+
+func TestFetchInvalidURL(t *testing.T) {
+	for _, rawURL := range []string{"", "ftp://example.com/a.png", "file:///etc/passwd", "http://", "not a url"} {
+		if _, err := newTestFetcher().Fetch(context.Background(), rawURL); !errors.Is(err, ErrInvalidURL) {
+			t.Errorf("Fetch(%q) = %v, want ErrInvalidURL", rawURL, err)
+		}
+	}
+}
+
+func TestFetchBlocksLoopbackByDefault(t *testing.T) {
+	hit := false
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hit = true
+	}))
+	defer srv.Close()
+
+	f := New(1024, 5*time.Second, 2)
+	_, port, _ := net.SplitHostPort(srv.Listener.Addr().String())
+	for _, rawURL := range []string{srv.URL, "http://localhost:" + port, "http://[::ffff:127.0.0.1]:" + port} {
+		if _, err := f.Fetch(context.Background(), rawURL); !errors.Is(err, ErrBlockedAddress) {
+			t.Errorf("Fetch(%q) = %v, want ErrBlockedAddress", rawURL, err)
+		}
+	}
+	if hit {
+		t.Error("被禁止的地址不应建立连接")
+	}
+
+	f = New(1024, 5*time.Second, 2)
+	f.AllowPrivate = true
+	if _, err := f.Fetch(context.Background(), srv.URL); err != nil {
+		t.Errorf("AllowPrivate 时应允许访问回环地址: %v", err)
+	}
+}
+
+// 重定向到内网地址时，在建立连接前由拨号检查拦截
+func TestFetchRedirectToPrivateAddress(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, "http://10.0.0.1/latest/meta-data/", http.StatusFound)
+	}))
+	defer srv.Close()
+
+	var mu sync.Mutex
+	var dialed []string
+	f := New(1024, 5*time.Second, 2)
+	f.blocked = func(addr netip.Addr) bool {
+		mu.Lock()
+		dialed = append(dialed, addr.String())
+		mu.Unlock()
+		// 只放行测试服务器
+		return addr != netip.MustParseAddr("127.0.0.1") && IsBlocked(addr)
+	}
+
+	if _, err := f.Fetch(context.Background(), srv.URL); !errors.Is(err, ErrBlockedAddress) {
+		t.Fatalf("重定向到内网地址应被拦截，got %v", err)
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if strings.Join(dialed, ",") != "127.0.0.1,10.0.0.1" {
+		t.Errorf("检查过的地址 = %v", dialed)
+	}
+}
+
+func TestFetchRedirectLimit(t *testing.T) {
+	var srv *httptest.Server
+	srv = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var n int
+		fmt.Sscanf(r.URL.Path, "/%d", &n)
+		if n > 0 {
+			http.Redirect(w, r, fmt.Sprintf("%s/%d", srv.URL, n-1), http.StatusFound)
+			return
+		}
+		w.Write([]byte("done"))
+	}))
+	defer srv.Close()
+
+	f := newTestFetcher()
+	result, err := f.Fetch(context.Background(), srv.URL+"/2")
+	if err != nil {
+		t.Fatalf("两次重定向应被允许: %v", err)
+	}
+	if result.FinalURL != srv.URL+"/0" {
+		t.Errorf("FinalURL = %q", result.FinalURL)
+	}
+	if _, err := f.Fetch(context.Background(), srv.URL+"/3"); !errors.Is(err, ErrTooManyRedirect) {
+		t.Errorf("超过重定向次数应返回 ErrTooManyRedirect，got %v", err)
+	}
+}
+
+func TestFetchRedirectToOtherScheme(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, "file:///etc/passwd", http.StatusFound)
+	}))
+	defer srv.Close()
+
+	if _, err := newTestFetcher().Fetch(context.Background(), srv.URL); !errors.Is(err, ErrInvalidURL) {
+		t.Errorf("重定向到非 http 地址应被拒绝，got %v", err)
+	}
+}
+
+func TestFetchSizeLimit(t *testing.T) {
+	body := bytes.Repeat([]byte("a"), 2048)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/declared":
+			// 如实声明的超大文件
+			w.Header().Set("Content-Length", "2048")
+			w.Write(body)
+		case "/chunked":
+			// 不声明 Content-Length，分块发送
+			for i := 0; i < len(body); i += 256 {
+				w.Write(body[i : i+256])
+				w.(http.Flusher).Flush()
+			}
+		case "/exact":
+			w.Write(body[:1024])
+		}
+	}))
+	defer srv.Close()
+
+	f := newTestFetcher()
+	for _, p := range []string{"/declared", "/chunked"} {
+		if _, err := f.Fetch(context.Background(), srv.URL+p); !errors.Is(err, ErrTooLarge) {
+			t.Errorf("%s: 超过大小限制应返回 ErrTooLarge，got %v", p, err)
+		}
+	}
+	result, err := f.Fetch(context.Background(), srv.URL+"/exact")
+	if err != nil || len(result.Data) != 1024 {
+		t.Errorf("恰好等于限制的文件应被接受: %v", err)
+	}
+}
+
+// 服务器声明的 Content-Length 与实际发送的数据不符
+func TestFetchSizeLimitLyingContentLength(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go func(conn net.Conn) {
+				defer conn.Close()
+				buf := make([]byte, 4096)
+				conn.Read(buf)
+				fmt.Fprint(conn, "HTTP/1.1 200 OK\r\nContent-Length: 16\r\nConnection: close\r\n\r\n")
+				conn.Write(bytes.Repeat([]byte("a"), 64<<10))
+			}(conn)
+		}
+	}()
+
+	result, err := newTestFetcher().Fetch(context.Background(), "http://"+ln.Addr().String()+"/")
+	if err != nil {
+		t.Fatalf("下载失败: %v", err)
+	}
+	if len(result.Data) != 16 {
+		t.Errorf("应只读取声明的 16 字节，got %d", len(result.Data))
+	}
+}
+
+func TestFetchTimeout(t *testing.T) {
+	release := make(chan struct{})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/slow-header":
+			<-release
+		case "/slow-body":
+			// 先返回响应头，正文迟迟不发完
+			w.Write([]byte("partial"))
+			w.(http.Flusher).Flush()
+			<-release
+		}
+	}))
+	defer srv.Close()
+	defer close(release)
+
+	f := New(1024, 200*time.Millisecond, 2)
+	f.AllowPrivate = true
+	for _, p := range []string{"/slow-header", "/slow-body"} {
+		start := time.Now()
+		if _, err := f.Fetch(context.Background(), srv.URL+p); err == nil {
+			t.Errorf("%s: 超时应返回错误", p)
+		}
+		if elapsed := time.Since(start); elapsed > 2*time.Second {
+			t.Errorf("%s: 超时未生效，耗时 %s", p, elapsed)
+		}
+	}
+}
+
+func TestFetchBadStatus(t *testing.T) {
+	srv := httptest.NewServer(http.NotFoundHandler())
+	defer srv.Close()
+
+	if _, err := newTestFetcher().Fetch(context.Background(), srv.URL); !errors.Is(err, ErrBadStatus) {
+		t.Errorf("非 200 状态应返回 ErrBadStatus，got %v", err)
+	}
+}
+
+func TestFetchConcurrent(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("ok"))
+	}))
+	defer srv.Close()
+
+	f := newTestFetcher()
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := f.Fetch(context.Background(), srv.URL); err != nil {
+				t.Error(err)
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+func TestIsBlocked(t *testing.T) {
+	tests := []struct {
+		addr    string
+		blocked bool
+	}{
+		{"127.0.0.1", true},
+		{"10.1.2.3", true},
+		{"172.16.0.1", true},
+		{"192.168.1.1", true},
+		{"169.254.169.254", true},
+		{"0.0.0.0", true},
+		{"0.1.2.3", true},
+		{"100.64.0.1", true},
+		{"100.127.255.254", true},
+		{"198.18.0.1", true},
+		{"224.0.0.1", true},
+		{"255.255.255.255", true},
+		{"::1", true},
+		{"::", true},
+		{"fc00::1", true},
+		{"fe80::1", true},
+		{"ff02::1", true},
+		{"::ffff:127.0.0.1", true},
+		{"::ffff:10.0.0.1", true},
+		{"::ffff:169.254.169.254", true},
+		{"64:ff9b::7f00:1", true},
+		{"64:ff9b::808:808", true},
+		{"64:ff9b:1::1", true},
+		{"2001:db8::1", true},
+		{"8.8.8.8", false},
+		{"100.63.255.255", false},
+		{"100.128.0.1", false},
+		{"::ffff:8.8.8.8", false},
+		{"2001:4860:4860::8888", false},
+	}
+	for _, tt := range tests {
+		if got := IsBlocked(netip.MustParseAddr(tt.addr)); got != tt.blocked {
+			t.Errorf("IsBlocked(%s) = %v, want %v", tt.addr, got, tt.blocked)
+		}
+	}
+	if !IsBlocked(netip.Addr{}) {
+		t.Error("无效地址应被禁止")
+	}
+}
@@ -0,0 +1,149 @@
+package filetype
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"image"
+	_ "image/gif"
+	_ "image/jpeg"
+	_ "image/png"
+	"img_hosting/pkg/animation"
+	"io"
+	"strings"
+
+	"github.com/gabriel-vasile/mimetype"
+	_ "golang.org/x/image/webp"
+)
+
+// DefaultMaxPixels 默认允许的最大像素数（约 7000x7000），用于防御解压炸弹
+const DefaultMaxPixels int64 = 50000000
+
+var (
+	ErrTypeMismatch  = errors.New("文件内容与扩展名不匹配")
+	ErrTooManyPixels = errors.New("图片像素数超过限制")
+	ErrBadImage      = errors.New("图片内容已损坏或无法解码")
+)
+
+// extensionMIMEs 扩展名与其允许的真实 MIME 类型
+var extensionMIMEs = map[string][]string{
+	".jpg":  {"image/jpeg"},
+	".jpeg": {"image/jpeg"},
+	".png":  {"image/png"},
+	".gif":  {"image/gif"},
+	".webp": {"image/webp"},
+	".pdf":  {"application/pdf"},
+	".doc":  {"application/msword", "application/x-ole-storage"},
+	".xls":  {"application/vnd.ms-excel", "application/x-ole-storage"},
+	".docx": {"application/vnd.openxmlformats-officedocument.wordprocessingml.document"},
+	".xlsx": {"application/vnd.openxmlformats-officedocument.spreadsheetml.sheet"},
+	".txt":  {"text/plain"},
+}
+
+// Detect 根据文件头的魔数识别 MIME 类型
+func Detect(data []byte) string {
+	return mimetype.Detect(data).String()
+}
+
+// DetectExtension 根据文件头的魔数推断扩展名（含点），无法识别时返回空字符串
+func DetectExtension(data []byte) string {
+	return mimetype.Detect(data).Extension()
+}
+
+// DetectReader 从读取器中识别 MIME 类型，只读取文件头部
+func DetectReader(r io.Reader) (string, error) {
+	m, err := mimetype.DetectReader(r)
+	if err != nil {
+		return "", err
+	}
+	return m.String(), nil
+}
+
+// IsImage 判断 MIME 类型是否为可解码的图片
+func IsImage(mimeType string) bool {
+	return strings.HasPrefix(mimeType, "image/")
+}
+
+// MatchExtension 校验识别出的 MIME 类型与扩展名是否一致
+func MatchExtension(mimeType, ext string) error {
+	allowed, ok := extensionMIMEs[strings.ToLower(ext)]
+	if !ok {
+		return fmt.Errorf("不支持的文件类型: %s", ext)
+	}
+	base := baseMIME(mimeType)
+	m := mimetype.Lookup(base)
+	for _, expected := range allowed {
+		if base == expected || (m != nil && m.Is(expected)) {
+			return nil
+		}
+	}
+	return fmt.Errorf("%w: 扩展名 %s, 实际类型 %s", ErrTypeMismatch, ext, mimeType)
+}
+
+// Validate 识别文件内容类型并校验与扩展名一致，返回识别出的 MIME 类型
+func Validate(data []byte, ext string) (string, error) {
+	mimeType := Detect(data)
+	if err := MatchExtension(mimeType, ext); err != nil {
+		return "", err
+	}
+	return mimeType, nil
+}
+
+// ValidateImage 校验图片的真实类型，并完整解码以检测损坏文件和解压炸弹
+func ValidateImage(data []byte, ext string, maxPixels int64) (string, error) {
+	mimeType, err := Validate(data, ext)
+	if err != nil {
+		return "", err
+	}
+	if !IsImage(mimeType) {
+		return "", fmt.Errorf("%w: %s 不是图片", ErrTypeMismatch, mimeType)
+	}
+	if err := CheckImage(data, maxPixels); err != nil {
+		return "", err
+	}
+	return mimeType, nil
+}
+
+// maxAnimatedPixelsFactor 动图所有帧像素之和允许达到单帧上限的倍数
+const maxAnimatedPixelsFactor = 4
+
+// CheckImage 先读取图片尺寸判断像素数，再完整解码图片
+func CheckImage(data []byte, maxPixels int64) error {
+	if maxPixels <= 0 {
+		maxPixels = DefaultMaxPixels
+	}
+
+	cfg, _, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrBadImage, err)
+	}
+	if cfg.Width <= 0 || cfg.Height <= 0 {
+		return ErrBadImage
+	}
+	if int64(cfg.Width)*int64(cfg.Height) > maxPixels {
+		return fmt.Errorf("%w: %dx%d", ErrTooManyPixels, cfg.Width, cfg.Height)
+	}
+
+	// 动图按所有帧的面积之和计算，防御多帧解压炸弹
+	if info, err := animation.Probe(data); err == nil && info.FramePixels > maxPixels*maxAnimatedPixelsFactor {
+		return fmt.Errorf("%w: %d 帧共 %d 像素", ErrTooManyPixels, info.TotalFrames, info.FramePixels)
+	}
+
+	// 完整解码，确保文件没有被截断或伪造
+	if _, _, err := image.Decode(bytes.NewReader(data)); err != nil {
+		// 标准库不支持动画 WebP，改为解析动画结构并解码第一帧
+		if _, animErr := animation.Decode(data, animation.Limits{MaxFrames: 1}); animErr == nil {
+			return nil
+		}
+		return fmt.Errorf("%w: %v", ErrBadImage, err)
+	}
+	return nil
+}
+
+// baseMIME 去掉 MIME 类型中的参数部分，如 "text/plain; charset=utf-8"
+func baseMIME(mimeType string) string {
+	if i := strings.Index(mimeType, ";"); i >= 0 {
+		return strings.TrimSpace(mimeType[:i])
+	}
+	return mimeType
+}
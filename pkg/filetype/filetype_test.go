@@ -0,0 +1,221 @@
+package filetype
+
+import (
+	"archive/zip"
+	"bytes"
+	"errors"
+	"image"
+	"image/color"
+	"image/gif"
+	"image/jpeg"
+	"image/png"
+	"strings"
+	"testing"
+
+	"github.com/HugoSmits86/nativewebp"
+)
+
+func testImage(w, h int) image.Image {
+	img := image.NewNRGBA(image.Rect(0, 0, w, h))
+	for i := range img.Pix {
+		img.Pix[i] = 0xFF
+	}
+	return img
+}
+
+func encodePNG(t *testing.T, w, h int) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, testImage(w, h)); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func encodeJPEG(t *testing.T) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, testImage(4, 4), nil); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func encodeGIF(t *testing.T, frames, w, h int) []byte {
+	t.Helper()
+	g := &gif.GIF{}
+	for i := 0; i < frames; i++ {
+		g.Image = append(g.Image, image.NewPaletted(image.Rect(0, 0, w, h), color.Palette{color.Black, color.White}))
+		g.Delay = append(g.Delay, 10)
+	}
+	var buf bytes.Buffer
+	if err := gif.EncodeAll(&buf, g); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func encodeWebP(t *testing.T, frames int) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	if frames == 1 {
+		if err := nativewebp.Encode(&buf, testImage(4, 4), nil); err != nil {
+			t.Fatal(err)
+		}
+		return buf.Bytes()
+	}
+	anim := &nativewebp.Animation{
+		Images:    make([]image.Image, frames),
+		Durations: make([]uint, frames),
+		Disposals: make([]uint, frames),
+	}
+	for i := range anim.Images {
+		anim.Images[i], anim.Durations[i] = testImage(4, 4), 100
+	}
+	if err := nativewebp.EncodeAll(&buf, anim, nil); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+// encodeOOXML 生成只包含内容类型声明和主文档目录的 Office Open XML 压缩包
+func encodeOOXML(t *testing.T, dir string) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	for _, name := range []string{"[Content_Types].xml", dir + "/document.xml"} {
+		f, err := zw.Create(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		f.Write([]byte("<?xml version=\"1.0\"?><x/>"))
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+// zipWith 生成只包含一个空文件的普通压缩包
+func zipWith(t *testing.T, name string) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	if _, err := zw.Create(name); err != nil {
+		t.Fatal(err)
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+// oleHeader OLE 复合文档的文件头，旧版 Word 和 Excel 文件都使用这种格式
+var oleHeader = append([]byte{0xD0, 0xCF, 0x11, 0xE0, 0xA1, 0xB1, 0x1A, 0xE1}, make([]byte, 504)...)
+
+func TestValidateAllowedTypes(t *testing.T) {
+	tests := []struct {
+		ext  string
+		data []byte
+	}{
+		{".jpg", encodeJPEG(t)},
+		{".JPEG", encodeJPEG(t)},
+		{".png", encodePNG(t, 4, 4)},
+		{".gif", encodeGIF(t, 1, 4, 4)},
+		{".webp", encodeWebP(t, 1)},
+		{".pdf", []byte("%PDF-1.4\n1 0 obj\n<<>>\nendobj\n%%EOF\n")},
+		{".doc", oleHeader},
+		{".xls", oleHeader},
+		{".docx", encodeOOXML(t, "word")},
+		{".xlsx", encodeOOXML(t, "xl")},
+		{".txt", []byte("hello, world\n")},
+	}
+	for _, tt := range tests {
+		t.Run(tt.ext, func(t *testing.T) {
+			if _, err := Validate(tt.data, tt.ext); err != nil {
+				t.Errorf("Validate(%s) = %v, 识别为 %s", tt.ext, err, Detect(tt.data))
+			}
+		})
+	}
+}
+
+func TestValidateSpoofedExtension(t *testing.T) {
+	tests := []struct {
+		name string
+		ext  string
+		data []byte
+	}{
+		{"PNG 改名为 JPG", ".jpg", encodePNG(t, 4, 4)},
+		{"HTML 改名为 PNG", ".png", []byte("<html><script>alert(1)</script></html>")},
+		{"SVG 改名为 PNG", ".png", []byte(`<svg xmlns="http://www.w3.org/2000/svg"><script>alert(1)</script></svg>`)},
+		{"PDF 改名为 TXT", ".txt", []byte("%PDF-1.4\n%%EOF\n")},
+		{"ZIP 改名为 DOCX", ".docx", zipWith(t, "payload.exe")},
+		{"可执行文件改名为 GIF", ".gif", append([]byte("MZ\x90\x00"), make([]byte, 60)...)},
+		{"只有文件头的 PNG", ".png", []byte("\x89PN")},
+		{"只有文件头的 WebP", ".webp", []byte("RIFF\x00\x00\x00\x00WEBP")},
+		{"空文件冒充图片", ".jpg", nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := Validate(tt.data, tt.ext); !errors.Is(err, ErrTypeMismatch) {
+				t.Errorf("应返回 ErrTypeMismatch，got %v (识别为 %s)", err, Detect(tt.data))
+			}
+		})
+	}
+
+	if _, err := Validate([]byte("#!/bin/sh\n"), ".sh"); err == nil || errors.Is(err, ErrTypeMismatch) {
+		t.Errorf("不支持的扩展名应单独报错，got %v", err)
+	}
+}
+
+func TestValidateImage(t *testing.T) {
+	pngData := encodePNG(t, 100, 100)
+
+	tests := []struct {
+		name      string
+		ext       string
+		data      []byte
+		maxPixels int64
+		want      error
+	}{
+		{"正常图片", ".png", pngData, 0, nil},
+		{"动图 GIF", ".gif", encodeGIF(t, 3, 8, 8), 0, nil},
+		{"动画 WebP", ".webp", encodeWebP(t, 3), 0, nil},
+		{"像素超过上限", ".png", pngData, 100*100 - 1, ErrTooManyPixels},
+		{"多帧解压炸弹", ".gif", encodeGIF(t, 5, 10, 10), 100, ErrTooManyPixels},
+		{"被截断的图片", ".png", pngData[:len(pngData)/2], 0, ErrBadImage},
+		{"GIF 文件头的脚本", ".gif", []byte("GIF89a\x01\x00\x01\x00\x00\x00\x00<?php system($_GET['c']); ?>"), 0, ErrBadImage},
+		{"PNG 文件头后接 HTML", ".png", append(append([]byte{}, pngData[:16]...), "<html><script>alert(1)</script>"...), 0, ErrBadImage},
+		{"文本文件", ".txt", []byte("hello"), 0, ErrTypeMismatch},
+		{"PDF", ".pdf", []byte("%PDF-1.4\n%%EOF\n"), 0, ErrTypeMismatch},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := ValidateImage(tt.data, tt.ext, tt.maxPixels)
+			if tt.want == nil && err != nil {
+				t.Errorf("应通过校验，got %v", err)
+			}
+			if tt.want != nil && !errors.Is(err, tt.want) {
+				t.Errorf("应返回 %v，got %v", tt.want, err)
+			}
+		})
+	}
+}
+
+func TestDetectReader(t *testing.T) {
+	mimeType, err := DetectReader(bytes.NewReader(encodePNG(t, 4, 4)))
+	if err != nil || mimeType != "image/png" {
+		t.Errorf("DetectReader = %q, %v", mimeType, err)
+	}
+	if ext := DetectExtension(encodeJPEG(t)); ext != ".jpg" {
+		t.Errorf("DetectExtension = %q", ext)
+	}
+
+	// 空输入不能识别为图片
+	if mimeType, err := DetectReader(strings.NewReader("")); err != nil || IsImage(mimeType) {
+		t.Errorf("空输入: %q, %v", mimeType, err)
+	}
+	if IsImage(Detect(nil)) {
+		t.Error("空数据不应识别为图片")
+	}
+}
@@ -0,0 +1,254 @@
+package imageenc
+
+import (
+	"errors"
+	"image"
+	"image/color"
+	"image/color/palette"
+	"image/draw"
+	"image/gif"
+	"image/jpeg"
+	"image/png"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/HugoSmits86/nativewebp"
+)
+
+// 支持的输出格式
+const (
+	FormatWebP = "webp"
+	FormatAVIF = "avif"
+	FormatJPEG = "jpeg"
+	FormatPNG  = "png"
+	FormatGIF  = "gif"
+)
+
+// ErrUnsupportedFormat 没有注册对应格式的编码器
+var ErrUnsupportedFormat = errors.New("不支持的图片编码格式")
+
+// Encoder 图片编码器
+type Encoder func(w io.Writer, img image.Image) error
+
+// formatInfo 格式的编码器、MIME 和扩展名
+type formatInfo struct {
+	encoder   Encoder
+	mimeType  string
+	extension string
+}
+
+var (
+	formats      = make(map[string]formatInfo)
+	formatsMutex = &sync.RWMutex{}
+)
+
+// preference 内容协商时客户端权重相同的情况下的优先顺序，体积越小越靠前
+var preference = []string{FormatAVIF, FormatWebP, FormatJPEG, FormatPNG, FormatGIF}
+
+func init() {
+	Register(FormatWebP, "image/webp", ".webp", func(w io.Writer, img image.Image) error {
+		return nativewebp.Encode(w, img, nil)
+	})
+	Register(FormatJPEG, "image/jpeg", ".jpg", func(w io.Writer, img image.Image) error {
+		return jpeg.Encode(w, img, &jpeg.Options{Quality: 85})
+	})
+	Register(FormatPNG, "image/png", ".png", func(w io.Writer, img image.Image) error {
+		return png.Encode(w, img)
+	})
+	Register(FormatGIF, "image/gif", ".gif", func(w io.Writer, img image.Image) error {
+		return gif.Encode(w, img, nil)
+	})
+}
+
+// Register 注册编码器，可用于接入 AVIF 等需要额外依赖的格式
+func Register(format, mimeType, extension string, encoder Encoder) {
+	formatsMutex.Lock()
+	formats[format] = formatInfo{encoder: encoder, mimeType: mimeType, extension: extension}
+	formatsMutex.Unlock()
+}
+
+// Supported 判断是否注册了该格式的编码器
+func Supported(format string) bool {
+	formatsMutex.RLock()
+	defer formatsMutex.RUnlock()
+	_, ok := formats[format]
+	return ok
+}
+
+// Encode 按指定格式编码图片
+func Encode(w io.Writer, img image.Image, format string) error {
+	formatsMutex.RLock()
+	info, ok := formats[format]
+	formatsMutex.RUnlock()
+	if !ok {
+		return ErrUnsupportedFormat
+	}
+	return info.encoder(w, img)
+}
+
+// SupportsAnimation 判断格式是否可以编码动图
+func SupportsAnimation(format string) bool {
+	return format == FormatWebP || format == FormatGIF
+}
+
+// EncodeAnimation 将帧序列编码为动图，delays 为每帧显示时间（毫秒），loopCount 为 0 表示无限循环
+func EncodeAnimation(w io.Writer, frames []image.Image, delays []int, loopCount int, format string) error {
+	if len(frames) == 0 || len(frames) != len(delays) {
+		return errors.New("动图帧数据无效")
+	}
+
+	switch format {
+	case FormatWebP:
+		anim := &nativewebp.Animation{
+			Images:    frames,
+			Durations: make([]uint, len(frames)),
+			Disposals: make([]uint, len(frames)),
+			LoopCount: uint16(loopCount),
+		}
+		for i, d := range delays {
+			anim.Durations[i] = uint(d)
+		}
+		return nativewebp.EncodeAll(w, anim, nil)
+
+	case FormatGIF:
+		g := &gif.GIF{
+			Image:     make([]*image.Paletted, len(frames)),
+			Delay:     make([]int, len(frames)),
+			LoopCount: loopCount,
+		}
+		// GIF 的 LoopCount 中 0 表示无限循环，-1 表示只播放一次
+		if loopCount == 1 {
+			g.LoopCount = -1
+		}
+		for i, frame := range frames {
+			g.Image[i] = toPaletted(frame)
+			g.Delay[i] = (delays[i] + 5) / 10
+		}
+		return gif.EncodeAll(w, g)
+	}
+	return ErrUnsupportedFormat
+}
+
+// gifPalette Web 安全色加上一个透明色
+var gifPalette = append(palette.WebSafe[:len(palette.WebSafe):len(palette.WebSafe)], color.Transparent)
+
+// toPaletted 使用抖动将帧转换为调色板图像，半透明以下的像素转为透明色
+func toPaletted(img image.Image) *image.Paletted {
+	bounds := img.Bounds()
+	dst := image.NewPaletted(bounds, gifPalette)
+	draw.FloydSteinberg.Draw(dst, bounds, img, bounds.Min)
+
+	transparent := uint8(len(gifPalette) - 1)
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			if _, _, _, a := img.At(x, y).RGBA(); a < 0x8000 {
+				dst.SetColorIndex(x, y, transparent)
+			}
+		}
+	}
+	return dst
+}
+
+// Extension 返回格式对应的文件扩展名（含点）
+func Extension(format string) string {
+	formatsMutex.RLock()
+	defer formatsMutex.RUnlock()
+	return formats[format].extension
+}
+
+// MIMEType 返回格式对应的 MIME 类型
+func MIMEType(format string) string {
+	formatsMutex.RLock()
+	defer formatsMutex.RUnlock()
+	return formats[format].mimeType
+}
+
+// Negotiate 根据 Accept 请求头从 available 中选出最合适的格式
+// 按 q 值选择，q 值相同时按 avif > webp > jpeg > png 的顺序；没有匹配项时返回 available 中的最后一个（兼容格式）
+func Negotiate(accept string, available []string) string {
+	if len(available) == 0 {
+		return ""
+	}
+
+	candidates := make([]string, len(available))
+	copy(candidates, available)
+	sort.SliceStable(candidates, func(i, j int) bool {
+		return preferenceIndex(candidates[i]) < preferenceIndex(candidates[j])
+	})
+
+	ranges := parseAccept(accept)
+	best, bestQ := "", 0.0
+	for _, format := range candidates {
+		q := acceptQuality(ranges, MIMEType(format))
+		if q > bestQ {
+			best, bestQ = format, q
+		}
+	}
+	if best == "" {
+		return candidates[len(candidates)-1]
+	}
+	return best
+}
+
+// mediaRange Accept 头中的一项
+type mediaRange struct {
+	mimeType string
+	q        float64
+}
+
+// parseAccept 解析 Accept 请求头
+func parseAccept(accept string) []mediaRange {
+	var ranges []mediaRange
+	for _, part := range strings.Split(accept, ",") {
+		fields := strings.Split(part, ";")
+		mimeType := strings.ToLower(strings.TrimSpace(fields[0]))
+		if mimeType == "" {
+			continue
+		}
+		q := 1.0
+		for _, param := range fields[1:] {
+			key, value, ok := strings.Cut(strings.TrimSpace(param), "=")
+			if ok && strings.EqualFold(strings.TrimSpace(key), "q") {
+				if v, err := strconv.ParseFloat(strings.TrimSpace(value), 64); err == nil {
+					q = v
+				}
+			}
+		}
+		ranges = append(ranges, mediaRange{mimeType: mimeType, q: q})
+	}
+	return ranges
+}
+
+// acceptQuality 计算 MIME 类型在 Accept 中的权重，精确匹配优先于通配符
+func acceptQuality(ranges []mediaRange, mimeType string) float64 {
+	major, _, _ := strings.Cut(mimeType, "/")
+	best, specificity := 0.0, -1
+	for _, r := range ranges {
+		s := -1
+		switch {
+		case r.mimeType == mimeType:
+			s = 2
+		case r.mimeType == major+"/*":
+			s = 1
+		case r.mimeType == "*/*":
+			s = 0
+		}
+		if s > specificity {
+			best, specificity = r.q, s
+		}
+	}
+	return best
+}
+
+// preferenceIndex 返回格式在优先顺序中的位置
+func preferenceIndex(format string) int {
+	for i, f := range preference {
+		if f == format {
+			return i
+		}
+	}
+	return len(preference)
+}
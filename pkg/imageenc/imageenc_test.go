@@ -0,0 +1,154 @@
+package imageenc
+
+import (
+	"bytes"
+	"errors"
+	"image"
+	"image/color"
+	"image/gif"
+	"io"
+	"testing"
+
+	_ "image/jpeg"
+	_ "image/png"
+
+	_ "golang.org/x/image/webp"
+)
+
+func testImage(w, h int) *image.NRGBA {
+	img := image.NewNRGBA(image.Rect(0, 0, w, h))
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			img.Set(x, y, color.NRGBA{R: uint8(x * 20), G: uint8(y * 20), B: 0x80, A: 0xFF})
+		}
+	}
+	return img
+}
+
+func TestEncodeRoundTrip(t *testing.T) {
+	src := testImage(12, 8)
+	for _, format := range []string{FormatWebP, FormatJPEG, FormatPNG, FormatGIF} {
+		t.Run(format, func(t *testing.T) {
+			var buf bytes.Buffer
+			if err := Encode(&buf, src, format); err != nil {
+				t.Fatal(err)
+			}
+			img, decoded, err := image.Decode(&buf)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if decoded != format {
+				t.Errorf("解码格式 = %s, want %s", decoded, format)
+			}
+			if img.Bounds() != src.Bounds() {
+				t.Errorf("尺寸 = %v, want %v", img.Bounds(), src.Bounds())
+			}
+			// 无损格式逐像素一致
+			if format == FormatWebP || format == FormatPNG {
+				for y := 0; y < 8; y++ {
+					for x := 0; x < 12; x++ {
+						if got := color.NRGBAModel.Convert(img.At(x, y)); got != src.At(x, y) {
+							t.Fatalf("(%d,%d) = %v, want %v", x, y, got, src.At(x, y))
+						}
+					}
+				}
+			}
+		})
+	}
+}
+
+func TestEncodeUnsupportedFormat(t *testing.T) {
+	var buf bytes.Buffer
+	for _, format := range []string{FormatAVIF, "bmp", ""} {
+		if Supported(format) {
+			t.Errorf("%q 不应注册编码器", format)
+		}
+		if err := Encode(&buf, testImage(2, 2), format); !errors.Is(err, ErrUnsupportedFormat) {
+			t.Errorf("Encode(%q) 应返回 ErrUnsupportedFormat，got %v", format, err)
+		}
+	}
+	if buf.Len() != 0 {
+		t.Error("不支持的格式不应写入数据")
+	}
+	frames := []image.Image{testImage(2, 2)}
+	if err := EncodeAnimation(&buf, frames, []int{100}, 0, FormatJPEG); !errors.Is(err, ErrUnsupportedFormat) {
+		t.Errorf("JPEG 动图应返回 ErrUnsupportedFormat，got %v", err)
+	}
+	if err := EncodeAnimation(&buf, frames, nil, 0, FormatGIF); err == nil {
+		t.Error("帧数与延迟数不一致时应报错")
+	}
+}
+
+func TestRegister(t *testing.T) {
+	const format = "test-format"
+	t.Cleanup(func() {
+		formatsMutex.Lock()
+		delete(formats, format)
+		formatsMutex.Unlock()
+	})
+
+	Register(format, "image/x-test", ".tst", func(w io.Writer, img image.Image) error {
+		_, err := w.Write([]byte("test"))
+		return err
+	})
+	var buf bytes.Buffer
+	if err := Encode(&buf, testImage(1, 1), format); err != nil || buf.String() != "test" {
+		t.Errorf("Encode = %q, %v", buf.String(), err)
+	}
+	if MIMEType(format) != "image/x-test" || Extension(format) != ".tst" {
+		t.Errorf("MIMEType = %s, Extension = %s", MIMEType(format), Extension(format))
+	}
+}
+
+func TestEncodeAnimationGIF(t *testing.T) {
+	frames := []image.Image{testImage(4, 4), testImage(4, 4), testImage(4, 4)}
+	tests := []struct {
+		loopCount int
+		want      int
+	}{
+		{0, 0},
+		{1, -1}, // 只播放一次
+		{3, 3},
+	}
+	for _, tt := range tests {
+		var buf bytes.Buffer
+		if err := EncodeAnimation(&buf, frames, []int{100, 40, 200}, tt.loopCount, FormatGIF); err != nil {
+			t.Fatal(err)
+		}
+		g, err := gif.DecodeAll(&buf)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(g.Image) != 3 || g.LoopCount != tt.want {
+			t.Errorf("loopCount %d: %d 帧, LoopCount = %d", tt.loopCount, len(g.Image), g.LoopCount)
+		}
+		if g.Delay[0] != 10 || g.Delay[1] != 4 || g.Delay[2] != 20 {
+			t.Errorf("Delay = %v", g.Delay)
+		}
+	}
+}
+
+func TestNegotiate(t *testing.T) {
+	available := []string{FormatPNG, FormatWebP, FormatJPEG}
+	tests := []struct {
+		accept string
+		want   string
+	}{
+		{"image/webp,*/*", FormatWebP},
+		{"image/png,image/webp,*/*;q=0.8", FormatWebP},
+		{"image/webp;q=0.5,image/png", FormatPNG},
+		{"image/*", FormatWebP},
+		{"image/jpeg", FormatJPEG},
+		{"image/webp;q=0,image/*;q=0.5", FormatJPEG},
+		{"", FormatPNG},
+		{"text/html", FormatPNG},
+	}
+	for _, tt := range tests {
+		if got := Negotiate(tt.accept, available); got != tt.want {
+			t.Errorf("Negotiate(%q) = %s, want %s", tt.accept, got, tt.want)
+		}
+	}
+	if got := Negotiate("image/webp", nil); got != "" {
+		t.Errorf("没有可选格式时应返回空字符串，got %s", got)
+	}
+}
@@ -0,0 +1,225 @@
+// Package jwtkeys 管理 JWT 的签名和验证密钥，支持 HS256、RS256、EdDSA 和按 kid 轮换
+package jwtkeys
+
+import (
+	"crypto/ed25519"
+	"crypto/rsa"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"math/big"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// 支持的算法
+const (
+	AlgHS256 = "HS256"
+	AlgRS256 = "RS256"
+	AlgEdDSA = "EdDSA"
+)
+
+// MinSecretLength HS256 密钥的最小长度（字节）
+const MinSecretLength = 32
+
+var (
+	ErrUnknownKey    = errors.New("未知的签名密钥")
+	ErrNoSigningKey  = errors.New("签名密钥不存在或没有私钥")
+	ErrAlgorithm     = errors.New("令牌的签名算法与密钥不一致")
+	ErrNoKeyMaterial = errors.New("密钥内容为空")
+)
+
+// Spec 密钥配置，PEM 为密钥文件的内容
+type Spec struct {
+	ID            string
+	Algorithm     string
+	Secret        []byte
+	PrivateKeyPEM []byte
+	PublicKeyPEM  []byte
+}
+
+// Key 解析后的密钥，signKey 为 nil 时只用于验证
+type Key struct {
+	ID        string
+	Method    jwt.SigningMethod
+	signKey   interface{}
+	verifyKey interface{}
+}
+
+// KeySet 一组密钥，其中一个用于签发，其余只用于验证已签发的令牌
+type KeySet struct {
+	signing *Key
+	keys    []*Key
+	byID    map[string]*Key
+}
+
+// New 解析密钥配置，signingID 为签发令牌使用的密钥
+func New(specs []Spec, signingID string) (*KeySet, error) {
+	ks := &KeySet{byID: make(map[string]*Key)}
+	for _, spec := range specs {
+		key, err := parseKey(spec)
+		if err != nil {
+			return nil, fmt.Errorf("密钥 %q: %w", spec.ID, err)
+		}
+		if _, exists := ks.byID[key.ID]; exists {
+			return nil, fmt.Errorf("密钥 %q 重复", key.ID)
+		}
+		ks.keys = append(ks.keys, key)
+		ks.byID[key.ID] = key
+	}
+
+	signing, ok := ks.byID[signingID]
+	if !ok || signing.signKey == nil {
+		return nil, fmt.Errorf("%w: %q", ErrNoSigningKey, signingID)
+	}
+	ks.signing = signing
+	return ks, nil
+}
+
+func parseKey(spec Spec) (*Key, error) {
+	if spec.ID == "" {
+		return nil, errors.New("缺少 id")
+	}
+	key := &Key{ID: spec.ID}
+
+	switch spec.Algorithm {
+	case AlgHS256:
+		if len(spec.Secret) == 0 {
+			return nil, ErrNoKeyMaterial
+		}
+		if len(spec.Secret) < MinSecretLength {
+			return nil, fmt.Errorf("HS256 密钥至少需要 %d 字节", MinSecretLength)
+		}
+		key.Method = jwt.SigningMethodHS256
+		key.signKey, key.verifyKey = spec.Secret, spec.Secret
+
+	case AlgRS256:
+		key.Method = jwt.SigningMethodRS256
+		if len(spec.PrivateKeyPEM) > 0 {
+			private, err := jwt.ParseRSAPrivateKeyFromPEM(spec.PrivateKeyPEM)
+			if err != nil {
+				return nil, err
+			}
+			key.signKey, key.verifyKey = private, &private.PublicKey
+		} else if len(spec.PublicKeyPEM) > 0 {
+			public, err := jwt.ParseRSAPublicKeyFromPEM(spec.PublicKeyPEM)
+			if err != nil {
+				return nil, err
+			}
+			key.verifyKey = public
+		} else {
+			return nil, ErrNoKeyMaterial
+		}
+
+	case AlgEdDSA:
+		key.Method = jwt.SigningMethodEdDSA
+		if len(spec.PrivateKeyPEM) > 0 {
+			private, err := jwt.ParseEdPrivateKeyFromPEM(spec.PrivateKeyPEM)
+			if err != nil {
+				return nil, err
+			}
+			edPrivate, ok := private.(ed25519.PrivateKey)
+			if !ok {
+				return nil, errors.New("不是 Ed25519 私钥")
+			}
+			key.signKey, key.verifyKey = edPrivate, edPrivate.Public()
+		} else if len(spec.PublicKeyPEM) > 0 {
+			public, err := jwt.ParseEdPublicKeyFromPEM(spec.PublicKeyPEM)
+			if err != nil {
+				return nil, err
+			}
+			key.verifyKey = public
+		} else {
+			return nil, ErrNoKeyMaterial
+		}
+
+	default:
+		return nil, fmt.Errorf("不支持的算法 %q", spec.Algorithm)
+	}
+	return key, nil
+}
+
+// Sign 使用签发密钥签名，kid 写入令牌头部
+func (ks *KeySet) Sign(claims jwt.Claims) (string, error) {
+	token := jwt.NewWithClaims(ks.signing.Method, claims)
+	token.Header["kid"] = ks.signing.ID
+	return token.SignedString(ks.signing.signKey)
+}
+
+// SigningKeyID 当前签发密钥的 kid
+func (ks *KeySet) SigningKeyID() string {
+	return ks.signing.ID
+}
+
+// Algorithms 所有密钥使用的算法，用于限制解析时接受的算法
+func (ks *KeySet) Algorithms() []string {
+	seen := make(map[string]bool)
+	var algs []string
+	for _, key := range ks.keys {
+		if alg := key.Method.Alg(); !seen[alg] {
+			seen[alg] = true
+			algs = append(algs, alg)
+		}
+	}
+	return algs
+}
+
+// Keyfunc 按令牌头部的 kid 选择验证密钥，令牌的算法必须与密钥一致
+// 没有 kid 的令牌使用签发密钥验证
+func (ks *KeySet) Keyfunc(token *jwt.Token) (interface{}, error) {
+	key := ks.signing
+	if kid, ok := token.Header["kid"].(string); ok {
+		if key, ok = ks.byID[kid]; !ok {
+			return nil, fmt.Errorf("%w: %q", ErrUnknownKey, kid)
+		}
+	}
+	if token.Method.Alg() != key.Method.Alg() {
+		return nil, ErrAlgorithm
+	}
+	return key.verifyKey, nil
+}
+
+// JWK JSON Web Key（RFC 7517），只包含公钥
+type JWK struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	Alg string `json:"alg"`
+	Crv string `json:"crv,omitempty"`
+	X   string `json:"x,omitempty"`
+	N   string `json:"n,omitempty"`
+	E   string `json:"e,omitempty"`
+}
+
+// JWKS JSON Web Key Set
+type JWKS struct {
+	Keys []JWK `json:"keys"`
+}
+
+// JWKS 返回所有非对称密钥的公钥，HS256 密钥不会公开
+func (ks *KeySet) JWKS() JWKS {
+	jwks := JWKS{Keys: []JWK{}}
+	for _, key := range ks.keys {
+		switch public := key.verifyKey.(type) {
+		case *rsa.PublicKey:
+			jwks.Keys = append(jwks.Keys, JWK{
+				Kty: "RSA",
+				Kid: key.ID,
+				Use: "sig",
+				Alg: key.Method.Alg(),
+				N:   base64.RawURLEncoding.EncodeToString(public.N.Bytes()),
+				E:   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(public.E)).Bytes()),
+			})
+		case ed25519.PublicKey:
+			jwks.Keys = append(jwks.Keys, JWK{
+				Kty: "OKP",
+				Kid: key.ID,
+				Use: "sig",
+				Alg: key.Method.Alg(),
+				Crv: "Ed25519",
+				X:   base64.RawURLEncoding.EncodeToString(public),
+			})
+		}
+	}
+	return jwks
+}
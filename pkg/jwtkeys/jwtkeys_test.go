@@ -0,0 +1,315 @@
+package jwtkeys
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"math/big"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+var (
+	testRSAOnce    sync.Once
+	testRSAPrivate []byte
+	testRSAPublic  []byte
+	testRSAKey     *rsa.PrivateKey
+)
+
+// testRSAPEM 生成一次 RSA 密钥，返回私钥和公钥的 PEM
+func testRSAPEM(t *testing.T) ([]byte, []byte) {
+	t.Helper()
+	testRSAOnce.Do(func() {
+		key, err := rsa.GenerateKey(rand.Reader, 2048)
+		if err != nil {
+			t.Fatal(err)
+		}
+		testRSAKey = key
+		testRSAPrivate = pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(key)})
+		public, err := x509.MarshalPKIXPublicKey(&key.PublicKey)
+		if err != nil {
+			t.Fatal(err)
+		}
+		testRSAPublic = pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: public})
+	})
+	if testRSAKey == nil {
+		t.Fatal("生成 RSA 密钥失败")
+	}
+	return testRSAPrivate, testRSAPublic
+}
+
+// testEdPEM 生成 Ed25519 密钥，返回私钥、公钥的 PEM 和公钥
+func testEdPEM(t *testing.T) ([]byte, []byte, ed25519.PublicKey) {
+	t.Helper()
+	public, private, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	privateDER, err := x509.MarshalPKCS8PrivateKey(private)
+	if err != nil {
+		t.Fatal(err)
+	}
+	publicDER, err := x509.MarshalPKIXPublicKey(public)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: privateDER}),
+		pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: publicDER}),
+		public
+}
+
+var testSecret = []byte(strings.Repeat("s", MinSecretLength))
+
+func testClaims() jwt.RegisteredClaims {
+	return jwt.RegisteredClaims{
+		Subject:   "42",
+		ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Hour)),
+	}
+}
+
+// parse 按应用中的方式解析令牌：限制算法并按 kid 选择密钥
+func parse(ks *KeySet, token string) (*jwt.RegisteredClaims, error) {
+	claims := &jwt.RegisteredClaims{}
+	_, err := jwt.ParseWithClaims(token, claims, ks.Keyfunc, jwt.WithValidMethods(ks.Algorithms()))
+	return claims, err
+}
+
+func TestNewInvalidSpecs(t *testing.T) {
+	rsaPrivate, rsaPublic := testRSAPEM(t)
+
+	tests := []struct {
+		name      string
+		specs     []Spec
+		signingID string
+		want      error
+	}{
+		{"缺少 id", []Spec{{Algorithm: AlgHS256, Secret: testSecret}}, "", nil},
+		{"HS256 密钥为空", []Spec{{ID: "a", Algorithm: AlgHS256}}, "a", ErrNoKeyMaterial},
+		{"HS256 密钥过短", []Spec{{ID: "a", Algorithm: AlgHS256, Secret: []byte("short")}}, "a", nil},
+		{"RS256 没有密钥", []Spec{{ID: "a", Algorithm: AlgRS256}}, "a", ErrNoKeyMaterial},
+		{"EdDSA 没有密钥", []Spec{{ID: "a", Algorithm: AlgEdDSA}}, "a", ErrNoKeyMaterial},
+		{"无效的 PEM", []Spec{{ID: "a", Algorithm: AlgRS256, PrivateKeyPEM: []byte("not a pem")}}, "a", nil},
+		{"RSA 私钥配置为 EdDSA", []Spec{{ID: "a", Algorithm: AlgEdDSA, PrivateKeyPEM: rsaPrivate}}, "a", nil},
+		{"不支持的算法", []Spec{{ID: "a", Algorithm: "none", Secret: testSecret}}, "a", nil},
+		{"重复的 id", []Spec{{ID: "a", Algorithm: AlgHS256, Secret: testSecret}, {ID: "a", Algorithm: AlgHS256, Secret: testSecret}}, "a", nil},
+		{"签发密钥不存在", []Spec{{ID: "a", Algorithm: AlgHS256, Secret: testSecret}}, "b", ErrNoSigningKey},
+		{"签发密钥只有公钥", []Spec{{ID: "a", Algorithm: AlgRS256, PublicKeyPEM: rsaPublic}}, "a", ErrNoSigningKey},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ks, err := New(tt.specs, tt.signingID)
+			if err == nil {
+				t.Fatalf("应返回错误，got %+v", ks)
+			}
+			if tt.want != nil && !errors.Is(err, tt.want) {
+				t.Errorf("err = %v, want %v", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestSignAndVerify(t *testing.T) {
+	rsaPrivate, _ := testRSAPEM(t)
+	edPrivate, _, _ := testEdPEM(t)
+
+	tests := []struct {
+		name string
+		spec Spec
+	}{
+		{AlgHS256, Spec{ID: "hs", Algorithm: AlgHS256, Secret: testSecret}},
+		{AlgRS256, Spec{ID: "rs", Algorithm: AlgRS256, PrivateKeyPEM: rsaPrivate}},
+		{AlgEdDSA, Spec{ID: "ed", Algorithm: AlgEdDSA, PrivateKeyPEM: edPrivate}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ks, err := New([]Spec{tt.spec}, tt.spec.ID)
+			if err != nil {
+				t.Fatal(err)
+			}
+			token, err := ks.Sign(testClaims())
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			parsed, _, err := jwt.NewParser().ParseUnverified(token, &jwt.RegisteredClaims{})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if parsed.Header["kid"] != tt.spec.ID || parsed.Header["alg"] != tt.name {
+				t.Errorf("令牌头部 = %v", parsed.Header)
+			}
+
+			claims, err := parse(ks, token)
+			if err != nil || claims.Subject != "42" {
+				t.Errorf("验证失败: %+v, %v", claims, err)
+			}
+
+			// 篡改签名后验证失败
+			tampered := token[:len(token)-4] + "AAAA"
+			if tampered == token {
+				tampered = token[:len(token)-4] + "BBBB"
+			}
+			if _, err := parse(ks, tampered); err == nil {
+				t.Error("篡改的令牌应验证失败")
+			}
+		})
+	}
+}
+
+func TestKeyRotation(t *testing.T) {
+	oldPrivate, oldPublic := testRSAPEM(t)
+	newPrivate, _, _ := testEdPEM(t)
+
+	before, err := New([]Spec{{ID: "2024", Algorithm: AlgRS256, PrivateKeyPEM: oldPrivate}}, "2024")
+	if err != nil {
+		t.Fatal(err)
+	}
+	oldToken, err := before.Sign(testClaims())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// 轮换后旧密钥只保留公钥，新令牌使用新密钥签发
+	after, err := New([]Spec{
+		{ID: "2024", Algorithm: AlgRS256, PublicKeyPEM: oldPublic},
+		{ID: "2025", Algorithm: AlgEdDSA, PrivateKeyPEM: newPrivate},
+	}, "2025")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if after.SigningKeyID() != "2025" {
+		t.Errorf("SigningKeyID = %q", after.SigningKeyID())
+	}
+	if _, err := parse(after, oldToken); err != nil {
+		t.Errorf("轮换后旧密钥签发的令牌应仍然有效: %v", err)
+	}
+	newToken, err := after.Sign(testClaims())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := parse(after, newToken); err != nil {
+		t.Errorf("新令牌验证失败: %v", err)
+	}
+
+	// 旧密钥删除后，即使还有同算法的其他密钥，旧令牌也因 kid 未知被拒绝
+	removed, err := New([]Spec{
+		{ID: "2025", Algorithm: AlgEdDSA, PrivateKeyPEM: newPrivate},
+		{ID: "partner", Algorithm: AlgRS256, PublicKeyPEM: oldPublic},
+	}, "2025")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := parse(removed, oldToken); !errors.Is(err, ErrUnknownKey) {
+		t.Errorf("删除密钥后 err = %v, want ErrUnknownKey", err)
+	}
+}
+
+func TestKeyfuncRejectsForgedTokens(t *testing.T) {
+	rsaPrivate, rsaPublic := testRSAPEM(t)
+	ks, err := New([]Spec{
+		{ID: "rs", Algorithm: AlgRS256, PrivateKeyPEM: rsaPrivate},
+		{ID: "hs", Algorithm: AlgHS256, Secret: testSecret},
+	}, "rs")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	sign := func(method jwt.SigningMethod, kid interface{}, key interface{}) string {
+		token := jwt.NewWithClaims(method, testClaims())
+		if kid != nil {
+			token.Header["kid"] = kid
+		}
+		s, err := token.SignedString(key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return s
+	}
+
+	tests := []struct {
+		name  string
+		token string
+		want  error
+	}{
+		{"未知的 kid", sign(jwt.SigningMethodHS256, "other", testSecret), ErrUnknownKey},
+		// 用公开的 RSA 公钥作为 HMAC 密钥伪造令牌（算法混淆）
+		{"RS256 密钥的 kid 配 HS256", sign(jwt.SigningMethodHS256, "rs", rsaPublic), ErrAlgorithm},
+		{"没有 kid 时按签发密钥的算法", sign(jwt.SigningMethodHS256, nil, testSecret), ErrAlgorithm},
+		{"alg=none", sign(jwt.SigningMethodNone, "rs", jwt.UnsafeAllowNoneSignatureType), jwt.ErrTokenSignatureInvalid},
+		{"非字符串的 kid 按签发密钥处理", sign(jwt.SigningMethodHS256, 1, testSecret), ErrAlgorithm},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := parse(ks, tt.token); !errors.Is(err, tt.want) {
+				t.Errorf("err = %v, want %v", err, tt.want)
+			}
+		})
+	}
+
+	// 同一个 HS256 密钥配正确的 kid 可以验证
+	if _, err := parse(ks, sign(jwt.SigningMethodHS256, "hs", testSecret)); err != nil {
+		t.Errorf("kid 为 hs 的令牌应验证通过: %v", err)
+	}
+}
+
+func TestJWKS(t *testing.T) {
+	rsaPrivate, _ := testRSAPEM(t)
+	_, edPublicPEM, edPublic := testEdPEM(t)
+	ks, err := New([]Spec{
+		{ID: "hs", Algorithm: AlgHS256, Secret: testSecret},
+		{ID: "rs", Algorithm: AlgRS256, PrivateKeyPEM: rsaPrivate},
+		{ID: "ed", Algorithm: AlgEdDSA, PublicKeyPEM: edPublicPEM},
+	}, "hs")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	jwks := ks.JWKS()
+	if len(jwks.Keys) != 2 {
+		t.Fatalf("HS256 密钥不应公开，keys = %+v", jwks.Keys)
+	}
+	decode := func(s string) []byte {
+		b, err := base64.RawURLEncoding.DecodeString(s)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return b
+	}
+	for _, key := range jwks.Keys {
+		if key.Use != "sig" {
+			t.Errorf("%s: use = %q", key.Kid, key.Use)
+		}
+		switch key.Kid {
+		case "rs":
+			n := new(big.Int).SetBytes(decode(key.N))
+			e := new(big.Int).SetBytes(decode(key.E))
+			if key.Kty != "RSA" || key.Alg != AlgRS256 || n.Cmp(testRSAKey.N) != 0 || e.Int64() != int64(testRSAKey.E) {
+				t.Errorf("RSA 公钥不一致: %+v", key)
+			}
+		case "ed":
+			if key.Kty != "OKP" || key.Crv != "Ed25519" || key.Alg != AlgEdDSA || !bytes.Equal(decode(key.X), edPublic) {
+				t.Errorf("Ed25519 公钥不一致: %+v", key)
+			}
+		default:
+			t.Errorf("意外的密钥 %q", key.Kid)
+		}
+	}
+
+	// 只有 HS256 密钥时返回空数组而不是 null
+	hsOnly, err := New([]Spec{{ID: "hs", Algorithm: AlgHS256, Secret: testSecret}}, "hs")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if keys := hsOnly.JWKS().Keys; keys == nil || len(keys) != 0 {
+		t.Errorf("keys = %#v", keys)
+	}
+}
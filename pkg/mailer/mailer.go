@@ -0,0 +1,193 @@
+package mailer
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net/mail"
+	"net/textproto"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// Message 一封邮件，HTML 为空时只发送纯文本
+type Message struct {
+	From    string // 发件人，为空时使用邮件发送器配置的发件人
+	To      []string
+	Subject string
+	Text    string
+	HTML    string
+}
+
+// Mailer 邮件发送器接口，账号验证、找回密码等邮件都通过它发送
+type Mailer interface {
+	// Send 发送邮件，发送失败时返回 error，调用方可以稍后重试
+	Send(ctx context.Context, msg *Message) error
+	// Name 返回发送器名称
+	Name() string
+}
+
+// LogMailer 不发送邮件，只把邮件内容写入日志，用于开发环境
+type LogMailer struct {
+	Printf func(format string, args ...interface{})
+}
+
+// Send 把邮件内容写入日志
+func (m LogMailer) Send(ctx context.Context, msg *Message) error {
+	printf := m.Printf
+	if printf == nil {
+		printf = func(format string, args ...interface{}) { fmt.Printf(format+"\n", args...) }
+	}
+	printf("邮件未发送（log 模式）: to=%s subject=%s\n%s", strings.Join(msg.To, ","), msg.Subject, msg.Text)
+	return nil
+}
+
+// Name 返回发送器名称
+func (LogMailer) Name() string {
+	return "log"
+}
+
+// FileMailer 把邮件保存为 .eml 文件，用于测试和没有邮件服务器的环境
+type FileMailer struct {
+	Dir  string // 发件箱目录
+	From string
+}
+
+// NewFileMailer 创建文件发件箱
+func NewFileMailer(dir, from string) *FileMailer {
+	return &FileMailer{Dir: dir, From: from}
+}
+
+// Send 把邮件写入发件箱目录，文件名以时间开头便于按顺序查看
+func (m *FileMailer) Send(ctx context.Context, msg *Message) error {
+	data, err := msg.Bytes(m.From)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(m.Dir, 0700); err != nil {
+		return fmt.Errorf("创建发件箱目录失败: %w", err)
+	}
+
+	name := time.Now().Format("20060102-150405.000000000") + "-" + randomHex(4) + ".eml"
+	tmp := filepath.Join(m.Dir, "."+name)
+	if err := os.WriteFile(tmp, data, 0600); err != nil {
+		return fmt.Errorf("写入邮件失败: %w", err)
+	}
+	// 先写临时文件再改名，读取发件箱的程序不会看到写了一半的邮件
+	return os.Rename(tmp, filepath.Join(m.Dir, name))
+}
+
+// Name 返回发送器名称
+func (m *FileMailer) Name() string {
+	return "file"
+}
+
+// Bytes 按 RFC 5322 编码邮件，defaultFrom 在 msg.From 为空时使用
+func (msg *Message) Bytes(defaultFrom string) ([]byte, error) {
+	from := msg.From
+	if from == "" {
+		from = defaultFrom
+	}
+	fromAddr, err := mail.ParseAddress(from)
+	if err != nil {
+		return nil, fmt.Errorf("无效的发件人地址 %q: %w", from, err)
+	}
+	if len(msg.To) == 0 {
+		return nil, fmt.Errorf("缺少收件人")
+	}
+	to := make([]string, 0, len(msg.To))
+	for _, addr := range msg.To {
+		parsed, err := mail.ParseAddress(addr)
+		if err != nil {
+			return nil, fmt.Errorf("无效的收件人地址 %q: %w", addr, err)
+		}
+		to = append(to, parsed.String())
+	}
+
+	var buf bytes.Buffer
+	header := func(key, value string) {
+		buf.WriteString(key + ": " + value + "\r\n")
+	}
+	header("From", fromAddr.String())
+	header("To", strings.Join(to, ", "))
+	header("Subject", mime.BEncoding.Encode("UTF-8", msg.Subject))
+	header("Date", time.Now().Format(time.RFC1123Z))
+	header("Message-ID", "<"+randomHex(16)+"@"+domainOf(fromAddr.Address)+">")
+	header("MIME-Version", "1.0")
+
+	if msg.HTML == "" {
+		header("Content-Type", "text/plain; charset=UTF-8")
+		header("Content-Transfer-Encoding", "quoted-printable")
+		buf.WriteString("\r\n")
+		if err := writeQuotedPrintable(&buf, msg.Text); err != nil {
+			return nil, err
+		}
+		return buf.Bytes(), nil
+	}
+
+	mw := multipart.NewWriter(&buf)
+	header("Content-Type", "multipart/alternative; boundary="+mw.Boundary())
+	buf.WriteString("\r\n")
+	parts := []struct{ contentType, body string }{
+		{"text/plain; charset=UTF-8", msg.Text},
+		{"text/html; charset=UTF-8", msg.HTML},
+	}
+	for _, p := range parts {
+		w, err := mw.CreatePart(textproto.MIMEHeader{
+			"Content-Type":              {p.contentType},
+			"Content-Transfer-Encoding": {"quoted-printable"},
+		})
+		if err != nil {
+			return nil, err
+		}
+		if err := writeQuotedPrintable(w, p.body); err != nil {
+			return nil, err
+		}
+	}
+	if err := mw.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// recipients 返回收件人的邮箱地址（不含显示名称），用于 SMTP RCPT 命令
+func (msg *Message) recipients() ([]string, error) {
+	addrs := make([]string, 0, len(msg.To))
+	for _, to := range msg.To {
+		parsed, err := mail.ParseAddress(to)
+		if err != nil {
+			return nil, fmt.Errorf("无效的收件人地址 %q: %w", to, err)
+		}
+		addrs = append(addrs, parsed.Address)
+	}
+	return addrs, nil
+}
+
+func writeQuotedPrintable(w io.Writer, s string) error {
+	qp := quotedprintable.NewWriter(w)
+	if _, err := qp.Write([]byte(strings.ReplaceAll(strings.ReplaceAll(s, "\r\n", "\n"), "\n", "\r\n"))); err != nil {
+		return err
+	}
+	return qp.Close()
+}
+
+func domainOf(addr string) string {
+	if i := strings.LastIndex(addr, "@"); i >= 0 {
+		return addr[i+1:]
+	}
+	return "localhost"
+}
+
+func randomHex(n int) string {
+	b := make([]byte, n)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
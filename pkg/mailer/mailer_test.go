@@ -0,0 +1,326 @@
+package mailer
+
+import (
+	"bufio"
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"math/big"
+	"mime"
+	"net"
+	"net/mail"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// smtpStub 本地 SMTP 服务器，记录收到的命令和邮件
+type smtpStub struct {
+	listener net.Listener
+	tls      *tls.Config // 不为空时支持 STARTTLS
+
+	mu       sync.Mutex
+	from     string
+	rcpts    []string
+	data     string
+	auth     string
+	tlsUsed  bool
+	tlsAtCmd map[string]bool // 命令执行时连接是否已加密
+}
+
+func newSMTPStub(t *testing.T, tlsConfig *tls.Config) *smtpStub {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("监听失败: %v", err)
+	}
+	s := &smtpStub{listener: ln, tls: tlsConfig, tlsAtCmd: make(map[string]bool)}
+	t.Cleanup(func() { ln.Close() })
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go s.serve(conn)
+		}
+	}()
+	return s
+}
+
+func (s *smtpStub) port() int {
+	return s.listener.Addr().(*net.TCPAddr).Port
+}
+
+func (s *smtpStub) serve(conn net.Conn) {
+	defer conn.Close()
+	encrypted := false
+	r := bufio.NewReader(conn)
+	reply := func(line string) { fmt.Fprintf(conn, "%s\r\n", line) }
+
+	reply("220 stub ESMTP")
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return
+		}
+		line = strings.TrimRight(line, "\r\n")
+		cmd := strings.ToUpper(strings.SplitN(line, " ", 2)[0])
+		s.mu.Lock()
+		s.tlsAtCmd[cmd] = encrypted
+		s.mu.Unlock()
+
+		switch cmd {
+		case "EHLO", "HELO":
+			reply("250-stub")
+			if s.tls != nil && !encrypted {
+				reply("250-STARTTLS")
+			}
+			reply("250 AUTH PLAIN")
+		case "STARTTLS":
+			if s.tls == nil {
+				reply("502 not supported")
+				continue
+			}
+			reply("220 ready")
+			tlsConn := tls.Server(conn, s.tls)
+			if err := tlsConn.Handshake(); err != nil {
+				return
+			}
+			conn, r, encrypted = tlsConn, bufio.NewReader(tlsConn), true
+			s.mu.Lock()
+			s.tlsUsed = true
+			s.mu.Unlock()
+		case "AUTH":
+			s.mu.Lock()
+			s.auth = line
+			s.mu.Unlock()
+			reply("235 ok")
+		case "MAIL":
+			s.mu.Lock()
+			s.from = strings.TrimSuffix(strings.TrimPrefix(line, "MAIL FROM:<"), ">")
+			s.mu.Unlock()
+			reply("250 ok")
+		case "RCPT":
+			s.mu.Lock()
+			s.rcpts = append(s.rcpts, strings.TrimSuffix(strings.TrimPrefix(line, "RCPT TO:<"), ">"))
+			s.mu.Unlock()
+			reply("250 ok")
+		case "DATA":
+			reply("354 go ahead")
+			var data strings.Builder
+			for {
+				l, err := r.ReadString('\n')
+				if err != nil {
+					return
+				}
+				if l == ".\r\n" {
+					break
+				}
+				data.WriteString(l)
+			}
+			s.mu.Lock()
+			s.data = data.String()
+			s.mu.Unlock()
+			reply("250 queued")
+		case "QUIT":
+			reply("221 bye")
+			return
+		default:
+			reply("250 ok")
+		}
+	}
+}
+
+// selfSignedTLS 生成 127.0.0.1 的自签名证书，返回服务端配置和信任该证书的客户端配置
+func selfSignedTLS(t *testing.T) (*tls.Config, *tls.Config) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "smtp stub"},
+		IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pool := x509.NewCertPool()
+	pool.AddCert(cert)
+	server := &tls.Config{Certificates: []tls.Certificate{{Certificate: [][]byte{der}, PrivateKey: key}}}
+	return server, &tls.Config{RootCAs: pool}
+}
+
+func testMessage() *Message {
+	return &Message{
+		To:      []string{"Alice <alice@example.com>", "bob@example.com"},
+		Subject: "验证邮箱",
+		Text:    "请点击链接完成验证",
+		HTML:    "<p>请点击链接完成验证</p>",
+	}
+}
+
+func TestSMTPMailerPlain(t *testing.T) {
+	stub := newSMTPStub(t, nil)
+	m := NewSMTPMailer("127.0.0.1", stub.port(), "user", "secret", EncryptionNone, 5*time.Second, "img_hosting <noreply@example.com>")
+
+	if err := m.Send(context.Background(), testMessage()); err != nil {
+		t.Fatalf("发送失败: %v", err)
+	}
+
+	stub.mu.Lock()
+	defer stub.mu.Unlock()
+	if stub.from != "noreply@example.com" {
+		t.Errorf("MAIL FROM = %q", stub.from)
+	}
+	if got := strings.Join(stub.rcpts, ","); got != "alice@example.com,bob@example.com" {
+		t.Errorf("RCPT TO = %q", got)
+	}
+	wantAuth := "AUTH PLAIN " + base64.StdEncoding.EncodeToString([]byte("\x00user\x00secret"))
+	if stub.auth != wantAuth {
+		t.Errorf("AUTH = %q, want %q", stub.auth, wantAuth)
+	}
+	if stub.tlsUsed {
+		t.Error("明文模式不应使用 STARTTLS")
+	}
+
+	msg, err := mail.ReadMessage(strings.NewReader(stub.data))
+	if err != nil {
+		t.Fatalf("解析邮件失败: %v", err)
+	}
+	subject, err := new(mime.WordDecoder).DecodeHeader(msg.Header.Get("Subject"))
+	if err != nil || subject != "验证邮箱" {
+		t.Errorf("Subject = %q, %v", subject, err)
+	}
+	if !strings.HasPrefix(msg.Header.Get("Content-Type"), "multipart/alternative") {
+		t.Errorf("Content-Type = %q", msg.Header.Get("Content-Type"))
+	}
+}
+
+func TestSMTPMailerStartTLS(t *testing.T) {
+	serverTLS, clientTLS := selfSignedTLS(t)
+	stub := newSMTPStub(t, serverTLS)
+	m := NewSMTPMailer("127.0.0.1", stub.port(), "user", "secret", EncryptionStartTLS, 5*time.Second, "noreply@example.com")
+	m.TLSConfig = clientTLS
+
+	if err := m.Send(context.Background(), testMessage()); err != nil {
+		t.Fatalf("发送失败: %v", err)
+	}
+
+	stub.mu.Lock()
+	defer stub.mu.Unlock()
+	if !stub.tlsUsed {
+		t.Fatal("没有使用 STARTTLS")
+	}
+	for _, cmd := range []string{"AUTH", "MAIL", "RCPT", "DATA"} {
+		if !stub.tlsAtCmd[cmd] {
+			t.Errorf("%s 在加密前发送", cmd)
+		}
+	}
+	if stub.data == "" {
+		t.Error("没有收到邮件内容")
+	}
+}
+
+func TestSMTPMailerStartTLSRequired(t *testing.T) {
+	stub := newSMTPStub(t, nil)
+	m := NewSMTPMailer("127.0.0.1", stub.port(), "", "", EncryptionStartTLS, 5*time.Second, "noreply@example.com")
+
+	err := m.Send(context.Background(), testMessage())
+	if err == nil || !strings.Contains(err.Error(), "STARTTLS") {
+		t.Fatalf("服务器不支持 STARTTLS 时应返回错误，got %v", err)
+	}
+	stub.mu.Lock()
+	defer stub.mu.Unlock()
+	if stub.from != "" {
+		t.Error("不应以明文发送邮件")
+	}
+}
+
+func TestSMTPMailerUntrustedCertificate(t *testing.T) {
+	serverTLS, _ := selfSignedTLS(t)
+	stub := newSMTPStub(t, serverTLS)
+	m := NewSMTPMailer("127.0.0.1", stub.port(), "", "", EncryptionStartTLS, 5*time.Second, "noreply@example.com")
+
+	if err := m.Send(context.Background(), testMessage()); err == nil {
+		t.Fatal("证书不受信任时应返回错误")
+	}
+}
+
+func TestFileMailer(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "outbox")
+	m := NewFileMailer(dir, "img_hosting <noreply@example.com>")
+
+	if err := m.Send(context.Background(), &Message{To: []string{"alice@example.com"}, Subject: "hello", Text: "line1\nline2"}); err != nil {
+		t.Fatalf("发送失败: %v", err)
+	}
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 || !strings.HasSuffix(entries[0].Name(), ".eml") || strings.HasPrefix(entries[0].Name(), ".") {
+		t.Fatalf("发件箱内容不正确: %v", entries)
+	}
+	f, err := os.Open(filepath.Join(dir, entries[0].Name()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	msg, err := mail.ReadMessage(f)
+	if err != nil {
+		t.Fatalf("解析邮件失败: %v", err)
+	}
+	if msg.Header.Get("To") != "<alice@example.com>" || !strings.Contains(msg.Header.Get("From"), "noreply@example.com") {
+		t.Errorf("邮件头不正确: %v", msg.Header)
+	}
+	body, _ := io.ReadAll(msg.Body)
+	if string(body) != "line1\r\nline2" {
+		t.Errorf("正文 = %q", body)
+	}
+}
+
+func TestLogMailer(t *testing.T) {
+	var logged string
+	m := LogMailer{Printf: func(format string, args ...interface{}) { logged = fmt.Sprintf(format, args...) }}
+
+	if err := m.Send(context.Background(), &Message{To: []string{"alice@example.com"}, Subject: "hello", Text: "body"}); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(logged, "alice@example.com") || !strings.Contains(logged, "hello") || !strings.Contains(logged, "body") {
+		t.Errorf("日志内容 = %q", logged)
+	}
+}
+
+func TestMessageBytesInvalidAddress(t *testing.T) {
+	if _, err := (&Message{To: []string{"alice@example.com"}}).Bytes("not an address"); err == nil {
+		t.Error("无效的发件人应返回错误")
+	}
+	if _, err := (&Message{To: []string{"not an address"}}).Bytes("noreply@example.com"); err == nil {
+		t.Error("无效的收件人应返回错误")
+	}
+	if _, err := (&Message{}).Bytes("noreply@example.com"); err == nil {
+		t.Error("缺少收件人应返回错误")
+	}
+}
@@ -0,0 +1,157 @@
+package mailer
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"net"
+	"net/mail"
+	"net/smtp"
+	"strconv"
+	"time"
+)
+
+// SMTP 连接的加密方式
+const (
+	EncryptionNone     = "none"     // 明文连接，仅用于本机或内网的邮件服务
+	EncryptionStartTLS = "starttls" // 明文连接后升级为 TLS（通常为 587 端口）
+	EncryptionTLS      = "tls"      // 直接建立 TLS 连接（通常为 465 端口）
+)
+
+// SMTPMailer 通过 SMTP 服务器发送邮件
+type SMTPMailer struct {
+	Host       string
+	Port       int
+	Username   string // 为空时不进行认证
+	Password   string
+	Encryption string        // none、starttls 或 tls
+	Timeout    time.Duration // 连接和发送的总超时
+	From       string
+	TLSConfig  *tls.Config // 为空时按 Host 验证服务器证书，使用自签名证书的内网服务器可以指定 RootCAs
+}
+
+// NewSMTPMailer 创建 SMTP 邮件发送器
+func NewSMTPMailer(host string, port int, username, password, encryption string, timeout time.Duration, from string) *SMTPMailer {
+	if encryption == "" {
+		encryption = EncryptionStartTLS
+	}
+	if timeout <= 0 {
+		timeout = 30 * time.Second
+	}
+	return &SMTPMailer{
+		Host:       host,
+		Port:       port,
+		Username:   username,
+		Password:   password,
+		Encryption: encryption,
+		Timeout:    timeout,
+		From:       from,
+	}
+}
+
+// Name 返回发送器名称
+func (m *SMTPMailer) Name() string {
+	return "smtp"
+}
+
+// Send 连接 SMTP 服务器发送一封邮件
+func (m *SMTPMailer) Send(ctx context.Context, msg *Message) error {
+	data, err := msg.Bytes(m.From)
+	if err != nil {
+		return err
+	}
+	rcpts, err := msg.recipients()
+	if err != nil {
+		return err
+	}
+	from := msg.From
+	if from == "" {
+		from = m.From
+	}
+	fromAddr, err := mail.ParseAddress(from)
+	if err != nil {
+		return fmt.Errorf("无效的发件人地址 %q: %w", from, err)
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, m.Timeout)
+	defer cancel()
+
+	client, err := m.dial(ctx)
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+
+	if m.Encryption == EncryptionStartTLS {
+		if ok, _ := client.Extension("STARTTLS"); !ok {
+			return fmt.Errorf("SMTP 服务器不支持 STARTTLS")
+		}
+		if err := client.StartTLS(m.tlsConfig()); err != nil {
+			return fmt.Errorf("SMTP STARTTLS 失败: %w", err)
+		}
+	}
+	if m.Username != "" {
+		if err := client.Auth(smtp.PlainAuth("", m.Username, m.Password, m.Host)); err != nil {
+			return fmt.Errorf("SMTP 认证失败: %w", err)
+		}
+	}
+
+	if err := client.Mail(fromAddr.Address); err != nil {
+		return fmt.Errorf("SMTP MAIL FROM 失败: %w", err)
+	}
+	for _, rcpt := range rcpts {
+		if err := client.Rcpt(rcpt); err != nil {
+			return fmt.Errorf("SMTP RCPT TO %s 失败: %w", rcpt, err)
+		}
+	}
+	w, err := client.Data()
+	if err != nil {
+		return fmt.Errorf("SMTP DATA 失败: %w", err)
+	}
+	if _, err := w.Write(data); err != nil {
+		return fmt.Errorf("发送邮件内容失败: %w", err)
+	}
+	if err := w.Close(); err != nil {
+		return fmt.Errorf("发送邮件内容失败: %w", err)
+	}
+	return client.Quit()
+}
+
+func (m *SMTPMailer) tlsConfig() *tls.Config {
+	if m.TLSConfig != nil {
+		cfg := m.TLSConfig.Clone()
+		if cfg.ServerName == "" {
+			cfg.ServerName = m.Host
+		}
+		return cfg
+	}
+	return &tls.Config{ServerName: m.Host}
+}
+
+// dial 建立 SMTP 连接，超时由 ctx 控制
+func (m *SMTPMailer) dial(ctx context.Context) (*smtp.Client, error) {
+	addr := net.JoinHostPort(m.Host, strconv.Itoa(m.Port))
+	dialer := &net.Dialer{}
+	conn, err := dialer.DialContext(ctx, "tcp", addr)
+	if err != nil {
+		return nil, fmt.Errorf("连接 SMTP 服务器失败: %w", err)
+	}
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	}
+	if m.Encryption == EncryptionTLS {
+		tlsConn := tls.Client(conn, m.tlsConfig())
+		if err := tlsConn.HandshakeContext(ctx); err != nil {
+			conn.Close()
+			return nil, fmt.Errorf("SMTP TLS 握手失败: %w", err)
+		}
+		conn = tlsConn
+	}
+
+	client, err := smtp.NewClient(conn, m.Host)
+	if err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("SMTP 握手失败: %w", err)
+	}
+	return client, nil
+}
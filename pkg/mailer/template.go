@@ -0,0 +1,94 @@
+package mailer
+
+import (
+	"bytes"
+	"embed"
+	"fmt"
+	htmltemplate "html/template"
+	"os"
+	"path/filepath"
+	"strings"
+	texttemplate "text/template"
+)
+
+//go:embed templates/*.tmpl
+var defaultTemplates embed.FS
+
+// Templates 邮件模板，每个模板文件定义 subject、text 和可选的 html 三个块
+// subject 和 text 按纯文本渲染，html 按 HTML 渲染并自动转义变量
+type Templates struct {
+	Dir string // 自定义模板目录，同名文件覆盖内置模板，为空时只使用内置模板
+}
+
+// NewTemplates 创建邮件模板
+func NewTemplates(dir string) *Templates {
+	return &Templates{Dir: dir}
+}
+
+// Render 渲染名为 name 的模板（不含 .tmpl 后缀），返回未填写收件人的邮件
+func (t *Templates) Render(name string, data interface{}) (*Message, error) {
+	src, err := t.load(name)
+	if err != nil {
+		return nil, err
+	}
+
+	textTmpl, err := texttemplate.New(name).Parse(src)
+	if err != nil {
+		return nil, fmt.Errorf("解析邮件模板 %s 失败: %w", name, err)
+	}
+	subject, err := executeText(textTmpl, "subject", data)
+	if err != nil {
+		return nil, err
+	}
+	text, err := executeText(textTmpl, "text", data)
+	if err != nil {
+		return nil, err
+	}
+	msg := &Message{
+		Subject: strings.TrimSpace(subject),
+		Text:    strings.TrimSpace(text) + "\n",
+	}
+
+	htmlTmpl, err := htmltemplate.New(name).Parse(src)
+	if err != nil {
+		return nil, fmt.Errorf("解析邮件模板 %s 失败: %w", name, err)
+	}
+	if htmlTmpl.Lookup("html") != nil {
+		var buf bytes.Buffer
+		if err := htmlTmpl.ExecuteTemplate(&buf, "html", data); err != nil {
+			return nil, fmt.Errorf("渲染邮件模板 %s 失败: %w", name, err)
+		}
+		msg.HTML = strings.TrimSpace(buf.String())
+	}
+	return msg, nil
+}
+
+// load 读取模板内容，自定义目录中的模板优先
+func (t *Templates) load(name string) (string, error) {
+	file := name + ".tmpl"
+	if t.Dir != "" {
+		data, err := os.ReadFile(filepath.Join(t.Dir, file))
+		if err == nil {
+			return string(data), nil
+		}
+		if !os.IsNotExist(err) {
+			return "", fmt.Errorf("读取邮件模板 %s 失败: %w", name, err)
+		}
+	}
+	data, err := defaultTemplates.ReadFile("templates/" + file)
+	if err != nil {
+		return "", fmt.Errorf("邮件模板 %s 不存在", name)
+	}
+	return string(data), nil
+}
+
+func executeText(tmpl *texttemplate.Template, block string, data interface{}) (string, error) {
+	if tmpl.Lookup(block) == nil {
+		return "", fmt.Errorf("邮件模板 %s 缺少 %s 块", tmpl.Name(), block)
+	}
+	var buf bytes.Buffer
+	if err := tmpl.ExecuteTemplate(&buf, block, data); err != nil {
+		return "", fmt.Errorf("渲染邮件模板 %s 失败: %w", tmpl.Name(), err)
+	}
+	return buf.String(), nil
+}
@@ -0,0 +1,285 @@
+// Package oidc 实现 OpenID Connect 依赖方（Relying Party）的授权码流程：
+// 服务发现、带 PKCE 的授权码交换和 ID 令牌验证
+package oidc
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// 默认值
+const (
+	DefaultTimeout  = 10 * time.Second
+	maxResponseSize = 1 << 20
+	clockSkew       = time.Minute
+)
+
+var (
+	ErrInvalidIDToken = errors.New("ID 令牌无效")
+	ErrNoIDToken      = errors.New("令牌响应中没有 ID 令牌")
+)
+
+// Config 身份提供方的客户端配置
+type Config struct {
+	Issuer       string // 身份提供方地址，服务发现文档位于 {Issuer}/.well-known/openid-configuration
+	ClientID     string
+	ClientSecret string   // 为空时作为公开客户端，只依靠 PKCE
+	Scopes       []string // 为空时使用 openid email profile
+	HTTPClient   *http.Client
+}
+
+// Metadata 服务发现文档中用到的字段
+type Metadata struct {
+	Issuer                 string   `json:"issuer"`
+	AuthorizationEndpoint  string   `json:"authorization_endpoint"`
+	TokenEndpoint          string   `json:"token_endpoint"`
+	JWKSURI                string   `json:"jwks_uri"`
+	UserinfoEndpoint       string   `json:"userinfo_endpoint"`
+	IDTokenSigningAlgs     []string `json:"id_token_signing_alg_values_supported"`
+	CodeChallengeMethods   []string `json:"code_challenge_methods_supported"`
+	TokenEndpointAuthTypes []string `json:"token_endpoint_auth_methods_supported"`
+}
+
+// Provider 完成服务发现后的身份提供方
+type Provider struct {
+	config   Config
+	metadata Metadata
+	client   *http.Client
+	keys     *keyCache
+}
+
+// TokenResponse 令牌端点的响应
+type TokenResponse struct {
+	AccessToken string `json:"access_token"`
+	TokenType   string `json:"token_type"`
+	IDToken     string `json:"id_token"`
+	ExpiresIn   int    `json:"expires_in"`
+}
+
+// Error 身份提供方返回的 OAuth2 错误
+type Error struct {
+	Code        string `json:"error"`
+	Description string `json:"error_description"`
+}
+
+func (e *Error) Error() string {
+	if e.Description != "" {
+		return fmt.Sprintf("身份提供方返回错误 %s: %s", e.Code, e.Description)
+	}
+	return "身份提供方返回错误 " + e.Code
+}
+
+// IDTokenClaims ID 令牌中的声明
+type IDTokenClaims struct {
+	jwt.RegisteredClaims
+	Nonce             string   `json:"nonce"`
+	AuthorizedParty   string   `json:"azp"`
+	Email             string   `json:"email"`
+	EmailVerified     flexBool `json:"email_verified"`
+	Name              string   `json:"name"`
+	PreferredUsername string   `json:"preferred_username"`
+}
+
+// flexBool 部分身份提供方把 email_verified 编码为字符串 "true"
+type flexBool bool
+
+func (b *flexBool) UnmarshalJSON(data []byte) error {
+	switch strings.Trim(string(data), `"`) {
+	case "true":
+		*b = true
+	case "false", "null", "":
+		*b = false
+	default:
+		return fmt.Errorf("无效的布尔值 %s", data)
+	}
+	return nil
+}
+
+// NewProvider 读取服务发现文档，文档中的 issuer 必须与配置一致
+func NewProvider(ctx context.Context, cfg Config) (*Provider, error) {
+	if cfg.Issuer == "" || cfg.ClientID == "" {
+		return nil, errors.New("缺少 issuer 或 client_id")
+	}
+	client := cfg.HTTPClient
+	if client == nil {
+		client = &http.Client{Timeout: DefaultTimeout}
+	}
+
+	issuer := strings.TrimSuffix(cfg.Issuer, "/")
+	var metadata Metadata
+	if err := getJSON(ctx, client, issuer+"/.well-known/openid-configuration", &metadata); err != nil {
+		return nil, fmt.Errorf("服务发现失败: %w", err)
+	}
+	if strings.TrimSuffix(metadata.Issuer, "/") != issuer {
+		return nil, fmt.Errorf("服务发现文档的 issuer %q 与配置不一致", metadata.Issuer)
+	}
+	if metadata.AuthorizationEndpoint == "" || metadata.TokenEndpoint == "" || metadata.JWKSURI == "" {
+		return nil, errors.New("服务发现文档缺少 authorization_endpoint、token_endpoint 或 jwks_uri")
+	}
+
+	return &Provider{
+		config:   cfg,
+		metadata: metadata,
+		client:   client,
+		keys:     newKeyCache(client, metadata.JWKSURI),
+	}, nil
+}
+
+// Metadata 返回服务发现文档
+func (p *Provider) Metadata() Metadata {
+	return p.metadata
+}
+
+// AuthCodeURL 生成跳转到身份提供方的授权地址，codeChallenge 为 S256 方式的 PKCE 挑战
+func (p *Provider) AuthCodeURL(redirectURI, state, nonce, codeChallenge string) string {
+	scopes := p.config.Scopes
+	if len(scopes) == 0 {
+		scopes = []string{"openid", "email", "profile"}
+	}
+
+	u, err := url.Parse(p.metadata.AuthorizationEndpoint)
+	if err != nil {
+		return p.metadata.AuthorizationEndpoint
+	}
+	q := u.Query()
+	q.Set("response_type", "code")
+	q.Set("client_id", p.config.ClientID)
+	q.Set("redirect_uri", redirectURI)
+	q.Set("scope", strings.Join(scopes, " "))
+	q.Set("state", state)
+	q.Set("nonce", nonce)
+	q.Set("code_challenge", codeChallenge)
+	q.Set("code_challenge_method", "S256")
+	u.RawQuery = q.Encode()
+	return u.String()
+}
+
+// Exchange 用授权码和 PKCE 验证码换取令牌
+// 配置了 client_secret 时使用 HTTP Basic 认证（client_secret_basic）
+func (p *Provider) Exchange(ctx context.Context, code, redirectURI, codeVerifier string) (*TokenResponse, error) {
+	form := url.Values{
+		"grant_type":    {"authorization_code"},
+		"code":          {code},
+		"redirect_uri":  {redirectURI},
+		"code_verifier": {codeVerifier},
+	}
+	if p.config.ClientSecret == "" {
+		form.Set("client_id", p.config.ClientID)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, p.metadata.TokenEndpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+	if p.config.ClientSecret != "" {
+		req.SetBasicAuth(url.QueryEscape(p.config.ClientID), url.QueryEscape(p.config.ClientSecret))
+	}
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(io.LimitReader(resp.Body, maxResponseSize))
+	if err != nil {
+		return nil, err
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		oauthErr := &Error{}
+		if json.Unmarshal(body, oauthErr) == nil && oauthErr.Code != "" {
+			return nil, oauthErr
+		}
+		return nil, fmt.Errorf("令牌端点返回 %s", resp.Status)
+	}
+
+	var token TokenResponse
+	if err := json.Unmarshal(body, &token); err != nil {
+		return nil, fmt.Errorf("解析令牌响应失败: %w", err)
+	}
+	if token.IDToken == "" {
+		return nil, ErrNoIDToken
+	}
+	return &token, nil
+}
+
+// VerifyIDToken 验证 ID 令牌的签名、issuer、audience、有效期和 nonce
+func (p *Provider) VerifyIDToken(ctx context.Context, rawIDToken, nonce string) (*IDTokenClaims, error) {
+	claims := &IDTokenClaims{}
+	_, err := jwt.ParseWithClaims(rawIDToken, claims,
+		func(token *jwt.Token) (interface{}, error) {
+			kid, _ := token.Header["kid"].(string)
+			return p.keys.get(ctx, kid)
+		},
+		jwt.WithValidMethods(p.signingAlgorithms()),
+		jwt.WithIssuer(p.metadata.Issuer),
+		jwt.WithAudience(p.config.ClientID),
+		jwt.WithExpirationRequired(),
+		jwt.WithIssuedAt(),
+		jwt.WithLeeway(clockSkew),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidIDToken, err)
+	}
+
+	if claims.Subject == "" {
+		return nil, fmt.Errorf("%w: 缺少 sub", ErrInvalidIDToken)
+	}
+	// 令牌发给多个客户端时，azp 必须是本客户端
+	if len(claims.Audience) > 1 && claims.AuthorizedParty != p.config.ClientID {
+		return nil, fmt.Errorf("%w: azp 与客户端不一致", ErrInvalidIDToken)
+	}
+	if claims.Nonce != nonce {
+		return nil, fmt.Errorf("%w: nonce 不一致", ErrInvalidIDToken)
+	}
+	return claims, nil
+}
+
+// signingAlgorithms ID 令牌可以使用的签名算法，只接受非对称算法
+func (p *Provider) signingAlgorithms() []string {
+	var algs []string
+	for _, alg := range p.metadata.IDTokenSigningAlgs {
+		if supportedAlgorithms[alg] {
+			algs = append(algs, alg)
+		}
+	}
+	if len(algs) == 0 {
+		algs = []string{"RS256"}
+	}
+	return algs
+}
+
+var supportedAlgorithms = map[string]bool{
+	"RS256": true, "RS384": true, "RS512": true,
+	"PS256": true, "PS384": true, "PS512": true,
+	"ES256": true, "ES384": true, "ES512": true,
+	"EdDSA": true,
+}
+
+func getJSON(ctx context.Context, client *http.Client, rawURL string, v interface{}) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, rawURL, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/json")
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("%s 返回 %s", rawURL, resp.Status)
+	}
+	return json.NewDecoder(io.LimitReader(resp.Body, maxResponseSize)).Decode(v)
+}
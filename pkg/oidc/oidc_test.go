@@ -0,0 +1,413 @@
+package oidc
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/subtle"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+const (
+	testClientID    = "img_hosting"
+	testRedirectURI = "https://img.example.com/auth/oidc/mock/callback"
+)
+
+var (
+	testRSAKey     *rsa.PrivateKey
+	testRSAKeyOnce sync.Once
+)
+
+// rsaKey 所有测试共用一个 RSA 密钥，避免重复生成
+func rsaKey(t *testing.T) *rsa.PrivateKey {
+	t.Helper()
+	testRSAKeyOnce.Do(func() {
+		key, err := rsa.GenerateKey(rand.Reader, 2048)
+		if err != nil {
+			t.Fatal(err)
+		}
+		testRSAKey = key
+	})
+	return testRSAKey
+}
+
+// mockCode 授权端点发出的授权码
+type mockCode struct {
+	redirectURI   string
+	nonce         string
+	codeChallenge string
+}
+
+// mockIdP httptest 实现的身份提供方：服务发现、JWKS 和校验 PKCE 的令牌端点
+type mockIdP struct {
+	*httptest.Server
+	t            *testing.T
+	issuer       string // 服务发现文档中的 issuer，默认为服务地址
+	clientSecret string // 不为空时令牌端点要求 HTTP Basic 认证
+	rsaKey       *rsa.PrivateKey
+	ecKey        *ecdsa.PrivateKey
+	jwksCalls    int
+
+	mu    sync.Mutex
+	codes map[string]mockCode
+}
+
+func newMockIdP(t *testing.T) *mockIdP {
+	t.Helper()
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	idp := &mockIdP{t: t, rsaKey: rsaKey(t), ecKey: ecKey, codes: make(map[string]mockCode)}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", idp.discovery)
+	mux.HandleFunc("/token", idp.token)
+	mux.HandleFunc("/jwks", idp.jwks)
+	idp.Server = httptest.NewServer(mux)
+	idp.issuer = idp.URL
+	t.Cleanup(idp.Close)
+	return idp
+}
+
+func (idp *mockIdP) discovery(w http.ResponseWriter, r *http.Request) {
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"issuer":                 idp.issuer,
+		"authorization_endpoint": idp.URL + "/authorize",
+		"token_endpoint":         idp.URL + "/token",
+		"jwks_uri":               idp.URL + "/jwks",
+		// 声明了对称算法和 none，客户端也不能接受
+		"id_token_signing_alg_values_supported": []string{"RS256", "ES256", "HS256", "none"},
+		"code_challenge_methods_supported":      []string{"S256"},
+	})
+}
+
+func (idp *mockIdP) jwks(w http.ResponseWriter, r *http.Request) {
+	idp.mu.Lock()
+	idp.jwksCalls++
+	idp.mu.Unlock()
+
+	b64 := base64.RawURLEncoding.EncodeToString
+	pub := idp.rsaKey.PublicKey
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"keys": []map[string]string{
+			{"kty": "RSA", "kid": "rsa", "use": "sig", "n": b64(pub.N.Bytes()), "e": b64(big.NewInt(int64(pub.E)).Bytes())},
+			{"kty": "EC", "kid": "ec", "crv": "P-256", "x": b64(idp.ecKey.X.FillBytes(make([]byte, 32))), "y": b64(idp.ecKey.Y.FillBytes(make([]byte, 32)))},
+			{"kty": "RSA", "kid": "enc", "use": "enc", "n": b64(pub.N.Bytes()), "e": "AQAB"},
+			{"kty": "oct", "kid": "hmac", "k": b64([]byte("secret"))},
+		},
+	})
+}
+
+func (idp *mockIdP) token(w http.ResponseWriter, r *http.Request) {
+	oauthError := func(code string) {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]string{"error": code})
+	}
+	if r.Method != http.MethodPost || r.ParseForm() != nil || r.PostForm.Get("grant_type") != "authorization_code" {
+		oauthError("invalid_request")
+		return
+	}
+	if idp.clientSecret != "" {
+		id, secret, ok := r.BasicAuth()
+		if !ok || id != testClientID || subtle.ConstantTimeCompare([]byte(secret), []byte(idp.clientSecret)) != 1 {
+			oauthError("invalid_client")
+			return
+		}
+	} else if r.PostForm.Get("client_id") != testClientID {
+		oauthError("invalid_client")
+		return
+	}
+
+	idp.mu.Lock()
+	code, ok := idp.codes[r.PostForm.Get("code")]
+	delete(idp.codes, r.PostForm.Get("code"))
+	idp.mu.Unlock()
+	if !ok || code.redirectURI != r.PostForm.Get("redirect_uri") || S256Challenge(r.PostForm.Get("code_verifier")) != code.codeChallenge {
+		oauthError("invalid_grant")
+		return
+	}
+
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"access_token": "access",
+		"token_type":   "Bearer",
+		"id_token":     idp.sign(jwt.SigningMethodRS256, "rsa", idp.claims(code.nonce)),
+		"expires_in":   3600,
+	})
+}
+
+// authorize 模拟用户在身份提供方登录：检查授权地址的参数并登记授权码
+func (idp *mockIdP) authorize(authURL string) string {
+	idp.t.Helper()
+	u, err := url.Parse(authURL)
+	if err != nil {
+		idp.t.Fatal(err)
+	}
+	q := u.Query()
+	if u.Path != "/authorize" || q.Get("response_type") != "code" || q.Get("client_id") != testClientID ||
+		q.Get("code_challenge_method") != "S256" || q.Get("code_challenge") == "" || q.Get("state") == "" {
+		idp.t.Fatalf("授权地址无效: %s", authURL)
+	}
+	code := "code-" + q.Get("state")
+	idp.mu.Lock()
+	idp.codes[code] = mockCode{redirectURI: q.Get("redirect_uri"), nonce: q.Get("nonce"), codeChallenge: q.Get("code_challenge")}
+	idp.mu.Unlock()
+	return code
+}
+
+// claims 返回一组有效的 ID 令牌声明
+func (idp *mockIdP) claims(nonce string) jwt.MapClaims {
+	now := time.Now()
+	return jwt.MapClaims{
+		"iss":            idp.issuer,
+		"sub":            "alice",
+		"aud":            testClientID,
+		"exp":            now.Add(5 * time.Minute).Unix(),
+		"iat":            now.Unix(),
+		"nonce":          nonce,
+		"email":          "alice@example.com",
+		"email_verified": true,
+	}
+}
+
+// sign 按指定算法签名，RS* 使用 RSA 密钥，ES256 使用 EC 密钥
+func (idp *mockIdP) sign(method jwt.SigningMethod, kid string, claims jwt.MapClaims) string {
+	idp.t.Helper()
+	token := jwt.NewWithClaims(method, claims)
+	if kid != "" {
+		token.Header["kid"] = kid
+	}
+	var key interface{} = idp.rsaKey
+	if method == jwt.SigningMethodES256 {
+		key = idp.ecKey
+	}
+	signed, err := token.SignedString(key)
+	if err != nil {
+		idp.t.Fatal(err)
+	}
+	return signed
+}
+
+func (idp *mockIdP) provider(secret string) *Provider {
+	idp.t.Helper()
+	p, err := NewProvider(context.Background(), Config{
+		Issuer:       idp.URL + "/",
+		ClientID:     testClientID,
+		ClientSecret: secret,
+		HTTPClient:   idp.Client(),
+	})
+	if err != nil {
+		idp.t.Fatal(err)
+	}
+	return p
+}
+
+func TestDiscovery(t *testing.T) {
+	idp := newMockIdP(t)
+	p := idp.provider("")
+	if m := p.Metadata(); m.TokenEndpoint != idp.URL+"/token" || m.JWKSURI != idp.URL+"/jwks" {
+		t.Errorf("Metadata = %+v", m)
+	}
+
+	// 服务发现文档的 issuer 与配置不一致时拒绝，防止混用其他身份提供方的令牌
+	idp.issuer = "https://evil.example.com"
+	if _, err := NewProvider(context.Background(), Config{Issuer: idp.URL, ClientID: testClientID, HTTPClient: idp.Client()}); err == nil {
+		t.Error("issuer 不一致时应报错")
+	}
+
+	if _, err := NewProvider(context.Background(), Config{Issuer: idp.URL + "/missing", ClientID: testClientID, HTTPClient: idp.Client()}); err == nil {
+		t.Error("服务发现文档不存在时应报错")
+	}
+	if _, err := NewProvider(context.Background(), Config{Issuer: idp.URL}); err == nil {
+		t.Error("缺少 client_id 时应报错")
+	}
+}
+
+func TestAuthCodeFlowWithPKCE(t *testing.T) {
+	for _, secret := range []string{"", "s3cret"} {
+		idp := newMockIdP(t)
+		idp.clientSecret = secret
+		p := idp.provider(secret)
+
+		verifier := "verifier-0123456789-0123456789-0123456789"
+		code := idp.authorize(p.AuthCodeURL(testRedirectURI, "state1", "nonce1", S256Challenge(verifier)))
+		token, err := p.Exchange(context.Background(), code, testRedirectURI, verifier)
+		if err != nil {
+			t.Fatalf("secret %q: %v", secret, err)
+		}
+		claims, err := p.VerifyIDToken(context.Background(), token.IDToken, "nonce1")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if claims.Subject != "alice" || claims.Email != "alice@example.com" || !bool(claims.EmailVerified) {
+			t.Errorf("claims = %+v", claims)
+		}
+
+		// 授权码只能使用一次
+		if _, err := p.Exchange(context.Background(), code, testRedirectURI, verifier); err == nil {
+			t.Error("授权码不能重复使用")
+		}
+	}
+}
+
+func TestExchangeRejected(t *testing.T) {
+	idp := newMockIdP(t)
+	p := idp.provider("")
+	verifier := "verifier-0123456789-0123456789-0123456789"
+
+	tests := []struct {
+		name        string
+		verifier    string
+		redirectURI string
+		want        string
+	}{
+		{"PKCE 验证码错误", "wrong-verifier", testRedirectURI, "invalid_grant"},
+		{"redirect_uri 不一致", verifier, "https://evil.example.com/callback", "invalid_grant"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			code := idp.authorize(p.AuthCodeURL(testRedirectURI, "state-"+tt.name, "nonce", S256Challenge(verifier)))
+			_, err := p.Exchange(context.Background(), code, tt.redirectURI, tt.verifier)
+			var oauthErr *Error
+			if !errors.As(err, &oauthErr) || oauthErr.Code != tt.want {
+				t.Errorf("应返回 %s，got %v", tt.want, err)
+			}
+		})
+	}
+
+	// 令牌端点要求客户端密钥时，公开客户端的请求被拒绝
+	idp.clientSecret = "s3cret"
+	code := idp.authorize(p.AuthCodeURL(testRedirectURI, "state-secret", "nonce", S256Challenge(verifier)))
+	var oauthErr *Error
+	if _, err := p.Exchange(context.Background(), code, testRedirectURI, verifier); !errors.As(err, &oauthErr) || oauthErr.Code != "invalid_client" {
+		t.Errorf("应返回 invalid_client，got %v", err)
+	}
+}
+
+func TestExchangeWithoutIDToken(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]string{"access_token": "access", "token_type": "Bearer"})
+	}))
+	defer srv.Close()
+
+	p := &Provider{config: Config{ClientID: testClientID}, metadata: Metadata{TokenEndpoint: srv.URL}, client: srv.Client()}
+	if _, err := p.Exchange(context.Background(), "code", testRedirectURI, "verifier"); !errors.Is(err, ErrNoIDToken) {
+		t.Errorf("应返回 ErrNoIDToken，got %v", err)
+	}
+}
+
+func TestVerifyIDToken(t *testing.T) {
+	idp := newMockIdP(t)
+	p := idp.provider("")
+	now := time.Now()
+
+	// hmacWithPublicKey 用公开的 RSA 公钥作为 HMAC 密钥伪造签名（算法混淆攻击）
+	hmacWithPublicKey := func(claims jwt.MapClaims) string {
+		der, err := x509.MarshalPKIXPublicKey(&idp.rsaKey.PublicKey)
+		if err != nil {
+			t.Fatal(err)
+		}
+		token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
+		token.Header["kid"] = "rsa"
+		signed, err := token.SignedString(pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der}))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return signed
+	}
+	unsigned := func(claims jwt.MapClaims) string {
+		signed, err := jwt.NewWithClaims(jwt.SigningMethodNone, claims).SignedString(jwt.UnsafeAllowNoneSignatureType)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return signed
+	}
+	otherKey := func(claims jwt.MapClaims) string {
+		key, err := rsa.GenerateKey(rand.Reader, 1024)
+		if err != nil {
+			t.Fatal(err)
+		}
+		token := jwt.NewWithClaims(jwt.SigningMethodRS256, claims)
+		token.Header["kid"] = "rsa"
+		signed, err := token.SignedString(key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return signed
+	}
+
+	tests := []struct {
+		name   string
+		mutate func(c jwt.MapClaims)
+		sign   func(c jwt.MapClaims) string
+		ok     bool
+	}{
+		{"RS256", nil, nil, true},
+		{"ES256", nil, func(c jwt.MapClaims) string { return idp.sign(jwt.SigningMethodES256, "ec", c) }, true},
+		{"字符串形式的 email_verified", func(c jwt.MapClaims) { c["email_verified"] = "true" }, nil, true},
+		{"多个 audience 且 azp 为本客户端", func(c jwt.MapClaims) { c["aud"], c["azp"] = []string{testClientID, "other"}, testClientID }, nil, true},
+		{"nonce 不一致", func(c jwt.MapClaims) { c["nonce"] = "replayed" }, nil, false},
+		{"缺少 nonce", func(c jwt.MapClaims) { delete(c, "nonce") }, nil, false},
+		{"audience 不是本客户端", func(c jwt.MapClaims) { c["aud"] = "other-client" }, nil, false},
+		{"多个 audience 但 azp 不是本客户端", func(c jwt.MapClaims) { c["aud"], c["azp"] = []string{testClientID, "other"}, "other" }, nil, false},
+		{"issuer 不一致", func(c jwt.MapClaims) { c["iss"] = "https://evil.example.com" }, nil, false},
+		{"已过期", func(c jwt.MapClaims) { c["exp"] = now.Add(-2 * time.Minute).Unix() }, nil, false},
+		{"缺少 exp", func(c jwt.MapClaims) { delete(c, "exp") }, nil, false},
+		{"签发时间在未来", func(c jwt.MapClaims) { c["iat"] = now.Add(10 * time.Minute).Unix() }, nil, false},
+		{"缺少 sub", func(c jwt.MapClaims) { delete(c, "sub") }, nil, false},
+		{"alg=none", nil, unsigned, false},
+		{"HS256 使用公钥作为密钥", nil, hmacWithPublicKey, false},
+		{"其他密钥签名", nil, otherKey, false},
+		{"kid 不存在", nil, func(c jwt.MapClaims) string { return idp.sign(jwt.SigningMethodRS256, "unknown", c) }, false},
+		{"用途为加密的密钥", nil, func(c jwt.MapClaims) string { return idp.sign(jwt.SigningMethodRS256, "enc", c) }, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			claims := idp.claims("nonce1")
+			if tt.mutate != nil {
+				tt.mutate(claims)
+			}
+			raw := ""
+			if tt.sign != nil {
+				raw = tt.sign(claims)
+			} else {
+				raw = idp.sign(jwt.SigningMethodRS256, "rsa", claims)
+			}
+
+			got, err := p.VerifyIDToken(context.Background(), raw, "nonce1")
+			if tt.ok && (err != nil || got.Subject != "alice" || !bool(got.EmailVerified)) {
+				t.Errorf("应验证通过: %+v, %v", got, err)
+			}
+			if !tt.ok && !errors.Is(err, ErrInvalidIDToken) {
+				t.Errorf("应返回 ErrInvalidIDToken，got %v", err)
+			}
+		})
+	}
+
+	// 未知 kid 触发的重新获取有最短间隔，伪造的令牌不能让客户端频繁请求身份提供方
+	idp.mu.Lock()
+	defer idp.mu.Unlock()
+	if idp.jwksCalls != 1 {
+		t.Errorf("获取 JWKS %d 次, want 1", idp.jwksCalls)
+	}
+	for _, alg := range p.signingAlgorithms() {
+		if alg == "HS256" || alg == "none" {
+			t.Errorf("不应接受身份提供方声明的 %s", alg)
+		}
+	}
+}
@@ -0,0 +1,181 @@
+package placeholder
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"math"
+
+	"github.com/buckket/go-blurhash"
+	"github.com/disintegration/imaging"
+)
+
+// 计算 BlurHash 和颜色时使用的缩略尺寸，足够表达整体色彩且计算很快
+const sampleSize = 64
+
+// BlurHash 分量数，4x3 适合大多数横向图片
+const (
+	xComponents = 4
+	yComponents = 3
+)
+
+// 颜色分类，用于按颜色筛选图片
+const (
+	ColorRed    = "red"
+	ColorOrange = "orange"
+	ColorYellow = "yellow"
+	ColorGreen  = "green"
+	ColorCyan   = "cyan"
+	ColorBlue   = "blue"
+	ColorPurple = "purple"
+	ColorPink   = "pink"
+	ColorBrown  = "brown"
+	ColorWhite  = "white"
+	ColorGray   = "gray"
+	ColorBlack  = "black"
+)
+
+// Families 所有颜色分类
+var Families = []string{
+	ColorRed, ColorOrange, ColorYellow, ColorGreen, ColorCyan, ColorBlue,
+	ColorPurple, ColorPink, ColorBrown, ColorWhite, ColorGray, ColorBlack,
+}
+
+// Result 图片占位信息
+type Result struct {
+	BlurHash      string // BlurHash 字符串
+	AverageColor  string // 平均色 #RRGGBB
+	DominantColor string // 主色 #RRGGBB
+	ColorFamily   string // 主色所属的颜色分类
+}
+
+// Analyze 计算图片的 BlurHash、平均色和主色
+func Analyze(img image.Image) (*Result, error) {
+	sample := imaging.Fit(img, sampleSize, sampleSize, imaging.Box)
+
+	hash, err := blurhash.Encode(xComponents, yComponents, sample)
+	if err != nil {
+		return nil, fmt.Errorf("计算 BlurHash 失败: %w", err)
+	}
+
+	avg, dominant := colors(sample)
+	return &Result{
+		BlurHash:      hash,
+		AverageColor:  hex(avg),
+		DominantColor: hex(dominant),
+		ColorFamily:   Family(dominant),
+	}, nil
+}
+
+// colors 计算平均色和主色（忽略透明像素）
+// 主色取颜色量化到每通道 4 位后出现次数最多的桶内像素的平均值
+func colors(img *image.NRGBA) (color.NRGBA, color.NRGBA) {
+	type bucket struct {
+		r, g, b, n int
+	}
+	buckets := make(map[int]*bucket)
+	var sumR, sumG, sumB, count int
+
+	for i := 0; i+3 < len(img.Pix); i += 4 {
+		r, g, b, a := int(img.Pix[i]), int(img.Pix[i+1]), int(img.Pix[i+2]), img.Pix[i+3]
+		if a < 128 {
+			continue
+		}
+		sumR, sumG, sumB, count = sumR+r, sumG+g, sumB+b, count+1
+
+		key := (r>>4)<<8 | (g>>4)<<4 | b>>4
+		bk, ok := buckets[key]
+		if !ok {
+			bk = &bucket{}
+			buckets[key] = bk
+		}
+		bk.r, bk.g, bk.b, bk.n = bk.r+r, bk.g+g, bk.b+b, bk.n+1
+	}
+	if count == 0 {
+		return color.NRGBA{A: 255}, color.NRGBA{A: 255}
+	}
+
+	avg := color.NRGBA{uint8(sumR / count), uint8(sumG / count), uint8(sumB / count), 255}
+	var best *bucket
+	for _, bk := range buckets {
+		if best == nil || bk.n > best.n {
+			best = bk
+		}
+	}
+	dominant := color.NRGBA{uint8(best.r / best.n), uint8(best.g / best.n), uint8(best.b / best.n), 255}
+	return avg, dominant
+}
+
+// Family 将颜色归入颜色分类
+func Family(c color.NRGBA) string {
+	r, g, b := float64(c.R)/255, float64(c.G)/255, float64(c.B)/255
+	max := math.Max(r, math.Max(g, b))
+	min := math.Min(r, math.Min(g, b))
+	v := max
+	s := 0.0
+	if max > 0 {
+		s = (max - min) / max
+	}
+
+	switch {
+	case v < 0.2:
+		return ColorBlack
+	case s < 0.15 && v > 0.85:
+		return ColorWhite
+	case s < 0.15:
+		return ColorGray
+	}
+
+	var h float64
+	switch max {
+	case r:
+		h = math.Mod((g-b)/(max-min), 6)
+	case g:
+		h = (b-r)/(max-min) + 2
+	default:
+		h = (r-g)/(max-min) + 4
+	}
+	h *= 60
+	if h < 0 {
+		h += 360
+	}
+
+	switch {
+	case h < 15 || h >= 345:
+		if v < 0.5 {
+			return ColorBrown
+		}
+		return ColorRed
+	case h < 45:
+		if v < 0.6 {
+			return ColorBrown
+		}
+		return ColorOrange
+	case h < 70:
+		return ColorYellow
+	case h < 165:
+		return ColorGreen
+	case h < 200:
+		return ColorCyan
+	case h < 260:
+		return ColorBlue
+	case h < 295:
+		return ColorPurple
+	default:
+		return ColorPink
+	}
+}
+
+// ValidFamily 判断是否为有效的颜色分类
+func ValidFamily(family string) bool {
+	for _, f := range Families {
+		if f == family {
+			return true
+		}
+	}
+	return false
+}
+
+func hex(c color.NRGBA) string {
+	return fmt.Sprintf("#%02X%02X%02X", c.R, c.G, c.B)
+}
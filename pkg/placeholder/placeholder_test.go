@@ -0,0 +1,101 @@
+package placeholder
+
+import (
+	"image"
+	"image/color"
+	"testing"
+
+	"github.com/buckket/go-blurhash"
+)
+
+// fill 生成 w x h 的图片，前 split 列为 left，其余为 right
+func fill(w, h, split int, left, right color.NRGBA) *image.NRGBA {
+	img := image.NewNRGBA(image.Rect(0, 0, w, h))
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			if x < split {
+				img.SetNRGBA(x, y, left)
+			} else {
+				img.SetNRGBA(x, y, right)
+			}
+		}
+	}
+	return img
+}
+
+func TestAnalyze(t *testing.T) {
+	red := color.NRGBA{R: 0xE0, G: 0x10, B: 0x10, A: 0xFF}
+	blue := color.NRGBA{R: 0x10, G: 0x20, B: 0xE0, A: 0xFF}
+
+	result, err := Analyze(fill(200, 100, 150, red, blue))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 4x3 分量的 BlurHash 长度为 6 + 2*(4*3-1)
+	if len(result.BlurHash) != 28 {
+		t.Errorf("BlurHash = %q", result.BlurHash)
+	}
+	if _, err := blurhash.Decode(result.BlurHash, 8, 8, 1); err != nil {
+		t.Errorf("BlurHash 无法解码: %v", err)
+	}
+	// 主色取面积最大的红色，平均色介于两者之间
+	if result.DominantColor != "#E01010" || result.ColorFamily != ColorRed {
+		t.Errorf("主色 = %s (%s)", result.DominantColor, result.ColorFamily)
+	}
+	if result.AverageColor == result.DominantColor || result.AverageColor[0] != '#' || len(result.AverageColor) != 7 {
+		t.Errorf("平均色 = %s", result.AverageColor)
+	}
+}
+
+func TestAnalyzeIgnoresTransparent(t *testing.T) {
+	// 大部分是透明的白色，主色应取不透明的绿色
+	green := color.NRGBA{R: 0x20, G: 0xC0, B: 0x30, A: 0xFF}
+	result, err := Analyze(fill(100, 100, 20, green, color.NRGBA{R: 0xFF, G: 0xFF, B: 0xFF}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.DominantColor != "#20C030" || result.AverageColor != "#20C030" || result.ColorFamily != ColorGreen {
+		t.Errorf("Analyze = %+v", result)
+	}
+
+	// 完全透明时返回黑色，不能除零
+	result, err = Analyze(image.NewNRGBA(image.Rect(0, 0, 10, 10)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.DominantColor != "#000000" || result.ColorFamily != ColorBlack {
+		t.Errorf("透明图片 = %+v", result)
+	}
+}
+
+func TestFamily(t *testing.T) {
+	tests := []struct {
+		c    color.NRGBA
+		want string
+	}{
+		{color.NRGBA{R: 0xFF}, ColorRed},
+		{color.NRGBA{R: 0x60, G: 0x08, B: 0x08}, ColorBrown},
+		{color.NRGBA{R: 0xFF, G: 0x80}, ColorOrange},
+		{color.NRGBA{R: 0x80, G: 0x50, B: 0x20}, ColorBrown},
+		{color.NRGBA{R: 0xFF, G: 0xE0}, ColorYellow},
+		{color.NRGBA{G: 0xC0}, ColorGreen},
+		{color.NRGBA{G: 0xC0, B: 0xC0}, ColorCyan},
+		{color.NRGBA{B: 0xFF}, ColorBlue},
+		{color.NRGBA{R: 0x90, B: 0xFF}, ColorPurple},
+		{color.NRGBA{R: 0xFF, G: 0x60, B: 0xB0}, ColorPink},
+		{color.NRGBA{R: 0xF8, G: 0xF8, B: 0xF8}, ColorWhite},
+		{color.NRGBA{R: 0x80, G: 0x80, B: 0x88}, ColorGray},
+		{color.NRGBA{R: 0x20, G: 0x10, B: 0x10}, ColorBlack},
+	}
+	for _, tt := range tests {
+		if got := Family(tt.c); got != tt.want {
+			t.Errorf("Family(%s) = %s, want %s", hex(tt.c), got, tt.want)
+		}
+		if !ValidFamily(tt.want) {
+			t.Errorf("%s 应为有效的颜色分类", tt.want)
+		}
+	}
+	if ValidFamily("") || ValidFamily("Red") || ValidFamily("magenta") {
+		t.Error("未定义的颜色分类不应通过校验")
+	}
+}
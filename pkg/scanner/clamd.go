@@ -0,0 +1,155 @@
+package scanner
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+	"time"
+)
+
+// 默认每次发送给 clamd 的数据块大小
+const defaultChunkSize = 64 * 1024
+
+// ClamdScanner 通过 clamd 协议（INSTREAM 命令）扫描文件
+type ClamdScanner struct {
+	Network   string        // 网络类型：tcp 或 unix
+	Address   string        // clamd 地址，如 127.0.0.1:3310 或 /var/run/clamav/clamd.ctl
+	Timeout   time.Duration // 单次扫描超时时间
+	ChunkSize int           // 发送数据块大小
+}
+
+// NewClamdScanner 创建 clamd 扫描器
+func NewClamdScanner(network, address string, timeout time.Duration) *ClamdScanner {
+	if network == "" {
+		network = "tcp"
+	}
+	return &ClamdScanner{
+		Network:   network,
+		Address:   address,
+		Timeout:   timeout,
+		ChunkSize: defaultChunkSize,
+	}
+}
+
+// Name 返回扫描引擎名称
+func (s *ClamdScanner) Name() string {
+	return "clamd"
+}
+
+// Ping 检查 clamd 是否可用
+func (s *ClamdScanner) Ping(ctx context.Context) error {
+	reply, err := s.command(ctx, "zPING\x00", nil)
+	if err != nil {
+		return err
+	}
+	if reply != "PONG" {
+		return fmt.Errorf("clamd 响应异常: %s", reply)
+	}
+	return nil
+}
+
+// Scan 使用 INSTREAM 命令把数据流发送给 clamd 扫描
+func (s *ClamdScanner) Scan(ctx context.Context, r io.Reader) (*Result, error) {
+	reply, err := s.command(ctx, "zINSTREAM\x00", r)
+	if err != nil {
+		return nil, err
+	}
+	return parseClamdReply(reply)
+}
+
+// command 发送命令并读取以 \0 结尾的响应，body 不为空时按 INSTREAM 格式分块发送
+func (s *ClamdScanner) command(ctx context.Context, cmd string, body io.Reader) (string, error) {
+	dialer := net.Dialer{Timeout: s.Timeout}
+	conn, err := dialer.DialContext(ctx, s.Network, s.Address)
+	if err != nil {
+		return "", fmt.Errorf("连接 clamd 失败: %w", err)
+	}
+	defer conn.Close()
+
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	} else if s.Timeout > 0 {
+		conn.SetDeadline(time.Now().Add(s.Timeout))
+	}
+
+	if _, err := io.WriteString(conn, cmd); err != nil {
+		return "", fmt.Errorf("发送 clamd 命令失败: %w", err)
+	}
+
+	reader := bufio.NewReader(conn)
+	if body != nil {
+		if err := s.writeChunks(conn, body); err != nil {
+			// clamd 超过 StreamMaxLength 时会先回复错误再关闭连接，此时以它的回复为准
+			if reply, rerr := reader.ReadString(0); rerr == nil {
+				return strings.TrimRight(reply, "\x00\n"), nil
+			}
+			return "", err
+		}
+	}
+
+	reply, err := reader.ReadString(0)
+	if err != nil && !(errors.Is(err, io.EOF) && reply != "") {
+		return "", fmt.Errorf("读取 clamd 响应失败: %w", err)
+	}
+	return strings.TrimRight(reply, "\x00\n"), nil
+}
+
+// writeChunks 按 <4字节大端长度><数据> 的格式发送数据，最后发送长度为 0 的块表示结束
+func (s *ClamdScanner) writeChunks(w io.Writer, r io.Reader) error {
+	chunkSize := s.ChunkSize
+	if chunkSize <= 0 {
+		chunkSize = defaultChunkSize
+	}
+	buf := make([]byte, chunkSize)
+	size := make([]byte, 4)
+
+	for {
+		n, err := r.Read(buf)
+		if n > 0 {
+			binary.BigEndian.PutUint32(size, uint32(n))
+			if _, werr := w.Write(size); werr != nil {
+				return fmt.Errorf("发送数据到 clamd 失败: %w", werr)
+			}
+			if _, werr := w.Write(buf[:n]); werr != nil {
+				return fmt.Errorf("发送数据到 clamd 失败: %w", werr)
+			}
+		}
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return fmt.Errorf("读取待扫描数据失败: %w", err)
+		}
+	}
+
+	binary.BigEndian.PutUint32(size, 0)
+	if _, err := w.Write(size); err != nil {
+		return fmt.Errorf("发送数据到 clamd 失败: %w", err)
+	}
+	return nil
+}
+
+// parseClamdReply 解析 clamd 响应，例如：
+// "stream: OK"、"stream: Eicar-Test-Signature FOUND"、"INSTREAM size limit exceeded. ERROR"
+func parseClamdReply(reply string) (*Result, error) {
+	result := &Result{Engine: "clamd"}
+	msg := strings.TrimSpace(strings.TrimPrefix(reply, "stream:"))
+
+	switch {
+	case msg == "OK":
+		return result, nil
+	case strings.HasSuffix(msg, "FOUND"):
+		result.Infected = true
+		result.Signature = strings.TrimSpace(strings.TrimSuffix(msg, "FOUND"))
+		return result, nil
+	case strings.HasSuffix(msg, "ERROR"):
+		return nil, fmt.Errorf("clamd 扫描出错: %s", strings.TrimSpace(strings.TrimSuffix(msg, "ERROR")))
+	default:
+		return nil, fmt.Errorf("无法解析 clamd 响应: %s", reply)
+	}
+}
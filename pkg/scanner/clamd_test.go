@@ -0,0 +1,204 @@
+package scanner
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/binary"
+	"io"
+	"net"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeClamd 本地 clamd 服务，记录收到的命令和 INSTREAM 数据块
+type fakeClamd struct {
+	listener net.Listener
+	reply    string // INSTREAM 的响应（不含结尾的 \0）
+	maxSize  int    // 大于 0 时模拟 StreamMaxLength 限制
+
+	mu      sync.Mutex
+	command string
+	chunks  []int
+	data    []byte
+}
+
+func newFakeClamd(t *testing.T, reply string) *fakeClamd {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("监听失败: %v", err)
+	}
+	s := &fakeClamd{listener: ln, reply: reply}
+	t.Cleanup(func() { ln.Close() })
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go s.serve(conn)
+		}
+	}()
+	return s
+}
+
+func (s *fakeClamd) scanner() *ClamdScanner {
+	return NewClamdScanner("tcp", s.listener.Addr().String(), 5*time.Second)
+}
+
+func (s *fakeClamd) serve(conn net.Conn) {
+	defer conn.Close()
+	r := bufio.NewReader(conn)
+
+	cmd, err := r.ReadString(0)
+	if err != nil {
+		return
+	}
+	s.mu.Lock()
+	s.command = cmd
+	s.mu.Unlock()
+
+	switch cmd {
+	case "zPING\x00":
+		io.WriteString(conn, "PONG\x00")
+	case "zINSTREAM\x00":
+		size := make([]byte, 4)
+		for {
+			if _, err := io.ReadFull(r, size); err != nil {
+				return
+			}
+			n := int(binary.BigEndian.Uint32(size))
+			if n == 0 {
+				break
+			}
+			chunk := make([]byte, n)
+			if _, err := io.ReadFull(r, chunk); err != nil {
+				return
+			}
+			s.mu.Lock()
+			s.chunks = append(s.chunks, n)
+			s.data = append(s.data, chunk...)
+			over := s.maxSize > 0 && len(s.data) > s.maxSize
+			s.mu.Unlock()
+			if over {
+				// 与 clamd 一致：超过限制时立即响应并关闭连接
+				io.WriteString(conn, "INSTREAM size limit exceeded. ERROR\x00")
+				return
+			}
+		}
+		io.WriteString(conn, s.reply+"\x00")
+	default:
+		io.WriteString(conn, "UNKNOWN COMMAND\x00")
+	}
+}
+
+func TestClamdPing(t *testing.T) {
+	clamd := newFakeClamd(t, "")
+	if err := clamd.scanner().Ping(context.Background()); err != nil {
+		t.Fatalf("Ping 失败: %v", err)
+	}
+	clamd.mu.Lock()
+	defer clamd.mu.Unlock()
+	if clamd.command != "zPING\x00" {
+		t.Errorf("命令 = %q", clamd.command)
+	}
+}
+
+func TestClamdScanClean(t *testing.T) {
+	clamd := newFakeClamd(t, "stream: OK")
+	result, err := clamd.scanner().Scan(context.Background(), strings.NewReader("hello"))
+	if err != nil {
+		t.Fatalf("扫描失败: %v", err)
+	}
+	if result.Infected || result.Signature != "" || result.Engine != "clamd" {
+		t.Errorf("结果 = %+v", result)
+	}
+}
+
+func TestClamdScanFound(t *testing.T) {
+	clamd := newFakeClamd(t, "stream: Eicar-Test-Signature FOUND")
+	result, err := clamd.scanner().Scan(context.Background(), strings.NewReader("X5O!P%@AP"))
+	if err != nil {
+		t.Fatalf("扫描失败: %v", err)
+	}
+	if !result.Infected || result.Signature != "Eicar-Test-Signature" {
+		t.Errorf("结果 = %+v", result)
+	}
+}
+
+func TestClamdScanError(t *testing.T) {
+	clamd := newFakeClamd(t, "stream: Can't allocate memory ERROR")
+	_, err := clamd.scanner().Scan(context.Background(), strings.NewReader("hello"))
+	if err == nil || !strings.Contains(err.Error(), "Can't allocate memory") {
+		t.Fatalf("应返回 clamd 的错误信息，got %v", err)
+	}
+}
+
+func TestClamdScanUnknownReply(t *testing.T) {
+	clamd := newFakeClamd(t, "stream: ???")
+	if _, err := clamd.scanner().Scan(context.Background(), strings.NewReader("hello")); err == nil {
+		t.Fatal("无法识别的响应应返回错误")
+	}
+}
+
+func TestClamdScanChunkFraming(t *testing.T) {
+	clamd := newFakeClamd(t, "stream: OK")
+	s := clamd.scanner()
+	s.ChunkSize = 4
+
+	data := []byte("0123456789")
+	if _, err := s.Scan(context.Background(), bytes.NewReader(data)); err != nil {
+		t.Fatalf("扫描失败: %v", err)
+	}
+
+	clamd.mu.Lock()
+	defer clamd.mu.Unlock()
+	if clamd.command != "zINSTREAM\x00" {
+		t.Errorf("命令 = %q", clamd.command)
+	}
+	if len(clamd.chunks) != 3 || clamd.chunks[0] != 4 || clamd.chunks[1] != 4 || clamd.chunks[2] != 2 {
+		t.Errorf("数据块大小 = %v, want [4 4 2]", clamd.chunks)
+	}
+	if !bytes.Equal(clamd.data, data) {
+		t.Errorf("clamd 收到的数据 = %q", clamd.data)
+	}
+}
+
+func TestClamdScanSizeLimit(t *testing.T) {
+	clamd := newFakeClamd(t, "stream: OK")
+	clamd.maxSize = 8
+	s := clamd.scanner()
+	s.ChunkSize = 4
+
+	_, err := s.Scan(context.Background(), strings.NewReader("0123456789"))
+	if err == nil || !strings.Contains(err.Error(), "INSTREAM size limit exceeded") {
+		t.Fatalf("超过 clamd 大小限制时应返回错误，got %v", err)
+	}
+}
+
+// clamd 在发送过程中关闭连接时，应返回它的限制说明而不是写入失败
+func TestClamdScanSizeLimitLargeStream(t *testing.T) {
+	clamd := newFakeClamd(t, "stream: OK")
+	clamd.maxSize = 1024
+
+	_, err := clamd.scanner().Scan(context.Background(), bytes.NewReader(make([]byte, 32<<20)))
+	if err == nil || !strings.Contains(err.Error(), "INSTREAM size limit exceeded") {
+		t.Fatalf("超过 clamd 大小限制时应返回错误，got %v", err)
+	}
+}
+
+func TestClamdUnavailable(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := ln.Addr().String()
+	ln.Close()
+
+	if _, err := NewClamdScanner("tcp", addr, time.Second).Scan(context.Background(), strings.NewReader("hello")); err == nil {
+		t.Fatal("clamd 不可用时应返回错误")
+	}
+}
@@ -0,0 +1,34 @@
+package scanner
+
+import (
+	"context"
+	"io"
+)
+
+// Result 扫描结果
+type Result struct {
+	Infected  bool   // 是否检测到恶意内容
+	Signature string // 命中的病毒特征名称
+	Engine    string // 扫描引擎名称
+}
+
+// Scanner 文件扫描器接口，上传文件在落库前都会经过扫描
+type Scanner interface {
+	// Scan 扫描数据流，返回扫描结果；扫描器本身不可用时返回 error
+	Scan(ctx context.Context, r io.Reader) (*Result, error)
+	// Name 返回扫描引擎名称
+	Name() string
+}
+
+// NoopScanner 不做任何检查的扫描器，未启用扫描时使用
+type NoopScanner struct{}
+
+// Scan 始终返回未感染
+func (NoopScanner) Scan(ctx context.Context, r io.Reader) (*Result, error) {
+	return &Result{Engine: "noop"}, nil
+}
+
+// Name 返回扫描引擎名称
+func (NoopScanner) Name() string {
+	return "noop"
+}
@@ -0,0 +1,172 @@
+package sigv4
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"hash"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// maxChunkSize 单个分块的大小上限，防止分块头声明超大长度耗尽内存
+const maxChunkSize = 16 << 20
+
+// Body 按签名方式包装请求体：
+// 十六进制摘要会在读完时校验 SHA256，aws-chunked 分块会被解码并校验每个分块的签名，
+// UNSIGNED-PAYLOAD 原样返回
+func (r *Result) Body(body io.Reader) (io.Reader, error) {
+	switch {
+	case r.PayloadHash == UnsignedPayload:
+		return body, nil
+	case r.Streaming():
+		return &chunkedReader{
+			br:       bufio.NewReader(body),
+			result:   r,
+			signed:   r.PayloadHash != StreamingUnsignedTrailer,
+			trailer:  r.PayloadHash != StreamingPayload,
+			prevSign: r.signature,
+		}, nil
+	case len(r.PayloadHash) == sha256.Size*2:
+		expected, err := hex.DecodeString(r.PayloadHash)
+		if err != nil {
+			return nil, ErrUnsupportedPayload
+		}
+		return &hashingReader{r: body, hash: sha256.New(), expected: expected}, nil
+	}
+	return nil, ErrUnsupportedPayload
+}
+
+// hashingReader 读到末尾时校验请求体的 SHA256
+type hashingReader struct {
+	r        io.Reader
+	hash     hash.Hash
+	expected []byte
+}
+
+func (h *hashingReader) Read(p []byte) (int, error) {
+	n, err := h.r.Read(p)
+	h.hash.Write(p[:n])
+	if err == io.EOF && !bytes.Equal(h.hash.Sum(nil), h.expected) {
+		return n, ErrContentSHAMismatch
+	}
+	return n, err
+}
+
+// chunkedReader 解码 aws-chunked 格式：
+//
+//	<十六进制长度>[;chunk-signature=<签名>]\r\n<数据>\r\n ... 0[;chunk-signature=<签名>]\r\n[尾部字段\r\n]\r\n
+type chunkedReader struct {
+	br       *bufio.Reader
+	result   *Result
+	signed   bool
+	trailer  bool
+	prevSign string
+	chunk    []byte
+	done     bool
+}
+
+func (c *chunkedReader) Read(p []byte) (int, error) {
+	for len(c.chunk) == 0 {
+		if c.done {
+			return 0, io.EOF
+		}
+		if err := c.nextChunk(); err != nil {
+			return 0, err
+		}
+	}
+	n := copy(p, c.chunk)
+	c.chunk = c.chunk[n:]
+	return n, nil
+}
+
+// nextChunk 读取并校验下一个分块
+func (c *chunkedReader) nextChunk() error {
+	line, err := c.readLine()
+	if err != nil {
+		return err
+	}
+
+	sizeField, params, _ := strings.Cut(line, ";")
+	size, err := strconv.ParseInt(strings.TrimSpace(sizeField), 16, 64)
+	if err != nil || size < 0 || size > maxChunkSize {
+		return ErrBadChunk
+	}
+
+	data := make([]byte, size)
+	if _, err := io.ReadFull(c.br, data); err != nil {
+		return ErrBadChunk
+	}
+
+	if c.signed {
+		signature, ok := strings.CutPrefix(strings.TrimSpace(params), "chunk-signature=")
+		if !ok || signature == "" {
+			return ErrBadChunk
+		}
+		stringToSign := strings.Join([]string{
+			"AWS4-HMAC-SHA256-PAYLOAD",
+			c.result.date.Format(TimeFormat),
+			c.result.scope,
+			c.prevSign,
+			emptySHA256,
+			hashHex(data),
+		}, "\n")
+		expected := hex.EncodeToString(hmacSHA256(c.result.signingKey, []byte(stringToSign)))
+		if !hmac.Equal([]byte(expected), []byte(signature)) {
+			return ErrChunkSignature
+		}
+		c.prevSign = signature
+	}
+
+	if size == 0 {
+		c.done = true
+		return c.skipTrailer()
+	}
+
+	// 数据后紧跟 \r\n
+	if line, err := c.readLine(); err != nil || line != "" {
+		return ErrBadChunk
+	}
+	c.chunk = data
+	return nil
+}
+
+// skipTrailer 跳过最后一个分块之后的尾部字段（如 x-amz-checksum-crc32），直到空行或结束
+func (c *chunkedReader) skipTrailer() error {
+	for {
+		line, err := c.readLine()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if line == "" && !c.trailer {
+			return nil
+		}
+		if line == "" {
+			// 带尾部字段的格式中，最后一个分块后可能还有空行分隔，继续读到结束
+			continue
+		}
+	}
+}
+
+// readLine 读取一行并去掉末尾的 \r\n
+func (c *chunkedReader) readLine() (string, error) {
+	line, err := c.br.ReadString('\n')
+	if err != nil {
+		if err == io.EOF && line == "" {
+			return "", io.EOF
+		}
+		if err != io.EOF {
+			return "", err
+		}
+	}
+	if len(line) > 4096 {
+		return "", ErrBadChunk
+	}
+	return strings.TrimRight(line, "\r\n"), nil
+}
@@ -0,0 +1,363 @@
+// Package sigv4 实现 AWS Signature Version 4 的服务端校验，供 S3 兼容接口使用
+// 支持 Authorization 请求头、预签名 URL 以及 aws-chunked 分块上传
+package sigv4
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// Algorithm 唯一支持的签名算法
+	Algorithm = "AWS4-HMAC-SHA256"
+	// TimeFormat X-Amz-Date 的时间格式
+	TimeFormat = "20060102T150405Z"
+	// dateFormat 凭证范围中的日期格式
+	dateFormat = "20060102"
+
+	// UnsignedPayload 请求体不参与签名
+	UnsignedPayload = "UNSIGNED-PAYLOAD"
+	// StreamingPayload 分块上传，每个分块都带签名
+	StreamingPayload = "STREAMING-AWS4-HMAC-SHA256-PAYLOAD"
+	// StreamingPayloadTrailer 分块上传，每个分块都带签名，末尾附带校验和
+	StreamingPayloadTrailer = "STREAMING-AWS4-HMAC-SHA256-PAYLOAD-TRAILER"
+	// StreamingUnsignedTrailer 分块上传，分块不签名，末尾附带校验和
+	StreamingUnsignedTrailer = "STREAMING-UNSIGNED-PAYLOAD-TRAILER"
+
+	// MaxClockSkew 允许的客户端时间误差
+	MaxClockSkew = 15 * time.Minute
+	// maxPresignExpires 预签名 URL 的最长有效期（7 天，与 AWS 一致）
+	maxPresignExpires = 7 * 24 * time.Hour
+)
+
+// emptySHA256 空字符串的 SHA256，分块签名时使用
+var emptySHA256 = hashHex(nil)
+
+// Error 签名校验错误，Code 与 S3 的错误码一致
+type Error struct {
+	Code    string
+	Message string
+}
+
+func (e *Error) Error() string {
+	return e.Code + ": " + e.Message
+}
+
+var (
+	ErrMissingAuth        = &Error{"AccessDenied", "请求缺少签名信息"}
+	ErrMalformedAuth      = &Error{"AuthorizationHeaderMalformed", "签名信息格式错误"}
+	ErrUnsupportedAlgo    = &Error{"AuthorizationHeaderMalformed", "只支持 AWS4-HMAC-SHA256 签名"}
+	ErrInvalidAccessKey   = &Error{"InvalidAccessKeyId", "访问密钥不存在或已失效"}
+	ErrSignatureMismatch  = &Error{"SignatureDoesNotMatch", "签名不匹配"}
+	ErrRequestExpired     = &Error{"AccessDenied", "预签名 URL 已过期"}
+	ErrTimeTooSkewed      = &Error{"RequestTimeTooSkewed", "请求时间与服务器时间相差过大"}
+	ErrContentSHAMismatch = &Error{"XAmzContentSHA256Mismatch", "请求体的 SHA256 与 x-amz-content-sha256 不一致"}
+	ErrUnsupportedPayload = &Error{"NotImplemented", "不支持的 x-amz-content-sha256"}
+	ErrBadChunk           = &Error{"IncompleteBody", "分块上传的数据格式错误"}
+	ErrChunkSignature     = &Error{"SignatureDoesNotMatch", "分块签名不匹配"}
+)
+
+// CredentialLookup 根据访问密钥 ID 返回对应的私有密钥，找不到时返回错误
+type CredentialLookup func(accessKeyID string) (secretKey string, err error)
+
+// Result 校验通过后的签名信息，读取请求体时需要用到
+type Result struct {
+	AccessKeyID string
+	Region      string
+	// PayloadHash x-amz-content-sha256 的值，可能是十六进制摘要或 UNSIGNED-PAYLOAD 等特殊值
+	PayloadHash string
+	// Presigned 是否为预签名 URL
+	Presigned bool
+
+	date       time.Time
+	scope      string
+	signature  string
+	signingKey []byte
+}
+
+// Streaming 请求体是否为 aws-chunked 分块格式
+func (r *Result) Streaming() bool {
+	switch r.PayloadHash {
+	case StreamingPayload, StreamingPayloadTrailer, StreamingUnsignedTrailer:
+		return true
+	}
+	return false
+}
+
+// authInfo 从请求头或查询参数中解析出的签名参数
+type authInfo struct {
+	accessKeyID   string
+	date          string
+	region        string
+	service       string
+	signedHeaders []string
+	signature     string
+	amzDate       string
+	expires       time.Duration
+	presigned     bool
+}
+
+// Verify 校验请求的签名，lookup 用于查询访问密钥对应的私有密钥
+// 返回的 Result 用于包装请求体（见 Result.Body）
+func Verify(r *http.Request, lookup CredentialLookup, now time.Time) (*Result, error) {
+	var info *authInfo
+	var err error
+	if r.URL.Query().Get("X-Amz-Algorithm") != "" {
+		info, err = parsePresigned(r.URL.Query())
+	} else {
+		info, err = parseAuthHeader(r)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if info.service != "s3" {
+		return nil, ErrMalformedAuth
+	}
+
+	requestTime, err := time.Parse(TimeFormat, info.amzDate)
+	if err != nil || requestTime.Format(dateFormat) != info.date {
+		return nil, ErrMalformedAuth
+	}
+	if info.presigned {
+		if now.Before(requestTime.Add(-MaxClockSkew)) {
+			return nil, ErrTimeTooSkewed
+		}
+		if now.After(requestTime.Add(info.expires)) {
+			return nil, ErrRequestExpired
+		}
+	} else if d := now.Sub(requestTime); d > MaxClockSkew || d < -MaxClockSkew {
+		return nil, ErrTimeTooSkewed
+	}
+
+	secretKey, err := lookup(info.accessKeyID)
+	if err != nil {
+		return nil, ErrInvalidAccessKey
+	}
+
+	payloadHash := r.Header.Get("X-Amz-Content-Sha256")
+	if info.presigned {
+		payloadHash = UnsignedPayload
+	} else if payloadHash == "" {
+		// 未声明时按 AWS 的约定视为对空请求体签名
+		payloadHash = emptySHA256
+	}
+
+	scope := strings.Join([]string{info.date, info.region, info.service, "aws4_request"}, "/")
+	canonical := canonicalRequest(r, info.signedHeaders, payloadHash, info.presigned)
+	stringToSign := strings.Join([]string{Algorithm, info.amzDate, scope, hashHex([]byte(canonical))}, "\n")
+	signingKey := SigningKey(secretKey, info.date, info.region, info.service)
+	expected := hex.EncodeToString(hmacSHA256(signingKey, []byte(stringToSign)))
+	if !hmac.Equal([]byte(expected), []byte(info.signature)) {
+		return nil, ErrSignatureMismatch
+	}
+
+	return &Result{
+		AccessKeyID: info.accessKeyID,
+		Region:      info.region,
+		PayloadHash: payloadHash,
+		Presigned:   info.presigned,
+		date:        requestTime,
+		scope:       scope,
+		signature:   info.signature,
+		signingKey:  signingKey,
+	}, nil
+}
+
+// parseAuthHeader 解析 Authorization 请求头：
+// AWS4-HMAC-SHA256 Credential=AKID/20060102/us-east-1/s3/aws4_request, SignedHeaders=host;x-amz-date, Signature=...
+func parseAuthHeader(r *http.Request) (*authInfo, error) {
+	header := r.Header.Get("Authorization")
+	if header == "" {
+		return nil, ErrMissingAuth
+	}
+	algorithm, rest, ok := strings.Cut(header, " ")
+	if !ok {
+		return nil, ErrMalformedAuth
+	}
+	if algorithm != Algorithm {
+		return nil, ErrUnsupportedAlgo
+	}
+
+	fields := make(map[string]string)
+	for _, part := range strings.Split(rest, ",") {
+		key, value, ok := strings.Cut(strings.TrimSpace(part), "=")
+		if !ok {
+			return nil, ErrMalformedAuth
+		}
+		fields[key] = value
+	}
+
+	info, err := parseCredential(fields["Credential"])
+	if err != nil {
+		return nil, err
+	}
+	if fields["SignedHeaders"] == "" || fields["Signature"] == "" {
+		return nil, ErrMalformedAuth
+	}
+	info.signedHeaders = strings.Split(fields["SignedHeaders"], ";")
+	info.signature = fields["Signature"]
+
+	info.amzDate = r.Header.Get("X-Amz-Date")
+	if info.amzDate == "" {
+		// 未提供 X-Amz-Date 时使用 Date 请求头
+		date, err := http.ParseTime(r.Header.Get("Date"))
+		if err != nil {
+			return nil, ErrMalformedAuth
+		}
+		info.amzDate = date.UTC().Format(TimeFormat)
+	}
+	return info, nil
+}
+
+// parsePresigned 解析预签名 URL 中的签名参数
+func parsePresigned(query url.Values) (*authInfo, error) {
+	if query.Get("X-Amz-Algorithm") != Algorithm {
+		return nil, ErrUnsupportedAlgo
+	}
+	info, err := parseCredential(query.Get("X-Amz-Credential"))
+	if err != nil {
+		return nil, err
+	}
+
+	expires, err := strconv.Atoi(query.Get("X-Amz-Expires"))
+	if err != nil || expires < 0 || time.Duration(expires)*time.Second > maxPresignExpires {
+		return nil, ErrMalformedAuth
+	}
+	if query.Get("X-Amz-SignedHeaders") == "" || query.Get("X-Amz-Signature") == "" {
+		return nil, ErrMalformedAuth
+	}
+
+	info.amzDate = query.Get("X-Amz-Date")
+	info.expires = time.Duration(expires) * time.Second
+	info.signedHeaders = strings.Split(query.Get("X-Amz-SignedHeaders"), ";")
+	info.signature = query.Get("X-Amz-Signature")
+	info.presigned = true
+	return info, nil
+}
+
+// parseCredential 解析 AKID/date/region/service/aws4_request
+func parseCredential(credential string) (*authInfo, error) {
+	parts := strings.Split(credential, "/")
+	if len(parts) != 5 || parts[4] != "aws4_request" || parts[0] == "" {
+		return nil, ErrMalformedAuth
+	}
+	return &authInfo{
+		accessKeyID: parts[0],
+		date:        parts[1],
+		region:      parts[2],
+		service:     parts[3],
+	}, nil
+}
+
+// canonicalRequest 按 SigV4 规则构造规范请求
+func canonicalRequest(r *http.Request, signedHeaders []string, payloadHash string, presigned bool) string {
+	var headers strings.Builder
+	for _, name := range signedHeaders {
+		headers.WriteString(name)
+		headers.WriteByte(':')
+		headers.WriteString(canonicalHeaderValue(r, name))
+		headers.WriteByte('\n')
+	}
+
+	return strings.Join([]string{
+		r.Method,
+		EncodePath(r.URL.Path),
+		canonicalQuery(r.URL.Query(), presigned),
+		headers.String(),
+		strings.Join(signedHeaders, ";"),
+		payloadHash,
+	}, "\n")
+}
+
+// canonicalHeaderValue 返回参与签名的请求头的值，多个值以逗号连接，并压缩连续空白
+func canonicalHeaderValue(r *http.Request, name string) string {
+	var values []string
+	switch name {
+	case "host":
+		values = []string{r.Host}
+	case "content-length":
+		values = append(values, r.Header.Values("Content-Length")...)
+		if len(values) == 0 && r.ContentLength >= 0 {
+			values = []string{strconv.FormatInt(r.ContentLength, 10)}
+		}
+	case "transfer-encoding":
+		values = append(values, r.TransferEncoding...)
+	default:
+		// 复制一份，避免压缩空白时修改原请求头
+		values = append(values, r.Header.Values(name)...)
+	}
+
+	for i, v := range values {
+		values[i] = strings.Join(strings.Fields(v), " ")
+	}
+	return strings.Join(values, ",")
+}
+
+// canonicalQuery 对查询参数按名称和值排序后编码，预签名 URL 不包含 X-Amz-Signature
+func canonicalQuery(query url.Values, presigned bool) string {
+	pairs := make([]string, 0, len(query))
+	for key, values := range query {
+		if presigned && key == "X-Amz-Signature" {
+			continue
+		}
+		encodedKey := uriEncode(key, true)
+		for _, value := range values {
+			pairs = append(pairs, encodedKey+"="+uriEncode(value, true))
+		}
+	}
+	sort.Strings(pairs)
+	return strings.Join(pairs, "&")
+}
+
+// EncodePath 按 S3 的规则编码路径：每个字节只编码一次，保留斜杠
+func EncodePath(path string) string {
+	if path == "" {
+		return "/"
+	}
+	return uriEncode(path, false)
+}
+
+// uriEncode 按 SigV4 的 UriEncode 规则编码，只保留 A-Za-z0-9-._~ 不编码
+func uriEncode(s string, encodeSlash bool) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case 'A' <= c && c <= 'Z', 'a' <= c && c <= 'z', '0' <= c && c <= '9',
+			c == '-', c == '_', c == '.', c == '~':
+			b.WriteByte(c)
+		case c == '/' && !encodeSlash:
+			b.WriteByte(c)
+		default:
+			fmt.Fprintf(&b, "%%%02X", c)
+		}
+	}
+	return b.String()
+}
+
+// SigningKey 派生签名密钥
+func SigningKey(secretKey, date, region, service string) []byte {
+	key := hmacSHA256([]byte("AWS4"+secretKey), []byte(date))
+	key = hmacSHA256(key, []byte(region))
+	key = hmacSHA256(key, []byte(service))
+	return hmacSHA256(key, []byte("aws4_request"))
+}
+
+func hmacSHA256(key, data []byte) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write(data)
+	return mac.Sum(nil)
+}
+
+func hashHex(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
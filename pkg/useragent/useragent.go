@@ -0,0 +1,84 @@
+// Package useragent 从 User-Agent 中识别浏览器和操作系统，生成会话列表中显示的设备名称
+package useragent
+
+import "strings"
+
+// rule 按顺序匹配 User-Agent 中的关键字，靠前的规则优先
+type rule struct {
+	token string
+	name  string
+}
+
+// 基于 Chromium 的浏览器同时包含 Chrome 和 Safari，需要排在前面
+var browsers = []rule{
+	{"Edg/", "Edge"},
+	{"EdgA/", "Edge"},
+	{"EdgiOS/", "Edge"},
+	{"OPR/", "Opera"},
+	{"SamsungBrowser/", "Samsung Internet"},
+	{"MicroMessenger/", "微信"},
+	{"Firefox/", "Firefox"},
+	{"FxiOS/", "Firefox"},
+	{"CriOS/", "Chrome"},
+	{"Chrome/", "Chrome"},
+	{"Safari/", "Safari"},
+}
+
+// iOS 和 Android 的 User-Agent 中也包含 Mac OS X 和 Linux
+var systems = []rule{
+	{"iPhone", "iOS"},
+	{"iPad", "iPadOS"},
+	{"Android", "Android"},
+	{"Windows", "Windows"},
+	{"Mac OS X", "macOS"},
+	{"Macintosh", "macOS"},
+	{"CrOS", "ChromeOS"},
+	{"Linux", "Linux"},
+}
+
+// 非浏览器客户端，如上传工具和命令行工具
+var clients = []rule{
+	{"PicGo", "PicGo"},
+	{"ShareX", "ShareX"},
+	{"Typora", "Typora"},
+	{"curl/", "curl"},
+	{"Wget/", "Wget"},
+	{"okhttp/", "OkHttp"},
+	{"python-requests/", "Python"},
+	{"Go-http-client/", "Go"},
+	{"PostmanRuntime/", "Postman"},
+}
+
+// Label 返回设备名称，如 "Chrome on Windows"；无法识别时返回 "未知设备"
+func Label(userAgent string) string {
+	if userAgent == "" {
+		return "未知设备"
+	}
+	for _, c := range clients {
+		if strings.Contains(userAgent, c.token) {
+			return c.name
+		}
+	}
+
+	browser := match(browsers, userAgent)
+	system := match(systems, userAgent)
+	switch {
+	case browser != "" && system != "":
+		return browser + " on " + system
+	case browser != "":
+		return browser
+	case system != "":
+		return system
+	default:
+		return "未知设备"
+	}
+}
+
+func match(rules []rule, userAgent string) string {
+	for _, r := range rules {
+		if strings.Contains(userAgent, r.token) {
+			return r.name
+		}
+	}
+	return ""
+}
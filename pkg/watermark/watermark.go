@@ -0,0 +1,237 @@
+package watermark
+
+import (
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/disintegration/imaging"
+	"golang.org/x/image/font"
+	"golang.org/x/image/font/gofont/gobold"
+	"golang.org/x/image/font/opentype"
+	"golang.org/x/image/math/fixed"
+)
+
+// 水印位置
+const (
+	PositionTopLeft     = "top-left"
+	PositionTopRight    = "top-right"
+	PositionBottomLeft  = "bottom-left"
+	PositionBottomRight = "bottom-right"
+	PositionCenter      = "center"
+)
+
+// 水印类型
+const (
+	TypeText  = "text"
+	TypeImage = "image"
+)
+
+// 默认参数
+const (
+	DefaultOpacity  = 0.5
+	DefaultScale    = 0.2
+	DefaultMargin   = 0.02
+	DefaultFontSize = 64
+	DefaultColor    = "#FFFFFF"
+)
+
+var (
+	ErrEmptyWatermark  = errors.New("水印文字和水印图片不能同时为空")
+	ErrInvalidPosition = errors.New("无效的水印位置")
+	ErrInvalidColor    = errors.New("无效的水印颜色")
+)
+
+// Options 水印参数
+type Options struct {
+	Type     string      // text 或 image
+	Text     string      // 文字水印内容
+	FontPath string      // 字体文件路径（TTF/OTF），为空时使用内置字体（不含中文字形）
+	Color    string      // 文字颜色，#RRGGBB 或 #RRGGBBAA
+	Image    image.Image // 图片水印
+	Position string      // 水印位置
+	Opacity  float64     // 不透明度 0~1
+	Scale    float64     // 水印宽度占目标图片宽度的比例 0~1
+	Margin   float64     // 水印与边缘的距离占目标图片宽度的比例
+	MinWidth int         // 目标图片窄于该宽度时不加水印，避免小缩略图被水印遮挡
+}
+
+// Watermark 已准备好的水印，可重复应用到多张图片
+type Watermark struct {
+	mark     image.Image
+	position string
+	opacity  float64
+	scale    float64
+	margin   float64
+	minWidth int
+}
+
+// New 根据参数创建水印，文字水印会预先渲染为图片
+func New(opts Options) (*Watermark, error) {
+	position := opts.Position
+	if position == "" {
+		position = PositionBottomRight
+	}
+	if !ValidPosition(position) {
+		return nil, ErrInvalidPosition
+	}
+
+	wm := &Watermark{
+		position: position,
+		opacity:  clamp(opts.Opacity, DefaultOpacity),
+		scale:    clamp(opts.Scale, DefaultScale),
+		margin:   opts.Margin,
+		minWidth: opts.MinWidth,
+	}
+	if wm.margin <= 0 {
+		wm.margin = DefaultMargin
+	}
+
+	switch {
+	case opts.Type == TypeImage && opts.Image != nil:
+		wm.mark = opts.Image
+	case opts.Type != TypeImage && strings.TrimSpace(opts.Text) != "":
+		mark, err := renderText(opts.Text, opts.FontPath, opts.Color)
+		if err != nil {
+			return nil, err
+		}
+		wm.mark = mark
+	default:
+		return nil, ErrEmptyWatermark
+	}
+	return wm, nil
+}
+
+// ValidPosition 判断水印位置是否有效
+func ValidPosition(position string) bool {
+	switch position {
+	case PositionTopLeft, PositionTopRight, PositionBottomLeft, PositionBottomRight, PositionCenter:
+		return true
+	}
+	return false
+}
+
+// Apply 将水印叠加到图片上，返回新图片；图片过窄时原样返回
+func (w *Watermark) Apply(img image.Image) image.Image {
+	if w == nil {
+		return img
+	}
+	bounds := img.Bounds()
+	if bounds.Dx() < w.minWidth {
+		return img
+	}
+
+	markWidth := int(float64(bounds.Dx()) * w.scale)
+	if markWidth < 1 {
+		return img
+	}
+	mark := imaging.Resize(w.mark, markWidth, 0, imaging.Lanczos)
+	// 水印比图片还高时按高度缩放
+	if mark.Bounds().Dy() > bounds.Dy() {
+		mark = imaging.Resize(w.mark, 0, bounds.Dy(), imaging.Lanczos)
+	}
+
+	margin := int(float64(bounds.Dx()) * w.margin)
+	mw, mh := mark.Bounds().Dx(), mark.Bounds().Dy()
+	var pos image.Point
+	switch w.position {
+	case PositionTopLeft:
+		pos = image.Pt(margin, margin)
+	case PositionTopRight:
+		pos = image.Pt(bounds.Dx()-mw-margin, margin)
+	case PositionBottomLeft:
+		pos = image.Pt(margin, bounds.Dy()-mh-margin)
+	case PositionCenter:
+		pos = image.Pt((bounds.Dx()-mw)/2, (bounds.Dy()-mh)/2)
+	default:
+		pos = image.Pt(bounds.Dx()-mw-margin, bounds.Dy()-mh-margin)
+	}
+	return imaging.Overlay(img, mark, bounds.Min.Add(pos), w.opacity)
+}
+
+// renderText 将文字渲染为透明背景的图片，带一层半透明阴影保证在浅色图片上可见
+func renderText(text, fontPath, hexColor string) (image.Image, error) {
+	fontData := gobold.TTF
+	if fontPath != "" {
+		data, err := os.ReadFile(fontPath)
+		if err != nil {
+			return nil, fmt.Errorf("读取水印字体失败: %w", err)
+		}
+		fontData = data
+	}
+	f, err := opentype.Parse(fontData)
+	if err != nil {
+		return nil, fmt.Errorf("解析水印字体失败: %w", err)
+	}
+	face, err := opentype.NewFace(f, &opentype.FaceOptions{Size: DefaultFontSize, DPI: 72, Hinting: font.HintingFull})
+	if err != nil {
+		return nil, err
+	}
+	defer face.Close()
+
+	textColor, err := parseColor(hexColor)
+	if err != nil {
+		return nil, err
+	}
+
+	metrics := face.Metrics()
+	shadow := DefaultFontSize / 16
+	width := font.MeasureString(face, text).Ceil() + shadow
+	height := (metrics.Ascent + metrics.Descent).Ceil() + shadow
+	if width <= shadow {
+		return nil, ErrEmptyWatermark
+	}
+
+	dst := image.NewNRGBA(image.Rect(0, 0, width, height))
+	drawer := &font.Drawer{Dst: dst, Face: face}
+
+	drawer.Src = image.NewUniform(color.NRGBA{0, 0, 0, 128})
+	drawer.Dot = fixed.Point26_6{X: fixed.I(shadow), Y: metrics.Ascent + fixed.I(shadow)}
+	drawer.DrawString(text)
+
+	drawer.Src = image.NewUniform(textColor)
+	drawer.Dot = fixed.Point26_6{X: 0, Y: metrics.Ascent}
+	drawer.DrawString(text)
+
+	return dst, nil
+}
+
+// parseColor 解析 #RRGGBB 或 #RRGGBBAA 格式的颜色
+func parseColor(s string) (color.Color, error) {
+	if s == "" {
+		s = DefaultColor
+	}
+	s = strings.TrimPrefix(s, "#")
+	if len(s) != 6 && len(s) != 8 {
+		return nil, ErrInvalidColor
+	}
+	v, err := strconv.ParseUint(s, 16, 32)
+	if err != nil {
+		return nil, ErrInvalidColor
+	}
+	if len(s) == 6 {
+		v = v<<8 | 0xFF
+	}
+	return color.NRGBA{R: uint8(v >> 24), G: uint8(v >> 16), B: uint8(v >> 8), A: uint8(v)}, nil
+}
+
+// ValidColor 判断颜色格式是否有效
+func ValidColor(s string) bool {
+	_, err := parseColor(s)
+	return err == nil
+}
+
+// clamp 将值限制在 (0, 1]，无效时使用默认值
+func clamp(v, def float64) float64 {
+	if v <= 0 {
+		return def
+	}
+	if v > 1 {
+		return 1
+	}
+	return v
+}
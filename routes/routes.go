@@ -2,9 +2,12 @@ package routes
 
 import (
 	"fmt"
+	"img_hosting/config"
 	"img_hosting/controllers"
 	"img_hosting/docs"
 	"img_hosting/middleware"
+	"img_hosting/pkg/logger"
+	"net/http"
 
 	"github.com/gin-gonic/gin"
 	swaggerFiles "github.com/swaggo/files"
@@ -20,6 +23,11 @@ import (
 func SetupRouter() *gin.Engine {
 	r := gin.Default()
 
+	// 设置可信的反向代理，只有经过这些代理的请求才使用转发头中的客户端 IP
+	if err := middleware.ConfigureTrustedProxies(r); err != nil {
+		logger.GetLogger().Fatalf("可信代理配置错误: %v", err)
+	}
+
 	// 使用自定义CORS中间件
 	r.Use(middleware.CORSMiddleware())
 
@@ -46,6 +54,15 @@ func SetupRouter() *gin.Engine {
 	tokenController := &controllers.TokenController{} // 取消注释，启用令牌控制器
 	tokenVerifyController := controllers.NewTokenVerifyController()
 	permController := controllers.NewPermissionController()
+	shareLinkController := controllers.NewShareLinkController()
+	quarantineController := controllers.NewQuarantineController()
+	watermarkController := controllers.NewWatermarkController()
+	uploaderController := controllers.NewUploaderController()
+	twoFactorController := controllers.NewTwoFactorController()
+	accountController := controllers.NewAccountController()
+	loginAttemptController := controllers.NewLoginAttemptController()
+	oidcController := controllers.NewOIDCController()
+	sessionController := controllers.NewSessionController()
 
 	fmt.Println("控制器初始化完成")
 
@@ -55,8 +72,22 @@ func SetupRouter() *gin.Engine {
 		fmt.Println("注册用户认证路由: /auth/login, /auth/register")
 		authGroup.POST("/login", authController.Login)
 		authGroup.POST("/register", authController.Register)
+		authGroup.POST("/refresh", authController.Refresh)
+		authGroup.POST("/logout", authController.Logout)
+		authGroup.POST("/2fa/verify", authController.VerifyTwoFactor)
+		authGroup.POST("/password/forgot", accountController.ForgotPassword)
+		authGroup.POST("/password/reset", accountController.ResetPassword)
+		authGroup.GET("/verify-email", accountController.VerifyEmail)
+		authGroup.POST("/verify-email", accountController.VerifyEmail)
+		authGroup.GET("/oidc/providers", oidcController.ListProviders)
+		authGroup.GET("/oidc/:provider/login", oidcController.Login)
+		authGroup.GET("/oidc/:provider/callback", oidcController.Callback)
+		authGroup.POST("/oidc/exchange", oidcController.Exchange)
 	}
 
+	// JWT 公钥（JWKS），供其他服务验证登录令牌
+	r.GET("/.well-known/jwks.json", authController.JWKS)
+
 	// 令牌验证路由
 	r.GET("/api/verify-token", tokenVerifyController.VerifyToken)
 
@@ -67,8 +98,22 @@ func SetupRouter() *gin.Engine {
 		tokenGroup.POST("/tokens", tokenController.CreateToken)
 		tokenGroup.GET("/tokens", tokenController.ListTokens)
 		tokenGroup.DELETE("/tokens/:token", tokenController.RevokeToken)
+		tokenGroup.GET("/uploaders/sharex", uploaderController.ShareXConfig)
+		tokenGroup.GET("/uploaders/picgo", uploaderController.PicGoConfig)
+	}
+
+	// 第三方上传工具（ShareX / PicGo / Typora）路由，使用个人 API 令牌认证
+	uploaderGroup := r.Group("/api")
+	uploaderGroup.Use(middleware.APITokenMiddleware(), middleware.PermissionMiddleware())
+	{
+		uploaderGroup.POST("/upload", uploaderController.Upload)
 	}
 
+	// 删除链接（无需认证，凭链接中的密钥删除）
+	r.GET("/api/delete/:key", uploaderController.ConfirmDelete)
+	r.POST("/api/delete/:key", uploaderController.DeleteByKey)
+	r.DELETE("/api/delete/:key", uploaderController.DeleteByKey)
+
 	// 图片相关路由
 	imageGroup := r.Group("/images")
 	imageGroup.Use(middleware.AuthMiddleware(), middleware.PermissionMiddleware())
@@ -76,6 +121,8 @@ func SetupRouter() *gin.Engine {
 		fmt.Println("注册图片上传路由: /images/upload")
 		imageGroup.POST("/upload", imageController.UploadImage)
 		imageGroup.POST("/batch-upload", imageController.BatchUploadImages)
+		imageGroup.POST("/upload-url", imageController.UploadImageFromURL)
+		imageGroup.POST("/upload-base64", imageController.UploadImageBase64)
 		imageGroup.GET("", imageController.ListImages)
 		imageGroup.GET("/search", imageController.SearchImages)
 		imageGroup.GET("/:id", imageController.GetImage)
@@ -86,6 +133,9 @@ func SetupRouter() *gin.Engine {
 		fmt.Println("注册图片批量上传路由: POST /images/batch-upload")
 	}
 
+	// 缩略图访问路由（无需认证）
+	r.GET("/thumbnails/:name", imageController.ServeThumbnail)
+
 	// 标签相关路由
 	tagGroup := r.Group("/tags")
 	tagGroup.Use(middleware.AuthMiddleware())
@@ -108,6 +158,25 @@ func SetupRouter() *gin.Engine {
 		userGroup.POST("/:id/roles", userController.ManageRoles)
 		userGroup.GET("/:id/roles", userController.GetRoles)
 		userGroup.GET("/me/images", imageController.GetUserImages)
+		userGroup.GET("/me/usage", userController.GetStorageUsage)
+		userGroup.PUT("/me/password", userController.ChangePassword)
+		userGroup.GET("/me/watermark", watermarkController.GetWatermark)
+		userGroup.PUT("/me/watermark", watermarkController.UpdateWatermark)
+		userGroup.DELETE("/me/watermark", watermarkController.DeleteWatermark)
+		userGroup.POST("/me/verify-email", accountController.ResendVerification)
+		userGroup.GET("/me/identities", oidcController.ListIdentities)
+		userGroup.GET("/me/sessions", sessionController.ListSessions)
+		userGroup.DELETE("/me/sessions", sessionController.RevokeOtherSessions)
+		userGroup.DELETE("/me/sessions/:id", sessionController.RevokeSession)
+		userGroup.GET("/me/2fa", twoFactorController.GetStatus)
+		userGroup.POST("/me/2fa/totp", twoFactorController.BeginTOTP)
+		userGroup.GET("/me/2fa/totp/qr", twoFactorController.TOTPQRCode)
+		userGroup.POST("/me/2fa/totp/verify", twoFactorController.ConfirmTOTP)
+		userGroup.DELETE("/me/2fa/totp", twoFactorController.DisableTOTP)
+		userGroup.POST("/me/2fa/recovery-codes", twoFactorController.RegenerateRecoveryCodes)
+		userGroup.DELETE("/:id/2fa", twoFactorController.ResetUserTwoFactor)
+		userGroup.DELETE("/:id/login-lock", loginAttemptController.UnlockLogin)
+		userGroup.PUT("/:id/quota", userController.UpdateQuota)
 	}
 
 	// 私有文件相关路由
@@ -120,12 +189,59 @@ func SetupRouter() *gin.Engine {
 		privateFileGroup.GET("/:id", privateFileController.GetFile)
 		privateFileGroup.DELETE("/:id", privateFileController.DeleteFile)
 		privateFileGroup.PUT("/:id", privateFileController.UpdateFile)
+		privateFileGroup.POST("/:id/shares", shareLinkController.CreateShareLink)
+		privateFileGroup.GET("/:id/shares", shareLinkController.ListFileShareLinks)
 
 		// 添加调试日志
 		fmt.Println("注册私有文件更新路由: PUT /private-files/:id")
 		fmt.Println("注册私有文件批量上传路由: POST /private-files/batch-upload")
 	}
 
+	// 分享链接管理路由
+	shareGroup := r.Group("/shares")
+	shareGroup.Use(middleware.AuthMiddleware())
+	{
+		shareGroup.GET("", shareLinkController.ListShareLinks)
+		shareGroup.DELETE("/:id", shareLinkController.RevokeShareLink)
+		shareGroup.GET("/:id/logs", shareLinkController.GetShareAccessLogs)
+	}
+
+	// S3 兼容接口（SigV4 签名认证，不经过 JWT 中间件）
+	if config.GetConfig().S3.Enabled {
+		s3Controller := controllers.NewS3Controller()
+		for _, method := range []string{http.MethodGet, http.MethodHead, http.MethodPut, http.MethodDelete, http.MethodPost} {
+			r.Handle(method, "/s3/*path", s3Controller.Handle)
+		}
+	}
+
+	// WebDAV 接口（API 令牌认证），PROPPATCH 和 LOCK/UNLOCK 供系统自带的客户端挂载时使用
+	if config.GetConfig().WebDAV.Enabled {
+		webdavController := controllers.NewWebDAVController()
+		for _, method := range []string{
+			http.MethodOptions, http.MethodGet, http.MethodHead, http.MethodPut, http.MethodDelete,
+			"PROPFIND", "PROPPATCH", "MKCOL", "MOVE", "LOCK", "UNLOCK",
+		} {
+			r.Handle(method, "/webdav", webdavController.Handle)
+			r.Handle(method, "/webdav/*path", webdavController.Handle)
+		}
+	}
+
+	// 分享链接访问路由（无需认证）
+	r.GET("/s/:slug", shareLinkController.DownloadShared)
+	r.POST("/s/:slug", shareLinkController.DownloadShared)
+
+	// 隔离区管理路由
+	quarantineGroup := r.Group("/admin/quarantine")
+	quarantineGroup.Use(middleware.AuthMiddleware(), middleware.PermissionMiddleware())
+	{
+		quarantineGroup.GET("", quarantineController.ListQuarantined)
+		quarantineGroup.POST("/:id/release", quarantineController.ReleaseQuarantined)
+		quarantineGroup.DELETE("/:id", quarantineController.DeleteQuarantined)
+	}
+
+	// 登录记录审计
+	r.GET("/admin/login-attempts", middleware.AuthMiddleware(), middleware.PermissionMiddleware(), loginAttemptController.ListLoginAttempts)
+
 	// 权限管理路由
 	permGroup := r.Group("/permissions")
 	permGroup.Use(middleware.AuthMiddleware())
@@ -0,0 +1,360 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"img_hosting/config"
+	"img_hosting/dao"
+	"img_hosting/models"
+	"img_hosting/pkg/cache"
+	"img_hosting/pkg/logger"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"golang.org/x/crypto/bcrypt"
+	"gorm.io/gorm"
+)
+
+// 邮件模板名称，对应 pkg/mailer/templates 下的文件
+const (
+	MailTemplateVerifyEmail   = "verify_email"
+	MailTemplatePasswordReset = "password_reset"
+)
+
+const (
+	defaultVerifyTokenTTL = 24 * time.Hour
+	defaultResetTokenTTL  = time.Hour
+	defaultResendInterval = time.Minute
+)
+
+var (
+	ErrEmailAlreadyVerified = errors.New("邮箱已验证")
+	ErrVerifyTokenInvalid   = errors.New("验证链接无效或已过期")
+	ErrResetTokenInvalid    = errors.New("重置链接无效或已过期")
+	ErrMailTooFrequent      = errors.New("邮件发送过于频繁，请稍后再试")
+	ErrMailLinkUnavailable  = errors.New("未配置邮件中的链接地址，暂时无法发送邮件")
+)
+
+// EmailVerificationRequired 注册和修改邮箱后是否需要验证邮箱
+func EmailVerificationRequired() bool {
+	return config.GetConfig().Account.RequireEmailVerification
+}
+
+// SendVerificationEmail 给用户发送邮箱验证邮件，之前发送的验证链接失效
+func SendVerificationEmail(userID uint) error {
+	link, err := accountLink(config.GetConfig().Account.VerifyURL, "/auth/verify-email")
+	if err != nil {
+		return err
+	}
+
+	db := models.GetDB()
+	user, err := dao.GetUserByID(db, userID)
+	if err != nil {
+		return err
+	}
+	if user.EmailVerifiedAt != nil {
+		return ErrEmailAlreadyVerified
+	}
+	if isUserDisabled(user.Status) {
+		return ErrUserDisabled
+	}
+	if err := checkMailInterval(db, userID, models.TokenTypeEmailVerify); err != nil {
+		return err
+	}
+
+	ttl := accountTokenTTL(config.GetConfig().Account.VerifyTokenTTL, defaultVerifyTokenTTL)
+	return sendAccountMail(db, user, models.TokenTypeEmailVerify, MailTemplateVerifyEmail, link, ttl, "")
+}
+
+// VerifyEmail 使用邮件中的令牌验证邮箱，返回用户 ID
+func VerifyEmail(token string) (uint, error) {
+	db := models.GetDB()
+	tokenModel, err := consumeAccountToken(db, token, models.TokenTypeEmailVerify)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return 0, ErrVerifyTokenInvalid
+		}
+		return 0, err
+	}
+
+	if err := dao.MarkEmailVerified(db, tokenModel.UserID, time.Now()); err != nil {
+		return 0, err
+	}
+	cache.ClearUserAuthState(tokenModel.UserID)
+
+	logger.GetLogger().WithField("user_id", tokenModel.UserID).Info("邮箱验证成功")
+	return tokenModel.UserID, nil
+}
+
+// RequestPasswordReset 发送重置密码邮件
+// 邮箱不存在、账号被禁用或发送过于频繁时同样返回成功，避免泄露邮箱是否已注册
+func RequestPasswordReset(email, ipAddress string) error {
+	link, err := resetPasswordLink()
+	if err != nil {
+		return err
+	}
+
+	log := logger.GetLogger().WithField("ip", ipAddress)
+	db := models.GetDB()
+
+	user, err := dao.GetUserByEmail(db, strings.TrimSpace(email))
+	if err != nil || user == nil {
+		log.Info("重置密码请求的邮箱不存在")
+		return nil
+	}
+	if isUserDisabled(user.Status) {
+		log.WithField("user_id", user.UserID).Info("账号已被禁用，不发送重置密码邮件")
+		return nil
+	}
+	if err := checkMailInterval(db, user.UserID, models.TokenTypePasswordReset); err != nil {
+		if errors.Is(err, ErrMailTooFrequent) {
+			log.WithField("user_id", user.UserID).Info("重置密码邮件发送过于频繁")
+			return nil
+		}
+		return err
+	}
+
+	ttl := accountTokenTTL(config.GetConfig().Account.ResetTokenTTL, defaultResetTokenTTL)
+	return sendAccountMail(db, user, models.TokenTypePasswordReset, MailTemplatePasswordReset, link, ttl, ipAddress)
+}
+
+// ResetPassword 使用邮件中的令牌设置新密码，成功后撤销用户的所有登录和个人 API 令牌
+// 能收到重置邮件说明邮箱属于用户，未验证的邮箱同时标记为已验证
+func ResetPassword(token, newPassword string) error {
+	db := models.GetDB()
+	tokenHash := hashRefreshToken(token)
+	tokenModel, err := dao.GetOneTimeToken(db, tokenHash, models.TokenTypePasswordReset)
+	if err != nil || time.Now().After(tokenModel.ExpiresAt) {
+		if err == nil || errors.Is(err, gorm.ErrRecordNotFound) {
+			return ErrResetTokenInvalid
+		}
+		return err
+	}
+	if err := CheckUserActive(tokenModel.UserID); err != nil {
+		return err
+	}
+
+	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(newPassword), bcrypt.DefaultCost)
+	if err != nil {
+		return err
+	}
+
+	err = db.Transaction(func(tx *gorm.DB) error {
+		ok, err := dao.ConsumeOneTimeToken(tx, tokenHash, models.TokenTypePasswordReset)
+		if err != nil {
+			return err
+		}
+		if !ok {
+			return ErrResetTokenInvalid
+		}
+		if err := dao.UpdateUserPassword(tx, tokenModel.UserID, string(hashedPassword)); err != nil {
+			return err
+		}
+		if err := dao.RevokeUserTokensByType(tx, tokenModel.UserID, models.TokenTypePasswordReset); err != nil {
+			return err
+		}
+		return dao.MarkEmailVerified(tx, tokenModel.UserID, time.Now())
+	})
+	if err != nil {
+		return err
+	}
+
+	logger.GetLogger().WithField("user_id", tokenModel.UserID).Info("通过邮件重置密码")
+	return RevokeUserCredentials(tokenModel.UserID)
+}
+
+// IsEmailUnverified 用户是否处于未验证邮箱状态
+func IsEmailUnverified(userID uint) (bool, error) {
+	state, err := getUserAuthState(userID)
+	if err != nil {
+		return false, err
+	}
+	return state.Status == models.UserStatusUnverified, nil
+}
+
+// UnverifiedMissingPermission 未验证邮箱的用户只有 account.unverified_permissions 中的权限
+// 返回 required 中第一个不允许的权限，已验证的用户或全部允许时返回空字符串
+func UnverifiedMissingPermission(userID uint, required []string) (string, error) {
+	unverified, err := IsEmailUnverified(userID)
+	if err != nil || !unverified {
+		return "", err
+	}
+	allowed := make(map[string]bool)
+	for _, perm := range config.GetConfig().Account.UnverifiedPermissions {
+		allowed[perm] = true
+	}
+	for _, perm := range required {
+		if !allowed[perm] {
+			return perm, nil
+		}
+	}
+	return "", nil
+}
+
+// sendAccountMail 创建一次性令牌并在同一事务中创建发送邮件的任务，之前未使用的同类令牌失效
+func sendAccountMail(db *gorm.DB, user *models.UserInfo, tokenType, template, link string, ttl time.Duration, ipAddress string) error {
+	token, err := randomToken(32)
+	if err != nil {
+		return err
+	}
+
+	err = db.Transaction(func(tx *gorm.DB) error {
+		if err := dao.RevokeUserTokensByType(tx, user.UserID, tokenType); err != nil {
+			return err
+		}
+		err := dao.CreateOneTimeToken(tx, &models.Token{
+			Token:      hashRefreshToken(token),
+			UserID:     user.UserID,
+			ExpiresAt:  time.Now().Add(ttl),
+			IPAddress:  ipAddress,
+			Status:     models.TokenStatusActive,
+			LastUsedAt: time.Now(),
+		}, tokenType)
+		if err != nil {
+			return err
+		}
+		return EnqueueMail(tx, user.Email, template, map[string]string{
+			"UserName":  user.Name,
+			"Link":      strings.ReplaceAll(link, "{token}", url.QueryEscape(token)),
+			"ExpiresIn": formatMailDuration(ttl),
+		})
+	})
+	if err != nil {
+		return err
+	}
+	NotifyJobWorkers()
+
+	logger.GetLogger().WithFields(logrus.Fields{
+		"user_id":  user.UserID,
+		"template": template,
+	}).Info("已创建邮件发送任务")
+	return nil
+}
+
+// consumeAccountToken 校验并使用一次性令牌
+func consumeAccountToken(db *gorm.DB, token, tokenType string) (*models.Token, error) {
+	tokenHash := hashRefreshToken(token)
+	tokenModel, err := dao.GetOneTimeToken(db, tokenHash, tokenType)
+	if err != nil {
+		return nil, err
+	}
+	if time.Now().After(tokenModel.ExpiresAt) {
+		return nil, gorm.ErrRecordNotFound
+	}
+	ok, err := dao.ConsumeOneTimeToken(db, tokenHash, tokenType)
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return nil, gorm.ErrRecordNotFound
+	}
+	return tokenModel, nil
+}
+
+// checkMailInterval 限制同一用户发送验证或重置邮件的频率
+func checkMailInterval(db *gorm.DB, userID uint, tokenType string) error {
+	interval := defaultResendInterval
+	if seconds := config.GetConfig().Account.ResendInterval; seconds > 0 {
+		interval = time.Duration(seconds) * time.Second
+	}
+	last, err := dao.GetLatestTokenCreatedAt(db, userID, tokenType)
+	if err != nil {
+		return err
+	}
+	if !last.IsZero() && time.Since(last) < interval {
+		return ErrMailTooFrequent
+	}
+	return nil
+}
+
+// CheckAccountConfig 检查邮件链接的配置，启动时调用
+// 要求验证邮箱时必须能真正发送邮件并生成验证链接；未配置 account.reset_url 时找回密码不可用，只记录警告
+func CheckAccountConfig() error {
+	cfg := config.GetConfig()
+	if cfg.Account.RequireEmailVerification {
+		// log 模式不会真正发送邮件，新注册的用户永远无法完成验证
+		if driver := cfg.Mail.Driver; driver == "" || driver == "log" {
+			return errors.New("account.require_email_verification 已开启，但 mail.driver 为 log，不会发送验证邮件")
+		}
+		if _, err := accountLink(cfg.Account.VerifyURL, "/auth/verify-email"); err != nil {
+			return fmt.Errorf("account.require_email_verification 已开启: %w", err)
+		}
+	} else if cfg.Account.VerifyURL != "" {
+		if err := checkAccountLink(cfg.Account.VerifyURL); err != nil {
+			return err
+		}
+	}
+	if _, err := resetPasswordLink(); err != nil {
+		if cfg.Account.ResetURL != "" {
+			return err
+		}
+		logger.GetLogger().Warn("未配置 account.reset_url，找回密码不可用")
+	}
+	return nil
+}
+
+// accountLink 生成邮件中的链接模板，{token} 在发送前替换为令牌
+// 链接只使用配置的地址（configured 或 url.apiurl），不能使用请求的 Host，否则伪造 Host 即可让令牌发往其他域名
+func accountLink(configured, path string) (string, error) {
+	if configured != "" {
+		if err := checkAccountLink(configured); err != nil {
+			return "", err
+		}
+		return configured, nil
+	}
+	base := strings.TrimRight(config.GetConfig().Url.Apiurl, "/")
+	if base == "" {
+		return "", ErrMailLinkUnavailable
+	}
+	link := base + path + "?token={token}"
+	if err := checkAccountLink(link); err != nil {
+		return "", fmt.Errorf("url.apiurl 无效: %w", err)
+	}
+	return link, nil
+}
+
+// resetPasswordLink 重置密码链接必须指向前端的重置密码页面（account.reset_url）
+// API 只提供 POST /auth/password/reset，没有可以在浏览器中打开的页面
+func resetPasswordLink() (string, error) {
+	link := config.GetConfig().Account.ResetURL
+	if link == "" {
+		return "", ErrMailLinkUnavailable
+	}
+	if err := checkAccountLink(link); err != nil {
+		return "", err
+	}
+	return link, nil
+}
+
+// checkAccountLink 链接必须是包含 {token} 的 http(s) 绝对地址
+func checkAccountLink(link string) error {
+	u, err := url.Parse(strings.ReplaceAll(link, "{token}", "token"))
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return fmt.Errorf("邮件链接 %q 不是 http(s) 绝对地址", link)
+	}
+	if !strings.Contains(link, "{token}") {
+		return fmt.Errorf("邮件链接 %q 缺少 {token}", link)
+	}
+	return nil
+}
+
+func accountTokenTTL(seconds int, fallback time.Duration) time.Duration {
+	if seconds > 0 {
+		return time.Duration(seconds) * time.Second
+	}
+	return fallback
+}
+
+// formatMailDuration 把有效期格式化为邮件中显示的文字
+func formatMailDuration(d time.Duration) string {
+	switch {
+	case d >= time.Hour && d%time.Hour == 0:
+		return fmt.Sprintf("%d 小时", int(d/time.Hour))
+	case d >= time.Minute:
+		return fmt.Sprintf("%d 分钟", int(d/time.Minute))
+	default:
+		return fmt.Sprintf("%d 秒", int(d/time.Second))
+	}
+}
@@ -6,64 +6,92 @@ import (
 	"img_hosting/dao"
 	"img_hosting/models"
 	"regexp"
+	"strings"
+	"sync"
 
 	"golang.org/x/crypto/bcrypt"
+	"gorm.io/gorm"
 )
 
 type AuthService struct{}
 
-// Login 处理用户登录
-func (s *AuthService) Login(identifier, password string) (*models.UserInfo, error) {
-	fmt.Println("开始处理登录服务")
-	db := models.GetDB()
-	var user *models.UserInfo
-	var err error
+// ErrInvalidCredentials 账号不存在或密码错误，两种情况不作区分
+var ErrInvalidCredentials = errors.New("账号或密码错误")
+
+var (
+	dummyHash     string
+	dummyHashOnce sync.Once
+)
 
-	fmt.Printf("登录信息: identifier=%s, password=%s (长度: %d)\n",
-		identifier, password, len(password))
+// Login 处理用户登录，identifier 为邮箱或用户名
+// 账号不存在和密码错误返回相同的错误，失败次数过多时返回 *LoginThrottledError
+func (s *AuthService) Login(identifier, password, ipAddress, userAgent string) (*models.UserInfo, error) {
+	db := models.GetDB()
+	identifier = strings.TrimSpace(identifier)
 
 	// 确定查询方式（邮箱或用户名）
+	var user *models.UserInfo
+	var err error
 	if isEmail(identifier) {
-		fmt.Println("使用邮箱登录")
 		user, err = dao.GetUserByEmail(db, identifier)
 	} else {
-		fmt.Println("使用用户名登录")
-		// 这里有问题，应该使用 name 字段查询
 		user, err = dao.GetUserByName(db, identifier)
 	}
-
-	fmt.Printf("查询用户结果: user=%+v, err=%v\n", user, err)
-
-	if err != nil {
-		fmt.Printf("查询用户失败: %v\n", err)
+	if err != nil && err.Error() != "用户不存在" {
 		return nil, err
 	}
-	if user == nil {
-		fmt.Println("用户不存在")
-		return nil, errors.New("用户不存在")
+
+	var userID uint
+	if user != nil {
+		userID = user.UserID
+	}
+	unlock := lockLogin(userID, identifier)
+	defer unlock()
+	if err := CheckLoginThrottle(userID, identifier, ipAddress); err != nil {
+		var throttled *LoginThrottledError
+		if errors.As(err, &throttled) {
+			result := models.LoginResultThrottled
+			if throttled.Locked {
+				result = models.LoginResultLocked
+			}
+			RecordLoginAttempt(userID, identifier, ipAddress, userAgent, result)
+		}
+		return nil, err
 	}
 
-	// 验证密码
-	fmt.Println("开始验证密码")
-	fmt.Printf("数据库中的密码哈希: %s (长度: %d)\n", user.Password, len(user.Password))
-	fmt.Printf("用户提供的密码: %s (长度: %d)\n", password, len(password))
+	// 账号不存在时同样计算一次哈希，避免通过响应时间判断账号是否存在
+	passwordHash := dummyPasswordHash()
+	if user != nil {
+		passwordHash = user.Password
+	}
+	if err := bcrypt.CompareHashAndPassword([]byte(passwordHash), []byte(password)); err != nil || user == nil {
+		RecordLoginAttempt(userID, identifier, ipAddress, userAgent, models.LoginResultFailure)
+		return nil, ErrInvalidCredentials
+	}
 
-	if err := bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(password)); err != nil {
-		fmt.Printf("密码验证失败: %v\n", err)
-		return nil, errors.New("密码错误")
+	// 封禁或停用的用户不能登录
+	if isUserDisabled(user.Status) {
+		RecordLoginAttempt(userID, identifier, ipAddress, userAgent, models.LoginResultDisabled)
+		return nil, ErrUserDisabled
 	}
-	fmt.Println("密码验证成功")
 
 	// 更新登录信息
-	if err := dao.UpdateLoginInfo(db, user.UserID, ""); err != nil {
-		fmt.Printf("更新登录信息失败: %v\n", err)
+	if err := dao.UpdateLoginInfo(db, user.UserID, ipAddress); err != nil {
 		return nil, err
 	}
-	fmt.Println("更新登录信息成功")
 
 	return user, nil
 }
 
+// dummyPasswordHash 账号不存在时用于比较的哈希，与真实密码哈希的计算成本相同
+func dummyPasswordHash() string {
+	dummyHashOnce.Do(func() {
+		hash, _ := bcrypt.GenerateFromPassword([]byte("img_hosting-dummy-password"), bcrypt.DefaultCost)
+		dummyHash = string(hash)
+	})
+	return dummyHash
+}
+
 // Register 处理用户注册
 func (s *AuthService) Register(input *models.UserInput) (*models.UserInfo, error) {
 	fmt.Println("开始处理注册服务")
@@ -71,12 +99,12 @@ func (s *AuthService) Register(input *models.UserInput) (*models.UserInfo, error
 
 	// 检查邮箱是否已存在
 	existingUser, err := dao.GetUserByEmail(db, input.Email)
-	fmt.Printf("检查邮箱存在: err=%v, existingUser=%+v\n", err, existingUser)
+	fmt.Printf("检查邮箱存在: exists=%v\n", existingUser != nil)
 
 	// 如果用户已存在，返回错误
 	if existingUser != nil {
 		fmt.Println("邮箱已被使用")
-		return nil, errors.New("邮箱已被使用")
+		return nil, ErrEmailTaken
 	}
 
 	// 如果是"用户不存在"错误，则继续注册流程
@@ -95,21 +123,30 @@ func (s *AuthService) Register(input *models.UserInput) (*models.UserInfo, error
 		return nil, err
 	}
 
+	// 需要验证邮箱时，验证前只有部分权限
+	status := models.UserStatusActive
+	if EmailVerificationRequired() {
+		status = models.UserStatusUnverified
+	}
+
 	// 创建用户
 	user := &models.UserInfo{
 		Name:     input.Name,
 		Email:    input.Email,
 		Password: string(hashedPassword),
 		Age:      input.Age,
-		Status:   models.UserStatusActive,
+		Status:   status,
 	}
 
 	if err := dao.CreateUser(db, user); err != nil {
 		fmt.Printf("创建用户失败: %v\n", err)
+		if errors.Is(err, gorm.ErrDuplicatedKey) {
+			return nil, ErrEmailTaken
+		}
 		return nil, err
 	}
 
-	fmt.Printf("用户创建成功: %+v\n", user)
+	fmt.Printf("用户创建成功: userID=%d\n", user.UserID)
 	return user, nil
 }
 
@@ -0,0 +1,102 @@
+package services
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"img_hosting/pkg/logger"
+	"io"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// ErrInvalidBase64 Base64 或 data URI 格式错误
+var ErrInvalidBase64 = errors.New("无效的 Base64 图片数据")
+
+// dataURIExtensions data URI 中声明的 MIME 类型对应的扩展名
+var dataURIExtensions = map[string]string{
+	"image/jpeg": ".jpg",
+	"image/jpg":  ".jpg",
+	"image/png":  ".png",
+	"image/gif":  ".gif",
+	"image/webp": ".webp",
+}
+
+// UploadImageBase64 保存 Base64 或 data URI（如 data:image/png;base64,...）编码的图片
+// fileName 只作为文件名提示，没有扩展名时依次按 data URI 的 MIME 类型和文件内容补全
+func UploadImageBase64(userID uint, data, fileName, description string) (uint, string, error) {
+	log := logger.GetLogger().WithFields(logrus.Fields{
+		"user_id":  userID,
+		"filename": fileName,
+		"length":   len(data),
+	})
+	log.Info("开始处理Base64图片上传")
+
+	mimeType, payload, err := parseDataURI(data)
+	if err != nil {
+		log.WithError(err).Warn("解析Base64图片数据失败")
+		return 0, "", err
+	}
+
+	fileName = strings.TrimSpace(fileName)
+	if fileName == "" {
+		fileName = "paste_" + time.Now().Format("20060102150405")
+	}
+	if filepath.Ext(fileName) == "" {
+		fileName += dataURIExtensions[mimeType]
+	}
+
+	// 边解码边读取，超过大小限制时不会把整个图片解码到内存
+	imageID, imageURL, err := UploadImageReader(userID, fileName, newBase64Reader(payload), description)
+	var corrupt base64.CorruptInputError
+	if errors.As(err, &corrupt) {
+		return 0, "", fmt.Errorf("%w: %v", ErrInvalidBase64, corrupt)
+	}
+	return imageID, imageURL, err
+}
+
+// parseDataURI 拆分 data URI，返回声明的 MIME 类型和 Base64 内容；不带 data: 前缀时视为纯 Base64
+func parseDataURI(data string) (string, string, error) {
+	data = strings.TrimSpace(data)
+	if len(data) < 5 || !strings.EqualFold(data[:5], "data:") {
+		if data == "" {
+			return "", "", fmt.Errorf("%w: 内容为空", ErrInvalidBase64)
+		}
+		return "", data, nil
+	}
+
+	meta, payload, ok := strings.Cut(data[5:], ",")
+	if !ok {
+		return "", "", fmt.Errorf("%w: data URI 缺少逗号分隔符", ErrInvalidBase64)
+	}
+
+	params := strings.Split(meta, ";")
+	isBase64 := false
+	for _, param := range params[1:] {
+		if strings.EqualFold(strings.TrimSpace(param), "base64") {
+			isBase64 = true
+		}
+	}
+	if !isBase64 {
+		return "", "", fmt.Errorf("%w: 只支持 base64 编码的 data URI", ErrInvalidBase64)
+	}
+
+	payload = strings.TrimSpace(payload)
+	if payload == "" {
+		return "", "", fmt.Errorf("%w: 内容为空", ErrInvalidBase64)
+	}
+	return strings.ToLower(strings.TrimSpace(params[0])), payload, nil
+}
+
+// newBase64Reader 创建 Base64 解码读取器，兼容标准和 URL 安全字母表、有无填充以及换行
+func newBase64Reader(payload string) io.Reader {
+	payload = strings.TrimRight(payload, "=")
+	encoding := base64.RawStdEncoding
+	if strings.ContainsAny(payload, "-_") {
+		encoding = base64.RawURLEncoding
+	}
+	return base64.NewDecoder(encoding, strings.NewReader(payload))
+}
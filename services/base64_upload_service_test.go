@@ -0,0 +1,110 @@
+package services
+
+import (
+	"encoding/base64"
+	"errors"
+	"img_hosting/dao"
+	"img_hosting/models"
+	"io"
+	"strings"
+	"testing"
+)
+
+func TestParseDataURI(t *testing.T) {
+	tests := []struct {
+		data     string
+		mimeType string
+		payload  string
+		wantErr  bool
+	}{
+		{"data:image/png;base64,iVBORw0KGgo=", "image/png", "iVBORw0KGgo=", false},
+		{"  DATA:Image/PNG;Base64,iVBORw0KGgo=\n", "image/png", "iVBORw0KGgo=", false},
+		{"data:;base64,iVBORw0KGgo=", "", "iVBORw0KGgo=", false},
+		{"data:image/png;charset=utf-8;base64,AAAA", "image/png", "AAAA", false},
+		{"iVBORw0KGgo=", "", "iVBORw0KGgo=", false},
+		{"", "", "", true},
+		{"data:image/png;base64", "", "", true},
+		{"data:image/png,iVBORw0KGgo=", "", "", true},
+		{"data:image/png;base64,  ", "", "", true},
+	}
+	for _, tt := range tests {
+		mimeType, payload, err := parseDataURI(tt.data)
+		if tt.wantErr {
+			if !errors.Is(err, ErrInvalidBase64) {
+				t.Errorf("parseDataURI(%q) 应返回 ErrInvalidBase64，got %v", tt.data, err)
+			}
+			continue
+		}
+		if err != nil || mimeType != tt.mimeType || payload != tt.payload {
+			t.Errorf("parseDataURI(%q) = %q, %q, %v", tt.data, mimeType, payload, err)
+		}
+	}
+}
+
+func TestNewBase64Reader(t *testing.T) {
+	raw := []byte{0xFB, 0xFF, 0xBF, 0x00, 0x10, 0x83, 0x7E}
+	std := base64.StdEncoding.EncodeToString(raw)
+	tests := map[string]string{
+		"标准":     std,
+		"无填充":    base64.RawStdEncoding.EncodeToString(raw),
+		"URL 安全": base64.URLEncoding.EncodeToString(raw),
+		"带换行":    std[:4] + "\r\n" + std[4:8] + "\n" + std[8:],
+	}
+	for name, payload := range tests {
+		got, err := io.ReadAll(newBase64Reader(payload))
+		if err != nil || string(got) != string(raw) {
+			t.Errorf("%s: %x, %v", name, got, err)
+		}
+	}
+
+	var corrupt base64.CorruptInputError
+	if _, err := io.ReadAll(newBase64Reader("iVBO*w0K")); !errors.As(err, &corrupt) {
+		t.Errorf("非法字符应返回 CorruptInputError，got %v", err)
+	}
+}
+
+func TestUploadImageBase64(t *testing.T) {
+	user := createTestUser(t)
+	payload := base64.StdEncoding.EncodeToString(encodeTestImage(t, 33, 21, "png"))
+
+	// 没有文件名时按 data URI 的类型补全扩展名
+	imageID, imageURL, err := UploadImageBase64(user.UserID, "data:image/png;base64,"+payload, "", "粘贴的截图")
+	if err != nil {
+		t.Fatal(err)
+	}
+	image, err := dao.GetImageByID(models.GetDB(), imageID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(image.ImageName, "paste_") || image.Imageextenion != ".png" || image.Width != 33 || imageURL == "" {
+		t.Errorf("上传结果 = %+v, %s", image, imageURL)
+	}
+
+	// 纯 Base64 且文件名没有扩展名时按文件内容补全
+	imageID, _, err = UploadImageBase64(user.UserID, base64.StdEncoding.EncodeToString(encodeTestImage(t, 34, 21, "jpeg")), "clipboard", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if image, err := dao.GetImageByID(models.GetDB(), imageID); err != nil || image.ImageName != "clipboard" || image.Imageextenion != ".jpg" {
+		t.Errorf("上传结果 = %+v, %v", image, err)
+	}
+
+	tests := []struct {
+		name     string
+		data     string
+		fileName string
+		want     error
+	}{
+		{"Base64 损坏", "data:image/png;base64,iVBO*w0K", "", ErrInvalidBase64},
+		{"不是 base64 编码", "data:image/png," + payload, "", ErrInvalidBase64},
+		{"内容与扩展名不符", "data:image/png;base64," + payload, "photo.jpg", nil},
+	}
+	for _, tt := range tests {
+		_, _, err := UploadImageBase64(user.UserID, tt.data, tt.fileName, "")
+		if err == nil {
+			t.Errorf("%s: 应上传失败", tt.name)
+		} else if tt.want != nil && !errors.Is(err, tt.want) {
+			t.Errorf("%s: 应返回 %v，got %v", tt.name, tt.want, err)
+		}
+	}
+}
@@ -0,0 +1,100 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"img_hosting/config"
+	"img_hosting/dao"
+	"img_hosting/models"
+	"img_hosting/pkg/animation"
+	"img_hosting/pkg/logger"
+	"os"
+	"path/filepath"
+
+	"github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+)
+
+// JobTypeImageThumbnail 生成图片缩略图的任务类型
+const JobTypeImageThumbnail = "image.thumbnail"
+
+// ImageJobPayload 图片处理任务参数
+type ImageJobPayload struct {
+	ImageID uint `json:"image_id"`
+}
+
+func init() {
+	RegisterJobHandler(JobTypeImageThumbnail, JobHandler{
+		Handle:   handleImageThumbnailJob,
+		OnFailed: onImageJobFailed,
+	})
+}
+
+// handleImageThumbnailJob 读取原图并生成缩略图，完成后将图片标记为 ready
+func handleImageThumbnailJob(ctx context.Context, job *models.Job) error {
+	var payload ImageJobPayload
+	if err := json.Unmarshal([]byte(job.Payload), &payload); err != nil {
+		return fmt.Errorf("解析任务参数失败: %w", err)
+	}
+
+	db := models.GetDB()
+	img, err := dao.GetImageByID(db, payload.ImageID)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			// 图片已被删除，无需处理
+			return nil
+		}
+		return err
+	}
+
+	srcPath := filepath.Join(config.GetConfig().Upload.Path, img.HashImage+img.Imageextenion)
+	data, err := os.ReadFile(srcPath)
+	if err != nil {
+		return fmt.Errorf("读取原图失败: %w", err)
+	}
+
+	// 水印设置有误时不阻塞缩略图生成
+	wm, _, err := loadWatermark(img.UserID)
+	if err != nil {
+		logger.GetLogger().WithError(err).WithField("image_id", img.ImageID).Warn("加载水印失败，跳过水印")
+		wm = nil
+	}
+
+	// 原图已加过水印时缩略图直接由原图缩放，避免重复叠加
+	thumbWM := wm
+	if img.Watermarked {
+		thumbWM = nil
+	}
+
+	variants, err := GenerateThumbnails(data, img.HashImage, thumbWM)
+	if err != nil {
+		return err
+	}
+
+	if info, err := animation.Probe(data); err == nil && info.TotalFrames > 1 {
+		if err := dao.UpdateImageAnimation(db, img.ImageID, info.TotalFrames, info.Duration); err != nil {
+			return err
+		}
+	}
+	if err := dao.ReplaceImageVariants(db, img.ImageID, variants); err != nil {
+		return err
+	}
+
+	return dao.UpdateImageStatus(db, img.ImageID, models.ImageStatusReady)
+}
+
+// onImageJobFailed 重试耗尽后将图片标记为处理失败
+func onImageJobFailed(job *models.Job, jobErr error) {
+	var payload ImageJobPayload
+	if err := json.Unmarshal([]byte(job.Payload), &payload); err != nil {
+		return
+	}
+	if err := dao.UpdateImageStatus(models.GetDB(), payload.ImageID, models.ImageStatusFailed); err != nil {
+		logger.GetLogger().WithError(err).WithFields(logrus.Fields{
+			"image_id": payload.ImageID,
+			"job_id":   job.ID,
+		}).Error("更新图片状态失败")
+	}
+}
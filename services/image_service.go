@@ -4,6 +4,7 @@ import (
 	"bytes"
 	"crypto/md5"
 	"encoding/hex"
+	"errors"
 	"fmt"
 	"image"
 	_ "image/gif"
@@ -12,11 +13,18 @@ import (
 	"img_hosting/config"
 	"img_hosting/dao"
 	"img_hosting/models"
+	"img_hosting/pkg/animation"
+	"img_hosting/pkg/filetype"
+	"img_hosting/pkg/imageenc"
 	"img_hosting/pkg/logger"
+	"img_hosting/pkg/placeholder"
+	"img_hosting/pkg/watermark"
 	"io"
 	"mime/multipart"
 	"os"
 	"path/filepath"
+	"slices"
+	"strconv"
 	"strings"
 
 	"github.com/disintegration/imaging"
@@ -24,19 +32,17 @@ import (
 	"gorm.io/gorm"
 )
 
+// ErrImageExists 相同内容的图片已经上传过
+var ErrImageExists = errors.New("图片已存在")
+
 // UploadImage 处理图片上传
 func UploadImage(userID uint, file *multipart.FileHeader, description string) (uint, string, error) {
-	cfg := config.GetConfig()
-	db := models.GetDB()
-	logger := logger.GetLogger()
+	return uploadImage(userID, file, description, "")
+}
 
-	// 开始事务
-	tx := db.Begin()
-	defer func() {
-		if r := recover(); r != nil {
-			tx.Rollback()
-		}
-	}()
+// uploadImage 打开表单中的图片并上传，deleteKeyHash 不为空时与图片记录一起保存
+func uploadImage(userID uint, file *multipart.FileHeader, description, deleteKeyHash string) (uint, string, error) {
+	logger := logger.GetLogger()
 
 	logger.WithFields(logrus.Fields{
 		"user_id":  userID,
@@ -44,9 +50,8 @@ func UploadImage(userID uint, file *multipart.FileHeader, description string) (u
 		"size":     file.Size,
 	}).Info("开始处理图片上传")
 
-	// 检查文件格式和大小
-	valid, message, extension, size := CheckImg(file.Filename, file.Size)
-	if !valid {
+	// 先按声明的大小检查，避免读取超大文件
+	if valid, message, _, _ := CheckImg(file.Filename, file.Size); !valid {
 		logger.WithFields(logrus.Fields{
 			"filename": file.Filename,
 			"message":  message,
@@ -54,13 +59,6 @@ func UploadImage(userID uint, file *multipart.FileHeader, description string) (u
 		return 0, "", fmt.Errorf(message)
 	}
 
-	// 确保文件名安全
-	name, _, err := SanitizeFileName(file.Filename)
-	if err != nil {
-		logger.WithError(err).Error("文件名安全检查失败")
-		return 0, "", err
-	}
-
 	// 读取文件内容
 	fileContent, err := file.Open()
 	if err != nil {
@@ -69,10 +67,50 @@ func UploadImage(userID uint, file *multipart.FileHeader, description string) (u
 	}
 	defer fileContent.Close()
 
-	// 将文件内容读取为字节切片
-	fileBytes, err := io.ReadAll(fileContent)
+	return uploadImageReader(userID, file.Filename, fileContent, description, deleteKeyHash)
+}
+
+// UploadImageReader 从读取器保存图片，表单、URL 和 Base64 等上传入口共用校验、去重和缩略图流程
+// 最多读取 maxImageSize 字节；fileName 没有扩展名时按文件内容补全
+func UploadImageReader(userID uint, fileName string, r io.Reader, description string) (uint, string, error) {
+	return uploadImageReader(userID, fileName, r, description, "")
+}
+
+// uploadImageReader 见 UploadImageReader，deleteKeyHash 不为空时在同一事务中保存删除链接密钥的哈希
+func uploadImageReader(userID uint, fileName string, r io.Reader, description, deleteKeyHash string) (uint, string, error) {
+	cfg := config.GetConfig()
+	db := models.GetDB()
+	logger := logger.GetLogger()
+
+	// 多读一个字节用于判断是否超过大小限制，避免把超大内容全部读入内存
+	fileBytes, err := io.ReadAll(io.LimitReader(r, maxImageSize+1))
 	if err != nil {
 		logger.WithError(err).Error("读取文件内容失败")
+		return 0, "", fmt.Errorf("读取文件内容失败: %w", err)
+	}
+	if int64(len(fileBytes)) > maxImageSize {
+		logger.WithField("filename", fileName).Warn("图片大小超过限制")
+		return 0, "", fmt.Errorf("文件大小超过限制")
+	}
+
+	if filepath.Ext(fileName) == "" {
+		fileName += filetype.DetectExtension(fileBytes)
+	}
+
+	// 检查文件格式和大小
+	valid, message, extension, size := CheckImg(fileName, int64(len(fileBytes)))
+	if !valid {
+		logger.WithFields(logrus.Fields{
+			"filename": fileName,
+			"message":  message,
+		}).Warn("图片格式或大小检查失败")
+		return 0, "", fmt.Errorf(message)
+	}
+
+	// 确保文件名安全
+	name, _, err := SanitizeFileName(fileName)
+	if err != nil {
+		logger.WithError(err).Error("文件名安全检查失败")
 		return 0, "", err
 	}
 
@@ -81,10 +119,35 @@ func UploadImage(userID uint, file *multipart.FileHeader, description string) (u
 		"extension":  extension,
 	}).Debug("文件内容已读取")
 
+	// 按魔数校验真实类型并完整解码，拒绝伪装文件和解压炸弹
+	mimeType, err := filetype.ValidateImage(fileBytes, extension, cfg.Upload.MaxPixels)
+	if err != nil {
+		logger.WithError(err).WithField("filename", fileName).Warn("图片内容校验失败")
+		return 0, "", err
+	}
+
+	// 设置了给原图加水印时先加水印，再计算哈希和大小
+	fileBytes, watermarked, err := watermarkOriginal(userID, fileBytes, extension)
+	if err != nil {
+		logger.WithError(err).WithField("filename", fileName).Warn("原图加水印失败")
+		return 0, "", err
+	}
+	if watermarked {
+		size = int64(len(fileBytes))
+	}
+
 	// 计算文件哈希
 	hashImage := HashFileName(fileBytes)
 	logger.WithField("hash", hashImage).Debug("文件哈希计算完成")
 
+	// 开始事务
+	tx := db.Begin()
+	defer func() {
+		if r := recover(); r != nil {
+			tx.Rollback()
+		}
+	}()
+
 	// 在事务中检查图片是否已存在
 	exists, err := dao.CheckImageExists(tx, hashImage)
 	if err != nil {
@@ -95,7 +158,14 @@ func UploadImage(userID uint, file *multipart.FileHeader, description string) (u
 	if exists {
 		tx.Rollback()
 		logger.WithField("hash", hashImage).Warn("图片已存在")
-		return 0, "", fmt.Errorf("图片已存在")
+		return 0, "", ErrImageExists
+	}
+
+	// 检查存储配额
+	if err := CheckStorageQuota(userID, size); err != nil {
+		tx.Rollback()
+		logger.WithError(err).WithField("user_id", userID).Warn("存储配额检查未通过")
+		return 0, "", err
 	}
 
 	// 使用配置的路径
@@ -106,42 +176,70 @@ func UploadImage(userID uint, file *multipart.FileHeader, description string) (u
 
 	// 确保上传目录存在
 	if err := os.MkdirAll(cfg.Upload.Path, 0755); err != nil {
+		tx.Rollback()
 		logger.WithError(err).Error("创建上传目录失败")
 		return 0, "", err
 	}
 
 	// 保存文件
-	if err := saveUploadedFile(file, uploadPath); err != nil {
+	if err := os.WriteFile(uploadPath, fileBytes, 0644); err != nil {
+		tx.Rollback()
 		logger.WithError(err).WithField("path", uploadPath).Error("保存文件失败")
 		return 0, "", err
 	}
 
 	logger.WithField("path", uploadPath).Info("文件保存成功")
 
-	// 生成缩略图
-	if err := CompressToWebP(fileBytes, hashImage); err != nil {
-		logger.WithError(err).Error("生成缩略图失败")
-		return 0, "", err
-	}
-
-	logger.Debug("缩略图生成成功")
-
 	// 构建图片URL
 	imageURL := config.AppConfigInstance.Url.Imgurl + hashImage + extension
 
 	// 保存到数据库
-	imageID, err := dao.CreateImage(tx, userID, imageURL, name, extension, hashImage, size, description)
+	imageID, err := dao.CreateImage(tx, userID, imageURL, name, extension, hashImage, size, mimeType, description)
 	if err != nil {
 		tx.Rollback()
 		logger.WithError(err).Error("保存图片信息到数据库失败")
 		return 0, "", err
 	}
+	if watermarked {
+		if err := dao.MarkImageWatermarked(tx, imageID); err != nil {
+			tx.Rollback()
+			logger.WithError(err).Error("保存图片信息到数据库失败")
+			return 0, "", err
+		}
+	}
+	if deleteKeyHash != "" {
+		if err := dao.SetImageDeleteKeyHash(tx, imageID, deleteKeyHash); err != nil {
+			tx.Rollback()
+			logger.WithError(err).Error("保存删除链接密钥失败")
+			return 0, "", err
+		}
+	}
+
+	// 记录尺寸、BlurHash 和颜色，供前端在加载前渲染占位图
+	width, height, meta := analyzeImage(fileBytes)
+	var blurHash, averageColor, dominantColor, colorFamily string
+	if meta != nil {
+		blurHash, averageColor, dominantColor, colorFamily = meta.BlurHash, meta.AverageColor, meta.DominantColor, meta.ColorFamily
+	}
+	if err := dao.UpdateImagePlaceholder(tx, imageID, width, height, blurHash, averageColor, dominantColor, colorFamily); err != nil {
+		tx.Rollback()
+		logger.WithError(err).Error("保存图片占位信息失败")
+		return 0, "", err
+	}
+
+	// 缩略图交给后台任务生成，任务与图片记录在同一事务中创建
+	if _, err := EnqueueJob(tx, JobTypeImageThumbnail, ImageJobPayload{ImageID: imageID}); err != nil {
+		tx.Rollback()
+		logger.WithError(err).Error("创建缩略图任务失败")
+		return 0, "", err
+	}
 
 	// 提交事务
 	if err := tx.Commit().Error; err != nil {
 		logger.WithError(err).Error("提交事务失败")
 		return 0, "", err
 	}
+	NotifyJobWorkers()
 
 	logger.WithFields(logrus.Fields{
 		"image_id":  imageID,
@@ -154,7 +252,12 @@ func UploadImage(userID uint, file *multipart.FileHeader, description string) (u
 // GetImageByID 获取图片详情
 func GetImageByID(imageID uint) (*models.Image, error) {
 	db := models.GetDB()
-	return dao.GetImageByID(db, imageID)
+	image, err := dao.GetImageByID(db, imageID)
+	if err != nil {
+		return nil, err
+	}
+	image.Srcset = BuildSrcset(image.Variants)
+	return image, nil
 }
 
 // GetUserImages 获取用户的所有图片
@@ -163,10 +266,10 @@ func GetUserImages(userID uint, page, pageSize int) ([]models.Image, int64, erro
 	return dao.GetImagesByUserID(db, userID, page, pageSize)
 }
 
-// SearchImages 搜索图片
-func SearchImages(userID uint, keyword string, page, pageSize int) ([]models.Image, int64, error) {
+// SearchImages 搜索图片，colorFamily 不为空时按主色分类筛选
+func SearchImages(userID uint, keyword, colorFamily string, page, pageSize int) ([]models.Image, int64, error) {
 	db := models.GetDB()
-	return dao.SearchImages(db, userID, keyword, page, pageSize)
+	return dao.SearchImages(db, userID, keyword, colorFamily, page, pageSize)
 }
 
 // DeleteImage 删除图片及其缩略图
@@ -198,7 +301,19 @@ func DeleteImage(imageID, userID uint) error {
 			return fmt.Errorf("删除原图失败: %w", err)
 		}
 
-		// 删除所有可能的缩略图格式
+		// 删除各尺寸缩略图
+		variants, err := dao.ListImageVariants(tx, imageID)
+		if err != nil {
+			return fmt.Errorf("获取缩略图信息失败: %w", err)
+		}
+		for _, variant := range variants {
+			thumbPath := filepath.Join(cfg.Upload.ThumbnailsPath, variant.FileName)
+			if err := deleteFile(thumbPath); err != nil {
+				return fmt.Errorf("删除缩略图失败 %s: %w", thumbPath, err)
+			}
+		}
+
+		// 删除旧版本生成的单一缩略图
 		thumbnailFormats := []string{".webp", ".png", ".jpg"}
 		for _, format := range thumbnailFormats {
 			thumbPath := filepath.Join(cfg.Upload.ThumbnailsPath, image.HashImage+format)
@@ -228,22 +343,33 @@ func DeleteImage(imageID, userID uint) error {
 	return nil
 }
 
-// 辅助函数：保存上传的文件
-func saveUploadedFile(file *multipart.FileHeader, dst string) error {
-	src, err := file.Open()
+// analyzeImage 读取图片尺寸并计算占位信息，失败时只记录日志，不影响上传
+func analyzeImage(data []byte) (int, int, *placeholder.Result) {
+	log := logger.GetLogger()
+
+	imgCfg, _, err := image.DecodeConfig(bytes.NewReader(data))
 	if err != nil {
-		return err
+		log.WithError(err).Warn("读取图片尺寸失败")
+		return 0, 0, nil
 	}
-	defer src.Close()
 
-	out, err := os.Create(dst)
+	img, _, err := image.Decode(bytes.NewReader(data))
 	if err != nil {
-		return err
+		// 动画 WebP 标准库无法解码，取第一帧
+		anim, animErr := animation.Decode(data, animation.Limits{MaxFrames: 1})
+		if animErr != nil || len(anim.Frames) == 0 {
+			log.WithError(err).Warn("解码图片失败，跳过占位信息")
+			return imgCfg.Width, imgCfg.Height, nil
+		}
+		img = anim.Frames[0]
 	}
-	defer out.Close()
 
-	_, err = io.Copy(out, src)
-	return err
+	meta, err := placeholder.Analyze(img)
+	if err != nil {
+		log.WithError(err).Warn("计算图片占位信息失败")
+		return imgCfg.Width, imgCfg.Height, nil
+	}
+	return imgCfg.Width, imgCfg.Height, meta
 }
 
 // HashFileName 计算文件哈希
@@ -275,6 +401,9 @@ func SanitizeFileName(filename string) (string, string, error) {
 	return name, ext, nil
 }
 
+// maxImageSize 单张图片的大小上限（10MB）
+const maxImageSize = int64(10 * 1024 * 1024)
+
 // CheckImg 检查图片格式和大小
 func CheckImg(filename string, size int64) (bool, string, string, int64) {
 	// 获取文件扩展名
@@ -293,17 +422,74 @@ func CheckImg(filename string, size int64) (bool, string, string, int64) {
 		return false, "不支持的文件类型", "", 0
 	}
 
-	// 检查文件大小（10MB限制）
-	maxSize := int64(10 * 1024 * 1024)
-	if size > maxSize {
+	// 检查文件大小
+	if size > maxImageSize {
 		return false, "文件大小超过限制", "", 0
 	}
 
 	return true, "", ext, size
 }
 
-// CompressToWebP 将图片压缩为缩略图
-func CompressToWebP(imageData []byte, hashName string) error {
+// defaultThumbnailSizes 未配置 upload.thumbnail_sizes 时使用的缩略图宽度
+var defaultThumbnailSizes = []int{150, 300, 800, 1600}
+
+// defaultThumbnailFormats 未配置 upload.thumbnail_formats 时额外生成的格式
+var defaultThumbnailFormats = []string{imageenc.FormatWebP}
+
+// 未配置时动图预览的默认限制
+const (
+	defaultAnimatedMaxWidth  = 800
+	defaultAnimatedMaxFrames = 100
+)
+
+// thumbnailSizes 返回去重、升序后的缩略图宽度列表
+func thumbnailSizes() []int {
+	sizes := config.GetConfig().Upload.ThumbnailSizes
+	if len(sizes) == 0 {
+		sizes = defaultThumbnailSizes
+	}
+	result := make([]int, 0, len(sizes))
+	for _, size := range sizes {
+		if size > 0 && !slices.Contains(result, size) {
+			result = append(result, size)
+		}
+	}
+	slices.Sort(result)
+	return result
+}
+
+// thumbnailFormats 返回需要生成的缩略图格式：配置的现代格式（未注册编码器的跳过）加上兼容格式
+// 兼容格式在 JPEG 原图时为 jpeg，其余为 png，保证不支持新格式的客户端也能显示
+func thumbnailFormats(sourceFormat string) []string {
+	configured := config.GetConfig().Upload.ThumbnailFormats
+	if configured == nil {
+		configured = defaultThumbnailFormats
+	}
+
+	fallback := imageenc.FormatPNG
+	if sourceFormat == "jpeg" {
+		fallback = imageenc.FormatJPEG
+	}
+
+	result := make([]string, 0, len(configured)+1)
+	for _, format := range configured {
+		format = strings.ToLower(strings.TrimSpace(format))
+		if format == fallback || slices.Contains(result, format) {
+			continue
+		}
+		if !imageenc.Supported(format) {
+			logger.GetLogger().WithField("format", format).Warn("未注册该格式的编码器，跳过")
+			continue
+		}
+		result = append(result, format)
+	}
+	return append(result, fallback)
+}
+
+// GenerateThumbnails 解码一次原图，按配置的宽度和格式列表生成所有缩略图
+// 宽度超过原图的尺寸会被跳过；原图比最小尺寸还窄时按原图宽度生成一张
+// wm 不为 nil 时给每个缩略图加水印
+func GenerateThumbnails(imageData []byte, hashName string, wm *watermark.Watermark) ([]models.ImageVariant, error) {
 	cfg := config.GetConfig()
 	logger := logger.GetLogger()
 
@@ -314,56 +500,236 @@ func CompressToWebP(imageData []byte, hashName string) error {
 
 	// 确保缩略图目录存在
 	if err := os.MkdirAll(cfg.Upload.ThumbnailsPath, 0755); err != nil {
-		logger.WithError(err).Error("创建缩略图目录失败")
-		return err
+		return nil, fmt.Errorf("创建缩略图目录失败: %w", err)
 	}
 
-	// 尝试直接从文件读取而不是从内存
-	uploadPath := filepath.Join(cfg.Upload.Path, hashName+".jpg")
-	logger.WithField("path", uploadPath).Debug("尝试从文件读取图像")
+	// 动图先按帧合成，第一帧作为静态缩略图的来源
+	var img image.Image
+	var format string
+	anim, err := animation.Decode(imageData, animation.Limits{
+		MaxFrames: animatedMaxFrames(),
+		MaxPixels: cfg.Upload.MaxPixels,
+	})
+	if err == nil && len(anim.Frames) > 0 {
+		img, format = anim.Frames[0], "animation"
+	} else {
+		anim = nil
+		img, format, err = image.Decode(bytes.NewReader(imageData))
+		if err != nil {
+			return nil, fmt.Errorf("解码图像失败: %w", err)
+		}
+	}
+	logger.WithField("format", format).Debug("成功解码图像")
 
-	// 尝试方法1：使用imaging直接打开文件
-	srcImg, err := imaging.Open(uploadPath)
-	if err != nil {
-		logger.WithError(err).Warn("使用imaging打开文件失败，尝试其他方法")
+	srcWidth := img.Bounds().Dx()
+	var widths []int
+	for _, size := range thumbnailSizes() {
+		if size <= srcWidth {
+			widths = append(widths, size)
+		}
+	}
+	if len(widths) == 0 {
+		widths = []int{srcWidth}
+	}
+	formats := thumbnailFormats(format)
+
+	variants := make([]models.ImageVariant, 0, len(widths)*len(formats))
+	for _, width := range widths {
+		thumbnail := wm.Apply(imaging.Resize(img, width, 0, imaging.Lanczos))
+		for _, thumbFormat := range formats {
+			variant, err := saveThumbnail(thumbnail, thumbnailBaseName(hashName, width), thumbFormat)
+			if err != nil {
+				return nil, err
+			}
+			variants = append(variants, *variant)
+		}
+	}
 
-		// 尝试方法2：使用标准库解码
-		reader := bytes.NewReader(imageData)
-		img, format, err := image.Decode(reader)
+	// 多帧动图额外生成动图预览
+	if anim != nil && anim.TotalFrames > 1 {
+		animated, err := generateAnimatedThumbnails(anim, hashName, widths, formats, wm)
 		if err != nil {
-			logger.WithError(err).Error("标准库解码图像失败")
+			return nil, err
+		}
+		variants = append(variants, animated...)
+	}
 
-			// 尝试方法3：跳过缩略图生成，返回成功
-			logger.Warn("无法生成缩略图，但将继续处理上传")
-			return nil // 返回nil而不是错误，允许上传继续
+	logger.WithFields(logrus.Fields{
+		"hash":    hashName,
+		"widths":  widths,
+		"formats": formats,
+	}).Info("缩略图生成成功")
+	return variants, nil
+}
+
+// animatedMaxFrames 动图预览最多保留的帧数
+func animatedMaxFrames() int {
+	if n := config.GetConfig().Upload.AnimatedMaxFrames; n > 0 {
+		return n
+	}
+	return defaultAnimatedMaxFrames
+}
+
+// generateAnimatedThumbnails 为不超过 animated_max_width 的尺寸生成动图预览
+// 格式取静态缩略图格式中支持动图的部分（WebP），另外总会生成一份 GIF 作为兼容格式
+func generateAnimatedThumbnails(anim *animation.Animation, hashName string, widths []int, formats []string, wm *watermark.Watermark) ([]models.ImageVariant, error) {
+	maxWidth := config.GetConfig().Upload.AnimatedMaxWidth
+	if maxWidth <= 0 {
+		maxWidth = defaultAnimatedMaxWidth
+	}
+
+	var animFormats []string
+	for _, format := range formats {
+		if imageenc.SupportsAnimation(format) && format != imageenc.FormatGIF {
+			animFormats = append(animFormats, format)
 		}
+	}
+	animFormats = append(animFormats, imageenc.FormatGIF)
 
-		logger.WithField("format", format).Info("成功解码图像")
-		srcImg = imaging.Clone(img)
+	var variants []models.ImageVariant
+	for _, width := range widths {
+		if width > maxWidth {
+			continue
+		}
+		frames := make([]image.Image, len(anim.Frames))
+		for i, frame := range anim.Frames {
+			frames[i] = wm.Apply(imaging.Resize(frame, width, 0, imaging.Lanczos))
+		}
+		for _, format := range animFormats {
+			variant, err := saveAnimatedThumbnail(frames, anim, thumbnailBaseName(hashName, width)+"_anim", format)
+			if err != nil {
+				return nil, err
+			}
+			variants = append(variants, *variant)
+		}
 	}
+	return variants, nil
+}
 
-	// 调整大小，创建缩略图
-	thumbnail := imaging.Resize(srcImg, 300, 0, imaging.Lanczos)
+// saveAnimatedThumbnail 编码并保存动图预览
+func saveAnimatedThumbnail(frames []image.Image, anim *animation.Animation, baseName, format string) (*models.ImageVariant, error) {
+	cfg := config.GetConfig()
 
-	// 使用配置的路径
-	thumbPath := filepath.Join(cfg.Upload.ThumbnailsPath, hashName+".webp")
-	logger.WithField("path", thumbPath).Debug("准备保存缩略图")
+	fileName := baseName + imageenc.Extension(format)
+	thumbPath := filepath.Join(cfg.Upload.ThumbnailsPath, fileName)
 
-	// 尝试保存为PNG格式，如果WebP不工作
-	err = imaging.Save(thumbnail, thumbPath)
-	if err != nil {
-		logger.WithError(err).Warn("保存为WebP失败，尝试保存为PNG")
+	var buf bytes.Buffer
+	if err := imageenc.EncodeAnimation(&buf, frames, anim.Delays, anim.LoopCount, format); err != nil {
+		return nil, fmt.Errorf("编码动图预览失败(%s): %w", format, err)
+	}
+	if err := os.WriteFile(thumbPath, buf.Bytes(), 0644); err != nil {
+		return nil, fmt.Errorf("保存动图预览失败: %w", err)
+	}
+
+	bounds := frames[0].Bounds()
+	return &models.ImageVariant{
+		Width:    bounds.Dx(),
+		Height:   bounds.Dy(),
+		Animated: true,
+		Format:   format,
+		FileName: fileName,
+		URL:      cfg.Url.Thumburl + fileName,
+		Size:     int64(buf.Len()),
+	}, nil
+}
+
+// thumbnailBaseName 缩略图的基础文件名（不含扩展名），同时也是内容协商地址
+func thumbnailBaseName(hashName string, width int) string {
+	return fmt.Sprintf("%s_%d", hashName, width)
+}
+
+// saveThumbnail 按指定格式编码缩略图并保存到缩略图目录
+func saveThumbnail(thumbnail image.Image, baseName, format string) (*models.ImageVariant, error) {
+	cfg := config.GetConfig()
+
+	fileName := baseName + imageenc.Extension(format)
+	thumbPath := filepath.Join(cfg.Upload.ThumbnailsPath, fileName)
+
+	var buf bytes.Buffer
+	if err := imageenc.Encode(&buf, thumbnail, format); err != nil {
+		return nil, fmt.Errorf("编码缩略图失败(%s): %w", format, err)
+	}
+	if err := os.WriteFile(thumbPath, buf.Bytes(), 0644); err != nil {
+		return nil, fmt.Errorf("保存缩略图失败: %w", err)
+	}
+
+	bounds := thumbnail.Bounds()
+	return &models.ImageVariant{
+		Width:    bounds.Dx(),
+		Height:   bounds.Dy(),
+		Format:   format,
+		FileName: fileName,
+		URL:      cfg.Url.Thumburl + fileName,
+		Size:     int64(buf.Len()),
+	}, nil
+}
+
+// BuildSrcset 根据缩略图生成 srcset 字符串，例如 "a_150 150w, a_300 300w"
+// 地址不带扩展名，由 /thumbnails/:name 根据 Accept 请求头返回最合适的格式
+func BuildSrcset(variants []models.ImageVariant) string {
+	parts := make([]string, 0, len(variants))
+	seen := make(map[int]bool)
+	for _, v := range variants {
+		if v.Animated || seen[v.Width] {
+			continue
+		}
+		seen[v.Width] = true
+		baseName := strings.TrimSuffix(v.FileName, filepath.Ext(v.FileName))
+		parts = append(parts, fmt.Sprintf("%s%s %dw", config.GetConfig().Url.Thumburl, baseName, v.Width))
+	}
+	return strings.Join(parts, ", ")
+}
+
+// ErrThumbnailNotFound 请求的缩略图不存在
+var ErrThumbnailNotFound = errors.New("缩略图不存在")
+
+// ResolveThumbnail 解析缩略图请求，返回文件路径和 MIME 类型
+// name 带扩展名时直接返回对应文件；不带扩展名（如 hash_300）时根据 accept 选择最合适的格式
+// animated 为 true 且该尺寸有动图预览时返回动图，否则返回静态缩略图
+func ResolveThumbnail(name, accept string, animated bool) (string, string, error) {
+	cfg := config.GetConfig()
+	db := models.GetDB()
 
-		// 尝试保存为PNG
-		pngPath := filepath.Join(cfg.Upload.ThumbnailsPath, hashName+".png")
-		err = imaging.Save(thumbnail, pngPath)
+	name = filepath.Base(name)
+	if ext := filepath.Ext(name); ext != "" {
+		variant, err := dao.GetImageVariantByFileName(db, name)
 		if err != nil {
-			logger.WithError(err).Error("保存缩略图失败")
-			// 继续处理，不返回错误
-			return nil
+			return "", "", ErrThumbnailNotFound
 		}
+		return filepath.Join(cfg.Upload.ThumbnailsPath, variant.FileName), imageenc.MIMEType(variant.Format), nil
 	}
 
-	logger.WithField("path", thumbPath).Info("缩略图保存成功")
-	return nil
+	idx := strings.LastIndex(name, "_")
+	if idx <= 0 {
+		return "", "", ErrThumbnailNotFound
+	}
+	width, err := strconv.Atoi(name[idx+1:])
+	if err != nil {
+		return "", "", ErrThumbnailNotFound
+	}
+	all, err := dao.ListImageVariantsByHash(db, name[:idx], width)
+	if err != nil || len(all) == 0 {
+		return "", "", ErrThumbnailNotFound
+	}
+
+	hasAnimated := slices.ContainsFunc(all, func(v models.ImageVariant) bool { return v.Animated })
+	wantAnimated := animated && hasAnimated
+	var variants []models.ImageVariant
+	for _, v := range all {
+		if v.Animated == wantAnimated {
+			variants = append(variants, v)
+		}
+	}
+
+	available := make([]string, 0, len(variants))
+	for _, v := range variants {
+		available = append(available, v.Format)
+	}
+	format := imageenc.Negotiate(accept, available)
+	for _, v := range variants {
+		if v.Format == format {
+			return filepath.Join(cfg.Upload.ThumbnailsPath, v.FileName), imageenc.MIMEType(v.Format), nil
+		}
+	}
+	return "", "", ErrThumbnailNotFound
 }
@@ -0,0 +1,201 @@
+package services
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"image/png"
+	"img_hosting/config"
+	"img_hosting/dao"
+	"img_hosting/models"
+	"img_hosting/pkg/imageenc"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	_ "golang.org/x/image/webp"
+)
+
+// encodeTestImage 生成 w x h 的 PNG 或 JPEG 图片
+func encodeTestImage(t *testing.T, w, h int, format string) []byte {
+	t.Helper()
+	img := image.NewNRGBA(image.Rect(0, 0, w, h))
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			img.Set(x, y, color.NRGBA{R: uint8(x), G: uint8(y), B: 0x80, A: 0xFF})
+		}
+	}
+	var buf bytes.Buffer
+	var err error
+	if format == "jpeg" {
+		err = jpeg.Encode(&buf, img, nil)
+	} else {
+		err = png.Encode(&buf, img)
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+// createTestThumbnails 创建图片记录并生成、保存缩略图，返回图片哈希
+func createTestThumbnails(t *testing.T, data []byte) (string, []models.ImageVariant) {
+	t.Helper()
+	user := createTestUser(t)
+	hash := fmt.Sprintf("thumb-%d", user.UserID)
+	imageID, err := dao.CreateImage(models.GetDB(), user.UserID, "/uploads/"+hash, "a.png", ".png", hash, int64(len(data)), "image/png", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	variants, err := GenerateThumbnails(data, hash, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := dao.ReplaceImageVariants(models.GetDB(), imageID, variants); err != nil {
+		t.Fatal(err)
+	}
+	return hash, variants
+}
+
+func TestGenerateThumbnails(t *testing.T) {
+	tests := []struct {
+		name   string
+		data   []byte
+		widths []int
+		want   []string
+	}{
+		{"PNG 原图", encodeTestImage(t, 400, 200, "png"), []int{150, 300}, []string{imageenc.FormatWebP, imageenc.FormatPNG}},
+		{"JPEG 原图", encodeTestImage(t, 400, 200, "jpeg"), []int{150, 300}, []string{imageenc.FormatWebP, imageenc.FormatJPEG}},
+		{"比最小尺寸还窄", encodeTestImage(t, 100, 50, "png"), []int{100}, []string{imageenc.FormatWebP, imageenc.FormatPNG}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, variants := createTestThumbnails(t, tt.data)
+			if len(variants) != len(tt.widths)*len(tt.want) {
+				t.Fatalf("生成了 %d 个缩略图，want %d", len(variants), len(tt.widths)*len(tt.want))
+			}
+			for i, v := range variants {
+				width, format := tt.widths[i/len(tt.want)], tt.want[i%len(tt.want)]
+				if v.Width != width || v.Height != width/2 || v.Format != format {
+					t.Errorf("缩略图 %d = %dx%d %s, want %dx%d %s", i, v.Width, v.Height, v.Format, width, width/2, format)
+				}
+
+				// 文件内容与记录的格式一致，不是改了扩展名的 PNG
+				data, err := os.ReadFile(filepath.Join(config.GetConfig().Upload.ThumbnailsPath, v.FileName))
+				if err != nil {
+					t.Fatal(err)
+				}
+				_, decoded, err := image.Decode(bytes.NewReader(data))
+				if err != nil || decoded != format || int64(len(data)) != v.Size {
+					t.Errorf("%s: 解码格式 = %s, 大小 = %d/%d, err = %v", v.FileName, decoded, len(data), v.Size, err)
+				}
+			}
+		})
+	}
+}
+
+func TestBuildSrcset(t *testing.T) {
+	thumburl := config.GetConfig().Url.Thumburl
+	variants := []models.ImageVariant{
+		{Width: 150, Format: imageenc.FormatWebP, FileName: "a_150.webp"},
+		{Width: 150, Format: imageenc.FormatPNG, FileName: "a_150.png"},
+		{Width: 300, Format: imageenc.FormatWebP, FileName: "a_300.webp"},
+		{Width: 300, Format: imageenc.FormatPNG, FileName: "a_300.png"},
+	}
+	// 每个宽度只出现一次，地址不带扩展名
+	want := fmt.Sprintf("%sa_150 150w, %sa_300 300w", thumburl, thumburl)
+	if got := BuildSrcset(variants); got != want {
+		t.Errorf("BuildSrcset = %q, want %q", got, want)
+	}
+}
+
+func TestResolveThumbnail(t *testing.T) {
+	hash, _ := createTestThumbnails(t, encodeTestImage(t, 400, 200, "png"))
+	name := hash + "_300"
+
+	tests := []struct {
+		name   string
+		accept string
+		want   string
+	}{
+		{name, "image/avif,image/webp,*/*", "image/webp"},
+		{name, "image/png,*/*;q=0.8", "image/png"},
+		{name, "image/webp;q=0,*/*", "image/png"},
+		{name, "", "image/png"}, // 没有 Accept 时返回兼容格式
+		{name + ".png", "image/webp", "image/png"},
+		{name + ".webp", "", "image/webp"},
+	}
+	for _, tt := range tests {
+		path, mimeType, err := ResolveThumbnail(tt.name, tt.accept, true)
+		if err != nil {
+			t.Errorf("%s (Accept %q): %v", tt.name, tt.accept, err)
+			continue
+		}
+		if mimeType != tt.want || !strings.HasSuffix(path, imageenc.Extension(strings.TrimPrefix(tt.want, "image/"))) {
+			t.Errorf("%s (Accept %q) = %s, %s, want %s", tt.name, tt.accept, path, mimeType, tt.want)
+		}
+	}
+
+	for _, missing := range []string{hash + "_800", hash + "_abc", hash, "nohash_300", name + ".jpg", "../" + name + ".gif"} {
+		if _, _, err := ResolveThumbnail(missing, "*/*", true); !errors.Is(err, ErrThumbnailNotFound) {
+			t.Errorf("%s 应返回 ErrThumbnailNotFound，got %v", missing, err)
+		}
+	}
+}
+
+func TestAnalyzeImage(t *testing.T) {
+	width, height, meta := analyzeImage(encodeTestImage(t, 120, 80, "png"))
+	if width != 120 || height != 80 || meta == nil || meta.BlurHash == "" || meta.ColorFamily == "" {
+		t.Errorf("analyzeImage = %d, %d, %+v", width, height, meta)
+	}
+
+	// 无法解码的数据不影响上传，只是没有占位信息
+	if width, height, meta := analyzeImage([]byte("not an image")); width != 0 || height != 0 || meta != nil {
+		t.Errorf("无效数据: %d, %d, %+v", width, height, meta)
+	}
+}
+
+func TestSearchImagesByColor(t *testing.T) {
+	user := createTestUser(t)
+	db := models.GetDB()
+	for i, family := range []string{"red", "red", "blue", ""} {
+		hash := fmt.Sprintf("color-%d-%d", user.UserID, i)
+		id, err := dao.CreateImage(db, user.UserID, "/uploads/"+hash, fmt.Sprintf("photo-%d.png", i), ".png", hash, 10, "image/png", "")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := dao.UpdateImagePlaceholder(db, id, 10, 10, "", "", "", family); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		keyword string
+		color   string
+		want    int64
+	}{
+		{"", "", 4},
+		{"", "red", 2},
+		{"photo-2", "blue", 1},
+		{"photo-0", "blue", 0},
+		{"", "green", 0},
+	}
+	for _, tt := range tests {
+		images, total, err := SearchImages(user.UserID, tt.keyword, tt.color, 1, 10)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if total != tt.want || int64(len(images)) != tt.want {
+			t.Errorf("SearchImages(%q, %q) = %d 张 (total %d), want %d", tt.keyword, tt.color, len(images), total, tt.want)
+		}
+		for _, img := range images {
+			if tt.color != "" && img.ColorFamily != tt.color {
+				t.Errorf("SearchImages(%q, %q) 返回了 %s 的图片", tt.keyword, tt.color, img.ColorFamily)
+			}
+		}
+	}
+}
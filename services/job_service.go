@@ -0,0 +1,209 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"img_hosting/config"
+	"img_hosting/dao"
+	"img_hosting/models"
+	"img_hosting/pkg/logger"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+)
+
+// JobHandler 后台任务处理器
+type JobHandler struct {
+	// Handle 执行任务，返回 error 时按退避策略重试
+	Handle func(ctx context.Context, job *models.Job) error
+	// OnFailed 重试次数耗尽后调用（可选）
+	OnFailed func(job *models.Job, err error)
+}
+
+const (
+	defaultJobWorkers      = 2
+	defaultJobMaxAttempts  = 3
+	defaultJobPollInterval = 2 * time.Second
+	defaultJobRetryBackoff = 5 * time.Second
+	maxJobRetryBackoff     = 10 * time.Minute
+)
+
+var (
+	jobHandlers      = make(map[string]JobHandler)
+	jobHandlersMutex = &sync.RWMutex{}
+	// jobNotify 用于在新任务入队后立即唤醒空闲的 worker
+	jobNotify = make(chan struct{}, 1)
+)
+
+// RegisterJobHandler 注册任务处理器
+func RegisterJobHandler(jobType string, handler JobHandler) {
+	jobHandlersMutex.Lock()
+	jobHandlers[jobType] = handler
+	jobHandlersMutex.Unlock()
+}
+
+// EnqueueJob 创建任务，db 可以是事务，保证任务与业务数据一起提交
+// 事务提交后应调用 NotifyJobWorkers 以便任务被立即执行
+func EnqueueJob(db *gorm.DB, jobType string, payload interface{}) (*models.Job, error) {
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return nil, fmt.Errorf("序列化任务参数失败: %w", err)
+	}
+
+	maxAttempts := config.GetConfig().Jobs.MaxAttempts
+	if maxAttempts <= 0 {
+		maxAttempts = defaultJobMaxAttempts
+	}
+
+	job := &models.Job{
+		Type:        jobType,
+		Payload:     string(data),
+		Status:      models.JobStatusPending,
+		MaxAttempts: maxAttempts,
+		RunAt:       time.Now(),
+	}
+	if err := dao.CreateJob(db, job); err != nil {
+		return nil, fmt.Errorf("创建任务失败: %w", err)
+	}
+	return job, nil
+}
+
+// NotifyJobWorkers 唤醒空闲的 worker
+func NotifyJobWorkers() {
+	select {
+	case jobNotify <- struct{}{}:
+	default:
+	}
+}
+
+// StartJobWorkers 启动后台任务 worker，worker 数量由配置 jobs.workers 决定
+func StartJobWorkers(ctx context.Context) {
+	cfg := config.GetConfig()
+	log := logger.GetLogger()
+	db := models.GetDB()
+
+	workers := cfg.Jobs.Workers
+	if workers <= 0 {
+		workers = defaultJobWorkers
+	}
+
+	// 恢复上次未执行完的任务
+	if n, err := dao.ResetRunningJobs(db); err != nil {
+		log.WithError(err).Error("恢复未完成任务失败")
+	} else if n > 0 {
+		log.WithField("count", n).Info("已恢复未完成的后台任务")
+	}
+
+	for i := 0; i < workers; i++ {
+		go runJobWorker(ctx, i)
+	}
+	log.WithField("workers", workers).Info("后台任务 worker 已启动")
+}
+
+// runJobWorker 循环领取并执行任务
+func runJobWorker(ctx context.Context, workerID int) {
+	cfg := config.GetConfig()
+	log := logger.GetLogger()
+	db := models.GetDB()
+
+	pollInterval := time.Duration(cfg.Jobs.PollInterval) * time.Second
+	if pollInterval <= 0 {
+		pollInterval = defaultJobPollInterval
+	}
+
+	for {
+		if ctx.Err() != nil {
+			return
+		}
+
+		job, err := dao.ClaimNextJob(db, time.Now())
+		if err != nil {
+			log.WithError(err).WithField("worker", workerID).Error("领取后台任务失败")
+		}
+		if job == nil {
+			select {
+			case <-ctx.Done():
+				return
+			case <-jobNotify:
+			case <-time.After(pollInterval):
+			}
+			continue
+		}
+
+		processJob(ctx, job)
+	}
+}
+
+// processJob 执行单个任务并根据结果更新状态
+func processJob(ctx context.Context, job *models.Job) {
+	log := logger.GetLogger().WithFields(logrus.Fields{
+		"job_id":   job.ID,
+		"job_type": job.Type,
+		"attempt":  job.Attempts,
+	})
+	db := models.GetDB()
+
+	jobHandlersMutex.RLock()
+	handler, ok := jobHandlers[job.Type]
+	jobHandlersMutex.RUnlock()
+	if !ok {
+		log.Error("未注册的任务类型")
+		dao.MarkJobFailed(db, job.ID, "未注册的任务类型: "+job.Type)
+		return
+	}
+
+	err := runJobHandler(ctx, handler, job)
+	if err == nil {
+		if err := dao.MarkJobDone(db, job.ID); err != nil {
+			log.WithError(err).Error("更新任务状态失败")
+		}
+		log.Debug("后台任务执行成功")
+		return
+	}
+
+	if job.Attempts >= job.MaxAttempts {
+		log.WithError(err).Error("后台任务重试耗尽，标记为失败")
+		if markErr := dao.MarkJobFailed(db, job.ID, err.Error()); markErr != nil {
+			log.WithError(markErr).Error("更新任务状态失败")
+		}
+		if handler.OnFailed != nil {
+			handler.OnFailed(job, err)
+		}
+		return
+	}
+
+	runAt := time.Now().Add(jobRetryBackoff(job.Attempts))
+	log.WithError(err).WithField("run_at", runAt).Warn("后台任务执行失败，稍后重试")
+	if markErr := dao.RescheduleJob(db, job.ID, runAt, err.Error()); markErr != nil {
+		log.WithError(markErr).Error("更新任务状态失败")
+	}
+}
+
+// runJobHandler 调用处理器，并把 panic 转换为错误
+func runJobHandler(ctx context.Context, handler JobHandler, job *models.Job) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("任务执行异常: %v", r)
+		}
+	}()
+	return handler.Handle(ctx, job)
+}
+
+// jobRetryBackoff 指数退避：base * 2^(attempts-1)，最长不超过 maxJobRetryBackoff
+func jobRetryBackoff(attempts int) time.Duration {
+	base := time.Duration(config.GetConfig().Jobs.RetryBackoff) * time.Second
+	if base <= 0 {
+		base = defaultJobRetryBackoff
+	}
+	backoff := base
+	for i := 1; i < attempts; i++ {
+		backoff *= 2
+		if backoff >= maxJobRetryBackoff {
+			return maxJobRetryBackoff
+		}
+	}
+	return backoff
+}
@@ -0,0 +1,165 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"img_hosting/config"
+	"img_hosting/dao"
+	"img_hosting/models"
+	"testing"
+	"time"
+)
+
+// jobTestTime 测试任务的执行时间，早于其他测试创建的任务，领取时不会领到它们
+var jobTestTime = time.Date(2000, 1, 1, 0, 0, 0, 0, time.UTC)
+
+// enqueueTestJob 创建一个在 jobTestTime 到期的任务
+func enqueueTestJob(t *testing.T, jobType string, maxAttempts int) *models.Job {
+	t.Helper()
+	db := models.GetDB()
+	job, err := EnqueueJob(db, jobType, map[string]string{"test": t.Name()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Model(job).Updates(map[string]interface{}{"run_at": jobTestTime, "max_attempts": maxAttempts}).Error; err != nil {
+		t.Fatal(err)
+	}
+	return job
+}
+
+// runTestJob 把任务重新设为到期后领取并执行一次，返回执行后的任务
+func runTestJob(t *testing.T, jobID uint) *models.Job {
+	t.Helper()
+	db := models.GetDB()
+	if err := db.Model(&models.Job{}).Where("id = ? AND status = ?", jobID, models.JobStatusPending).Update("run_at", jobTestTime).Error; err != nil {
+		t.Fatal(err)
+	}
+	job, err := dao.ClaimNextJob(db, jobTestTime)
+	if err != nil || job == nil || job.ID != jobID {
+		t.Fatalf("领取任务失败: %+v, %v", job, err)
+	}
+	processJob(context.Background(), job)
+
+	job, err = dao.GetJobByID(db, jobID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return job
+}
+
+func TestJobRetriesWithBackoff(t *testing.T) {
+	cfg := config.GetConfig()
+	oldBackoff := cfg.Jobs.RetryBackoff
+	cfg.Jobs.RetryBackoff = 60
+	t.Cleanup(func() { cfg.Jobs.RetryBackoff = oldBackoff })
+
+	calls := 0
+	var failedWith error
+	RegisterJobHandler("test.flaky", JobHandler{
+		Handle: func(ctx context.Context, job *models.Job) error {
+			calls++
+			if calls < 3 {
+				return errors.New("暂时失败")
+			}
+			return nil
+		},
+		OnFailed: func(job *models.Job, err error) { failedWith = err },
+	})
+
+	job := enqueueTestJob(t, "test.flaky", 3)
+
+	before := time.Now()
+	job = runTestJob(t, job.ID)
+	if job.Status != models.JobStatusPending || job.Attempts != 1 || job.LastError != "暂时失败" {
+		t.Fatalf("第一次失败后应重新排队: %+v", job)
+	}
+	if delay := job.RunAt.Sub(before); delay < 60*time.Second || delay > 61*time.Second {
+		t.Errorf("第一次重试延迟 = %s, want 60s", delay)
+	}
+	// 未到重试时间时不会被领取
+	if claimed, err := dao.ClaimNextJob(models.GetDB(), jobTestTime); err != nil || claimed != nil {
+		t.Fatalf("未到期的任务不应被领取: %+v, %v", claimed, err)
+	}
+
+	before = time.Now()
+	job = runTestJob(t, job.ID)
+	if job.Status != models.JobStatusPending || job.Attempts != 2 {
+		t.Fatalf("第二次失败后应重新排队: %+v", job)
+	}
+	if delay := job.RunAt.Sub(before); delay < 120*time.Second || delay > 121*time.Second {
+		t.Errorf("第二次重试延迟 = %s, want 120s", delay)
+	}
+
+	job = runTestJob(t, job.ID)
+	if job.Status != models.JobStatusDone || job.Attempts != 3 || job.LastError != "" {
+		t.Fatalf("第三次成功后应完成: %+v", job)
+	}
+	if failedWith != nil {
+		t.Errorf("成功的任务不应调用 OnFailed: %v", failedWith)
+	}
+}
+
+func TestJobFailsAfterMaxAttempts(t *testing.T) {
+	calls, failedCalls := 0, 0
+	RegisterJobHandler("test.broken", JobHandler{
+		Handle: func(ctx context.Context, job *models.Job) error {
+			calls++
+			if calls == 1 {
+				panic("崩溃")
+			}
+			return errors.New("一直失败")
+		},
+		OnFailed: func(job *models.Job, err error) { failedCalls++ },
+	})
+
+	job := enqueueTestJob(t, "test.broken", 2)
+
+	// panic 按失败处理并重试
+	job = runTestJob(t, job.ID)
+	if job.Status != models.JobStatusPending || job.LastError != "任务执行异常: 崩溃" {
+		t.Fatalf("panic 后应重新排队: %+v", job)
+	}
+
+	job = runTestJob(t, job.ID)
+	if job.Status != models.JobStatusFailed || job.Attempts != 2 || job.LastError != "一直失败" {
+		t.Fatalf("重试耗尽后应标记为失败: %+v", job)
+	}
+	if failedCalls != 1 {
+		t.Errorf("OnFailed 调用了 %d 次, want 1", failedCalls)
+	}
+	if claimed, err := dao.ClaimNextJob(models.GetDB(), jobTestTime); err != nil || claimed != nil {
+		t.Errorf("失败的任务不应再被领取: %+v, %v", claimed, err)
+	}
+}
+
+func TestJobUnknownType(t *testing.T) {
+	job := enqueueTestJob(t, "test.unregistered", 3)
+	job = runTestJob(t, job.ID)
+	if job.Status != models.JobStatusFailed {
+		t.Errorf("未注册的任务类型应直接失败: %+v", job)
+	}
+}
+
+func TestJobRetryBackoff(t *testing.T) {
+	cfg := config.GetConfig()
+	oldBackoff := cfg.Jobs.RetryBackoff
+	cfg.Jobs.RetryBackoff = 5
+	t.Cleanup(func() { cfg.Jobs.RetryBackoff = oldBackoff })
+
+	tests := []struct {
+		attempts int
+		want     time.Duration
+	}{
+		{1, 5 * time.Second},
+		{2, 10 * time.Second},
+		{3, 20 * time.Second},
+		{7, 320 * time.Second},
+		{8, maxJobRetryBackoff},
+		{100, maxJobRetryBackoff},
+	}
+	for _, tt := range tests {
+		if got := jobRetryBackoff(tt.attempts); got != tt.want {
+			t.Errorf("jobRetryBackoff(%d) = %s, want %s", tt.attempts, got, tt.want)
+		}
+	}
+}
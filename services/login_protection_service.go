@@ -0,0 +1,288 @@
+package services
+
+import (
+	"fmt"
+	"hash/fnv"
+	"img_hosting/config"
+	"img_hosting/dao"
+	"img_hosting/models"
+	"img_hosting/pkg/logger"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	defaultLoginWindow           = 15 * time.Minute
+	defaultLoginFreeAttempts     = 3
+	defaultLoginIPFreeAttempts   = 20
+	defaultLoginBaseDelay        = time.Second
+	defaultLoginMaxDelay         = 5 * time.Minute
+	defaultLoginLockoutThreshold = 10
+	defaultLoginLockoutDuration  = 15 * time.Minute
+	defaultLoginRetentionDays    = 90
+	loginAttemptCleanupInterval  = time.Hour
+)
+
+var (
+	lastLoginAttemptCleanup      time.Time
+	lastLoginAttemptCleanupMutex = &sync.Mutex{}
+
+	// loginLocks 同一账号的登录尝试串行执行，按账号哈希分到固定数量的锁上
+	loginLocks [256]sync.Mutex
+)
+
+// LoginThrottledError 登录失败次数过多，需要等待 RetryAfter 之后再试
+type LoginThrottledError struct {
+	RetryAfter time.Duration
+	Locked     bool // 账号已被临时锁定
+}
+
+func (e *LoginThrottledError) Error() string {
+	if e.Locked {
+		minutes := int((e.RetryAfter + time.Minute - 1) / time.Minute)
+		return fmt.Sprintf("登录失败次数过多，账号已临时锁定，请 %d 分钟后再试", minutes)
+	}
+	return fmt.Sprintf("登录失败次数过多，请 %d 秒后再试", e.RetrySeconds())
+}
+
+// RetrySeconds 需要等待的秒数（向上取整），用于 Retry-After 响应头
+func (e *LoginThrottledError) RetrySeconds() int {
+	return int((e.RetryAfter + time.Second - 1) / time.Second)
+}
+
+// loginProtectionSettings 读取登录保护配置，未配置的项使用默认值
+type loginProtectionSettings struct {
+	window           time.Duration
+	freeAttempts     int64
+	ipFreeAttempts   int64
+	baseDelay        time.Duration
+	maxDelay         time.Duration
+	lockoutThreshold int64
+	lockoutDuration  time.Duration
+	retentionDays    int
+}
+
+func getLoginProtectionSettings() loginProtectionSettings {
+	cfg := config.GetConfig().LoginProtection
+	seconds := func(v int, fallback time.Duration) time.Duration {
+		if v > 0 {
+			return time.Duration(v) * time.Second
+		}
+		return fallback
+	}
+	count := func(v int, fallback int64) int64 {
+		if v > 0 {
+			return int64(v)
+		}
+		return fallback
+	}
+	retention := cfg.RetentionDays
+	if retention <= 0 {
+		retention = defaultLoginRetentionDays
+	}
+	return loginProtectionSettings{
+		window:           seconds(cfg.Window, defaultLoginWindow),
+		freeAttempts:     count(cfg.FreeAttempts, defaultLoginFreeAttempts),
+		ipFreeAttempts:   count(cfg.IPFreeAttempts, defaultLoginIPFreeAttempts),
+		baseDelay:        seconds(cfg.BaseDelay, defaultLoginBaseDelay),
+		maxDelay:         seconds(cfg.MaxDelay, defaultLoginMaxDelay),
+		lockoutThreshold: count(cfg.LockoutThreshold, defaultLoginLockoutThreshold),
+		lockoutDuration:  seconds(cfg.LockoutDuration, defaultLoginLockoutDuration),
+		retentionDays:    retention,
+	}
+}
+
+// backoff 失败 failures 次后下一次登录前需要等待的时间：超过 free 次后从 baseDelay 开始每次翻倍
+func (s loginProtectionSettings) backoff(failures, free int64) time.Duration {
+	if failures < free {
+		return 0
+	}
+	delay := s.baseDelay
+	for i := free; i < failures; i++ {
+		delay *= 2
+		if delay >= s.maxDelay {
+			return s.maxDelay
+		}
+	}
+	return delay
+}
+
+// normalizeLoginIdentifier 登录名不区分大小写和首尾空格，限流和审计记录使用同一形式
+func normalizeLoginIdentifier(identifier string) string {
+	return strings.ToLower(strings.TrimSpace(identifier))
+}
+
+// lockLogin 锁住账号的登录尝试，返回解锁函数
+// 检查失败次数和记录本次结果之间要校验密码，不加锁时并发的请求都能通过检查，绕过等待和锁定
+// userID 为 0 表示账号不存在，此时按登录名加锁
+func lockLogin(userID uint, identifier string) func() {
+	key := "user:" + strconv.FormatUint(uint64(userID), 10)
+	if userID == 0 {
+		key = "name:" + normalizeLoginIdentifier(identifier)
+	}
+	return lockAttempts(key)
+}
+
+// lockAttempts 按 key 加锁，同一 key 的尝试串行执行，返回解锁函数
+func lockAttempts(key string) func() {
+	h := fnv.New32a()
+	h.Write([]byte(key))
+	mu := &loginLocks[h.Sum32()%uint32(len(loginLocks))]
+	mu.Lock()
+	return mu.Unlock
+}
+
+// CheckLoginThrottle 检查 IP 和账号是否需要等待后才能再次尝试登录
+// userID 为 0 表示账号不存在，此时按登录名计算，与存在的账号表现一致
+func CheckLoginThrottle(userID uint, identifier, ipAddress string) error {
+	db := models.GetDB()
+	s := getLoginProtectionSettings()
+	now := time.Now()
+	var err error
+
+	// 同一 IP 尝试多个账号的失败次数合计，登录成功不会清零
+	if ipAddress != "" {
+		var failures int64
+		var last time.Time
+		failures, last, err = dao.GetIPLoginFailures(db, ipAddress, now.Add(-s.window))
+		if err != nil {
+			return err
+		}
+		if wait := last.Add(s.backoff(failures, s.ipFreeAttempts)).Sub(now); failures > 0 && wait > 0 {
+			return &LoginThrottledError{RetryAfter: wait}
+		}
+	}
+
+	since := s.since(now)
+	var failures int64
+	var last time.Time
+	if userID != 0 {
+		var reset time.Time
+		reset, err = dao.GetLastLoginReset(db, userID)
+		if err != nil {
+			return err
+		}
+		if reset.After(since) {
+			since = reset
+		}
+		failures, last, err = dao.GetUserLoginFailures(db, userID, since)
+	} else {
+		failures, last, err = dao.GetIdentifierLoginFailures(db, normalizeLoginIdentifier(identifier), since)
+	}
+	if err != nil {
+		return err
+	}
+	if throttled := s.throttle(failures, last, now); throttled != nil {
+		return throttled
+	}
+	return nil
+}
+
+// since 统计失败次数的起始时间，锁定时长超过统计窗口时按锁定时长统计，避免锁定提前结束
+func (s loginProtectionSettings) since(now time.Time) time.Time {
+	since := now.Add(-s.window)
+	if lockSince := now.Add(-s.lockoutDuration); lockSince.Before(since) {
+		since = lockSince
+	}
+	return since
+}
+
+// throttle 按失败次数和最近一次失败的时间判断是否需要等待，不需要时返回 nil
+func (s loginProtectionSettings) throttle(failures int64, last, now time.Time) *LoginThrottledError {
+	if failures == 0 {
+		return nil
+	}
+	if failures >= s.lockoutThreshold {
+		if wait := last.Add(s.lockoutDuration).Sub(now); wait > 0 {
+			return &LoginThrottledError{RetryAfter: wait, Locked: true}
+		}
+	}
+	if wait := last.Add(s.backoff(failures, s.freeAttempts)).Sub(now); wait > 0 {
+		return &LoginThrottledError{RetryAfter: wait}
+	}
+	return nil
+}
+
+// RecordLoginAttempt 保存登录尝试记录，记录失败不影响登录流程
+func RecordLoginAttempt(userID uint, identifier, ipAddress, userAgent, result string) {
+	log := logger.GetLogger().WithFields(logrus.Fields{
+		"user_id": userID,
+		"ip":      ipAddress,
+		"result":  result,
+	})
+
+	attempt := &models.LoginAttempt{
+		Identifier: normalizeLoginIdentifier(identifier),
+		IPAddress:  ipAddress,
+		UserAgent:  userAgent,
+		Result:     result,
+	}
+	if userID != 0 {
+		attempt.UserID = &userID
+	}
+	if len(attempt.Identifier) > 255 {
+		attempt.Identifier = attempt.Identifier[:255]
+	}
+	if len(attempt.UserAgent) > 255 {
+		attempt.UserAgent = attempt.UserAgent[:255]
+	}
+
+	db := models.GetDB()
+	if err := dao.CreateLoginAttempt(db, attempt); err != nil {
+		log.WithError(err).Error("保存登录记录失败")
+		return
+	}
+
+	if result == models.LoginResultSuccess {
+		log.Info("登录成功")
+		cleanLoginAttempts()
+	} else {
+		log.Warn("登录未成功")
+	}
+}
+
+// RecordLoginSuccess 登录成功（包括两步验证），账号的失败次数清零
+func RecordLoginSuccess(userID uint, ipAddress, userAgent string) {
+	RecordLoginAttempt(userID, "", ipAddress, userAgent, models.LoginResultSuccess)
+}
+
+// UnlockLogin 管理员解除账号的登录锁定，失败次数清零
+func UnlockLogin(userID, operatorID uint) error {
+	err := dao.CreateLoginAttempt(models.GetDB(), &models.LoginAttempt{
+		UserID: &userID,
+		Result: models.LoginResultUnlock,
+	})
+	if err != nil {
+		return err
+	}
+	logger.GetLogger().WithFields(logrus.Fields{
+		"user_id":     userID,
+		"operator_id": operatorID,
+	}).Info("解除账号登录锁定")
+	return nil
+}
+
+// ListLoginAttempts 分页查询登录记录
+func ListLoginAttempts(filter dao.LoginAttemptFilter, page, pageSize int) ([]models.LoginAttempt, int64, error) {
+	return dao.ListLoginAttempts(models.GetDB(), filter, page, pageSize)
+}
+
+// cleanLoginAttempts 删除超过保留天数的登录记录，每小时最多执行一次
+func cleanLoginAttempts() {
+	lastLoginAttemptCleanupMutex.Lock()
+	if time.Since(lastLoginAttemptCleanup) < loginAttemptCleanupInterval {
+		lastLoginAttemptCleanupMutex.Unlock()
+		return
+	}
+	lastLoginAttemptCleanup = time.Now()
+	lastLoginAttemptCleanupMutex.Unlock()
+
+	before := time.Now().AddDate(0, 0, -getLoginProtectionSettings().retentionDays)
+	if err := dao.DeleteLoginAttemptsBefore(models.GetDB(), before); err != nil {
+		logger.GetLogger().WithError(err).Warn("清理过期的登录记录失败")
+	}
+}
@@ -0,0 +1,264 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"img_hosting/config"
+	"img_hosting/dao"
+	"img_hosting/models"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// useTestLoginProtection 测试期间使用固定的登录保护配置：
+// 失败 3 次后开始等待，5 次后锁定 60 秒，统计窗口 15 分钟
+func useTestLoginProtection(t *testing.T) {
+	t.Helper()
+	cfg := config.GetConfig()
+	old := cfg.LoginProtection
+	cfg.LoginProtection.Window = 900
+	cfg.LoginProtection.FreeAttempts = 3
+	cfg.LoginProtection.IPFreeAttempts = 8
+	cfg.LoginProtection.BaseDelay = 1
+	cfg.LoginProtection.MaxDelay = 30
+	cfg.LoginProtection.LockoutThreshold = 5
+	cfg.LoginProtection.LockoutDuration = 60
+	t.Cleanup(func() { cfg.LoginProtection = old })
+}
+
+// addLoginFailures 写入 n 条 at 时刻的登录失败记录
+func addLoginFailures(t *testing.T, userID uint, identifier, ip string, n int, at time.Time) {
+	t.Helper()
+	for i := 0; i < n; i++ {
+		attempt := &models.LoginAttempt{
+			Identifier: normalizeLoginIdentifier(identifier),
+			IPAddress:  ip,
+			Result:     models.LoginResultFailure,
+			CreatedAt:  at,
+		}
+		if userID != 0 {
+			attempt.UserID = &userID
+		}
+		if err := dao.CreateLoginAttempt(models.GetDB(), attempt); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+// loginTestIP 按用户 ID 生成测试用的 IP，同一进程多次运行测试时互不影响
+func loginTestIP(userID uint) string {
+	return fmt.Sprintf("10.47.%d.%d", userID/256, userID%256)
+}
+
+// loginThrottle 返回 CheckLoginThrottle 的限流错误，未限流时返回 nil
+func loginThrottle(t *testing.T, userID uint, identifier, ip string) *LoginThrottledError {
+	t.Helper()
+	err := CheckLoginThrottle(userID, identifier, ip)
+	if err == nil {
+		return nil
+	}
+	var throttled *LoginThrottledError
+	if !errors.As(err, &throttled) {
+		t.Fatalf("意外的错误: %v", err)
+	}
+	return throttled
+}
+
+func TestLoginBackoff(t *testing.T) {
+	useTestLoginProtection(t)
+	s := getLoginProtectionSettings()
+
+	tests := []struct {
+		failures int64
+		want     time.Duration
+	}{
+		{0, 0},
+		{2, 0},
+		{3, time.Second},
+		{4, 2 * time.Second},
+		{5, 4 * time.Second},
+		{8, 30 * time.Second},
+		{100, 30 * time.Second},
+	}
+	for _, tt := range tests {
+		if got := s.backoff(tt.failures, s.freeAttempts); got != tt.want {
+			t.Errorf("backoff(%d) = %s, want %s", tt.failures, got, tt.want)
+		}
+	}
+}
+
+func TestLoginLockoutThreshold(t *testing.T) {
+	useTestLoginProtection(t)
+	user := createTestUser(t)
+	ip := loginTestIP(user.UserID)
+	now := time.Now()
+
+	// 免等待次数之内不限制
+	addLoginFailures(t, user.UserID, user.Email, ip, 2, now)
+	if throttled := loginThrottle(t, user.UserID, user.Email, ip); throttled != nil {
+		t.Fatalf("失败 2 次时不应限制: %v", throttled)
+	}
+
+	// 达到免等待次数后需要等待，但不锁定
+	addLoginFailures(t, user.UserID, user.Email, ip, 1, now)
+	throttled := loginThrottle(t, user.UserID, user.Email, ip)
+	if throttled == nil || throttled.Locked || throttled.RetryAfter > time.Second {
+		t.Fatalf("失败 3 次后应等待 1 秒: %+v", throttled)
+	}
+
+	// 达到锁定阈值后锁定，锁定时长从最近一次失败开始计算
+	addLoginFailures(t, user.UserID, user.Email, ip, 2, now.Add(-10*time.Second))
+	throttled = loginThrottle(t, user.UserID, user.Email, ip)
+	if throttled == nil || !throttled.Locked || throttled.RetryAfter <= 50*time.Second || throttled.RetryAfter > 60*time.Second {
+		t.Fatalf("失败 5 次后应锁定约 60 秒: %+v", throttled)
+	}
+	if throttled.RetrySeconds() != 60 && throttled.RetrySeconds() != 59 {
+		t.Errorf("RetrySeconds = %d", throttled.RetrySeconds())
+	}
+}
+
+func TestLoginLockoutExpires(t *testing.T) {
+	useTestLoginProtection(t)
+	user := createTestUser(t)
+
+	// 锁定时长已过，退避等待也已过，可以再次尝试
+	ip := loginTestIP(user.UserID)
+	addLoginFailures(t, user.UserID, user.Email, ip, 5, time.Now().Add(-2*time.Minute))
+	if throttled := loginThrottle(t, user.UserID, user.Email, ip); throttled != nil {
+		t.Errorf("锁定结束后不应限制: %+v", throttled)
+	}
+}
+
+func TestLoginLockoutReset(t *testing.T) {
+	useTestLoginProtection(t)
+
+	// 登录成功后失败次数清零
+	user := createTestUser(t)
+	ip := loginTestIP(user.UserID)
+	addLoginFailures(t, user.UserID, user.Email, ip, 5, time.Now().Add(-time.Second))
+	if throttled := loginThrottle(t, user.UserID, user.Email, ""); throttled == nil || !throttled.Locked {
+		t.Fatalf("应已锁定: %+v", throttled)
+	}
+	RecordLoginSuccess(user.UserID, ip, "test")
+	if throttled := loginThrottle(t, user.UserID, user.Email, ""); throttled != nil {
+		t.Errorf("登录成功后应清零: %+v", throttled)
+	}
+
+	// 管理员解锁后失败次数清零
+	other := createTestUser(t)
+	addLoginFailures(t, other.UserID, other.Email, ip, 5, time.Now().Add(-time.Second))
+	if err := UnlockLogin(other.UserID, user.UserID); err != nil {
+		t.Fatal(err)
+	}
+	if throttled := loginThrottle(t, other.UserID, other.Email, ""); throttled != nil {
+		t.Errorf("解锁后应清零: %+v", throttled)
+	}
+}
+
+func TestLoginThrottleByIdentifierAndIP(t *testing.T) {
+	useTestLoginProtection(t)
+	now := time.Now().Add(-time.Second)
+
+	// 不存在的账号按登录名统计，不区分大小写
+	fresh := createTestUser(t)
+	ghost := fmt.Sprintf("Ghost%d@Example.com", fresh.UserID)
+	addLoginFailures(t, 0, ghost, "", 5, now)
+	if throttled := loginThrottle(t, 0, " "+strings.ToUpper(ghost)+" ", ""); throttled == nil || !throttled.Locked {
+		t.Errorf("不存在的账号也应锁定: %+v", throttled)
+	}
+
+	// 同一 IP 对多个账号的失败次数合计
+	ip := loginTestIP(fresh.UserID)
+	for i := 0; i < 4; i++ {
+		user := createTestUser(t)
+		addLoginFailures(t, user.UserID, user.Email, ip, 2, time.Now())
+	}
+	throttled := loginThrottle(t, fresh.UserID, fresh.Email, ip)
+	if throttled == nil || throttled.Locked {
+		t.Errorf("IP 失败 8 次后应等待: %+v", throttled)
+	}
+	if throttled := loginThrottle(t, fresh.UserID, fresh.Email, loginTestIP(fresh.UserID+1)); throttled != nil {
+		t.Errorf("其他 IP 不应受影响: %+v", throttled)
+	}
+}
+
+func TestLoginRejectedWhileLocked(t *testing.T) {
+	useTestLoginProtection(t)
+	user := createTestUser(t)
+	ip := loginTestIP(user.UserID)
+	auth := &AuthService{}
+
+	addLoginFailures(t, user.UserID, user.Email, ip, 5, time.Now().Add(-time.Second))
+
+	// 锁定期间密码正确也不能登录
+	_, err := auth.Login(user.Email, "Passw0rd!", ip, "test")
+	var throttled *LoginThrottledError
+	if !errors.As(err, &throttled) || !throttled.Locked {
+		t.Fatalf("锁定期间应拒绝登录，got %v", err)
+	}
+	attempts, _, err := ListLoginAttempts(dao.LoginAttemptFilter{UserID: user.UserID, Result: models.LoginResultLocked}, 1, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(attempts) != 1 {
+		t.Errorf("应记录 1 次被锁定的登录，got %d", len(attempts))
+	}
+
+	// 被拒绝的请求不计入失败次数，锁定结束后可以登录
+	if err := models.GetDB().Model(&models.LoginAttempt{}).Where("user_id = ?", user.UserID).
+		Update("created_at", time.Now().Add(-2*time.Minute)).Error; err != nil {
+		t.Fatal(err)
+	}
+	if _, err := auth.Login(user.Email, "Passw0rd!", ip, "test"); err != nil {
+		t.Errorf("锁定结束后应能登录: %v", err)
+	}
+}
+
+func TestLoginLockoutUnderConcurrentAttempts(t *testing.T) {
+	useTestLoginProtection(t)
+	cfg := config.GetConfig()
+	cfg.LoginProtection.FreeAttempts = 10
+	cfg.LoginProtection.IPFreeAttempts = 100
+	user := createTestUser(t)
+	auth := &AuthService{}
+
+	// 并发的错误密码请求不能同时通过检查，失败次数恰好在阈值处停止
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	invalid, locked := 0, 0
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			_, err := auth.Login(user.Email, "wrong-password", loginTestIP(user.UserID+uint(i)), "test")
+			var throttled *LoginThrottledError
+			mu.Lock()
+			defer mu.Unlock()
+			switch {
+			case errors.Is(err, ErrInvalidCredentials):
+				invalid++
+			case errors.As(err, &throttled) && throttled.Locked:
+				locked++
+			default:
+				t.Errorf("意外的错误: %v", err)
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	if invalid != 5 || locked != 15 {
+		t.Errorf("密码错误 %d 次、被锁定 %d 次，want 5 和 15", invalid, locked)
+	}
+	failures, _, err := dao.GetUserLoginFailures(models.GetDB(), user.UserID, time.Now().Add(-time.Minute))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if failures != 5 {
+		t.Errorf("记录的失败次数 = %d, want 5", failures)
+	}
+	if _, err := auth.Login(user.Email, "Passw0rd!", loginTestIP(user.UserID), "test"); err == nil {
+		t.Error("锁定后密码正确也不能登录")
+	}
+}
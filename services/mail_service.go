@@ -0,0 +1,131 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"img_hosting/config"
+	"img_hosting/dao"
+	"img_hosting/models"
+	"img_hosting/pkg/logger"
+	"img_hosting/pkg/mailer"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+)
+
+// JobTypeSendMail 发送邮件的任务类型
+const JobTypeSendMail = "mail.send"
+
+// MailJobPayload 发送邮件任务参数，邮件在发送时按模板渲染
+type MailJobPayload struct {
+	To       string            `json:"to"`
+	Template string            `json:"template"`
+	Data     map[string]string `json:"data"`
+}
+
+var (
+	mailSender      mailer.Mailer
+	mailSenderMutex = &sync.Mutex{}
+)
+
+func init() {
+	RegisterJobHandler(JobTypeSendMail, JobHandler{
+		Handle:   handleSendMailJob,
+		OnFailed: onSendMailJobFailed,
+	})
+}
+
+// GetMailer 获取邮件发送器，首次调用时根据配置创建
+func GetMailer() mailer.Mailer {
+	mailSenderMutex.Lock()
+	defer mailSenderMutex.Unlock()
+
+	if mailSender != nil {
+		return mailSender
+	}
+
+	cfg := config.GetConfig().Mail
+	switch cfg.Driver {
+	case "smtp":
+		mailSender = mailer.NewSMTPMailer(
+			cfg.SMTP.Host,
+			cfg.SMTP.Port,
+			cfg.SMTP.Username,
+			os.ExpandEnv(cfg.SMTP.Password),
+			cfg.SMTP.Encryption,
+			time.Duration(cfg.SMTP.Timeout)*time.Second,
+			cfg.From,
+		)
+	case "file":
+		mailSender = mailer.NewFileMailer(cfg.OutboxPath, cfg.From)
+	case "", "log":
+		mailSender = mailer.LogMailer{Printf: logger.GetLogger().Infof}
+	default:
+		logger.GetLogger().WithField("driver", cfg.Driver).Warn("未知的邮件发送方式，邮件只写入日志")
+		mailSender = mailer.LogMailer{Printf: logger.GetLogger().Infof}
+	}
+	return mailSender
+}
+
+// SetMailer 替换邮件发送器，用于接入其他邮件服务
+func SetMailer(m mailer.Mailer) {
+	mailSenderMutex.Lock()
+	mailSender = m
+	mailSenderMutex.Unlock()
+}
+
+// EnqueueMail 创建发送邮件的任务，db 可以是事务；提交后需要调用 NotifyJobWorkers
+func EnqueueMail(db *gorm.DB, to, template string, data map[string]string) error {
+	if data == nil {
+		data = make(map[string]string)
+	}
+	if data["SiteName"] == "" {
+		data["SiteName"] = mailSiteName()
+	}
+	_, err := EnqueueJob(db, JobTypeSendMail, MailJobPayload{To: to, Template: template, Data: data})
+	return err
+}
+
+// handleSendMailJob 渲染模板并发送邮件，发送成功后清空任务参数（其中包含一次性链接）
+func handleSendMailJob(ctx context.Context, job *models.Job) error {
+	var payload MailJobPayload
+	if err := json.Unmarshal([]byte(job.Payload), &payload); err != nil {
+		return fmt.Errorf("解析任务参数失败: %w", err)
+	}
+
+	msg, err := mailer.NewTemplates(config.GetConfig().Mail.TemplatesPath).Render(payload.Template, payload.Data)
+	if err != nil {
+		return err
+	}
+	msg.To = []string{payload.To}
+
+	m := GetMailer()
+	if err := m.Send(ctx, msg); err != nil {
+		return fmt.Errorf("发送邮件失败(%s): %w", m.Name(), err)
+	}
+
+	logger.GetLogger().WithFields(logrus.Fields{
+		"job_id":   job.ID,
+		"template": payload.Template,
+		"mailer":   m.Name(),
+	}).Info("邮件已发送")
+	return dao.ClearJobPayload(models.GetDB(), job.ID)
+}
+
+// onSendMailJobFailed 重试耗尽后同样清空任务参数
+func onSendMailJobFailed(job *models.Job, err error) {
+	if clearErr := dao.ClearJobPayload(models.GetDB(), job.ID); clearErr != nil {
+		logger.GetLogger().WithError(clearErr).WithField("job_id", job.ID).Error("清空邮件任务参数失败")
+	}
+}
+
+func mailSiteName() string {
+	if name := config.GetConfig().Mail.SiteName; name != "" {
+		return name
+	}
+	return "img_hosting"
+}
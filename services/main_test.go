@@ -0,0 +1,54 @@
+package services
+
+import (
+	"fmt"
+	"img_hosting/config"
+	"img_hosting/models"
+	"img_hosting/pkg/logger"
+	"os"
+	"testing"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// TestMain 在临时目录中运行测试，数据库（test.db）、日志和上传文件都写在临时目录
+func TestMain(m *testing.M) {
+	config.LoadConfig()
+
+	dir, err := os.MkdirTemp("", "img_hosting-services-*")
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+	if err := os.Chdir(dir); err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+	logger.Init()
+
+	code := m.Run()
+	os.RemoveAll(dir)
+	os.Exit(code)
+}
+
+var testUserSeq int
+
+// createTestUser 创建一个状态正常的用户，密码为 Passw0rd!
+func createTestUser(t *testing.T) *models.UserInfo {
+	t.Helper()
+	testUserSeq++
+	hashed, err := bcrypt.GenerateFromPassword([]byte("Passw0rd!"), bcrypt.MinCost)
+	if err != nil {
+		t.Fatal(err)
+	}
+	user := &models.UserInfo{
+		Name:     fmt.Sprintf("%s_%d", t.Name(), testUserSeq),
+		Email:    fmt.Sprintf("user%d@example.com", testUserSeq),
+		Password: string(hashed),
+		Status:   models.UserStatusActive,
+	}
+	if err := models.GetDB().Create(user).Error; err != nil {
+		t.Fatalf("创建测试用户失败: %v", err)
+	}
+	return user
+}
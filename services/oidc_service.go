@@ -0,0 +1,437 @@
+package services
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"img_hosting/config"
+	"img_hosting/dao"
+	"img_hosting/models"
+	"img_hosting/pkg/logger"
+	"img_hosting/pkg/oidc"
+	"os"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"golang.org/x/crypto/bcrypt"
+	"gorm.io/gorm"
+)
+
+const (
+	defaultOIDCStateTTL = 10 * time.Minute
+	oidcLoginCodeTTL    = time.Minute
+	oidcRequestTimeout  = 15 * time.Second
+	maxOIDCUserNameLen  = 32
+)
+
+var (
+	ErrOIDCProviderNotFound = errors.New("单点登录提供方不存在")
+	ErrOIDCStateInvalid     = errors.New("登录请求无效或已过期，请重新登录")
+	ErrOIDCStateMismatch    = errors.New("登录请求不是由当前浏览器发起的，请重新登录")
+	ErrOIDCEmailRequired    = errors.New("身份提供方没有返回已验证的邮箱")
+	ErrOIDCDomainNotAllowed = errors.New("该邮箱域名不允许登录")
+	ErrOIDCAccountNotFound  = errors.New("没有与该身份关联的账号，请联系管理员")
+	ErrOIDCEmailTaken       = errors.New("该邮箱已注册，请使用密码登录")
+	ErrOIDCLinkUnverified   = errors.New("该邮箱对应的账号尚未验证邮箱，请先使用密码登录并验证邮箱")
+	ErrOIDCLoginCodeInvalid = errors.New("登录码无效或已过期")
+)
+
+// OIDCProviderInfo 登录页面显示的单点登录入口
+type OIDCProviderInfo struct {
+	ID       string `json:"id"`
+	Name     string `json:"name"`
+	LoginURL string `json:"login_url"`
+}
+
+var (
+	oidcProviders      = make(map[string]*oidc.Provider)
+	oidcProvidersMutex = &sync.Mutex{}
+	oidcUserNameStrip  = regexp.MustCompile(`[\W_]`)
+)
+
+// ListOIDCProviders 返回配置的单点登录提供方
+func ListOIDCProviders() []OIDCProviderInfo {
+	providers := make([]OIDCProviderInfo, 0, len(config.GetConfig().OIDC.Providers))
+	for _, cfg := range config.GetConfig().OIDC.Providers {
+		name := cfg.Name
+		if name == "" {
+			name = cfg.ID
+		}
+		providers = append(providers, OIDCProviderInfo{
+			ID:       cfg.ID,
+			Name:     name,
+			LoginURL: "/auth/oidc/" + cfg.ID + "/login",
+		})
+	}
+	return providers
+}
+
+// StartOIDCLogin 保存 state、nonce 和 PKCE 验证码，返回跳转到身份提供方的授权地址和 state
+// 调用方需要把 state 保存在发起登录的浏览器中（Cookie），回调时校验，baseURL 为请求的访问地址，配置了 url.apiurl 时使用配置
+func StartOIDCLogin(providerID, baseURL, ipAddress string) (authURL, state string, err error) {
+	cfg, err := findOIDCProviderConfig(providerID)
+	if err != nil {
+		return "", "", err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), oidcRequestTimeout)
+	defer cancel()
+	provider, err := getOIDCProvider(ctx, cfg)
+	if err != nil {
+		return "", "", err
+	}
+
+	state, err = randomToken(32)
+	if err != nil {
+		return "", "", err
+	}
+	nonce, err := randomToken(32)
+	if err != nil {
+		return "", "", err
+	}
+	verifier, err := randomToken(48)
+	if err != nil {
+		return "", "", err
+	}
+
+	ttl := OIDCStateTTL()
+	redirectURI := oidcRedirectURI(cfg, baseURL)
+
+	db := models.GetDB()
+	if err := dao.DeleteExpiredOIDCAuthRequests(db, time.Now()); err != nil {
+		logger.GetLogger().WithError(err).Warn("清理过期的单点登录请求失败")
+	}
+	err = dao.CreateOIDCAuthRequest(db, &models.OIDCAuthRequest{
+		State:        hashRefreshToken(state),
+		Provider:     cfg.ID,
+		Nonce:        nonce,
+		CodeVerifier: verifier,
+		RedirectURI:  redirectURI,
+		IPAddress:    ipAddress,
+		ExpiresAt:    time.Now().Add(ttl),
+	})
+	if err != nil {
+		return "", "", err
+	}
+
+	return provider.AuthCodeURL(redirectURI, state, nonce, oidc.S256Challenge(verifier)), state, nil
+}
+
+// OIDCStateTTL 跳转到身份提供方后完成登录的时限
+func OIDCStateTTL() time.Duration {
+	if seconds := config.GetConfig().OIDC.StateTTL; seconds > 0 {
+		return time.Duration(seconds) * time.Second
+	}
+	return defaultOIDCStateTTL
+}
+
+// FinishOIDCLogin 处理身份提供方的回调：校验 state，用授权码换取并验证 ID 令牌，返回对应的用户
+// 首次登录时按配置关联同邮箱的账号或自动创建账号
+func FinishOIDCLogin(providerID, state, code, ipAddress string) (*models.UserInfo, error) {
+	log := logger.GetLogger().WithFields(logrus.Fields{
+		"provider": providerID,
+		"ip":       ipAddress,
+	})
+	cfg, err := findOIDCProviderConfig(providerID)
+	if err != nil {
+		return nil, err
+	}
+
+	db := models.GetDB()
+	req, err := dao.TakeOIDCAuthRequest(db, hashRefreshToken(state))
+	if err != nil {
+		return nil, err
+	}
+	if req == nil || req.Provider != cfg.ID || time.Now().After(req.ExpiresAt) {
+		return nil, ErrOIDCStateInvalid
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), oidcRequestTimeout)
+	defer cancel()
+	provider, err := getOIDCProvider(ctx, cfg)
+	if err != nil {
+		return nil, err
+	}
+	token, err := provider.Exchange(ctx, code, req.RedirectURI, req.CodeVerifier)
+	if err != nil {
+		return nil, err
+	}
+	claims, err := provider.VerifyIDToken(ctx, token.IDToken, req.Nonce)
+	if err != nil {
+		return nil, err
+	}
+
+	log = log.WithField("subject", claims.Subject)
+	user, err := resolveOIDCUser(db, cfg, claims)
+	if err != nil {
+		log.WithError(err).Warn("单点登录失败")
+		return nil, err
+	}
+	if isUserDisabled(user.Status) {
+		log.WithField("user_id", user.UserID).Warn("单点登录失败，账号已被禁用")
+		return nil, ErrUserDisabled
+	}
+	if err := dao.UpdateLoginInfo(db, user.UserID, ipAddress); err != nil {
+		return nil, err
+	}
+
+	log.WithField("user_id", user.UserID).Info("单点登录成功")
+	return user, nil
+}
+
+// CreateOIDCLoginCode 生成跳转到前端时携带的一次性登录码，前端用它换取令牌
+func CreateOIDCLoginCode(userID uint, ipAddress string) (string, error) {
+	code, err := randomToken(32)
+	if err != nil {
+		return "", err
+	}
+	err = dao.CreateOneTimeToken(models.GetDB(), &models.Token{
+		Token:      hashRefreshToken(code),
+		UserID:     userID,
+		ExpiresAt:  time.Now().Add(oidcLoginCodeTTL),
+		IPAddress:  ipAddress,
+		Status:     models.TokenStatusActive,
+		LastUsedAt: time.Now(),
+	}, models.TokenTypeOIDCLogin)
+	if err != nil {
+		return "", err
+	}
+	return code, nil
+}
+
+// ExchangeOIDCLoginCode 使用一次性登录码，返回用户 ID
+func ExchangeOIDCLoginCode(code string) (uint, error) {
+	token, err := consumeAccountToken(models.GetDB(), code, models.TokenTypeOIDCLogin)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return 0, ErrOIDCLoginCodeInvalid
+		}
+		return 0, err
+	}
+	if err := CheckUserActive(token.UserID); err != nil {
+		return 0, err
+	}
+	return token.UserID, nil
+}
+
+// ListUserIdentities 获取用户关联的单点登录身份
+func ListUserIdentities(userID uint) ([]models.UserIdentity, error) {
+	return dao.ListUserIdentities(models.GetDB(), userID)
+}
+
+// resolveOIDCUser 找到外部身份对应的用户，没有关联时按邮箱关联或创建账号
+func resolveOIDCUser(db *gorm.DB, cfg *config.OIDCProviderConfig, claims *oidc.IDTokenClaims) (*models.UserInfo, error) {
+	email := strings.TrimSpace(claims.Email)
+	if len(cfg.AllowedDomains) > 0 && !oidcEmailDomainAllowed(email, cfg.AllowedDomains) {
+		return nil, ErrOIDCDomainNotAllowed
+	}
+
+	identity, err := dao.GetUserIdentity(db, cfg.ID, claims.Subject)
+	if err != nil {
+		return nil, err
+	}
+	if identity != nil {
+		user, err := dao.GetUserByID(db, identity.UserID)
+		if err == nil {
+			if err := dao.TouchUserIdentity(db, identity.ID, email); err != nil {
+				return nil, err
+			}
+			return user, nil
+		}
+		if err.Error() != "用户不存在" {
+			return nil, err
+		}
+		// 关联的用户已被删除，按新身份处理
+		if err := dao.DeleteUserIdentity(db, identity.ID); err != nil {
+			return nil, err
+		}
+	}
+
+	// 关联或创建账号需要身份提供方确认过的邮箱
+	if email == "" || (!bool(claims.EmailVerified) && !cfg.AllowUnverifiedEmail) {
+		return nil, ErrOIDCEmailRequired
+	}
+
+	existing, err := dao.GetUserByEmail(db, email)
+	if err != nil && err.Error() != "用户不存在" {
+		return nil, err
+	}
+	if existing != nil {
+		if !cfg.LinkByEmail {
+			return nil, ErrOIDCEmailTaken
+		}
+		// 本地账号的邮箱没有验证过时可能是他人抢注的（抢注者仍能用密码登录），
+		// 关联只在双方都确认过邮箱时进行，allow_unverified_email 不适用于关联
+		if existing.EmailVerifiedAt == nil || !bool(claims.EmailVerified) {
+			return nil, ErrOIDCLinkUnverified
+		}
+		err := dao.CreateUserIdentity(db, &models.UserIdentity{
+			UserID:      existing.UserID,
+			Provider:    cfg.ID,
+			Subject:     claims.Subject,
+			Email:       email,
+			LastLoginAt: time.Now(),
+		})
+		if err != nil {
+			return nil, err
+		}
+		logger.GetLogger().WithFields(logrus.Fields{
+			"provider": cfg.ID,
+			"user_id":  existing.UserID,
+		}).Info("单点登录身份已按邮箱关联到已有账号")
+		return existing, nil
+	}
+
+	if !cfg.AutoCreate {
+		return nil, ErrOIDCAccountNotFound
+	}
+	return createOIDCUser(db, cfg, claims, email)
+}
+
+// createOIDCUser 为新身份创建账号，密码为随机值，用户可以通过找回密码设置密码
+func createOIDCUser(db *gorm.DB, cfg *config.OIDCProviderConfig, claims *oidc.IDTokenClaims, email string) (*models.UserInfo, error) {
+	password, err := randomToken(32)
+	if err != nil {
+		return nil, err
+	}
+	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return nil, err
+	}
+
+	var user *models.UserInfo
+	err = db.Transaction(func(tx *gorm.DB) error {
+		name, err := oidcUserName(tx, claims, email)
+		if err != nil {
+			return err
+		}
+		now := time.Now()
+		user = &models.UserInfo{
+			Name:            name,
+			Email:           email,
+			Password:        string(hashedPassword),
+			Status:          models.UserStatusActive,
+			EmailVerifiedAt: &now,
+		}
+		if err := dao.CreateUser(tx, user); err != nil {
+			return err
+		}
+
+		if cfg.DefaultRole != "" {
+			role, err := dao.GetRoleByName(tx, cfg.DefaultRole)
+			if err != nil {
+				return errors.New("单点登录配置的默认角色不存在: " + cfg.DefaultRole)
+			}
+			if err := dao.AssignRoleToUser(tx, user.UserID, role.RoleID); err != nil {
+				return err
+			}
+		}
+
+		return dao.CreateUserIdentity(tx, &models.UserIdentity{
+			UserID:      user.UserID,
+			Provider:    cfg.ID,
+			Subject:     claims.Subject,
+			Email:       email,
+			LastLoginAt: now,
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	logger.GetLogger().WithFields(logrus.Fields{
+		"provider": cfg.ID,
+		"user_id":  user.UserID,
+		"role":     cfg.DefaultRole,
+	}).Info("单点登录自动创建账号")
+	return user, nil
+}
+
+// oidcUserName 根据身份提供方返回的用户名生成不重复的用户名，只保留字母和数字（与注册时的校验一致）
+func oidcUserName(db *gorm.DB, claims *oidc.IDTokenClaims, email string) (string, error) {
+	base := ""
+	for _, candidate := range []string{claims.PreferredUsername, claims.Name, strings.SplitN(email, "@", 2)[0]} {
+		if base = oidcUserNameStrip.ReplaceAllString(candidate, ""); base != "" {
+			break
+		}
+	}
+	if base == "" {
+		base = "user"
+	}
+	if len(base) > maxOIDCUserNameLen-6 {
+		base = base[:maxOIDCUserNameLen-6]
+	}
+
+	name := base
+	for i := 0; i < 5; i++ {
+		existing, err := dao.GetUserByName(db, name)
+		if err != nil && err.Error() != "用户不存在" {
+			return "", err
+		}
+		if existing == nil {
+			return name, nil
+		}
+		b, err := randomBytes(2)
+		if err != nil {
+			return "", err
+		}
+		name = fmt.Sprintf("%s%04d", base, binary.BigEndian.Uint16(b)%10000)
+	}
+	return "", errors.New("生成用户名失败")
+}
+
+func oidcEmailDomainAllowed(email string, domains []string) bool {
+	at := strings.LastIndex(email, "@")
+	if at < 0 {
+		return false
+	}
+	domain := strings.ToLower(email[at+1:])
+	for _, allowed := range domains {
+		if strings.ToLower(strings.TrimPrefix(allowed, "@")) == domain {
+			return true
+		}
+	}
+	return false
+}
+
+func oidcRedirectURI(cfg *config.OIDCProviderConfig, baseURL string) string {
+	if cfg.RedirectURL != "" {
+		return cfg.RedirectURL
+	}
+	return UploaderBaseURL(baseURL) + "/auth/oidc/" + cfg.ID + "/callback"
+}
+
+func findOIDCProviderConfig(id string) (*config.OIDCProviderConfig, error) {
+	providers := config.GetConfig().OIDC.Providers
+	for i := range providers {
+		if providers[i].ID == id {
+			return &providers[i], nil
+		}
+	}
+	return nil, ErrOIDCProviderNotFound
+}
+
+// getOIDCProvider 返回完成服务发现的身份提供方，服务发现失败时不缓存，下次请求重试
+func getOIDCProvider(ctx context.Context, cfg *config.OIDCProviderConfig) (*oidc.Provider, error) {
+	oidcProvidersMutex.Lock()
+	defer oidcProvidersMutex.Unlock()
+
+	if provider, ok := oidcProviders[cfg.ID]; ok {
+		return provider, nil
+	}
+	provider, err := oidc.NewProvider(ctx, oidc.Config{
+		Issuer:       cfg.Issuer,
+		ClientID:     cfg.ClientID,
+		ClientSecret: os.ExpandEnv(cfg.ClientSecret),
+		Scopes:       cfg.Scopes,
+	})
+	if err != nil {
+		logger.GetLogger().WithError(err).WithField("provider", cfg.ID).Error("单点登录服务发现失败")
+		return nil, err
+	}
+	oidcProviders[cfg.ID] = provider
+	return provider, nil
+}
@@ -0,0 +1,80 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"img_hosting/config"
+	"img_hosting/dao"
+	"img_hosting/models"
+	"img_hosting/pkg/oidc"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+func testOIDCProvider() *config.OIDCProviderConfig {
+	return &config.OIDCProviderConfig{ID: "mock", LinkByEmail: true}
+}
+
+func testOIDCClaims(subject, email string, verified bool) *oidc.IDTokenClaims {
+	claims := &oidc.IDTokenClaims{
+		RegisteredClaims: jwt.RegisteredClaims{Subject: subject},
+		Email:            email,
+	}
+	if verified {
+		claims.EmailVerified = true
+	}
+	return claims
+}
+
+func TestOIDCLinkRequiresVerifiedLocalEmail(t *testing.T) {
+	cfg := testOIDCProvider()
+	db := models.GetDB()
+
+	// 抢注的账号：未开启邮箱验证时状态为 active，但邮箱从未验证
+	squatted := createTestUser(t)
+	if squatted.Status != models.UserStatusActive || squatted.EmailVerifiedAt != nil {
+		t.Fatalf("测试账号应为未验证邮箱的 active 账号: %+v", squatted)
+	}
+	subject := fmt.Sprintf("sub-%d", squatted.UserID)
+	if _, err := resolveOIDCUser(db, cfg, testOIDCClaims(subject, squatted.Email, true)); !errors.Is(err, ErrOIDCLinkUnverified) {
+		t.Fatalf("本地邮箱未验证时应拒绝关联，got %v", err)
+	}
+	if identity, err := dao.GetUserIdentity(db, cfg.ID, subject); err != nil || identity != nil {
+		t.Errorf("不应创建关联: %+v, %v", identity, err)
+	}
+
+	// 本地邮箱验证后可以关联
+	now := time.Now()
+	if err := db.Model(squatted).Update("email_verified_at", &now).Error; err != nil {
+		t.Fatal(err)
+	}
+	user, err := resolveOIDCUser(db, cfg, testOIDCClaims(subject, squatted.Email, true))
+	if err != nil || user.UserID != squatted.UserID {
+		t.Fatalf("邮箱已验证时应关联到已有账号: %+v, %v", user, err)
+	}
+}
+
+func TestOIDCLinkRequiresVerifiedClaim(t *testing.T) {
+	cfg := testOIDCProvider()
+	cfg.AllowUnverifiedEmail = true
+	db := models.GetDB()
+
+	existing := createTestUser(t)
+	now := time.Now()
+	if err := db.Model(existing).Update("email_verified_at", &now).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	// allow_unverified_email 只用于创建账号，关联已有账号仍要求身份提供方验证过邮箱
+	subject := fmt.Sprintf("sub-%d", existing.UserID)
+	if _, err := resolveOIDCUser(db, cfg, testOIDCClaims(subject, existing.Email, false)); !errors.Is(err, ErrOIDCLinkUnverified) {
+		t.Errorf("身份提供方未验证邮箱时应拒绝关联，got %v", err)
+	}
+
+	cfg.LinkByEmail = false
+	if _, err := resolveOIDCUser(db, cfg, testOIDCClaims(subject, existing.Email, true)); !errors.Is(err, ErrOIDCEmailTaken) {
+		t.Errorf("未开启 link_by_email 时应返回 ErrOIDCEmailTaken，got %v", err)
+	}
+}
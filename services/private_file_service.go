@@ -8,38 +8,60 @@ import (
 	"img_hosting/dao"
 	"img_hosting/models"
 	"img_hosting/pkg/encryption"
+	"img_hosting/pkg/filetype"
 	"img_hosting/pkg/logger"
 	"io"
 	"mime/multipart"
 	"os"
 	"path/filepath"
 	"strings"
+	"time"
 
 	"img_hosting/config"
 
 	"github.com/sirupsen/logrus"
 )
 
+// ErrPrivateFileExists 用户已上传过相同内容的文件
+var ErrPrivateFileExists = errors.New("文件已存在")
+
 // UploadPrivateFile 上传私人文件
 func UploadPrivateFile(file *multipart.FileHeader, userID uint, isEncrypted bool, password string) (*models.PrivateFile, error) {
+	// 先按声明的大小检查，避免打开超大文件
+	if file.Size > config.GetConfig().PrivateFiles.MaxSize {
+		return nil, errors.New("文件大小超过限制")
+	}
+
+	// 打开文件
+	src, err := file.Open()
+	if err != nil {
+		return nil, err
+	}
+	defer src.Close()
+
+	return UploadPrivateFileReader(userID, file.Filename, src, file.Size, isEncrypted, password)
+}
+
+// UploadPrivateFileReader 从可回读的读取器保存私人文件，表单上传和 S3 接口共用
+// size 为文件的实际大小
+func UploadPrivateFileReader(userID uint, fileName string, src io.ReadSeeker, size int64, isEncrypted bool, password string) (*models.PrivateFile, error) {
 	cfg := config.GetConfig()
 
 	// 使用配置的限制
-	if file.Size > cfg.PrivateFiles.MaxSize {
+	if size > cfg.PrivateFiles.MaxSize {
 		return nil, errors.New("文件大小超过限制")
 	}
 
-	ext := strings.ToLower(filepath.Ext(file.Filename))
-	if !strings.Contains(cfg.PrivateFiles.AllowedTypes, ext) {
+	ext := strings.ToLower(filepath.Ext(fileName))
+	if !isAllowedPrivateFileType(cfg.PrivateFiles.AllowedTypes, ext) {
 		return nil, errors.New("不支持的文件类型")
 	}
 
-	// 打开文件
-	src, err := file.Open()
+	// 按魔数识别真实类型，不信任客户端提供的 Content-Type
+	mimeType, err := detectPrivateFileType(src, ext, cfg.Upload.MaxPixels)
 	if err != nil {
 		return nil, err
 	}
-	defer src.Close()
 
 	// 计算文件哈希
 	hash := md5.New()
@@ -55,7 +77,38 @@ func UploadPrivateFile(file *multipart.FileHeader, userID uint, isEncrypted bool
 		return nil, err
 	}
 	if existingFile != nil {
-		return nil, errors.New("文件已存在")
+		return nil, ErrPrivateFileExists
+	}
+
+	// 检查存储配额
+	if err := CheckStorageQuota(userID, size); err != nil {
+		return nil, err
+	}
+
+	// 落盘前进行恶意内容扫描，命中的文件写入隔离区
+	if _, err := src.Seek(0, io.SeekStart); err != nil {
+		return nil, err
+	}
+	scanStatus, scanResult, err := scanUpload(src)
+	if err != nil {
+		return nil, err
+	}
+	var scannedAt *time.Time
+	if scanStatus != models.ScanStatusSkipped {
+		now := time.Now()
+		scannedAt = &now
+	}
+	if scanStatus == models.ScanStatusInfected {
+		return nil, quarantineUpload(src, &models.PrivateFile{
+			UserID:     userID,
+			FileName:   fileName,
+			FileHash:   fileHash,
+			FileSize:   size,
+			FileType:   mimeType,
+			ScanStatus: scanStatus,
+			ScanResult: scanResult,
+			ScannedAt:  scannedAt,
+		})
 	}
 
 	// 使用配置的路径
@@ -84,7 +137,6 @@ func UploadPrivateFile(file *multipart.FileHeader, userID uint, isEncrypted bool
 
 	// 重要：在加密前确保文件已完全关闭
 	dst.Close() // 显式关闭文件
-	src.Close() // 显式关闭文件
 
 	// 如果需要加密
 	if isEncrypted {
@@ -99,14 +151,17 @@ func UploadPrivateFile(file *multipart.FileHeader, userID uint, isEncrypted bool
 	// 创建文件记录
 	privateFile := &models.PrivateFile{
 		UserID:      userID,
-		FileName:    file.Filename,
+		FileName:    fileName,
 		FileHash:    fileHash,
-		FileSize:    file.Size,
-		FileType:    file.Header.Get("Content-Type"),
+		FileSize:    size,
+		FileType:    mimeType,
 		StoragePath: storagePath,
 		IsEncrypted: isEncrypted,
 		Password:    password,
 		Status:      models.FileStatusActive,
+		ScanStatus:  scanStatus,
+		ScanResult:  scanResult,
+		ScannedAt:   scannedAt,
 	}
 
 	if err := dao.CreatePrivateFile(db, privateFile); err != nil {
@@ -118,6 +173,49 @@ func UploadPrivateFile(file *multipart.FileHeader, userID uint, isEncrypted bool
 	return privateFile, nil
 }
 
+// isAllowedPrivateFileType 检查扩展名是否在配置的允许列表中
+func isAllowedPrivateFileType(allowedTypes, ext string) bool {
+	if ext == "" {
+		return false
+	}
+	for _, allowed := range strings.Split(allowedTypes, ",") {
+		if strings.EqualFold(strings.TrimSpace(allowed), ext) {
+			return true
+		}
+	}
+	return false
+}
+
+// detectPrivateFileType 识别文件真实类型并与扩展名比对，图片会额外完整解码校验
+// 调用结束后读取位置会被重置到文件开头
+func detectPrivateFileType(src io.ReadSeeker, ext string, maxPixels int64) (string, error) {
+	mimeType, err := filetype.DetectReader(src)
+	if err != nil {
+		return "", err
+	}
+	if _, err := src.Seek(0, io.SeekStart); err != nil {
+		return "", err
+	}
+	if err := filetype.MatchExtension(mimeType, ext); err != nil {
+		return "", err
+	}
+
+	if filetype.IsImage(mimeType) {
+		data, err := io.ReadAll(src)
+		if err != nil {
+			return "", err
+		}
+		if err := filetype.CheckImage(data, maxPixels); err != nil {
+			return "", err
+		}
+		if _, err := src.Seek(0, io.SeekStart); err != nil {
+			return "", err
+		}
+	}
+
+	return mimeType, nil
+}
+
 // GetPrivateFile 获取私人文件信息
 func GetPrivateFile(fileID, userID uint, password string) (*models.PrivateFile, error) {
 	db := models.GetDB()
@@ -125,6 +223,9 @@ func GetPrivateFile(fileID, userID uint, password string) (*models.PrivateFile,
 	if err != nil {
 		return nil, err
 	}
+	if file.Status == models.FileStatusQuarantined {
+		return nil, ErrFileQuarantined
+	}
 
 	// 检查加密文件的密码
 	if file.IsEncrypted && file.Password != password {
@@ -255,6 +356,9 @@ func UpdatePrivateFileInfo(fileID, userID uint, fileName string, isEncrypted boo
 		fmt.Println("【更新文件错误】获取文件信息失败:", err)
 		return nil, err
 	}
+	if file.Status == models.FileStatusQuarantined {
+		return nil, ErrFileQuarantined
+	}
 
 	fmt.Println("【更新文件】当前文件信息:", "path=", file.StoragePath, "isEncrypted=", file.IsEncrypted)
 
@@ -0,0 +1,107 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"img_hosting/config"
+	"img_hosting/dao"
+	"img_hosting/models"
+)
+
+// ErrQuotaExceeded 上传后将超过存储配额
+var ErrQuotaExceeded = errors.New("存储空间不足，超过配额限制")
+
+// GetUserQuota 获取用户的有效存储配额（字节），返回 0 表示不限
+// 优先使用用户的个人配额，其次取所有角色配额中的最大值，都没有时使用默认配额
+func GetUserQuota(userID uint) (int64, error) {
+	db := models.GetDB()
+	cfg := config.GetConfig()
+
+	user, err := dao.GetUserByID(db, userID)
+	if err != nil {
+		return 0, err
+	}
+	if user.StorageQuota != nil {
+		return *user.StorageQuota, nil
+	}
+
+	found := false
+	var quota int64
+	for _, role := range user.Roles {
+		roleQuota, ok := cfg.Quota.Roles[role.RoleName]
+		if !ok {
+			continue
+		}
+		if roleQuota == 0 {
+			return 0, nil
+		}
+		if !found || roleQuota > quota {
+			quota = roleQuota
+		}
+		found = true
+	}
+	if !found {
+		return cfg.Quota.Default, nil
+	}
+	return quota, nil
+}
+
+// GetStorageUsage 获取用户的存储用量，按图片和私人文件分类统计
+func GetStorageUsage(userID uint) (*models.StorageUsage, error) {
+	db := models.GetDB()
+
+	images, err := dao.SumImageUsage(db, userID)
+	if err != nil {
+		return nil, fmt.Errorf("统计图片用量失败: %w", err)
+	}
+	files, err := dao.SumPrivateFileUsage(db, userID)
+	if err != nil {
+		return nil, fmt.Errorf("统计私人文件用量失败: %w", err)
+	}
+	quota, err := GetUserQuota(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	usage := &models.StorageUsage{
+		Used:         images.Bytes + files.Bytes,
+		Quota:        quota,
+		Unlimited:    quota == 0,
+		Images:       images,
+		PrivateFiles: files,
+	}
+	if !usage.Unlimited {
+		usage.Remaining = quota - usage.Used
+		if usage.Remaining < 0 {
+			usage.Remaining = 0
+		}
+	}
+	return usage, nil
+}
+
+// CheckStorageQuota 检查再上传 incoming 字节后是否会超过配额
+func CheckStorageQuota(userID uint, incoming int64) error {
+	usage, err := GetStorageUsage(userID)
+	if err != nil {
+		return err
+	}
+	if usage.Unlimited {
+		return nil
+	}
+	if usage.Used+incoming > usage.Quota {
+		return fmt.Errorf("%w: 已用 %d 字节，配额 %d 字节", ErrQuotaExceeded, usage.Used, usage.Quota)
+	}
+	return nil
+}
+
+// SetUserQuota 设置用户的个人存储配额，quota 为 nil 时恢复使用角色配额
+func SetUserQuota(userID uint, quota *int64) error {
+	if quota != nil && *quota < 0 {
+		return errors.New("配额不能为负数")
+	}
+	db := models.GetDB()
+	if _, err := dao.GetUserByID(db, userID); err != nil {
+		return err
+	}
+	return dao.UpdateUserQuota(db, userID, quota)
+}
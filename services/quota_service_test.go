@@ -0,0 +1,126 @@
+package services
+
+import (
+	"bytes"
+	"errors"
+	"img_hosting/config"
+	"img_hosting/models"
+	"testing"
+)
+
+// assignTestRoles 给用户分配角色，角色不存在时创建
+func assignTestRoles(t *testing.T, user *models.UserInfo, names ...string) {
+	t.Helper()
+	db := models.GetDB()
+	for _, name := range names {
+		role := models.Roles{RoleName: name, IsActive: true}
+		if err := db.Where("role_name = ?", name).FirstOrCreate(&role).Error; err != nil {
+			t.Fatal(err)
+		}
+		if err := db.Model(user).Association("Roles").Append(&role); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestGetUserQuota(t *testing.T) {
+	cfg := config.GetConfig()
+	oldDefault, oldRoles := cfg.Quota.Default, cfg.Quota.Roles
+	cfg.Quota.Default = 500
+	cfg.Quota.Roles = map[string]int64{"admin": 0, "user": 1000, "vip": 5000}
+	t.Cleanup(func() { cfg.Quota.Default, cfg.Quota.Roles = oldDefault, oldRoles })
+
+	tests := []struct {
+		name  string
+		roles []string
+		want  int64
+	}{
+		{"没有角色时使用默认配额", nil, 500},
+		{"未配置配额的角色使用默认配额", []string{"guest"}, 500},
+		{"角色配额", []string{"user"}, 1000},
+		{"多个角色取最大值", []string{"user", "vip"}, 5000},
+		{"任一角色不限时不限", []string{"vip", "admin"}, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			user := createTestUser(t)
+			assignTestRoles(t, user, tt.roles...)
+			got, err := GetUserQuota(user.UserID)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != tt.want {
+				t.Errorf("配额 = %d, want %d", got, tt.want)
+			}
+		})
+	}
+
+	// 个人配额优先于角色配额
+	user := createTestUser(t)
+	assignTestRoles(t, user, "admin")
+	quota := int64(42)
+	if err := SetUserQuota(user.UserID, &quota); err != nil {
+		t.Fatal(err)
+	}
+	if got, _ := GetUserQuota(user.UserID); got != 42 {
+		t.Errorf("个人配额 = %d, want 42", got)
+	}
+	if err := SetUserQuota(user.UserID, nil); err != nil {
+		t.Fatal(err)
+	}
+	if got, _ := GetUserQuota(user.UserID); got != 0 {
+		t.Errorf("恢复角色配额后 = %d, want 0", got)
+	}
+
+	negative := int64(-1)
+	if err := SetUserQuota(user.UserID, &negative); err == nil {
+		t.Error("负数配额应被拒绝")
+	}
+}
+
+func TestStorageQuotaBlocksUploads(t *testing.T) {
+	user := createTestUser(t)
+	quota := int64(100)
+	if err := SetUserQuota(user.UserID, &quota); err != nil {
+		t.Fatal(err)
+	}
+
+	upload := func(name string, size int) error {
+		content := bytes.Repeat([]byte("a"), size)
+		_, err := UploadPrivateFileReader(user.UserID, name, bytes.NewReader(content), int64(size), false, "")
+		return err
+	}
+
+	if err := upload("a.txt", 60); err != nil {
+		t.Fatalf("配额内上传失败: %v", err)
+	}
+	if err := upload("b.txt", 41); !errors.Is(err, ErrQuotaExceeded) {
+		t.Fatalf("超过配额时应返回 ErrQuotaExceeded，got %v", err)
+	}
+	// 恰好用满配额是允许的
+	if err := upload("c.txt", 40); err != nil {
+		t.Fatalf("恰好用满配额时应允许上传: %v", err)
+	}
+
+	usage, err := GetStorageUsage(user.UserID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if usage.Used != 100 || usage.Remaining != 0 || usage.Unlimited || usage.PrivateFiles.Count != 2 {
+		t.Errorf("用量 = %+v", usage)
+	}
+
+	// 图片上传同样计入配额
+	if _, _, err := UploadImageReader(user.UserID, "a.png", bytes.NewReader(testPNG(t, user.UserID)), ""); !errors.Is(err, ErrQuotaExceeded) {
+		t.Errorf("配额用完后上传图片应返回 ErrQuotaExceeded，got %v", err)
+	}
+
+	// 不限配额时不检查
+	unlimited := int64(0)
+	if err := SetUserQuota(user.UserID, &unlimited); err != nil {
+		t.Fatal(err)
+	}
+	if err := upload("d.txt", 1000); err != nil {
+		t.Errorf("不限配额时应允许上传: %v", err)
+	}
+}
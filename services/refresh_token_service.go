@@ -0,0 +1,167 @@
+package services
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"img_hosting/config"
+	"img_hosting/dao"
+	"img_hosting/models"
+	"img_hosting/pkg/logger"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// defaultRefreshTokenTTL 未配置时刷新令牌的有效期
+const defaultRefreshTokenTTL = 30 * 24 * time.Hour
+
+var (
+	ErrRefreshTokenInvalid = errors.New("刷新令牌无效或已过期")
+	ErrRefreshTokenReused  = errors.New("刷新令牌已被使用，请重新登录")
+)
+
+// IssueRefreshToken 登录成功后创建登录会话并签发刷新令牌，返回会话 ID 和刷新令牌
+// 会话 ID 即刷新令牌的令牌族，之后轮换出的刷新令牌都属于这个会话
+func IssueRefreshToken(userID uint, userAgent, ipAddress string) (string, string, error) {
+	sessionID, err := startSession(userID, userAgent, ipAddress)
+	if err != nil {
+		return "", "", err
+	}
+	refreshToken, err := createRefreshToken(userID, sessionID, userAgent, ipAddress)
+	if err != nil {
+		return "", "", err
+	}
+	return sessionID, refreshToken, nil
+}
+
+// RotateRefreshToken 用刷新令牌换取新的刷新令牌，旧令牌随即失效，返回用户 ID、会话 ID 和新的刷新令牌
+// 已轮换过的令牌再次出现说明令牌可能被盗用，整个令牌族都会被撤销
+func RotateRefreshToken(refreshToken, ipAddress string) (uint, string, string, error) {
+	db := models.GetDB()
+	log := logger.GetLogger()
+
+	token, err := dao.GetRefreshToken(db, hashRefreshToken(refreshToken))
+	if err != nil {
+		return 0, "", "", ErrRefreshTokenInvalid
+	}
+
+	if token.Status == models.TokenStatusRotated {
+		log.WithFields(logrus.Fields{
+			"user_id":   token.UserID,
+			"family_id": token.FamilyID,
+			"ip":        ipAddress,
+		}).Warn("检测到刷新令牌重复使用，撤销该登录的所有刷新令牌")
+		if err := endSession(db, token.FamilyID); err != nil {
+			return 0, "", "", err
+		}
+		return 0, "", "", ErrRefreshTokenReused
+	}
+	if token.Status != models.TokenStatusActive || token.ExpiresAt.Before(time.Now()) {
+		return 0, "", "", ErrRefreshTokenInvalid
+	}
+	if err := CheckUserActive(token.UserID); err != nil {
+		if errors.Is(err, ErrUserNotFound) {
+			return 0, "", "", ErrRefreshTokenInvalid
+		}
+		return 0, "", "", err
+	}
+
+	// 条件更新保证同一个令牌只能成功轮换一次
+	rotated, err := dao.MarkRefreshTokenRotated(db, token.Token)
+	if err != nil {
+		return 0, "", "", err
+	}
+	if !rotated {
+		log.WithFields(logrus.Fields{
+			"user_id":   token.UserID,
+			"family_id": token.FamilyID,
+		}).Warn("刷新令牌被并发使用，撤销该登录的所有刷新令牌")
+		if err := endSession(db, token.FamilyID); err != nil {
+			return 0, "", "", err
+		}
+		return 0, "", "", ErrRefreshTokenReused
+	}
+
+	if err := refreshSession(db, token, ipAddress); err != nil {
+		return 0, "", "", err
+	}
+	newToken, err := createRefreshToken(token.UserID, token.FamilyID, token.DeviceID, ipAddress)
+	if err != nil {
+		return 0, "", "", err
+	}
+	return token.UserID, token.FamilyID, newToken, nil
+}
+
+// RevokeRefreshToken 退出登录，撤销刷新令牌所在令牌族的所有令牌；令牌不存在时不做处理
+func RevokeRefreshToken(refreshToken string) error {
+	db := models.GetDB()
+	token, err := dao.GetRefreshToken(db, hashRefreshToken(refreshToken))
+	if err != nil {
+		return nil
+	}
+
+	logger.GetLogger().WithFields(logrus.Fields{
+		"user_id":   token.UserID,
+		"family_id": token.FamilyID,
+	}).Info("退出登录，撤销刷新令牌")
+	return endSession(db, token.FamilyID)
+}
+
+// createRefreshToken 生成刷新令牌，数据库中只保存哈希
+func createRefreshToken(userID uint, familyID, deviceID, ipAddress string) (string, error) {
+	refreshToken, err := randomToken(32)
+	if err != nil {
+		return "", err
+	}
+
+	err = dao.CreateRefreshToken(models.GetDB(), &models.Token{
+		Token:      hashRefreshToken(refreshToken),
+		UserID:     userID,
+		ExpiresAt:  time.Now().Add(refreshTokenTTL()),
+		DeviceID:   truncateString(deviceID, 255),
+		IPAddress:  ipAddress,
+		Status:     models.TokenStatusActive,
+		LastUsedAt: time.Now(),
+		FamilyID:   familyID,
+	})
+	if err != nil {
+		return "", err
+	}
+	return refreshToken, nil
+}
+
+// refreshTokenTTL 刷新令牌的有效期，每次刷新后重新计算
+func refreshTokenTTL() time.Duration {
+	ttl := time.Duration(config.GetConfig().JWT.RefreshTokenTTL) * time.Second
+	if ttl <= 0 {
+		ttl = defaultRefreshTokenTTL
+	}
+	return ttl
+}
+
+// hashRefreshToken 刷新令牌的 SHA256，避免数据库泄露后令牌被直接使用
+func hashRefreshToken(refreshToken string) string {
+	sum := sha256.Sum256([]byte(refreshToken))
+	return hex.EncodeToString(sum[:])
+}
+
+// randomToken 生成 n 字节的随机令牌（URL 安全的 base64）
+func randomToken(n int) (string, error) {
+	b, err := randomBytes(n)
+	if err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// randomBytes 生成 n 字节的随机数据
+func randomBytes(n int) ([]byte, error) {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		return nil, err
+	}
+	return b, nil
+}
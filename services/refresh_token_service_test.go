@@ -0,0 +1,137 @@
+package services
+
+import (
+	"errors"
+	"img_hosting/dao"
+	"img_hosting/models"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestRefreshTokenRotation(t *testing.T) {
+	user := createTestUser(t)
+	sessionID, first, err := IssueRefreshToken(user.UserID, "test-agent", "192.0.2.1")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	userID, gotSession, second, err := RotateRefreshToken(first, "192.0.2.2")
+	if err != nil {
+		t.Fatalf("轮换失败: %v", err)
+	}
+	if userID != user.UserID || gotSession != sessionID || second == first {
+		t.Fatalf("轮换结果 = %d, %s, %s", userID, gotSession, second)
+	}
+
+	// 数据库中只保存哈希
+	saved, err := dao.GetRefreshToken(models.GetDB(), hashRefreshToken(second))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if saved.Token == second || saved.FamilyID != sessionID || saved.Status != models.TokenStatusActive {
+		t.Errorf("保存的刷新令牌 = %+v", saved)
+	}
+
+	if _, _, _, err := RotateRefreshToken("no-such-token", "192.0.2.1"); !errors.Is(err, ErrRefreshTokenInvalid) {
+		t.Errorf("不存在的令牌应返回 ErrRefreshTokenInvalid，got %v", err)
+	}
+}
+
+func TestRefreshTokenReuseRevokesFamily(t *testing.T) {
+	user := createTestUser(t)
+	sessionID, first, err := IssueRefreshToken(user.UserID, "test-agent", "192.0.2.1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	otherSession, other, err := IssueRefreshToken(user.UserID, "other-agent", "192.0.2.1")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, _, second, err := RotateRefreshToken(first, "192.0.2.1")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// 已轮换的令牌再次使用，整个令牌族都被撤销
+	if _, _, _, err := RotateRefreshToken(first, "198.51.100.1"); !errors.Is(err, ErrRefreshTokenReused) {
+		t.Fatalf("重复使用应返回 ErrRefreshTokenReused，got %v", err)
+	}
+	if _, _, _, err := RotateRefreshToken(second, "192.0.2.1"); !errors.Is(err, ErrRefreshTokenInvalid) {
+		t.Errorf("令牌族被撤销后新令牌也应失效，got %v", err)
+	}
+	if err := ValidateAccessToken(user.UserID, "", sessionID, time.Now()); !errors.Is(err, ErrSessionRevoked) {
+		t.Errorf("会话的访问令牌应失效，got %v", err)
+	}
+
+	// 同一用户的其他登录不受影响
+	if err := ValidateAccessToken(user.UserID, "", otherSession, time.Now()); err != nil {
+		t.Errorf("其他会话不应受影响: %v", err)
+	}
+	if _, _, _, err := RotateRefreshToken(other, "192.0.2.1"); err != nil {
+		t.Errorf("其他会话的刷新令牌不应受影响: %v", err)
+	}
+}
+
+func TestRefreshTokenConcurrentRotation(t *testing.T) {
+	user := createTestUser(t)
+	_, token, err := IssueRefreshToken(user.UserID, "test-agent", "192.0.2.1")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// 同一个令牌并发轮换时只能成功一次
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	success := 0
+	for i := 0; i < 5; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, _, _, err := RotateRefreshToken(token, "192.0.2.1")
+			mu.Lock()
+			defer mu.Unlock()
+			switch {
+			case err == nil:
+				success++
+			case errors.Is(err, ErrRefreshTokenReused), errors.Is(err, ErrRefreshTokenInvalid):
+			default:
+				t.Errorf("意外的错误: %v", err)
+			}
+		}()
+	}
+	wg.Wait()
+	if success > 1 {
+		t.Errorf("并发轮换成功了 %d 次，最多 1 次", success)
+	}
+}
+
+func TestRefreshTokenExpiredAndRevoked(t *testing.T) {
+	user := createTestUser(t)
+	_, expired, err := IssueRefreshToken(user.UserID, "test-agent", "192.0.2.1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := models.GetDB().Model(&models.Token{}).Where("token = ?", hashRefreshToken(expired)).
+		Update("expires_at", time.Now().Add(-time.Minute)).Error; err != nil {
+		t.Fatal(err)
+	}
+	if _, _, _, err := RotateRefreshToken(expired, "192.0.2.1"); !errors.Is(err, ErrRefreshTokenInvalid) {
+		t.Errorf("过期的令牌应返回 ErrRefreshTokenInvalid，got %v", err)
+	}
+
+	sessionID, loggedOut, err := IssueRefreshToken(user.UserID, "test-agent", "192.0.2.1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := RevokeRefreshToken(loggedOut); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, _, err := RotateRefreshToken(loggedOut, "192.0.2.1"); !errors.Is(err, ErrRefreshTokenInvalid) {
+		t.Errorf("退出登录后的令牌应返回 ErrRefreshTokenInvalid，got %v", err)
+	}
+	if err := ValidateAccessToken(user.UserID, "", sessionID, time.Now()); !errors.Is(err, ErrSessionRevoked) {
+		t.Errorf("退出登录后访问令牌应失效，got %v", err)
+	}
+}
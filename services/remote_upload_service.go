@@ -0,0 +1,89 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"img_hosting/config"
+	"img_hosting/pkg/fetcher"
+	"img_hosting/pkg/filetype"
+	"img_hosting/pkg/logger"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+var (
+	imageFetcher      *fetcher.Fetcher
+	imageFetcherMutex sync.Mutex
+)
+
+// GetImageFetcher 获取 URL 上传使用的下载器，首次调用时根据配置创建
+func GetImageFetcher() *fetcher.Fetcher {
+	imageFetcherMutex.Lock()
+	defer imageFetcherMutex.Unlock()
+
+	if imageFetcher != nil {
+		return imageFetcher
+	}
+
+	cfg := config.GetConfig()
+	maxRedirects := cfg.Upload.RemoteMaxRedirects
+	if maxRedirects == 0 {
+		maxRedirects = fetcher.DefaultMaxRedirects
+	}
+	imageFetcher = fetcher.New(cfg.Upload.MaxSize, time.Duration(cfg.Upload.RemoteTimeout)*time.Second, maxRedirects)
+	imageFetcher.AllowPrivate = cfg.Upload.RemoteAllowPrivate
+	return imageFetcher
+}
+
+// SetImageFetcher 替换 URL 上传使用的下载器，例如测试时允许访问 httptest 服务器
+func SetImageFetcher(f *fetcher.Fetcher) {
+	imageFetcherMutex.Lock()
+	imageFetcher = f
+	imageFetcherMutex.Unlock()
+}
+
+// UploadImageFromURL 服务端下载远程图片后按普通上传流程保存
+func UploadImageFromURL(ctx context.Context, userID uint, rawURL, description string) (uint, string, error) {
+	log := logger.GetLogger().WithFields(logrus.Fields{
+		"user_id": userID,
+		"url":     rawURL,
+	})
+	log.Info("开始下载远程图片")
+
+	result, err := GetImageFetcher().Fetch(ctx, rawURL)
+	if err != nil {
+		log.WithError(err).Warn("下载远程图片失败")
+		return 0, "", err
+	}
+
+	fileName := remoteImageName(result.FileName, result.Data)
+	log.WithFields(logrus.Fields{
+		"final_url": result.FinalURL,
+		"filename":  fileName,
+		"size":      len(result.Data),
+	}).Info("远程图片下载完成")
+
+	return UploadImageReader(userID, fileName, bytes.NewReader(result.Data), description)
+}
+
+// remoteImageName 远程文件名没有扩展名或扩展名与内容不符时，按实际内容补全扩展名
+func remoteImageName(name string, data []byte) string {
+	name = strings.TrimSpace(name)
+	ext := filepath.Ext(name)
+	base := strings.TrimSuffix(name, ext)
+	if base == "" {
+		base = "remote"
+	}
+
+	if err := filetype.MatchExtension(filetype.Detect(data), ext); err == nil {
+		return base + ext
+	}
+	if detected := filetype.DetectExtension(data); detected != "" {
+		return base + detected
+	}
+	return base + ext
+}
@@ -0,0 +1,445 @@
+package services
+
+import (
+	"bytes"
+	"crypto/md5"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"img_hosting/config"
+	"img_hosting/dao"
+	"img_hosting/models"
+	"img_hosting/pkg/logger"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// S3 接口提供的 bucket，每个用户只能看到自己的对象
+const (
+	S3BucketImages  = "images"  // 对应 Image，上传流程与普通图片上传相同
+	S3BucketPrivate = "private" // 对应 PrivateFile
+)
+
+// maxS3KeyLength 对象键的最大长度
+const maxS3KeyLength = 512
+
+var (
+	ErrS3NoSuchBucket  = errors.New("bucket 不存在")
+	ErrS3NoSuchKey     = errors.New("对象不存在")
+	ErrS3InvalidKey    = errors.New("无效的对象键")
+	ErrS3TooLarge      = errors.New("对象大小超过限制")
+	ErrS3AccessDenied  = errors.New("没有权限执行该操作")
+	ErrS3Encrypted     = errors.New("加密文件不能通过 S3 接口下载")
+	ErrS3InvalidAccess = errors.New("访问密钥不存在或已过期")
+)
+
+// S3Object S3 接口中的对象
+type S3Object struct {
+	Key          string
+	Size         int64
+	ETag         string
+	ContentType  string
+	LastModified time.Time
+	// Path 对象内容的本地文件路径
+	Path string
+}
+
+// S3ListOptions 列出对象的参数
+type S3ListOptions struct {
+	Prefix     string
+	Delimiter  string
+	StartAfter string // 只返回键大于该值的对象（V1 的 marker 和 V2 的 continuation-token/start-after）
+	MaxKeys    int
+}
+
+// S3ListResult 列出对象的结果
+type S3ListResult struct {
+	Objects        []S3Object
+	CommonPrefixes []string
+	IsTruncated    bool
+	// NextMarker 结果被截断时最后一个返回的键或公共前缀，下次从它之后继续
+	NextMarker string
+}
+
+// S3Buckets 返回 S3 接口提供的 bucket 列表
+func S3Buckets() []string {
+	return []string{S3BucketImages, S3BucketPrivate}
+}
+
+// IsS3Bucket 判断 bucket 是否存在
+func IsS3Bucket(bucket string) bool {
+	return bucket == S3BucketImages || bucket == S3BucketPrivate
+}
+
+// LookupS3Credential 根据访问密钥 ID 查找有效的 token，token 本身作为私有密钥
+func LookupS3Credential(accessKeyID string) (*models.Token, error) {
+	db := models.GetDB()
+	token, err := dao.GetTokenByAccessKey(db, accessKeyID)
+	if err != nil {
+		return nil, ErrS3InvalidAccess
+	}
+	if token.ExpiresAt.Before(time.Now()) {
+		return nil, ErrS3InvalidAccess
+	}
+	if err := CheckUserActive(token.UserID); err != nil {
+		return nil, ErrS3InvalidAccess
+	}
+	dao.UpdateTokenLastUsed(db, token.Token)
+	return token, nil
+}
+
+// S3BucketScope 返回访问 bucket 需要的令牌范围
+func S3BucketScope(bucket string) string {
+	if bucket == S3BucketPrivate {
+		return ScopeFiles
+	}
+	return ScopeImages
+}
+
+// PutS3Object 上传对象，已存在同名对象时覆盖
+// 图片和私人文件都按内容哈希去重，内容与已有对象相同时直接返回已有对象
+func PutS3Object(userID uint, bucket, key string, body io.Reader) (*S3Object, error) {
+	if err := validateS3Key(key); err != nil {
+		return nil, err
+	}
+
+	log := logger.GetLogger().WithFields(logrus.Fields{
+		"user_id": userID,
+		"bucket":  bucket,
+		"key":     key,
+	})
+	log.Info("S3 上传对象")
+
+	switch bucket {
+	case S3BucketImages:
+		return putS3Image(userID, key, body)
+	case S3BucketPrivate:
+		return putS3PrivateFile(userID, key, body)
+	}
+	return nil, ErrS3NoSuchBucket
+}
+
+// putS3Image 以图片形式保存对象
+func putS3Image(userID uint, key string, body io.Reader) (*S3Object, error) {
+	db := models.GetDB()
+
+	permissions, err := dao.UserHasPermissions(userID, []string{"upload_img"})
+	if err != nil {
+		return nil, err
+	}
+	if !permissions["upload_img"] {
+		return nil, ErrS3AccessDenied
+	}
+
+	data, err := io.ReadAll(io.LimitReader(body, maxImageSize+1))
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(data)) > maxImageSize {
+		return nil, ErrS3TooLarge
+	}
+
+	existing, err := findS3Image(userID, key)
+	if err != nil {
+		return nil, err
+	}
+	if existing != nil && existing.HashImage == HashFileName(data) {
+		return imageToS3Object(existing, key), nil
+	}
+
+	imageID, _, err := UploadImageReader(userID, path.Base(key), bytes.NewReader(data), "")
+	if err != nil {
+		return nil, err
+	}
+	if err := dao.SetImageObjectKey(db, imageID, key); err != nil {
+		return nil, err
+	}
+
+	// 新对象保存成功后再删除被覆盖的旧对象
+	if existing != nil {
+		if err := DeleteImage(existing.ImageID, userID); err != nil {
+			logger.GetLogger().WithError(err).WithField("image_id", existing.ImageID).Error("删除被覆盖的图片失败")
+		}
+	}
+
+	image, err := dao.GetImageByID(db, imageID)
+	if err != nil {
+		return nil, err
+	}
+	return imageToS3Object(image, key), nil
+}
+
+// putS3PrivateFile 以私人文件形式保存对象，内容先写入临时文件以便扫描和校验时回读
+func putS3PrivateFile(userID uint, key string, body io.Reader) (*S3Object, error) {
+	maxSize := config.GetConfig().PrivateFiles.MaxSize
+
+	tmp, err := os.CreateTemp("", "s3-upload-*")
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		tmp.Close()
+		os.Remove(tmp.Name())
+	}()
+
+	hash := md5.New()
+	size, err := io.Copy(io.MultiWriter(tmp, hash), io.LimitReader(body, maxSize+1))
+	if err != nil {
+		return nil, err
+	}
+	if size > maxSize {
+		return nil, ErrS3TooLarge
+	}
+	if _, err := tmp.Seek(0, io.SeekStart); err != nil {
+		return nil, err
+	}
+
+	file, err := savePrivateFileObject(userID, key, tmp, size, hex.EncodeToString(hash.Sum(nil)))
+	if err != nil {
+		return nil, err
+	}
+	return privateFileToS3Object(file, key), nil
+}
+
+// savePrivateFileObject 以对象键保存私人文件，S3 和 WebDAV 共用
+// 同一个键的内容未变化时直接返回已有文件；内容变化时新文件保存成功后再删除旧文件
+func savePrivateFileObject(userID uint, key string, src io.ReadSeeker, size int64, fileHash string) (*models.PrivateFile, error) {
+	existing, err := findS3PrivateFile(userID, key)
+	if err != nil {
+		return nil, err
+	}
+	if existing != nil && existing.FileHash == fileHash {
+		return existing, nil
+	}
+
+	file, err := UploadPrivateFileReader(userID, path.Base(key), src, size, false, "")
+	if err != nil {
+		return nil, err
+	}
+	if err := dao.SetPrivateFileObjectKey(models.GetDB(), file.ID, key); err != nil {
+		return nil, err
+	}
+	file.ObjectKey = key
+
+	if existing != nil {
+		if err := DeletePrivateFile(existing.ID, userID); err != nil {
+			logger.GetLogger().WithError(err).WithField("file_id", existing.ID).Error("删除被覆盖的文件失败")
+		}
+	}
+	return file, nil
+}
+
+// GetS3Object 获取对象信息和内容所在的本地路径
+func GetS3Object(userID uint, bucket, key string) (*S3Object, error) {
+	switch bucket {
+	case S3BucketImages:
+		image, err := findS3Image(userID, key)
+		if err != nil {
+			return nil, err
+		}
+		if image == nil {
+			return nil, ErrS3NoSuchKey
+		}
+		return imageToS3Object(image, key), nil
+
+	case S3BucketPrivate:
+		file, err := findS3PrivateFile(userID, key)
+		if err != nil {
+			return nil, err
+		}
+		if file == nil {
+			return nil, ErrS3NoSuchKey
+		}
+		if file.IsEncrypted {
+			return nil, ErrS3Encrypted
+		}
+		return privateFileToS3Object(file, key), nil
+	}
+	return nil, ErrS3NoSuchBucket
+}
+
+// DeleteS3Object 删除对象，对象不存在时视为成功（与 S3 一致）
+func DeleteS3Object(userID uint, bucket, key string) error {
+	switch bucket {
+	case S3BucketImages:
+		image, err := findS3Image(userID, key)
+		if err != nil || image == nil {
+			return err
+		}
+		return DeleteImage(image.ImageID, userID)
+
+	case S3BucketPrivate:
+		file, err := findS3PrivateFile(userID, key)
+		if err != nil || file == nil {
+			return err
+		}
+		return DeletePrivateFile(file.ID, userID)
+	}
+	return ErrS3NoSuchBucket
+}
+
+// ListS3Objects 按键的字典序列出对象，支持前缀、分隔符和分页
+func ListS3Objects(userID uint, bucket string, opts S3ListOptions) (*S3ListResult, error) {
+	var objects []S3Object
+	db := models.GetDB()
+
+	switch bucket {
+	case S3BucketImages:
+		images, err := dao.ListUserImageObjects(db, userID)
+		if err != nil {
+			return nil, err
+		}
+		for i := range images {
+			objects = append(objects, *imageToS3Object(&images[i], imageObjectKey(&images[i])))
+		}
+	case S3BucketPrivate:
+		files, err := dao.ListUserPrivateFileObjects(db, userID)
+		if err != nil {
+			return nil, err
+		}
+		for i := range files {
+			objects = append(objects, *privateFileToS3Object(&files[i], privateFileObjectKey(&files[i])))
+		}
+	default:
+		return nil, ErrS3NoSuchBucket
+	}
+
+	sort.Slice(objects, func(i, j int) bool { return objects[i].Key < objects[j].Key })
+	return paginateS3Objects(objects, opts), nil
+}
+
+// paginateS3Objects 按前缀筛选，按分隔符合并公共前缀，并截取一页
+func paginateS3Objects(objects []S3Object, opts S3ListOptions) *S3ListResult {
+	result := &S3ListResult{}
+	seenPrefixes := make(map[string]bool)
+	count := 0
+
+	for _, obj := range objects {
+		if !strings.HasPrefix(obj.Key, opts.Prefix) || obj.Key <= opts.StartAfter {
+			continue
+		}
+
+		// 前缀之后还有分隔符的键合并为公共前缀
+		commonPrefix := ""
+		if opts.Delimiter != "" {
+			if i := strings.Index(obj.Key[len(opts.Prefix):], opts.Delimiter); i >= 0 {
+				commonPrefix = obj.Key[:len(opts.Prefix)+i+len(opts.Delimiter)]
+			}
+		}
+		if commonPrefix != "" && (seenPrefixes[commonPrefix] || commonPrefix <= opts.StartAfter) {
+			continue
+		}
+
+		if count >= opts.MaxKeys {
+			result.IsTruncated = true
+			break
+		}
+		count++
+
+		if commonPrefix != "" {
+			seenPrefixes[commonPrefix] = true
+			result.CommonPrefixes = append(result.CommonPrefixes, commonPrefix)
+			result.NextMarker = commonPrefix
+			continue
+		}
+		result.Objects = append(result.Objects, obj)
+		result.NextMarker = obj.Key
+	}
+
+	if !result.IsTruncated {
+		result.NextMarker = ""
+	}
+	return result
+}
+
+// findS3Image 按对象键查找图片，找不到时返回 nil
+func findS3Image(userID uint, key string) (*models.Image, error) {
+	hash, ext := splitHashKey(key)
+	return dao.GetImageObject(models.GetDB(), userID, key, hash, ext)
+}
+
+// findS3PrivateFile 按对象键查找私人文件，找不到时返回 nil
+func findS3PrivateFile(userID uint, key string) (*models.PrivateFile, error) {
+	hash, _ := splitHashKey(key)
+	file, err := dao.GetPrivateFileObject(models.GetDB(), userID, key, hash)
+	if err != nil || file == nil {
+		return nil, err
+	}
+	// 按哈希匹配到的文件还要核对扩展名
+	if file.ObjectKey != key && privateFileObjectKey(file) != key {
+		return nil, nil
+	}
+	return file, nil
+}
+
+// splitHashKey 解析 哈希+扩展名 格式的对象键，不符合时返回空字符串
+func splitHashKey(key string) (string, string) {
+	ext := strings.ToLower(filepath.Ext(key))
+	hash := strings.TrimSuffix(key, filepath.Ext(key))
+	if len(hash) != md5.Size*2 {
+		return "", ""
+	}
+	if _, err := hex.DecodeString(hash); err != nil {
+		return "", ""
+	}
+	return hash, ext
+}
+
+// imageObjectKey 图片的对象键，没有通过 S3 上传的图片使用 哈希+扩展名
+func imageObjectKey(image *models.Image) string {
+	if image.ObjectKey != "" {
+		return image.ObjectKey
+	}
+	return image.HashImage + image.Imageextenion
+}
+
+// privateFileObjectKey 私人文件的对象键，没有通过 S3 上传的文件使用 哈希+扩展名
+func privateFileObjectKey(file *models.PrivateFile) string {
+	if file.ObjectKey != "" {
+		return file.ObjectKey
+	}
+	return file.FileHash + strings.ToLower(filepath.Ext(file.FileName))
+}
+
+func imageToS3Object(image *models.Image, key string) *S3Object {
+	cfg := config.GetConfig()
+	return &S3Object{
+		Key:          key,
+		Size:         image.ImageSize,
+		ETag:         image.HashImage,
+		ContentType:  image.ImageType,
+		LastModified: image.UploadTime,
+		Path:         filepath.Join(cfg.Upload.Path, image.HashImage+image.Imageextenion),
+	}
+}
+
+func privateFileToS3Object(file *models.PrivateFile, key string) *S3Object {
+	return &S3Object{
+		Key:          key,
+		Size:         file.FileSize,
+		ETag:         file.FileHash,
+		ContentType:  file.FileType,
+		LastModified: file.UpdatedAt,
+		Path:         file.StoragePath,
+	}
+}
+
+// validateS3Key 检查对象键，文件名部分会作为图片或文件的名称
+func validateS3Key(key string) error {
+	if key == "" || len(key) > maxS3KeyLength || strings.HasSuffix(key, "/") {
+		return fmt.Errorf("%w: %s", ErrS3InvalidKey, key)
+	}
+	for _, r := range key {
+		if r < 0x20 || r == 0x7f {
+			return fmt.Errorf("%w: 包含控制字符", ErrS3InvalidKey)
+		}
+	}
+	return nil
+}
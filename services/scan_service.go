@@ -0,0 +1,213 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"img_hosting/config"
+	"img_hosting/dao"
+	"img_hosting/models"
+	"img_hosting/pkg/logger"
+	"img_hosting/pkg/scanner"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// ErrFileQuarantined 上传的文件命中恶意特征，已被隔离
+var ErrFileQuarantined = errors.New("文件包含恶意内容，已被隔离")
+
+var (
+	fileScanner      scanner.Scanner
+	fileScannerMutex sync.Mutex
+)
+
+// GetFileScanner 获取文件扫描器，首次调用时根据配置创建
+func GetFileScanner() scanner.Scanner {
+	fileScannerMutex.Lock()
+	defer fileScannerMutex.Unlock()
+
+	if fileScanner != nil {
+		return fileScanner
+	}
+
+	cfg := config.GetConfig()
+	if !cfg.Scanner.Enabled {
+		fileScanner = scanner.NoopScanner{}
+		return fileScanner
+	}
+
+	switch cfg.Scanner.Type {
+	case "", "clamd":
+		timeout := time.Duration(cfg.Scanner.Timeout) * time.Second
+		fileScanner = scanner.NewClamdScanner(cfg.Scanner.Network, cfg.Scanner.Address, timeout)
+	default:
+		logger.GetLogger().WithField("type", cfg.Scanner.Type).Warn("未知的扫描器类型，已禁用扫描")
+		fileScanner = scanner.NoopScanner{}
+	}
+	return fileScanner
+}
+
+// SetFileScanner 替换文件扫描器，用于接入其他扫描引擎
+func SetFileScanner(s scanner.Scanner) {
+	fileScannerMutex.Lock()
+	fileScanner = s
+	fileScannerMutex.Unlock()
+}
+
+// scanUpload 扫描上传内容，返回扫描状态和结果描述
+func scanUpload(r io.Reader) (string, string, error) {
+	s := GetFileScanner()
+	if _, ok := s.(scanner.NoopScanner); ok {
+		return models.ScanStatusSkipped, "", nil
+	}
+
+	cfg := config.GetConfig()
+	ctx := context.Background()
+	if cfg.Scanner.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, time.Duration(cfg.Scanner.Timeout)*time.Second)
+		defer cancel()
+	}
+
+	result, err := s.Scan(ctx, r)
+	if err != nil {
+		if cfg.Scanner.FailOpen {
+			logger.GetLogger().WithError(err).Warn("文件扫描失败，按配置放行")
+			return models.ScanStatusError, err.Error(), nil
+		}
+		return "", "", fmt.Errorf("文件安全扫描失败: %w", err)
+	}
+
+	if result.Infected {
+		return models.ScanStatusInfected, result.Signature, nil
+	}
+	return models.ScanStatusClean, "", nil
+}
+
+// quarantineUpload 把命中恶意特征的上传文件写入隔离区并记录
+func quarantineUpload(src io.ReadSeeker, file *models.PrivateFile) error {
+	cfg := config.GetConfig()
+	log := logger.GetLogger()
+
+	quarantineDir := filepath.Join(cfg.Scanner.QuarantinePath, fmt.Sprintf("user_%d", file.UserID))
+	if err := os.MkdirAll(quarantineDir, 0700); err != nil {
+		return err
+	}
+	file.StoragePath = filepath.Join(quarantineDir, file.FileHash+strings.ToLower(filepath.Ext(file.FileName)))
+
+	if _, err := src.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+	dst, err := os.OpenFile(file.StoragePath, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0600)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(dst, src); err != nil {
+		dst.Close()
+		os.Remove(file.StoragePath)
+		return err
+	}
+	dst.Close()
+
+	file.Status = models.FileStatusQuarantined
+	if err := dao.CreatePrivateFile(models.GetDB(), file); err != nil {
+		os.Remove(file.StoragePath)
+		return err
+	}
+
+	log.WithFields(logrus.Fields{
+		"file_id":   file.ID,
+		"user_id":   file.UserID,
+		"signature": file.ScanResult,
+	}).Warn("上传文件命中恶意特征，已隔离")
+
+	return ErrFileQuarantined
+}
+
+// ListQuarantinedFiles 获取隔离区中的文件（管理员用）
+func ListQuarantinedFiles(page, pageSize int) ([]models.PrivateFile, int64, error) {
+	return dao.ListPrivateFilesByStatus(models.GetDB(), models.FileStatusQuarantined, page, pageSize)
+}
+
+// ReleaseQuarantinedFile 将文件移出隔离区，恢复为正常文件
+func ReleaseQuarantinedFile(fileID, adminID uint) (*models.PrivateFile, error) {
+	cfg := config.GetConfig()
+	db := models.GetDB()
+
+	file, err := dao.GetPrivateFileByStatus(db, fileID, models.FileStatusQuarantined)
+	if err != nil {
+		return nil, err
+	}
+
+	uploadDir := filepath.Join(cfg.PrivateFiles.Path, fmt.Sprintf("user_%d", file.UserID))
+	if err := os.MkdirAll(uploadDir, 0755); err != nil {
+		return nil, err
+	}
+	targetPath := filepath.Join(uploadDir, file.FileHash+strings.ToLower(filepath.Ext(file.FileName)))
+	if err := moveFile(file.StoragePath, targetPath); err != nil {
+		return nil, fmt.Errorf("移出隔离区失败: %w", err)
+	}
+
+	file.StoragePath = targetPath
+	file.Status = models.FileStatusActive
+	file.ScanStatus = models.ScanStatusReleased
+	if err := dao.UpdatePrivateFileScan(db, file); err != nil {
+		return nil, err
+	}
+
+	logger.GetLogger().WithFields(logrus.Fields{
+		"file_id":  file.ID,
+		"user_id":  file.UserID,
+		"admin_id": adminID,
+	}).Warn("管理员已放行隔离文件")
+
+	return file, nil
+}
+
+// DeleteQuarantinedFile 永久删除隔离区中的文件
+func DeleteQuarantinedFile(fileID uint) error {
+	db := models.GetDB()
+
+	file, err := dao.GetPrivateFileByStatus(db, fileID, models.FileStatusQuarantined)
+	if err != nil {
+		return err
+	}
+	if err := deleteFile(file.StoragePath); err != nil {
+		return err
+	}
+	return dao.DeletePrivateFile(db, file.ID, file.UserID)
+}
+
+// moveFile 移动文件，跨设备时退化为复制后删除
+func moveFile(src, dst string) error {
+	if err := os.Rename(src, dst); err == nil {
+		return nil
+	}
+
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	out, err := os.Create(dst)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		os.Remove(dst)
+		return err
+	}
+	if err := out.Close(); err != nil {
+		return err
+	}
+	in.Close()
+	return os.Remove(src)
+}
@@ -0,0 +1,170 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"img_hosting/config"
+	"img_hosting/models"
+	"img_hosting/pkg/scanner"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// stubScanner 按内容是否包含 signature 判定是否感染
+type stubScanner struct {
+	signature string
+	err       error
+}
+
+func (s stubScanner) Scan(ctx context.Context, r io.Reader) (*scanner.Result, error) {
+	if s.err != nil {
+		return nil, s.err
+	}
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	if bytes.Contains(data, []byte(s.signature)) {
+		return &scanner.Result{Infected: true, Signature: "Eicar-Test-Signature", Engine: "stub"}, nil
+	}
+	return &scanner.Result{Engine: "stub"}, nil
+}
+
+func (stubScanner) Name() string { return "stub" }
+
+func useScanner(t *testing.T, s scanner.Scanner) {
+	t.Helper()
+	SetFileScanner(s)
+	t.Cleanup(func() { SetFileScanner(nil) })
+}
+
+func TestUploadInfectedFileIsQuarantined(t *testing.T) {
+	useScanner(t, stubScanner{signature: "EICAR"})
+	user := createTestUser(t)
+	content := []byte("X5O!P%@AP EICAR test file")
+
+	_, err := UploadPrivateFileReader(user.UserID, "notes.txt", bytes.NewReader(content), int64(len(content)), false, "")
+	if !errors.Is(err, ErrFileQuarantined) {
+		t.Fatalf("感染文件应被隔离，got %v", err)
+	}
+
+	file := findQuarantinedFile(t, user.UserID)
+	if _, err := GetPrivateFile(file.ID, user.UserID, ""); !errors.Is(err, ErrFileQuarantined) {
+		t.Fatalf("用户不应能访问隔离文件，got %v", err)
+	}
+	if file.ScanStatus != models.ScanStatusInfected || file.ScanResult != "Eicar-Test-Signature" || file.ScannedAt == nil {
+		t.Errorf("扫描记录不正确: %+v", file)
+	}
+	quarantineDir, _ := filepath.Abs(config.GetConfig().Scanner.QuarantinePath)
+	storagePath, _ := filepath.Abs(file.StoragePath)
+	if !strings.HasPrefix(storagePath, quarantineDir) {
+		t.Errorf("文件应写入隔离目录，got %s", file.StoragePath)
+	}
+	if data, err := os.ReadFile(file.StoragePath); err != nil || !bytes.Equal(data, content) {
+		t.Errorf("隔离文件内容不正确: %q, %v", data, err)
+	}
+
+	// 放行后文件移回私人文件目录并出现在用户文件列表中
+	released, err := ReleaseQuarantinedFile(file.ID, 1)
+	if err != nil {
+		t.Fatalf("放行失败: %v", err)
+	}
+	if released.Status != models.FileStatusActive || released.ScanStatus != models.ScanStatusReleased {
+		t.Errorf("放行后状态不正确: %+v", released)
+	}
+	if _, err := os.Stat(file.StoragePath); !os.IsNotExist(err) {
+		t.Error("放行后隔离区中的文件应被移走")
+	}
+	if data, err := os.ReadFile(released.StoragePath); err != nil || !bytes.Equal(data, content) {
+		t.Errorf("放行后文件内容不正确: %q, %v", data, err)
+	}
+	if _, err := GetPrivateFile(released.ID, user.UserID, ""); err != nil {
+		t.Errorf("放行后用户应能访问文件: %v", err)
+	}
+	if _, err := ReleaseQuarantinedFile(file.ID, 1); err == nil {
+		t.Error("已放行的文件不应再次放行")
+	}
+}
+
+func TestDeleteQuarantinedFile(t *testing.T) {
+	useScanner(t, stubScanner{signature: "EICAR"})
+	user := createTestUser(t)
+	content := []byte("EICAR")
+
+	if _, err := UploadPrivateFileReader(user.UserID, "eicar.txt", bytes.NewReader(content), int64(len(content)), false, ""); !errors.Is(err, ErrFileQuarantined) {
+		t.Fatalf("感染文件应被隔离，got %v", err)
+	}
+	file := findQuarantinedFile(t, user.UserID)
+
+	if err := DeleteQuarantinedFile(file.ID); err != nil {
+		t.Fatalf("删除失败: %v", err)
+	}
+	if _, err := os.Stat(file.StoragePath); !os.IsNotExist(err) {
+		t.Error("隔离文件应从磁盘删除")
+	}
+	if _, err := ReleaseQuarantinedFile(file.ID, 1); err == nil {
+		t.Error("已删除的文件不应还能放行")
+	}
+}
+
+func TestUploadCleanFileIsStored(t *testing.T) {
+	useScanner(t, stubScanner{signature: "EICAR"})
+	user := createTestUser(t)
+	content := []byte("just some notes")
+
+	file, err := UploadPrivateFileReader(user.UserID, "notes.txt", bytes.NewReader(content), int64(len(content)), false, "")
+	if err != nil {
+		t.Fatalf("上传失败: %v", err)
+	}
+	if file.Status != models.FileStatusActive || file.ScanStatus != models.ScanStatusClean {
+		t.Errorf("文件状态不正确: %+v", file)
+	}
+}
+
+func TestUploadScannerFailure(t *testing.T) {
+	useScanner(t, stubScanner{err: errors.New("clamd 不可用")})
+	user := createTestUser(t)
+	content := []byte("just some notes")
+
+	if _, err := UploadPrivateFileReader(user.UserID, "notes.txt", bytes.NewReader(content), int64(len(content)), false, ""); err == nil {
+		t.Fatal("扫描器不可用且未开启 fail_open 时应拒绝上传")
+	}
+
+	cfg := config.GetConfig()
+	cfg.Scanner.FailOpen = true
+	t.Cleanup(func() { cfg.Scanner.FailOpen = false })
+
+	file, err := UploadPrivateFileReader(user.UserID, "notes.txt", bytes.NewReader(content), int64(len(content)), false, "")
+	if err != nil {
+		t.Fatalf("开启 fail_open 后应放行上传: %v", err)
+	}
+	if file.ScanStatus != models.ScanStatusError {
+		t.Errorf("扫描状态 = %s, want %s", file.ScanStatus, models.ScanStatusError)
+	}
+}
+
+// findQuarantinedFile 查找用户在隔离区中唯一的文件
+func findQuarantinedFile(t *testing.T, userID uint) *models.PrivateFile {
+	t.Helper()
+	files, _, err := ListQuarantinedFiles(1, 100)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var found *models.PrivateFile
+	for i := range files {
+		if files[i].UserID == userID {
+			if found != nil {
+				t.Fatal("隔离区中有多个该用户的文件")
+			}
+			found = &files[i]
+		}
+	}
+	if found == nil {
+		t.Fatal("隔离区中没有该用户的文件")
+	}
+	return found
+}
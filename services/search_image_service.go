@@ -71,8 +71,8 @@ func GetAllimage(user_id uint, enablePaging bool, page, pageSize int, order stri
 	return &result, nil
 }
 
-// ListAllImages 获取所有图片
-func ListAllImages(page, pageSize int) ([]models.Image, int64, error) {
+// ListAllImages 获取所有图片，colorFamily 不为空时按主色分类筛选
+func ListAllImages(colorFamily string, page, pageSize int) ([]models.Image, int64, error) {
 	db := models.GetDB()
-	return dao.ListAllImages(db, page, pageSize)
+	return dao.ListAllImages(db, colorFamily, page, pageSize)
 }
@@ -0,0 +1,367 @@
+package services
+
+import (
+	"errors"
+	"img_hosting/dao"
+	"img_hosting/models"
+	"img_hosting/pkg/cache"
+	"img_hosting/pkg/logger"
+	"img_hosting/pkg/useragent"
+	"sync"
+	"sync/atomic"
+	"time"
+	"unicode/utf8"
+
+	"github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+)
+
+var (
+	ErrUserDisabled    = errors.New("账号已被禁用")
+	ErrUserNotFound    = errors.New("用户不存在")
+	ErrSessionRevoked  = errors.New("登录已失效，请重新登录")
+	ErrSessionNotFound = errors.New("登录会话不存在或已失效")
+)
+
+// sessionTouchInterval 同一会话两次记录使用时间的最短间隔，避免每个请求都写数据库
+const sessionTouchInterval = time.Minute
+
+var (
+	sessionTouches         sync.Map     // 会话 ID -> 最近一次记录的 sessionTouch
+	sessionTouchesPrunedAt atomic.Int64 // 最近一次清理 sessionTouches 的时间（Unix 纳秒）
+)
+
+type sessionTouch struct {
+	at time.Time
+	ip string
+}
+
+// SessionInfo 会话列表中的一项，Current 表示发起请求的会话
+type SessionInfo struct {
+	models.Session
+	Current bool `json:"current"`
+}
+
+// isUserDisabled 封禁和停用的用户不能登录，已签发的令牌也不能继续使用
+func isUserDisabled(status string) bool {
+	return status == models.UserStatusBanned || status == models.UserStatusInactive
+}
+
+// getUserAuthState 读取用户的认证状态，结果短时间缓存，封禁等操作会立即清除缓存
+func getUserAuthState(userID uint) (cache.UserAuthState, error) {
+	if state, ok := cache.GetUserAuthState(userID); ok {
+		return state, nil
+	}
+
+	state := cache.UserAuthState{}
+	var user models.UserInfo
+	err := models.GetDB().Select("user_id", "status", "tokens_valid_after").Limit(1).Find(&user, userID).Error
+	if err != nil {
+		return state, err
+	}
+	if user.UserID != 0 {
+		state.Exists = true
+		state.Status = user.Status
+		if user.TokensValidAfter != nil {
+			state.TokensValidAfter = *user.TokensValidAfter
+		}
+		if state.TwoFactorSetupRequired, err = twoFactorSetupRequired(userID); err != nil {
+			return state, err
+		}
+	}
+	cache.SetUserAuthState(userID, state)
+	return state, nil
+}
+
+// CheckUserActive 检查用户存在且未被封禁或停用
+func CheckUserActive(userID uint) error {
+	state, err := getUserAuthState(userID)
+	if err != nil {
+		return err
+	}
+	return checkUserState(state)
+}
+
+// checkUserState 根据认证状态判断用户是否存在且未被封禁或停用
+func checkUserState(state cache.UserAuthState) error {
+	if !state.Exists {
+		return ErrUserNotFound
+	}
+	if isUserDisabled(state.Status) {
+		return ErrUserDisabled
+	}
+	return nil
+}
+
+// ValidateAccessToken 检查登录令牌（JWT）是否仍然有效：用户状态正常、令牌和所属会话未被撤销且签发于用户最近一次撤销登录之后
+func ValidateAccessToken(userID uint, jti, sessionID string, issuedAt time.Time) error {
+	state, err := getUserAuthState(userID)
+	if err != nil {
+		return err
+	}
+	if err := checkUserState(state); err != nil {
+		return err
+	}
+
+	// 令牌的 iat 精确到毫秒（见 middleware.GenerateJWT），撤销之后立即签发的令牌不受影响
+	if issuedAt.Before(state.TokensValidAfter.Truncate(time.Millisecond)) {
+		return ErrSessionRevoked
+	}
+
+	if jti != "" {
+		revoked, ok := cache.GetTokenRevoked(jti)
+		if !ok {
+			revoked, err = dao.IsTokenRevoked(models.GetDB(), jti)
+			if err != nil {
+				return err
+			}
+			cache.SetTokenRevoked(jti, revoked)
+		}
+		if revoked {
+			return ErrSessionRevoked
+		}
+	}
+
+	// 会话被撤销后，该会话签发的访问令牌同时失效；没有 sid 的旧令牌只检查上面的条件
+	if sessionID != "" {
+		revoked, ok := cache.GetSessionRevoked(sessionID)
+		if !ok {
+			session, err := dao.GetSession(models.GetDB(), sessionID)
+			if err != nil {
+				return err
+			}
+			revoked = session == nil || session.UserID != userID || session.RevokedAt != nil
+			cache.SetSessionRevoked(sessionID, revoked)
+		}
+		if revoked {
+			return ErrSessionRevoked
+		}
+	}
+	return nil
+}
+
+// RevokeAccessToken 撤销单个登录令牌（退出登录时使用）
+func RevokeAccessToken(jti string, userID uint, expiresAt time.Time) error {
+	if jti == "" {
+		return nil
+	}
+	db := models.GetDB()
+	err := dao.CreateRevokedToken(db, &models.RevokedToken{
+		JTI:       jti,
+		UserID:    userID,
+		ExpiresAt: expiresAt,
+	})
+	if err != nil {
+		return err
+	}
+	cache.SetTokenRevoked(jti, true)
+
+	// 过期令牌的撤销记录已经没有意义，顺便清理
+	if err := dao.CleanExpiredRevokedTokens(db); err != nil {
+		logger.GetLogger().WithError(err).Warn("清理过期的令牌撤销记录失败")
+	}
+	return nil
+}
+
+// RevokeUserCredentials 修改或重置密码后撤销用户的所有登录和个人 API 令牌
+// 密码泄露时攻击者可能已创建 API 令牌（S3、WebDAV 也使用这些令牌），用户需要重新创建
+func RevokeUserCredentials(userID uint) error {
+	if err := dao.RevokeUserTokensByType(models.GetDB(), userID, models.TokenTypeAPI); err != nil {
+		return err
+	}
+	return RevokeUserSessions(userID)
+}
+
+// RevokeUserSessions 立即撤销用户的所有登录：已签发的登录令牌失效，刷新令牌全部撤销
+// 个人 API 令牌不受影响，封禁期间由用户状态检查拦截；修改密码使用 RevokeUserCredentials
+func RevokeUserSessions(userID uint) error {
+	db := models.GetDB()
+	if err := dao.UpdateTokensValidAfter(db, userID, time.Now()); err != nil {
+		return err
+	}
+	if err := dao.RevokeUserRefreshTokens(db, userID); err != nil {
+		return err
+	}
+	if _, err := dao.RevokeUserSessionsExcept(db, userID, ""); err != nil {
+		return err
+	}
+	cache.ClearUserAuthState(userID)
+
+	logger.GetLogger().WithFields(logrus.Fields{
+		"user_id": userID,
+	}).Info("已撤销用户的所有登录")
+	return nil
+}
+
+// ListSessions 获取用户当前有效的登录会话，currentID 为发起请求的会话
+func ListSessions(userID uint, currentID string) ([]SessionInfo, error) {
+	sessions, err := dao.ListActiveSessions(models.GetDB(), userID, time.Now())
+	if err != nil {
+		return nil, err
+	}
+	infos := make([]SessionInfo, 0, len(sessions))
+	for _, session := range sessions {
+		infos = append(infos, SessionInfo{
+			Session: session,
+			Current: currentID != "" && session.ID == currentID,
+		})
+	}
+	return infos, nil
+}
+
+// RevokeSession 用户撤销自己的一个登录会话，会话的刷新令牌和访问令牌立即失效
+func RevokeSession(userID uint, sessionID string) error {
+	db := models.GetDB()
+	session, err := dao.GetSession(db, sessionID)
+	if err != nil {
+		return err
+	}
+	if session == nil || session.UserID != userID || session.RevokedAt != nil {
+		return ErrSessionNotFound
+	}
+	if err := endSession(db, sessionID); err != nil {
+		return err
+	}
+
+	logger.GetLogger().WithFields(logrus.Fields{
+		"user_id":    userID,
+		"session_id": sessionID,
+	}).Info("撤销登录会话")
+	return nil
+}
+
+// RevokeOtherSessions 撤销用户除 currentID 之外的所有登录会话，返回撤销的数量
+// 个人 API 令牌不受影响
+func RevokeOtherSessions(userID uint, currentID string) (int, error) {
+	db := models.GetDB()
+	ids, err := dao.RevokeUserSessionsExcept(db, userID, currentID)
+	if err != nil {
+		return 0, err
+	}
+	for _, id := range ids {
+		if err := dao.RevokeTokenFamily(db, id); err != nil {
+			return 0, err
+		}
+		cache.SetSessionRevoked(id, true)
+	}
+
+	logger.GetLogger().WithFields(logrus.Fields{
+		"user_id": userID,
+		"count":   len(ids),
+	}).Info("撤销其他登录会话")
+	return len(ids), nil
+}
+
+// TouchSession 记录会话的最近使用时间和 IP，同一会话每分钟最多写一次数据库（IP 变化时立即写入）
+func TouchSession(sessionID, ipAddress string) {
+	now := time.Now()
+	if v, ok := sessionTouches.Load(sessionID); ok {
+		last := v.(sessionTouch)
+		if last.ip == ipAddress && now.Sub(last.at) < sessionTouchInterval {
+			return
+		}
+	}
+	sessionTouches.Store(sessionID, sessionTouch{at: now, ip: ipAddress})
+	pruneSessionTouches(now)
+
+	if err := dao.TouchSession(models.GetDB(), sessionID, ipAddress, now, time.Time{}); err != nil {
+		logger.GetLogger().WithError(err).WithField("session_id", sessionID).Warn("更新登录会话失败")
+	}
+}
+
+// pruneSessionTouches 删除超过记录间隔的条目，这些条目不再影响是否写数据库
+// 每个间隔最多清理一次，会话过期或被撤销后留下的条目也会在这里被删除
+func pruneSessionTouches(now time.Time) {
+	last := sessionTouchesPrunedAt.Load()
+	if now.UnixNano()-last < int64(sessionTouchInterval) || !sessionTouchesPrunedAt.CompareAndSwap(last, now.UnixNano()) {
+		return
+	}
+	sessionTouches.Range(func(key, value interface{}) bool {
+		if now.Sub(value.(sessionTouch).at) >= sessionTouchInterval {
+			sessionTouches.CompareAndDelete(key, value)
+		}
+		return true
+	})
+}
+
+// startSession 登录成功后创建会话，顺便清理已过期的会话
+func startSession(userID uint, userAgent, ipAddress string) (string, error) {
+	sessionID, err := randomToken(16)
+	if err != nil {
+		return "", err
+	}
+
+	db := models.GetDB()
+	now := time.Now()
+	err = dao.CreateSession(db, &models.Session{
+		ID:         sessionID,
+		UserID:     userID,
+		UserAgent:  truncateString(userAgent, 255),
+		Device:     useragent.Label(userAgent),
+		IPAddress:  ipAddress,
+		LastIP:     ipAddress,
+		LastUsedAt: now,
+		ExpiresAt:  now.Add(refreshTokenTTL()),
+	})
+	if err != nil {
+		return "", err
+	}
+	sessionTouches.Store(sessionID, sessionTouch{at: now, ip: ipAddress})
+	pruneSessionTouches(now)
+
+	if err := dao.DeleteExpiredSessions(db, now); err != nil {
+		logger.GetLogger().WithError(err).Warn("清理过期的登录会话失败")
+	}
+	return sessionID, nil
+}
+
+// refreshSession 刷新令牌轮换时延长会话有效期
+// 功能上线前签发的刷新令牌没有对应的会话，第一次刷新时补建
+func refreshSession(db *gorm.DB, token *models.Token, ipAddress string) error {
+	now := time.Now()
+	session, err := dao.GetSession(db, token.FamilyID)
+	if err != nil {
+		return err
+	}
+	if session == nil {
+		return dao.CreateSession(db, &models.Session{
+			ID:         token.FamilyID,
+			UserID:     token.UserID,
+			UserAgent:  token.DeviceID,
+			Device:     useragent.Label(token.DeviceID),
+			IPAddress:  token.IPAddress,
+			LastIP:     ipAddress,
+			LastUsedAt: now,
+			ExpiresAt:  now.Add(refreshTokenTTL()),
+		})
+	}
+	if session.RevokedAt != nil {
+		return ErrRefreshTokenInvalid
+	}
+	sessionTouches.Store(session.ID, sessionTouch{at: now, ip: ipAddress})
+	return dao.TouchSession(db, session.ID, ipAddress, now, now.Add(refreshTokenTTL()))
+}
+
+// endSession 结束会话：会话标记为已撤销，刷新令牌全部撤销，访问令牌在下次请求时被拦截
+func endSession(db *gorm.DB, sessionID string) error {
+	if err := dao.RevokeTokenFamily(db, sessionID); err != nil {
+		return err
+	}
+	if _, err := dao.RevokeSession(db, sessionID); err != nil {
+		return err
+	}
+	cache.SetSessionRevoked(sessionID, true)
+	sessionTouches.Delete(sessionID)
+	return nil
+}
+
+// truncateString 按字节截断字符串，保证不会截断在 UTF-8 字符中间
+func truncateString(s string, n int) string {
+	if len(s) <= n {
+		return s
+	}
+	for n > 0 && !utf8.RuneStart(s[n]) {
+		n--
+	}
+	return s[:n]
+}
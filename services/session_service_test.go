@@ -0,0 +1,107 @@
+package services
+
+import (
+	"errors"
+	"img_hosting/models"
+	"testing"
+	"time"
+)
+
+func TestPruneSessionTouches(t *testing.T) {
+	now := time.Now()
+	sessionTouchesPrunedAt.Store(0)
+	sessionTouches.Store("prune-old", sessionTouch{at: now.Add(-2 * sessionTouchInterval), ip: "192.0.2.1"})
+	sessionTouches.Store("prune-recent", sessionTouch{at: now.Add(-time.Second), ip: "192.0.2.1"})
+	t.Cleanup(func() {
+		sessionTouches.Delete("prune-old")
+		sessionTouches.Delete("prune-recent")
+		sessionTouches.Delete("prune-later")
+	})
+
+	pruneSessionTouches(now)
+	if _, ok := sessionTouches.Load("prune-old"); ok {
+		t.Error("超过记录间隔的条目应被删除")
+	}
+	if _, ok := sessionTouches.Load("prune-recent"); !ok {
+		t.Error("记录间隔内的条目应保留")
+	}
+
+	// 同一间隔内不重复清理
+	sessionTouches.Store("prune-later", sessionTouch{at: now.Add(-2 * sessionTouchInterval), ip: "192.0.2.1"})
+	pruneSessionTouches(now.Add(time.Second))
+	if _, ok := sessionTouches.Load("prune-later"); !ok {
+		t.Error("同一间隔内不应再次清理")
+	}
+	pruneSessionTouches(now.Add(sessionTouchInterval))
+	if _, ok := sessionTouches.Load("prune-later"); ok {
+		t.Error("下一个间隔应再次清理")
+	}
+}
+
+func TestChangePasswordRevokesCredentials(t *testing.T) {
+	user := createTestUser(t)
+	apiToken, err := CreateToken(user.UserID, "test-device", "192.0.2.1", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, refreshToken, err := IssueRefreshToken(user.UserID, "test-agent", "192.0.2.1")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := (&UserService{}).ChangePassword(user.UserID, "Passw0rd!", "N3wPassw0rd!"); err != nil {
+		t.Fatal(err)
+	}
+
+	// 修改密码前创建的 API 令牌和登录会话全部失效
+	if _, _, err := NewTokenService().Authenticate(apiToken.Token); err == nil {
+		t.Error("修改密码后 API 令牌应失效")
+	}
+	tokens, err := ListUserTokens(user.UserID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, token := range tokens {
+		if token.Token == apiToken.Token && token.Status != models.TokenStatusRevoked {
+			t.Errorf("API 令牌状态 = %s", token.Status)
+		}
+	}
+	if sessions, err := ListSessions(user.UserID, ""); err != nil || len(sessions) != 0 {
+		t.Errorf("修改密码后不应有有效会话: %d, %v", len(sessions), err)
+	}
+	if _, _, _, err := RotateRefreshToken(refreshToken, "192.0.2.1"); !errors.Is(err, ErrRefreshTokenInvalid) && !errors.Is(err, ErrRefreshTokenReused) {
+		t.Errorf("修改密码后刷新令牌应失效，got %v", err)
+	}
+
+	// 新创建的 API 令牌可以正常使用
+	newToken, err := CreateToken(user.UserID, "test-device", "192.0.2.1", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := NewTokenService().Authenticate(newToken.Token); err != nil {
+		t.Errorf("新令牌应可用，got %v", err)
+	}
+}
+
+func TestBanKeepsAPITokens(t *testing.T) {
+	user := createTestUser(t)
+	apiToken, err := CreateToken(user.UserID, "test-device", "192.0.2.1", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := &UserService{}
+	if err := s.UpdateUserStatus(user.UserID, models.UserStatusBanned); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := NewTokenService().Authenticate(apiToken.Token); !errors.Is(err, ErrUserDisabled) {
+		t.Errorf("封禁期间应返回 ErrUserDisabled，got %v", err)
+	}
+
+	// 封禁只拦截请求，解封后原有的 API 令牌恢复可用
+	if err := s.UpdateUserStatus(user.UserID, models.UserStatusActive); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := NewTokenService().Authenticate(apiToken.Token); err != nil {
+		t.Errorf("解封后 API 令牌应恢复可用，got %v", err)
+	}
+}
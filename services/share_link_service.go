@@ -0,0 +1,241 @@
+package services
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"img_hosting/dao"
+	"img_hosting/models"
+	"img_hosting/pkg/encryption"
+	"img_hosting/pkg/logger"
+	"os"
+	"path/filepath"
+	"strconv"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// 分享链接访问错误，控制器据此返回不同的状态码
+var (
+	ErrShareNotFound     = errors.New("分享链接不存在")
+	ErrShareRevoked      = errors.New("分享链接已被撤销")
+	ErrShareExpired      = errors.New("分享链接已过期")
+	ErrShareLimitReached = errors.New("分享链接下载次数已用完")
+	ErrSharePassword     = errors.New("分享密码错误")
+)
+
+// SharePasswordThrottledError 同一 IP 对分享链接输错密码次数过多，需要等待 RetryAfter 之后再试
+// 等待和锁定时间按登录保护（login_protection）的配置计算
+type SharePasswordThrottledError struct {
+	LoginThrottledError
+}
+
+func (e *SharePasswordThrottledError) Error() string {
+	if e.Locked {
+		minutes := int((e.RetryAfter + time.Minute - 1) / time.Minute)
+		return fmt.Sprintf("分享密码错误次数过多，请 %d 分钟后再试", minutes)
+	}
+	return fmt.Sprintf("分享密码错误次数过多，请 %d 秒后再试", e.RetrySeconds())
+}
+
+// CreateShareLinkInput 创建分享链接参数
+type CreateShareLinkInput struct {
+	FileID       uint
+	FilePassword string     // 加密文件的密码，用于校验分享者有权解密
+	Password     string     // 分享访问密码(可选)
+	ExpiresAt    *time.Time // 过期时间(可选)
+	MaxDownloads int64      // 最大下载次数(0表示不限)
+}
+
+// CreateShareLink 为私人文件创建分享链接
+func CreateShareLink(userID uint, input CreateShareLinkInput) (*models.ShareLink, error) {
+	db := models.GetDB()
+
+	file, err := dao.GetPrivateFileByID(db, input.FileID, userID)
+	if err != nil {
+		return nil, err
+	}
+	if file.IsEncrypted && file.Password != input.FilePassword {
+		return nil, errors.New("文件密码错误")
+	}
+	if input.ExpiresAt != nil && !input.ExpiresAt.After(time.Now()) {
+		return nil, errors.New("过期时间必须晚于当前时间")
+	}
+	if input.MaxDownloads < 0 {
+		return nil, errors.New("下载次数不能为负数")
+	}
+
+	slug, err := generateShareSlug()
+	if err != nil {
+		return nil, err
+	}
+
+	link := &models.ShareLink{
+		Slug:         slug,
+		FileID:       file.ID,
+		UserID:       userID,
+		ExpiresAt:    input.ExpiresAt,
+		MaxDownloads: input.MaxDownloads,
+		Status:       models.ShareLinkStatusActive,
+	}
+	if input.Password != "" {
+		hashed, err := bcrypt.GenerateFromPassword([]byte(input.Password), bcrypt.DefaultCost)
+		if err != nil {
+			return nil, err
+		}
+		link.Password = string(hashed)
+		link.HasPassword = true
+	}
+
+	if err := dao.CreateShareLink(db, link); err != nil {
+		return nil, err
+	}
+
+	logger.GetLogger().WithFields(logrus.Fields{
+		"share_id": link.ID,
+		"file_id":  file.ID,
+		"user_id":  userID,
+	}).Info("创建分享链接成功")
+
+	return link, nil
+}
+
+// ListShareLinks 获取用户的分享链接
+func ListShareLinks(userID, fileID uint) ([]models.ShareLink, error) {
+	return dao.ListShareLinks(models.GetDB(), userID, fileID)
+}
+
+// RevokeShareLink 撤销分享链接
+func RevokeShareLink(userID, linkID uint) error {
+	return dao.RevokeShareLink(models.GetDB(), linkID, userID)
+}
+
+// GetShareAccessLogs 获取分享链接的访问记录
+func GetShareAccessLogs(userID, linkID uint, limit int) ([]models.ShareAccessLog, error) {
+	db := models.GetDB()
+	if _, err := dao.GetShareLinkByID(db, linkID, userID); err != nil {
+		return nil, err
+	}
+	return dao.ListShareAccessLogs(db, linkID, limit)
+}
+
+// OpenShareLink 校验分享链接并返回可下载的文件路径
+// 返回的 isTemp 为 true 时表示路径是临时目录中的解密文件，调用方使用后需删除其所在目录
+func OpenShareLink(slug, password, ip, userAgent string) (file *models.PrivateFile, path string, isTemp bool, err error) {
+	db := models.GetDB()
+	log := logger.GetLogger()
+
+	link, err := dao.GetShareLinkBySlug(db, slug)
+	if err != nil {
+		return nil, "", false, ErrShareNotFound
+	}
+
+	// 同一链接和 IP 的密码校验串行执行，否则并发的请求都能通过限流检查
+	unlock := func() {}
+	if link.HasPassword {
+		unlock = lockAttempts("share:" + strconv.FormatUint(uint64(link.ID), 10) + ":" + ip)
+	}
+
+	// 记录每一次访问结果，记录之后才解锁，下一次请求能看到本次的结果
+	result := models.ShareAccessSuccess
+	defer func() {
+		defer unlock()
+		accessLog := &models.ShareAccessLog{
+			ShareLinkID: link.ID,
+			IPAddress:   ip,
+			UserAgent:   userAgent,
+			Result:      result,
+		}
+		if logErr := dao.CreateShareAccessLog(db, accessLog); logErr != nil {
+			log.WithError(logErr).WithField("share_id", link.ID).Warn("记录分享访问失败")
+		}
+	}()
+
+	if link.Status != models.ShareLinkStatusActive {
+		result = models.ShareAccessRevoked
+		return nil, "", false, ErrShareRevoked
+	}
+	if link.ExpiresAt != nil && time.Now().After(*link.ExpiresAt) {
+		result = models.ShareAccessExpired
+		return nil, "", false, ErrShareExpired
+	}
+	if link.HasPassword {
+		if err := checkSharePasswordThrottle(link.ID, ip); err != nil {
+			var throttled *SharePasswordThrottledError
+			if errors.As(err, &throttled) {
+				result = models.ShareAccessThrottled
+			}
+			return nil, "", false, err
+		}
+		if err := bcrypt.CompareHashAndPassword([]byte(link.Password), []byte(password)); err != nil {
+			result = models.ShareAccessBadPassword
+			return nil, "", false, ErrSharePassword
+		}
+		// 密码正确后提前解锁，解密大文件时不阻塞同一 IP 的其他请求
+		unlock()
+		unlock = func() {}
+	}
+
+	file, err = dao.GetActivePrivateFile(db, link.FileID)
+	if err != nil {
+		result = models.ShareAccessFileMissing
+		return nil, "", false, ErrShareNotFound
+	}
+
+	// 原子地占用一次下载次数，避免并发下超过上限
+	ok, err := dao.IncrementShareDownloadCount(db, link.ID)
+	if err != nil {
+		return nil, "", false, err
+	}
+	if !ok {
+		result = models.ShareAccessLimitReached
+		return nil, "", false, ErrShareLimitReached
+	}
+
+	if err := dao.IncrementViewCount(db, file.ID); err != nil {
+		log.WithError(err).WithField("file_id", file.ID).Warn("增加文件查看次数失败")
+	}
+
+	if !file.IsEncrypted {
+		return file, file.StoragePath, false, nil
+	}
+
+	// 加密文件解密到临时目录
+	tempDir, err := os.MkdirTemp("", "share_")
+	if err != nil {
+		return nil, "", false, err
+	}
+	decryptedPath := filepath.Join(tempDir, filepath.Base(file.FileName))
+	if err := encryption.DecryptFile(file.StoragePath, decryptedPath, file.Password); err != nil {
+		os.RemoveAll(tempDir)
+		return nil, "", false, fmt.Errorf("文件解密失败: %w", err)
+	}
+
+	return file, decryptedPath, true, nil
+}
+
+// checkSharePasswordThrottle 检查 IP 是否需要等待后才能再次尝试分享密码，计算方式与账号登录限流相同
+func checkSharePasswordThrottle(linkID uint, ip string) error {
+	s := getLoginProtectionSettings()
+	now := time.Now()
+	failures, last, err := dao.GetSharePasswordFailures(models.GetDB(), linkID, ip, s.since(now))
+	if err != nil {
+		return err
+	}
+	if throttled := s.throttle(failures, last, now); throttled != nil {
+		return &SharePasswordThrottledError{LoginThrottledError: *throttled}
+	}
+	return nil
+}
+
+// generateShareSlug 生成随机的分享短链标识
+func generateShareSlug() (string, error) {
+	b := make([]byte, 12)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
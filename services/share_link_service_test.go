@@ -0,0 +1,296 @@
+package services
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"img_hosting/dao"
+	"img_hosting/models"
+	"sync"
+	"testing"
+	"time"
+)
+
+// createTestPrivateFile 为用户上传一个文本私人文件
+func createTestPrivateFile(t *testing.T, userID uint) *models.PrivateFile {
+	t.Helper()
+	content := []byte(fmt.Sprintf("shared notes of %s", t.Name()))
+	file, err := UploadPrivateFileReader(userID, "notes.txt", bytes.NewReader(content), int64(len(content)), false, "")
+	if err != nil {
+		t.Fatalf("上传私人文件失败: %v", err)
+	}
+	return file
+}
+
+func shareAccessResults(t *testing.T, linkID uint) map[string]int {
+	t.Helper()
+	logs, err := dao.ListShareAccessLogs(models.GetDB(), linkID, 100)
+	if err != nil {
+		t.Fatal(err)
+	}
+	results := make(map[string]int)
+	for _, l := range logs {
+		results[l.Result]++
+	}
+	return results
+}
+
+func TestShareLinkDownloadLimit(t *testing.T) {
+	user := createTestUser(t)
+	file := createTestPrivateFile(t, user.UserID)
+
+	link, err := CreateShareLink(user.UserID, CreateShareLinkInput{FileID: file.ID, MaxDownloads: 3})
+	if err != nil {
+		t.Fatalf("创建分享链接失败: %v", err)
+	}
+
+	// 并发下载时成功次数不能超过上限
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	success, limited := 0, 0
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, _, _, err := OpenShareLink(link.Slug, "", "192.0.2.1", "test")
+			mu.Lock()
+			defer mu.Unlock()
+			switch {
+			case err == nil:
+				success++
+			case errors.Is(err, ErrShareLimitReached):
+				limited++
+			default:
+				t.Errorf("意外的错误: %v", err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if success != 3 || limited != 7 {
+		t.Errorf("成功 %d 次、达到上限 %d 次，want 3 和 7", success, limited)
+	}
+	saved, err := dao.GetShareLinkBySlug(models.GetDB(), link.Slug)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if saved.DownloadCount != 3 {
+		t.Errorf("download_count = %d, want 3", saved.DownloadCount)
+	}
+	if got := shareAccessResults(t, link.ID); got[models.ShareAccessSuccess] != 3 || got[models.ShareAccessLimitReached] != 7 {
+		t.Errorf("访问记录 = %v", got)
+	}
+}
+
+func TestShareLinkExpiry(t *testing.T) {
+	user := createTestUser(t)
+	file := createTestPrivateFile(t, user.UserID)
+
+	past := time.Now().Add(-time.Minute)
+	if _, err := CreateShareLink(user.UserID, CreateShareLinkInput{FileID: file.ID, ExpiresAt: &past}); err == nil {
+		t.Fatal("过期时间早于当前时间时应拒绝创建")
+	}
+
+	future := time.Now().Add(time.Hour)
+	link, err := CreateShareLink(user.UserID, CreateShareLinkInput{FileID: file.ID, ExpiresAt: &future})
+	if err != nil {
+		t.Fatalf("创建分享链接失败: %v", err)
+	}
+	if _, _, _, err := OpenShareLink(link.Slug, "", "192.0.2.1", "test"); err != nil {
+		t.Fatalf("有效期内应能下载: %v", err)
+	}
+
+	if err := models.GetDB().Model(&models.ShareLink{}).Where("id = ?", link.ID).Update("expires_at", past).Error; err != nil {
+		t.Fatal(err)
+	}
+	if _, _, _, err := OpenShareLink(link.Slug, "", "192.0.2.1", "test"); !errors.Is(err, ErrShareExpired) {
+		t.Errorf("过期后应返回 ErrShareExpired，got %v", err)
+	}
+	if got := shareAccessResults(t, link.ID); got[models.ShareAccessExpired] != 1 {
+		t.Errorf("访问记录 = %v", got)
+	}
+}
+
+func TestShareLinkPasswordAndRevoke(t *testing.T) {
+	user := createTestUser(t)
+	file := createTestPrivateFile(t, user.UserID)
+
+	link, err := CreateShareLink(user.UserID, CreateShareLinkInput{FileID: file.ID, Password: "s3cret", MaxDownloads: 1})
+	if err != nil {
+		t.Fatalf("创建分享链接失败: %v", err)
+	}
+	if !link.HasPassword || link.Password == "s3cret" {
+		t.Fatalf("访问密码应以哈希保存: %+v", link)
+	}
+
+	// 密码错误不占用下载次数
+	for _, password := range []string{"", "wrong"} {
+		if _, _, _, err := OpenShareLink(link.Slug, password, "192.0.2.1", "test"); !errors.Is(err, ErrSharePassword) {
+			t.Errorf("密码 %q 应返回 ErrSharePassword，got %v", password, err)
+		}
+	}
+	got, path, _, err := OpenShareLink(link.Slug, "s3cret", "192.0.2.1", "test")
+	if err != nil {
+		t.Fatalf("密码正确时应能下载: %v", err)
+	}
+	if got.ID != file.ID || path != file.StoragePath {
+		t.Errorf("返回的文件不正确: %+v, %s", got, path)
+	}
+
+	if err := RevokeShareLink(user.UserID, link.ID); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, _, err := OpenShareLink(link.Slug, "s3cret", "192.0.2.1", "test"); !errors.Is(err, ErrShareRevoked) {
+		t.Errorf("撤销后应返回 ErrShareRevoked，got %v", err)
+	}
+	if _, _, _, err := OpenShareLink("no-such-slug", "", "192.0.2.1", "test"); !errors.Is(err, ErrShareNotFound) {
+		t.Errorf("不存在的链接应返回 ErrShareNotFound，got %v", err)
+	}
+}
+
+func TestShareLinkOwnership(t *testing.T) {
+	owner := createTestUser(t)
+	other := createTestUser(t)
+	file := createTestPrivateFile(t, owner.UserID)
+
+	if _, err := CreateShareLink(other.UserID, CreateShareLinkInput{FileID: file.ID}); err == nil {
+		t.Error("不能分享其他用户的文件")
+	}
+	link, err := CreateShareLink(owner.UserID, CreateShareLinkInput{FileID: file.ID})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := RevokeShareLink(other.UserID, link.ID); err == nil {
+		t.Error("不能撤销其他用户的分享链接")
+	}
+	if _, _, _, err := OpenShareLink(link.Slug, "", "192.0.2.1", "test"); err != nil {
+		t.Errorf("其他用户撤销失败后链接应仍然有效: %v", err)
+	}
+}
+
+// addSharePasswordFailures 写入 n 条 at 时刻的分享密码错误记录
+func addSharePasswordFailures(t *testing.T, linkID uint, ip string, n int, at time.Time) {
+	t.Helper()
+	for i := 0; i < n; i++ {
+		accessLog := &models.ShareAccessLog{ShareLinkID: linkID, IPAddress: ip, Result: models.ShareAccessBadPassword, CreatedAt: at}
+		if err := dao.CreateShareAccessLog(models.GetDB(), accessLog); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestShareLinkPasswordThrottle(t *testing.T) {
+	useTestLoginProtection(t)
+	user := createTestUser(t)
+	file := createTestPrivateFile(t, user.UserID)
+	link, err := CreateShareLink(user.UserID, CreateShareLinkInput{FileID: file.ID, Password: "s3cret"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ip := loginTestIP(user.UserID)
+
+	// 免等待次数之内可以连续尝试
+	for i := 0; i < 3; i++ {
+		if _, _, _, err := OpenShareLink(link.Slug, "wrong", ip, "test"); !errors.Is(err, ErrSharePassword) {
+			t.Fatalf("第 %d 次应返回 ErrSharePassword，got %v", i+1, err)
+		}
+	}
+
+	// 之后需要等待，等待期间密码正确也不校验
+	_, _, _, err = OpenShareLink(link.Slug, "s3cret", ip, "test")
+	var throttled *SharePasswordThrottledError
+	if !errors.As(err, &throttled) || throttled.Locked || throttled.RetryAfter > time.Second {
+		t.Fatalf("失败 3 次后应等待 1 秒，got %v", err)
+	}
+
+	// 其他 IP 和其他链接不受影响
+	if _, _, _, err := OpenShareLink(link.Slug, "s3cret", loginTestIP(user.UserID+1), "test"); err != nil {
+		t.Errorf("其他 IP 不应受影响: %v", err)
+	}
+	other, err := CreateShareLink(user.UserID, CreateShareLinkInput{FileID: file.ID, Password: "s3cret"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, _, _, err := OpenShareLink(other.Slug, "s3cret", ip, "test"); err != nil {
+		t.Errorf("其他链接不应受影响: %v", err)
+	}
+
+	// 被限流的请求不计入失败次数
+	if got := shareAccessResults(t, link.ID); got[models.ShareAccessBadPassword] != 3 || got[models.ShareAccessThrottled] != 1 {
+		t.Errorf("访问记录 = %v", got)
+	}
+
+	// 达到锁定阈值后锁定，锁定时长从最近一次失败开始计算
+	addSharePasswordFailures(t, link.ID, ip, 2, time.Now().Add(-10*time.Second))
+	_, _, _, err = OpenShareLink(link.Slug, "s3cret", ip, "test")
+	if !errors.As(err, &throttled) || !throttled.Locked || throttled.RetryAfter <= 50*time.Second {
+		t.Fatalf("失败 5 次后应锁定约 60 秒，got %v", err)
+	}
+}
+
+func TestShareLinkPasswordThrottleReset(t *testing.T) {
+	useTestLoginProtection(t)
+	user := createTestUser(t)
+	file := createTestPrivateFile(t, user.UserID)
+	link, err := CreateShareLink(user.UserID, CreateShareLinkInput{FileID: file.ID, Password: "s3cret"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ip := loginTestIP(user.UserID)
+
+	// 成功访问后重新计数
+	addSharePasswordFailures(t, link.ID, ip, 2, time.Now().Add(-time.Minute))
+	if _, _, _, err := OpenShareLink(link.Slug, "s3cret", ip, "test"); err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 3; i++ {
+		if _, _, _, err := OpenShareLink(link.Slug, "wrong", ip, "test"); !errors.Is(err, ErrSharePassword) {
+			t.Fatalf("成功后第 %d 次失败应返回 ErrSharePassword，got %v", i+1, err)
+		}
+	}
+
+	// 统计窗口之外的失败不计入
+	addSharePasswordFailures(t, link.ID, loginTestIP(user.UserID+1), 10, time.Now().Add(-time.Hour))
+	if _, _, _, err := OpenShareLink(link.Slug, "s3cret", loginTestIP(user.UserID+1), "test"); err != nil {
+		t.Errorf("窗口之外的失败不应限制: %v", err)
+	}
+}
+
+func TestShareLinkPasswordConcurrentAttempts(t *testing.T) {
+	useTestLoginProtection(t)
+	user := createTestUser(t)
+	file := createTestPrivateFile(t, user.UserID)
+	link, err := CreateShareLink(user.UserID, CreateShareLinkInput{FileID: file.ID, Password: "s3cret"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ip := loginTestIP(user.UserID)
+
+	// 并发的错误密码请求不能同时通过检查，只有免等待次数内的请求校验了密码
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	invalid, throttled := 0, 0
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, _, _, err := OpenShareLink(link.Slug, "wrong", ip, "test")
+			var throttledErr *SharePasswordThrottledError
+			mu.Lock()
+			defer mu.Unlock()
+			switch {
+			case errors.Is(err, ErrSharePassword):
+				invalid++
+			case errors.As(err, &throttledErr):
+				throttled++
+			default:
+				t.Errorf("意外的错误: %v", err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if invalid != 3 || throttled != 7 {
+		t.Errorf("密码错误 %d 次、被限流 %d 次，want 3 和 7", invalid, throttled)
+	}
+}
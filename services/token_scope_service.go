@@ -0,0 +1,102 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"img_hosting/config"
+	"net/http"
+	"sort"
+	"strings"
+)
+
+// 令牌范围的访问级别
+const (
+	ScopeRead  = "read"
+	ScopeWrite = "write"
+)
+
+// 各接口对应的范围名称
+const (
+	ScopeImages = "images"
+	ScopeFiles  = "files"
+)
+
+var ErrInvalidScope = errors.New("无效的令牌范围")
+
+// ParseScopes 解析令牌保存的范围字符串（空格分隔）
+func ParseScopes(s string) []string {
+	return strings.Fields(s)
+}
+
+// NormalizeScopes 校验范围是否在配置中定义，去重后按空格拼接保存
+func NormalizeScopes(scopes []string) (string, error) {
+	defined := config.GetConfig().Permissions.Scopes
+	seen := make(map[string]bool)
+	var result []string
+	for _, scope := range scopes {
+		scope = strings.ToLower(strings.TrimSpace(scope))
+		if scope == "" || seen[scope] {
+			continue
+		}
+		name, level, ok := strings.Cut(scope, ":")
+		if _, exists := defined[name]; !exists || !ok || (level != ScopeRead && level != ScopeWrite) {
+			return "", fmt.Errorf("%w: %q", ErrInvalidScope, scope)
+		}
+		seen[scope] = true
+		result = append(result, scope)
+	}
+	sort.Strings(result)
+	return strings.Join(result, " "), nil
+}
+
+// isReadMethod 只读请求只需要 read 范围
+func isReadMethod(method string) bool {
+	return method == http.MethodGet || method == http.MethodHead || method == http.MethodOptions || method == "PROPFIND"
+}
+
+// scopeGranted 判断范围列表是否包含 name，写请求需要 write 级别
+func scopeGranted(scopes []string, name string, write bool) bool {
+	for _, scope := range scopes {
+		n, level, _ := strings.Cut(scope, ":")
+		if n != name {
+			continue
+		}
+		if level == ScopeWrite || !write {
+			return true
+		}
+	}
+	return false
+}
+
+// TokenScopeAllows 判断令牌范围是否允许对 name 范围的资源执行 method 请求
+func TokenScopeAllows(scopes []string, name, method string) bool {
+	return scopeGranted(scopes, name, !isReadMethod(method))
+}
+
+// TokenScopeAllowsPath 判断令牌范围是否覆盖路由，path 为路由模板（如 /images/:id）
+func TokenScopeAllowsPath(scopes []string, path, method string) bool {
+	for name, scope := range config.GetConfig().Permissions.Scopes {
+		for _, prefix := range scope.Paths {
+			if path == prefix || strings.HasPrefix(path, strings.TrimRight(prefix, "/")+"/") {
+				if TokenScopeAllows(scopes, name, method) {
+					return true
+				}
+			}
+		}
+	}
+	return false
+}
+
+// TokenScopePermissions 返回令牌范围对 method 请求授予的权限
+func TokenScopePermissions(scopes []string, method string) map[string]bool {
+	permissions := make(map[string]bool)
+	for name, scope := range config.GetConfig().Permissions.Scopes {
+		if !TokenScopeAllows(scopes, name, method) {
+			continue
+		}
+		for _, perm := range scope.Permissions {
+			permissions[perm] = true
+		}
+	}
+	return permissions
+}
@@ -0,0 +1,113 @@
+package services
+
+import (
+	"errors"
+	"img_hosting/config"
+	"net/http"
+	"testing"
+)
+
+// useTestScopes 测试期间使用固定的令牌范围配置
+func useTestScopes(t *testing.T) {
+	t.Helper()
+	cfg := config.GetConfig()
+	old := cfg.Permissions.Scopes
+	cfg.Permissions.Scopes = map[string]config.TokenScopeConfig{
+		ScopeImages: {Permissions: []string{"upload_img", "view_images"}, Paths: []string{"/images", "/api/upload"}},
+		ScopeFiles:  {Permissions: []string{"manage_private_files"}, Paths: []string{"/private-files/"}},
+	}
+	t.Cleanup(func() { cfg.Permissions.Scopes = old })
+}
+
+func TestNormalizeScopes(t *testing.T) {
+	useTestScopes(t)
+
+	got, err := NormalizeScopes([]string{" Images:Write ", "files:read", "images:write", ""})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got != "files:read images:write" {
+		t.Errorf("NormalizeScopes = %q", got)
+	}
+
+	for _, scope := range []string{"admin:write", "images", "images:admin", ":read"} {
+		if _, err := NormalizeScopes([]string{scope}); !errors.Is(err, ErrInvalidScope) {
+			t.Errorf("%q 应返回 ErrInvalidScope，got %v", scope, err)
+		}
+	}
+}
+
+func TestTokenScopeAllowsPath(t *testing.T) {
+	useTestScopes(t)
+
+	tests := []struct {
+		name   string
+		scopes []string
+		path   string
+		method string
+		want   bool
+	}{
+		{"读范围允许读请求", []string{"images:read"}, "/images/:id", http.MethodGet, true},
+		{"读范围不允许写请求", []string{"images:read"}, "/images/:id", http.MethodDelete, false},
+		{"写范围包含读", []string{"images:write"}, "/images", http.MethodGet, true},
+		{"写范围允许写请求", []string{"images:write"}, "/api/upload", http.MethodPost, true},
+		{"其他范围的路由", []string{"images:write"}, "/private-files/:id", http.MethodGet, false},
+		{"前缀只按路径段匹配", []string{"images:write"}, "/imagesfoo", http.MethodGet, false},
+		{"配置中带斜杠的前缀", []string{"files:read"}, "/private-files/:id", http.MethodGet, true},
+		{"未配置的路由", []string{"images:write", "files:write"}, "/admin/users", http.MethodGet, false},
+		{"没有范围的令牌", nil, "/images", http.MethodGet, false},
+		{"PROPFIND 视为读请求", []string{"files:read"}, "/private-files/a", "PROPFIND", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := TokenScopeAllowsPath(tt.scopes, tt.path, tt.method); got != tt.want {
+				t.Errorf("TokenScopeAllowsPath(%v, %q, %s) = %v, want %v", tt.scopes, tt.path, tt.method, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestTokenScopePermissions(t *testing.T) {
+	useTestScopes(t)
+
+	got := TokenScopePermissions([]string{"images:read", "files:write"}, http.MethodPost)
+	if got["upload_img"] || !got["manage_private_files"] || len(got) != 1 {
+		t.Errorf("写请求的权限 = %v", got)
+	}
+	got = TokenScopePermissions([]string{"images:read"}, http.MethodGet)
+	if !got["upload_img"] || !got["view_images"] || got["manage_private_files"] {
+		t.Errorf("读请求的权限 = %v", got)
+	}
+}
+
+func TestCreateTokenScopes(t *testing.T) {
+	useTestScopes(t)
+	user := createTestUser(t)
+
+	if _, err := CreateToken(user.UserID, "", "192.0.2.1", []string{"admin:write"}); !errors.Is(err, ErrInvalidScope) {
+		t.Fatalf("未定义的范围应被拒绝，got %v", err)
+	}
+
+	token, err := CreateToken(user.UserID, "", "192.0.2.1", []string{"images:read"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, saved, err := NewTokenService().Authenticate(token.Token)
+	if err != nil {
+		t.Fatalf("令牌认证失败: %v", err)
+	}
+	scopes := ParseScopes(saved.Scopes)
+	if !TokenScopeAllowsPath(scopes, "/images", http.MethodGet) || TokenScopeAllowsPath(scopes, "/images", http.MethodPost) {
+		t.Errorf("保存的令牌范围 = %q", saved.Scopes)
+	}
+
+	// 上传工具的令牌只能上传图片
+	uploader, err := createToken(user.UserID, "uploader", "192.0.2.1", ScopeImages+":"+ScopeWrite, uploaderTokenTTL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	scopes = ParseScopes(uploader.Scopes)
+	if !TokenScopeAllows(scopes, S3BucketScope("images"), http.MethodPut) || TokenScopeAllows(scopes, S3BucketScope(S3BucketPrivate), http.MethodGet) {
+		t.Errorf("上传工具令牌的范围 = %q", uploader.Scopes)
+	}
+}
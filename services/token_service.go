@@ -6,11 +6,24 @@ import (
 	"errors"
 	"img_hosting/dao"
 	"img_hosting/models"
+	"strings"
 	"time"
 )
 
-// CreateToken 创建新的 token
-func CreateToken(userID uint, deviceID, ipAddress string) (*models.Token, error) {
+// defaultTokenTTL 普通 token 的有效期
+const defaultTokenTTL = 30 * 24 * time.Hour
+
+// CreateToken 创建新的 token，scopes 为令牌可以访问的范围（如 images:write）
+func CreateToken(userID uint, deviceID, ipAddress string, scopes []string) (*models.Token, error) {
+	scopeStr, err := NormalizeScopes(scopes)
+	if err != nil {
+		return nil, err
+	}
+	return createToken(userID, deviceID, ipAddress, scopeStr, defaultTokenTTL)
+}
+
+// createToken 创建指定有效期的 token
+func createToken(userID uint, deviceID, ipAddress, scopes string, ttl time.Duration) (*models.Token, error) {
 	// 生成随机 token
 	tokenBytes := make([]byte, 32)
 	if _, err := rand.Read(tokenBytes); err != nil {
@@ -25,11 +38,17 @@ func CreateToken(userID uint, deviceID, ipAddress string) (*models.Token, error)
 		deviceID = "dev_" + hex.EncodeToString(deviceBytes)
 	}
 
-	// 设置过期时间（30天）
-	expiresAt := time.Now().Add(30 * 24 * time.Hour)
+	// 设置过期时间
+	expiresAt := time.Now().Add(ttl)
+
+	// 同时生成 S3 接口使用的访问密钥 ID
+	accessKeyID, err := generateAccessKeyID()
+	if err != nil {
+		return nil, err
+	}
 
 	// 创建 token
-	err := dao.CreateToken(models.GetDB(), tokenString, userID, expiresAt, deviceID, ipAddress)
+	err = dao.CreateToken(models.GetDB(), tokenString, userID, expiresAt, deviceID, ipAddress, accessKeyID, scopes)
 	if err != nil {
 		return nil, err
 	}
@@ -37,9 +56,37 @@ func CreateToken(userID uint, deviceID, ipAddress string) (*models.Token, error)
 	return dao.GetTokenByString(models.GetDB(), tokenString)
 }
 
-// ListUserTokens 获取用户的所有 token
+// ListUserTokens 获取用户的所有 token，旧 token 没有访问密钥 ID 时补上
 func ListUserTokens(userID uint) ([]models.Token, error) {
-	return dao.ListUserTokens(models.GetDB(), userID)
+	db := models.GetDB()
+	tokens, err := dao.ListUserTokens(db, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	for i := range tokens {
+		if tokens[i].AccessKeyID != "" {
+			continue
+		}
+		accessKeyID, err := generateAccessKeyID()
+		if err != nil {
+			return nil, err
+		}
+		if err := dao.SetTokenAccessKey(db, tokens[i].Token, accessKeyID); err != nil {
+			return nil, err
+		}
+		tokens[i].AccessKeyID = accessKeyID
+	}
+	return tokens, nil
+}
+
+// generateAccessKeyID 生成 20 位的访问密钥 ID，格式与 AWS 的 AKIA... 类似
+func generateAccessKeyID() (string, error) {
+	b := make([]byte, 9)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return "AK" + strings.ToUpper(hex.EncodeToString(b)), nil
 }
 
 // RevokeToken 撤销指定的 token
@@ -64,17 +111,23 @@ func NewTokenService() *TokenService {
 
 // ValidateToken 验证token并返回用户信息
 func (s *TokenService) ValidateToken(tokenStr string) (*models.UserInfo, error) {
+	user, _, err := s.Authenticate(tokenStr)
+	return user, err
+}
+
+// Authenticate 验证token，返回用户信息和令牌记录（包含令牌范围）
+func (s *TokenService) Authenticate(tokenStr string) (*models.UserInfo, *models.Token, error) {
 	db := models.GetDB()
 
 	// 使用现有的 dao 方法获取 token
 	token, err := dao.GetTokenByString(db, tokenStr)
 	if err != nil {
-		return nil, errors.New("token无效")
+		return nil, nil, errors.New("token无效")
 	}
 
 	// 检查过期时间
 	if token.ExpiresAt.Before(time.Now()) {
-		return nil, errors.New("token已过期")
+		return nil, nil, errors.New("token已过期")
 	}
 
 	// 更新最后使用时间
@@ -83,10 +136,13 @@ func (s *TokenService) ValidateToken(tokenStr string) (*models.UserInfo, error)
 	// 获取用户信息
 	var user models.UserInfo
 	if err := db.First(&user, token.UserID).Error; err != nil {
-		return nil, errors.New("用户不存在")
+		return nil, nil, errors.New("用户不存在")
+	}
+	if isUserDisabled(user.Status) {
+		return nil, nil, ErrUserDisabled
 	}
 
-	return &user, nil
+	return &user, token, nil
 }
 
 // CheckFileAccess 检查用户是否有权限访问文件
@@ -0,0 +1,430 @@
+package services
+
+import (
+	"bytes"
+	"crypto/subtle"
+	"encoding/base32"
+	"errors"
+	"image/png"
+	"img_hosting/config"
+	"img_hosting/dao"
+	"img_hosting/models"
+	"img_hosting/pkg/cache"
+	"img_hosting/pkg/logger"
+	"strings"
+	"time"
+
+	"github.com/pquerna/otp"
+	"github.com/pquerna/otp/totp"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	totpPeriod             = 30
+	totpQRCodeSize         = 256
+	recoveryCodeCount      = 10
+	defaultChallengeTTL    = 5 * time.Minute
+	maxChallengeAttempts   = 5 // 同一次登录最多输错验证码的次数，超过后需要重新输入密码
+	defaultTwoFactorIssuer = "img_hosting"
+)
+
+var (
+	ErrTwoFactorNotEnabled     = errors.New("未启用两步验证")
+	ErrTwoFactorAlreadyEnabled = errors.New("已启用两步验证")
+	ErrTwoFactorNotPending     = errors.New("请先开始绑定验证器")
+	ErrTwoFactorCodeInvalid    = errors.New("验证码错误")
+	ErrTwoFactorRequired       = errors.New("当前角色必须启用两步验证，不能关闭")
+	ErrTwoFactorSetupRequired  = errors.New("当前角色必须启用两步验证，请先完成设置")
+	ErrChallengeInvalid        = errors.New("登录验证已失效，请重新登录")
+)
+
+// TOTPEnrollment 绑定验证器需要的信息
+type TOTPEnrollment struct {
+	Secret     string `json:"secret"`
+	OtpauthURL string `json:"otpauth_url"`
+}
+
+// TwoFactorStatus 用户的两步验证状态
+type TwoFactorStatus struct {
+	Enabled                bool  `json:"enabled"`
+	Pending                bool  `json:"pending"`  // 已生成密钥但尚未验证
+	Required               bool  `json:"required"` // 用户所在角色要求启用两步验证
+	RecoveryCodesRemaining int64 `json:"recovery_codes_remaining"`
+}
+
+// GetTwoFactorStatus 获取用户的两步验证状态
+func GetTwoFactorStatus(userID uint) (*TwoFactorStatus, error) {
+	db := models.GetDB()
+	setting, err := dao.GetUserTOTP(db, userID)
+	if err != nil {
+		return nil, err
+	}
+	required, err := isTwoFactorRequired(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	status := &TwoFactorStatus{Required: required}
+	if setting != nil {
+		status.Enabled = setting.Enabled
+		status.Pending = !setting.Enabled
+	}
+	if status.Enabled {
+		if status.RecoveryCodesRemaining, err = dao.CountUnusedRecoveryCodes(db, userID); err != nil {
+			return nil, err
+		}
+	}
+	return status, nil
+}
+
+// TwoFactorEnabled 用户是否已启用两步验证
+func TwoFactorEnabled(userID uint) (bool, error) {
+	setting, err := dao.GetUserTOTP(models.GetDB(), userID)
+	if err != nil {
+		return false, err
+	}
+	return setting != nil && setting.Enabled, nil
+}
+
+// BeginTOTPEnrollment 生成新的 TOTP 密钥，验证通过后才会启用；重复调用会生成新的密钥
+func BeginTOTPEnrollment(userID uint) (*TOTPEnrollment, error) {
+	db := models.GetDB()
+	setting, err := dao.GetUserTOTP(db, userID)
+	if err != nil {
+		return nil, err
+	}
+	if setting != nil && setting.Enabled {
+		return nil, ErrTwoFactorAlreadyEnabled
+	}
+
+	user, err := dao.GetUserByID(db, userID)
+	if err != nil {
+		return nil, err
+	}
+	key, err := totp.Generate(totp.GenerateOpts{
+		Issuer:      twoFactorIssuer(),
+		AccountName: user.Email,
+		Period:      totpPeriod,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if err := dao.SaveUserTOTP(db, &models.UserTOTP{UserID: userID, Secret: key.Secret()}); err != nil {
+		return nil, err
+	}
+	return &TOTPEnrollment{Secret: key.Secret(), OtpauthURL: key.URL()}, nil
+}
+
+// TOTPQRCode 返回正在绑定的密钥的二维码（PNG），启用后不再提供，避免密钥再次泄露
+func TOTPQRCode(userID uint) ([]byte, error) {
+	db := models.GetDB()
+	setting, err := dao.GetUserTOTP(db, userID)
+	if err != nil {
+		return nil, err
+	}
+	if setting == nil || setting.Enabled {
+		return nil, ErrTwoFactorNotPending
+	}
+
+	user, err := dao.GetUserByID(db, userID)
+	if err != nil {
+		return nil, err
+	}
+	secret, err := base32.StdEncoding.WithPadding(base32.NoPadding).DecodeString(setting.Secret)
+	if err != nil {
+		return nil, err
+	}
+	key, err := totp.Generate(totp.GenerateOpts{
+		Issuer:      twoFactorIssuer(),
+		AccountName: user.Email,
+		Period:      totpPeriod,
+		Secret:      secret,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	img, err := key.Image(totpQRCodeSize, totpQRCodeSize)
+	if err != nil {
+		return nil, err
+	}
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// ConfirmTOTPEnrollment 验证验证器生成的验证码并启用两步验证，返回恢复码（只显示这一次）
+func ConfirmTOTPEnrollment(userID uint, code string) ([]string, error) {
+	db := models.GetDB()
+	setting, err := dao.GetUserTOTP(db, userID)
+	if err != nil {
+		return nil, err
+	}
+	if setting == nil || setting.Enabled {
+		return nil, ErrTwoFactorNotPending
+	}
+	ok, err := verifyTOTPCode(setting, code)
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return nil, ErrTwoFactorCodeInvalid
+	}
+
+	if err := dao.EnableUserTOTP(db, userID); err != nil {
+		return nil, err
+	}
+	codes, err := resetRecoveryCodes(userID)
+	if err != nil {
+		return nil, err
+	}
+	cache.ClearUserAuthState(userID)
+
+	logger.GetLogger().WithField("user_id", userID).Info("用户启用两步验证")
+	return codes, nil
+}
+
+// DisableTOTP 关闭两步验证，需要验证码或恢复码；角色要求启用时不能关闭
+func DisableTOTP(userID uint, code string) error {
+	if err := verifyTwoFactor(userID, code); err != nil {
+		return err
+	}
+	required, err := isTwoFactorRequired(userID)
+	if err != nil {
+		return err
+	}
+	if required {
+		return ErrTwoFactorRequired
+	}
+
+	if err := dao.DeleteUserTOTP(models.GetDB(), userID); err != nil {
+		return err
+	}
+	cache.ClearUserAuthState(userID)
+
+	logger.GetLogger().WithField("user_id", userID).Info("用户关闭两步验证")
+	return nil
+}
+
+// RegenerateRecoveryCodes 重新生成恢复码，旧的恢复码全部失效
+func RegenerateRecoveryCodes(userID uint, code string) ([]string, error) {
+	if err := verifyTwoFactor(userID, code); err != nil {
+		return nil, err
+	}
+	return resetRecoveryCodes(userID)
+}
+
+// ResetTwoFactor 管理员重置用户的两步验证（用户丢失验证器和恢复码时使用）
+// 角色要求两步验证的用户下次登录后需要重新绑定
+func ResetTwoFactor(userID uint) error {
+	if err := dao.DeleteUserTOTP(models.GetDB(), userID); err != nil {
+		return err
+	}
+	cache.ClearUserAuthState(userID)
+
+	logger.GetLogger().WithField("user_id", userID).Warn("管理员重置了用户的两步验证")
+	return nil
+}
+
+// StartLoginChallenge 密码验证通过后创建两步验证凭证，凭证只保存哈希
+func StartLoginChallenge(userID uint, ipAddress string) (string, time.Duration, error) {
+	challenge, err := randomToken(32)
+	if err != nil {
+		return "", 0, err
+	}
+
+	ttl := time.Duration(config.GetConfig().TwoFactor.ChallengeTTL) * time.Second
+	if ttl <= 0 {
+		ttl = defaultChallengeTTL
+	}
+
+	err = dao.CreateChallengeToken(models.GetDB(), &models.Token{
+		Token:      hashRefreshToken(challenge),
+		UserID:     userID,
+		ExpiresAt:  time.Now().Add(ttl),
+		IPAddress:  ipAddress,
+		Status:     models.TokenStatusActive,
+		LastUsedAt: time.Now(),
+	})
+	if err != nil {
+		return "", 0, err
+	}
+	return challenge, ttl, nil
+}
+
+// VerifyLoginChallenge 用验证码或恢复码完成登录，返回用户ID
+// 验证码连续错误 maxChallengeAttempts 次后凭证失效，错误同样计入账号的登录失败次数
+func VerifyLoginChallenge(challenge, code, ipAddress, userAgent string) (uint, error) {
+	db := models.GetDB()
+	challengeHash := hashRefreshToken(challenge)
+
+	token, err := dao.GetChallengeToken(db, challengeHash)
+	if err != nil || token.ExpiresAt.Before(time.Now()) {
+		return 0, ErrChallengeInvalid
+	}
+	if err := CheckUserActive(token.UserID); err != nil {
+		return 0, err
+	}
+	unlock := lockLogin(token.UserID, "")
+	defer unlock()
+	if err := CheckLoginThrottle(token.UserID, "", ipAddress); err != nil {
+		return 0, err
+	}
+
+	if err := verifyTwoFactor(token.UserID, code); err != nil {
+		if errors.Is(err, ErrTwoFactorCodeInvalid) {
+			RecordLoginAttempt(token.UserID, "", ipAddress, userAgent, models.LoginResultTwoFactorFailure)
+			if incErr := dao.IncrementTokenAttempts(db, challengeHash, maxChallengeAttempts); incErr != nil {
+				return 0, incErr
+			}
+			logger.GetLogger().WithFields(logrus.Fields{
+				"user_id":  token.UserID,
+				"attempts": token.Attempts + 1,
+			}).Warn("登录两步验证失败")
+		}
+		return 0, err
+	}
+
+	consumed, err := dao.ConsumeChallengeToken(db, challengeHash)
+	if err != nil {
+		return 0, err
+	}
+	if !consumed {
+		return 0, ErrChallengeInvalid
+	}
+	return token.UserID, nil
+}
+
+// CheckTwoFactorSetup 角色要求两步验证但用户尚未启用时返回 ErrTwoFactorSetupRequired
+func CheckTwoFactorSetup(userID uint) error {
+	state, err := getUserAuthState(userID)
+	if err != nil {
+		return err
+	}
+	if state.TwoFactorSetupRequired {
+		return ErrTwoFactorSetupRequired
+	}
+	return nil
+}
+
+// twoFactorSetupRequired 计算认证状态缓存中的 TwoFactorSetupRequired
+func twoFactorSetupRequired(userID uint) (bool, error) {
+	required, err := isTwoFactorRequired(userID)
+	if err != nil || !required {
+		return false, err
+	}
+	enabled, err := TwoFactorEnabled(userID)
+	return !enabled, err
+}
+
+// isTwoFactorRequired 用户的角色是否在 two_factor.required_roles 中
+func isTwoFactorRequired(userID uint) (bool, error) {
+	requiredRoles := config.GetConfig().TwoFactor.RequiredRoles
+	if len(requiredRoles) == 0 {
+		return false, nil
+	}
+	roles, err := dao.GetUserRoles(models.GetDB(), userID)
+	if err != nil {
+		return false, err
+	}
+	for _, role := range roles {
+		for _, name := range requiredRoles {
+			if role.RoleName == name {
+				return true, nil
+			}
+		}
+	}
+	return false, nil
+}
+
+// verifyTwoFactor 校验验证码或恢复码
+func verifyTwoFactor(userID uint, code string) error {
+	db := models.GetDB()
+	setting, err := dao.GetUserTOTP(db, userID)
+	if err != nil {
+		return err
+	}
+	if setting == nil || !setting.Enabled {
+		return ErrTwoFactorNotEnabled
+	}
+
+	// 6 位数字为验证码，其余按恢复码处理
+	code = strings.TrimSpace(code)
+	if len(code) == int(otp.DigitsSix) && strings.Trim(code, "0123456789") == "" {
+		ok, err := verifyTOTPCode(setting, code)
+		if err != nil {
+			return err
+		}
+		if !ok {
+			return ErrTwoFactorCodeInvalid
+		}
+		return nil
+	}
+
+	used, err := dao.UseRecoveryCode(db, userID, hashRecoveryCode(code))
+	if err != nil {
+		return err
+	}
+	if !used {
+		return ErrTwoFactorCodeInvalid
+	}
+	logger.GetLogger().WithField("user_id", userID).Info("使用恢复码完成两步验证")
+	return nil
+}
+
+// verifyTOTPCode 校验验证码，允许前后各一个时间步的误差；同一时间步的验证码只能使用一次
+func verifyTOTPCode(setting *models.UserTOTP, code string) (bool, error) {
+	code = strings.TrimSpace(code)
+	now := time.Now()
+	for _, skew := range []int64{0, -1, 1} {
+		t := now.Add(time.Duration(skew*totpPeriod) * time.Second)
+		expected, err := totp.GenerateCodeCustom(setting.Secret, t, totp.ValidateOpts{
+			Period:    totpPeriod,
+			Digits:    otp.DigitsSix,
+			Algorithm: otp.AlgorithmSHA1,
+		})
+		if err != nil {
+			return false, err
+		}
+		if subtle.ConstantTimeCompare([]byte(expected), []byte(code)) == 1 {
+			return dao.UseTOTPStep(models.GetDB(), setting.UserID, t.Unix()/totpPeriod)
+		}
+	}
+	return false, nil
+}
+
+// resetRecoveryCodes 生成新的恢复码，数据库中只保存哈希
+func resetRecoveryCodes(userID uint) ([]string, error) {
+	codes := make([]string, 0, recoveryCodeCount)
+	hashes := make([]string, 0, recoveryCodeCount)
+	for i := 0; i < recoveryCodeCount; i++ {
+		b, err := randomBytes(7)
+		if err != nil {
+			return nil, err
+		}
+		raw := strings.ToLower(base32.StdEncoding.WithPadding(base32.NoPadding).EncodeToString(b))[:10]
+		code := raw[:5] + "-" + raw[5:]
+		codes = append(codes, code)
+		hashes = append(hashes, hashRecoveryCode(code))
+	}
+	if err := dao.ReplaceRecoveryCodes(models.GetDB(), userID, hashes); err != nil {
+		return nil, err
+	}
+	return codes, nil
+}
+
+// hashRecoveryCode 恢复码不区分大小写，忽略连字符和空格
+func hashRecoveryCode(code string) string {
+	code = strings.ToLower(strings.NewReplacer("-", "", " ", "").Replace(code))
+	return hashRefreshToken(code)
+}
+
+func twoFactorIssuer() string {
+	if issuer := config.GetConfig().TwoFactor.Issuer; issuer != "" {
+		return issuer
+	}
+	return defaultTwoFactorIssuer
+}
@@ -0,0 +1,147 @@
+package services
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/pquerna/otp"
+	"github.com/pquerna/otp/totp"
+)
+
+// totpCodeAt 生成 at 时刻的验证码
+func totpCodeAt(t *testing.T, secret string, at time.Time) string {
+	t.Helper()
+	code, err := totp.GenerateCodeCustom(secret, at, totp.ValidateOpts{
+		Period:    totpPeriod,
+		Digits:    otp.DigitsSix,
+		Algorithm: otp.AlgorithmSHA1,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return code
+}
+
+// enableTestTOTP 为用户启用两步验证，返回密钥和恢复码
+// 绑定时使用上一个时间步的验证码，当前时间步留给测试使用
+func enableTestTOTP(t *testing.T, userID uint) (string, []string) {
+	t.Helper()
+	enrollment, err := BeginTOTPEnrollment(userID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	codes, err := ConfirmTOTPEnrollment(userID, totpCodeAt(t, enrollment.Secret, time.Now().Add(-totpPeriod*time.Second)))
+	if err != nil {
+		t.Fatalf("启用两步验证失败: %v", err)
+	}
+	return enrollment.Secret, codes
+}
+
+func TestTOTPCodeCannotBeReused(t *testing.T) {
+	user := createTestUser(t)
+	secret, _ := enableTestTOTP(t, user.UserID)
+
+	code := totpCodeAt(t, secret, time.Now())
+	if err := verifyTwoFactor(user.UserID, code); err != nil {
+		t.Fatalf("验证码校验失败: %v", err)
+	}
+	if err := verifyTwoFactor(user.UserID, code); !errors.Is(err, ErrTwoFactorCodeInvalid) {
+		t.Errorf("同一个验证码再次使用应返回 ErrTwoFactorCodeInvalid，got %v", err)
+	}
+}
+
+func TestTOTPEarlierStepRejected(t *testing.T) {
+	user := createTestUser(t)
+	secret, _ := enableTestTOTP(t, user.UserID)
+
+	// 使用下一个时间步的验证码后，更早时间步的验证码都不能再用
+	now := time.Now()
+	if err := verifyTwoFactor(user.UserID, totpCodeAt(t, secret, now.Add(totpPeriod*time.Second))); err != nil {
+		t.Fatalf("下一个时间步的验证码应在允许的误差内: %v", err)
+	}
+	if err := verifyTwoFactor(user.UserID, totpCodeAt(t, secret, now)); !errors.Is(err, ErrTwoFactorCodeInvalid) {
+		t.Errorf("更早时间步的验证码应被拒绝，got %v", err)
+	}
+
+	// 超出误差范围的验证码无效
+	other := createTestUser(t)
+	secret, _ = enableTestTOTP(t, other.UserID)
+	if err := verifyTwoFactor(other.UserID, totpCodeAt(t, secret, now.Add(3*totpPeriod*time.Second))); !errors.Is(err, ErrTwoFactorCodeInvalid) {
+		t.Errorf("超出误差范围的验证码应被拒绝，got %v", err)
+	}
+}
+
+func TestTOTPEnrollmentStepCannotBeReplayed(t *testing.T) {
+	user := createTestUser(t)
+	enrollment, err := BeginTOTPEnrollment(user.UserID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	code := totpCodeAt(t, enrollment.Secret, time.Now())
+	if _, err := ConfirmTOTPEnrollment(user.UserID, code); err != nil {
+		t.Fatalf("启用两步验证失败: %v", err)
+	}
+	// 绑定时使用的验证码不能再用于登录
+	if err := verifyTwoFactor(user.UserID, code); !errors.Is(err, ErrTwoFactorCodeInvalid) {
+		t.Errorf("绑定时使用的验证码应失效，got %v", err)
+	}
+}
+
+func TestRecoveryCodeSingleUse(t *testing.T) {
+	user := createTestUser(t)
+	_, codes := enableTestTOTP(t, user.UserID)
+	if len(codes) != recoveryCodeCount {
+		t.Fatalf("恢复码数量 = %d, want %d", len(codes), recoveryCodeCount)
+	}
+
+	// 恢复码不区分大小写，忽略连字符
+	if err := verifyTwoFactor(user.UserID, " "+codes[0]+" "); err != nil {
+		t.Fatalf("恢复码校验失败: %v", err)
+	}
+	if err := verifyTwoFactor(user.UserID, codes[0]); !errors.Is(err, ErrTwoFactorCodeInvalid) {
+		t.Errorf("恢复码再次使用应返回 ErrTwoFactorCodeInvalid，got %v", err)
+	}
+	if err := verifyTwoFactor(user.UserID, strings.ToUpper(strings.ReplaceAll(codes[1], "-", ""))); err != nil {
+		t.Errorf("大写且不带连字符的恢复码应有效: %v", err)
+	}
+
+	status, err := GetTwoFactorStatus(user.UserID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if status.RecoveryCodesRemaining != recoveryCodeCount-2 {
+		t.Errorf("剩余恢复码 = %d, want %d", status.RecoveryCodesRemaining, recoveryCodeCount-2)
+	}
+}
+
+func TestLoginChallengeCodeReuse(t *testing.T) {
+	user := createTestUser(t)
+	secret, _ := enableTestTOTP(t, user.UserID)
+	const ip = "192.0.2.45"
+
+	challenge, _, err := StartLoginChallenge(user.UserID, ip)
+	if err != nil {
+		t.Fatal(err)
+	}
+	code := totpCodeAt(t, secret, time.Now())
+	userID, err := VerifyLoginChallenge(challenge, code, ip, "test")
+	if err != nil || userID != user.UserID {
+		t.Fatalf("完成两步验证失败: %d, %v", userID, err)
+	}
+
+	// 登录凭证只能使用一次
+	if _, err := VerifyLoginChallenge(challenge, code, ip, "test"); !errors.Is(err, ErrChallengeInvalid) {
+		t.Errorf("凭证再次使用应返回 ErrChallengeInvalid，got %v", err)
+	}
+
+	// 截获的验证码不能用于新的登录凭证
+	challenge, _, err = StartLoginChallenge(user.UserID, ip)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := VerifyLoginChallenge(challenge, code, ip, "test"); !errors.Is(err, ErrTwoFactorCodeInvalid) {
+		t.Errorf("已使用的验证码应返回 ErrTwoFactorCodeInvalid，got %v", err)
+	}
+}
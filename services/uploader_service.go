@@ -0,0 +1,157 @@
+package services
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"img_hosting/config"
+	"img_hosting/dao"
+	"img_hosting/models"
+	"img_hosting/pkg/logger"
+	"mime/multipart"
+	"strings"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+)
+
+// ErrDeleteKeyNotFound 删除链接无效或图片已被删除
+var ErrDeleteKeyNotFound = errors.New("删除链接无效或图片已被删除")
+
+// uploaderTokenTTL 上传工具配置中内置的 API 令牌有效期
+const uploaderTokenTTL = 365 * 24 * time.Hour
+
+// uploaderName 上传工具配置中显示的名称
+const uploaderName = "img_hosting"
+
+// UploaderResult 第三方上传工具上传成功后的结果
+type UploaderResult struct {
+	ImageID   uint
+	ImageURL  string
+	DeleteKey string
+}
+
+// ShareXConfig ShareX 自定义上传器配置（.sxcu）
+type ShareXConfig struct {
+	Version         string            `json:"Version"`
+	Name            string            `json:"Name"`
+	DestinationType string            `json:"DestinationType"`
+	RequestMethod   string            `json:"RequestMethod"`
+	RequestURL      string            `json:"RequestURL"`
+	Headers         map[string]string `json:"Headers"`
+	Body            string            `json:"Body"`
+	FileFormName    string            `json:"FileFormName"`
+	URL             string            `json:"URL"`
+	DeletionURL     string            `json:"DeletionURL"`
+	ErrorMessage    string            `json:"ErrorMessage"`
+}
+
+// UploadImageForUploader 上传图片并生成删除链接密钥，供 ShareX、PicGo 等工具使用
+// 数据库中只保存密钥的哈希，密钥与图片记录在同一事务中保存
+func UploadImageForUploader(userID uint, file *multipart.FileHeader, description string) (*UploaderResult, error) {
+	deleteKey, err := generateDeleteKey()
+	if err != nil {
+		return nil, fmt.Errorf("生成删除链接失败: %w", err)
+	}
+
+	imageID, imageURL, err := uploadImage(userID, file, description, hashRefreshToken(deleteKey))
+	if err != nil {
+		return nil, err
+	}
+
+	return &UploaderResult{
+		ImageID:   imageID,
+		ImageURL:  imageURL,
+		DeleteKey: deleteKey,
+	}, nil
+}
+
+// DeleteImageByKey 通过删除链接删除图片，不需要登录
+func DeleteImageByKey(deleteKey string) error {
+	if deleteKey == "" {
+		return ErrDeleteKeyNotFound
+	}
+
+	image, err := dao.GetImageByDeleteKeyHash(models.GetDB(), hashRefreshToken(deleteKey))
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return ErrDeleteKeyNotFound
+		}
+		return err
+	}
+
+	logger.GetLogger().WithFields(logrus.Fields{
+		"image_id": image.ImageID,
+		"user_id":  image.UserID,
+	}).Info("通过删除链接删除图片")
+	return DeleteImage(image.ImageID, image.UserID)
+}
+
+// CreateUploaderToken 为上传工具配置创建一个长期有效的 API 令牌，可在令牌管理中撤销
+// 令牌只有 images:write 范围，泄露后不能访问私人文件等其他接口
+func CreateUploaderToken(userID uint, client, ipAddress string) (*models.Token, error) {
+	return createToken(userID, client, ipAddress, ScopeImages+":"+ScopeWrite, uploaderTokenTTL)
+}
+
+// UploaderBaseURL 返回生成上传工具配置和删除链接使用的 API 地址
+// 优先使用配置 url.apiurl，未配置时使用 requestBase（由请求的协议和 Host 组成）
+func UploaderBaseURL(requestBase string) string {
+	if base := config.GetConfig().Url.Apiurl; base != "" {
+		return strings.TrimRight(base, "/")
+	}
+	return strings.TrimRight(requestBase, "/")
+}
+
+// UploaderDeleteURL 拼接删除链接
+func UploaderDeleteURL(baseURL, deleteKey string) string {
+	return baseURL + "/api/delete/" + deleteKey
+}
+
+// BuildShareXConfig 生成 ShareX 自定义上传器配置
+func BuildShareXConfig(baseURL, token string) *ShareXConfig {
+	return &ShareXConfig{
+		Version:         "15.0.0",
+		Name:            uploaderName,
+		DestinationType: "ImageUploader",
+		RequestMethod:   "POST",
+		RequestURL:      baseURL + "/api/upload",
+		Headers:         map[string]string{"Authorization": "Bearer " + token},
+		Body:            "MultipartFormData",
+		FileFormName:    "file",
+		URL:             "{json:data.url}",
+		DeletionURL:     "{json:data.delete_url}",
+		ErrorMessage:    "{json:message}",
+	}
+}
+
+// BuildPicGoConfig 生成 PicGo（picgo-plugin-web-uploader）配置，可合并到 PicGo 的 data.json 中
+// Typora 使用 PicGo 作为上传服务时同样适用
+func BuildPicGoConfig(baseURL, token string) map[string]interface{} {
+	return map[string]interface{}{
+		"picBed": map[string]interface{}{
+			"uploader": "web-uploader",
+			"current":  "web-uploader",
+			"web-uploader": map[string]interface{}{
+				"url":          baseURL + "/api/upload",
+				"paramName":    "file",
+				"jsonPath":     "data.url",
+				"customHeader": fmt.Sprintf(`{"Authorization":"Bearer %s"}`, token),
+				"customBody":   "",
+			},
+		},
+		"picgoPlugins": map[string]interface{}{
+			"picgo-plugin-web-uploader": true,
+		},
+	}
+}
+
+// generateDeleteKey 生成随机的删除链接密钥
+func generateDeleteKey() (string, error) {
+	b := make([]byte, 24)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
@@ -0,0 +1,110 @@
+package services
+
+import (
+	"bytes"
+	"errors"
+	"image"
+	"image/color"
+	"image/png"
+	"img_hosting/dao"
+	"img_hosting/models"
+	"mime/multipart"
+	"testing"
+
+	"gorm.io/gorm"
+)
+
+// testPNG 生成一张内容由 seed 决定的 PNG 图片
+func testPNG(t *testing.T, seed uint) []byte {
+	t.Helper()
+	img := image.NewRGBA(image.Rect(0, 0, 64, 64))
+	for y := 0; y < 64; y++ {
+		for x := 0; x < 64; x++ {
+			img.Set(x, y, color.RGBA{R: uint8(x * 4), G: uint8(y * 4), B: uint8(seed), A: 255})
+		}
+	}
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+// multipartFile 把内容包装成表单上传的文件
+func multipartFile(t *testing.T, fileName string, data []byte) *multipart.FileHeader {
+	t.Helper()
+	var body bytes.Buffer
+	w := multipart.NewWriter(&body)
+	part, err := w.CreateFormFile("file", fileName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	part.Write(data)
+	w.Close()
+
+	form, err := multipart.NewReader(&body, w.Boundary()).ReadForm(10 << 20)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { form.RemoveAll() })
+	return form.File["file"][0]
+}
+
+func TestDeleteKeyIsStoredHashed(t *testing.T) {
+	user := createTestUser(t)
+
+	result, err := UploadImageForUploader(user.UserID, multipartFile(t, "shot.png", testPNG(t, user.UserID)), "")
+	if err != nil {
+		t.Fatalf("上传失败: %v", err)
+	}
+	if result.DeleteKey == "" {
+		t.Fatal("应返回删除链接密钥")
+	}
+
+	img, err := dao.GetImageByID(models.GetDB(), result.ImageID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if img.DeleteKeyHash == "" || img.DeleteKeyHash == result.DeleteKey {
+		t.Fatalf("数据库中应只保存密钥的哈希，got %q", img.DeleteKeyHash)
+	}
+
+	// 数据库中的哈希不能当作密钥使用
+	if err := DeleteImageByKey(img.DeleteKeyHash); !errors.Is(err, ErrDeleteKeyNotFound) {
+		t.Errorf("使用哈希删除应失败，got %v", err)
+	}
+	if err := DeleteImageByKey(""); !errors.Is(err, ErrDeleteKeyNotFound) {
+		t.Errorf("空密钥应返回 ErrDeleteKeyNotFound，got %v", err)
+	}
+
+	if err := DeleteImageByKey(result.DeleteKey); err != nil {
+		t.Fatalf("通过删除链接删除失败: %v", err)
+	}
+	if _, err := dao.GetImageByID(models.GetDB(), result.ImageID); !errors.Is(err, gorm.ErrRecordNotFound) {
+		t.Errorf("图片应已删除，got %v", err)
+	}
+	if err := DeleteImageByKey(result.DeleteKey); !errors.Is(err, ErrDeleteKeyNotFound) {
+		t.Errorf("重复删除应返回 ErrDeleteKeyNotFound，got %v", err)
+	}
+
+	// 删除后可以重新上传同一张图片
+	if _, err := UploadImageForUploader(user.UserID, multipartFile(t, "shot.png", testPNG(t, user.UserID)), ""); err != nil {
+		t.Errorf("删除后重新上传失败: %v", err)
+	}
+}
+
+func TestUploadWithoutDeleteKey(t *testing.T) {
+	user := createTestUser(t)
+
+	imageID, _, err := UploadImage(user.UserID, multipartFile(t, "plain.png", testPNG(t, user.UserID+100)), "")
+	if err != nil {
+		t.Fatalf("上传失败: %v", err)
+	}
+	img, err := dao.GetImageByID(models.GetDB(), imageID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if img.DeleteKeyHash != "" {
+		t.Errorf("普通上传不应生成删除链接，got %q", img.DeleteKeyHash)
+	}
+}
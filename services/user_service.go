@@ -6,12 +6,21 @@ import (
 	"img_hosting/dao"
 	"img_hosting/models"
 
+	"img_hosting/pkg/cache"
 	"img_hosting/pkg/logger"
 
 	"github.com/sirupsen/logrus"
+	"golang.org/x/crypto/bcrypt"
 	"gorm.io/gorm"
 )
 
+var (
+	// ErrWrongPassword 原密码错误
+	ErrWrongPassword = errors.New("原密码错误")
+	// ErrEmailTaken 邮箱已被其他账号使用
+	ErrEmailTaken = errors.New("邮箱已被使用")
+)
+
 type UserService struct{}
 
 // GetUserProfile 获取用户信息
@@ -20,21 +29,21 @@ func (s *UserService) GetUserProfile(userID uint) (*models.UserInfo, error) {
 	return dao.GetUserByID(db, userID)
 }
 
-// UpdateUserProfile 更新用户信息
-func (s *UserService) UpdateUserProfile(userID uint, updates map[string]interface{}) error {
+// UpdateUserProfile 更新用户信息，返回是否需要重新验证邮箱
+func (s *UserService) UpdateUserProfile(userID uint, updates map[string]interface{}) (bool, error) {
 	db := models.GetDB()
 	user, err := dao.GetUserByID(db, userID)
 	if err != nil {
-		return err
+		return false, err
 	}
+	oldEmail := user.Email
 
-	// 只更新允许的字段
+	// 只更新允许的字段，用户状态只能由管理员修改
 	allowedFields := map[string]bool{
-		"name":   true,
-		"email":  true,
-		"phone":  true,
-		"age":    true,
-		"status": true,
+		"name":  true,
+		"email": true,
+		"phone": true,
+		"age":   true,
 	}
 
 	updateData := make(map[string]interface{})
@@ -52,11 +61,39 @@ func (s *UserService) UpdateUserProfile(userID uint, updates map[string]interfac
 	if age, ok := updateData["age"].(int); ok {
 		user.Age = age
 	}
-	if status, ok := updateData["status"].(string); ok {
-		user.Status = status
+
+	// 邮箱用于登录、找回密码和单点登录关联，不能与其他账号重复
+	if user.Email != oldEmail {
+		other, err := dao.GetUserByEmail(db, user.Email)
+		if err != nil && err.Error() != "用户不存在" {
+			return false, err
+		}
+		if other != nil && other.UserID != userID {
+			return false, ErrEmailTaken
+		}
 	}
 
-	return dao.UpdateUser(db, user)
+	// 修改邮箱后需要重新验证，旧邮箱的验证链接失效
+	reverify := user.Email != oldEmail && EmailVerificationRequired() && user.Status == models.UserStatusActive
+	if reverify {
+		user.Status = models.UserStatusUnverified
+	}
+	if err := dao.UpdateUser(db, user); err != nil {
+		if errors.Is(err, gorm.ErrDuplicatedKey) {
+			return false, ErrEmailTaken
+		}
+		return false, err
+	}
+	if user.Email != oldEmail {
+		if err := dao.ClearEmailVerified(db, userID); err != nil {
+			return false, err
+		}
+		if err := dao.RevokeUserTokensByType(db, userID, models.TokenTypeEmailVerify); err != nil {
+			return false, err
+		}
+		cache.ClearUserAuthState(userID)
+	}
+	return reverify, nil
 }
 
 // ListUsers 获取用户列表
@@ -122,6 +159,8 @@ func (s *UserService) DeleteUser(userID uint) error {
 		return fmt.Errorf("删除用户失败: %w", err)
 	}
 
+	// 已删除用户的令牌立即失效
+	cache.ClearUserAuthState(userID)
 	return nil
 }
 
@@ -154,12 +193,44 @@ func (s *UserService) UpdateUserStatus(userID uint, status string) error {
 	}
 
 	db := models.GetDB()
-	return dao.UpdateUserStatus(db, userID, status)
+	if err := dao.UpdateUserStatus(db, userID, status); err != nil {
+		return err
+	}
+
+	// 封禁或停用时立即撤销所有登录，重新启用后也需要重新登录
+	if isUserDisabled(status) {
+		return RevokeUserSessions(userID)
+	}
+	cache.ClearUserAuthState(userID)
+	return nil
+}
+
+// ChangePassword 修改密码，成功后撤销用户的所有登录和个人 API 令牌
+func (s *UserService) ChangePassword(userID uint, oldPassword, newPassword string) error {
+	db := models.GetDB()
+	user, err := dao.GetUserByID(db, userID)
+	if err != nil {
+		return err
+	}
+	if err := bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(oldPassword)); err != nil {
+		return ErrWrongPassword
+	}
+
+	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(newPassword), bcrypt.DefaultCost)
+	if err != nil {
+		return err
+	}
+	if err := dao.UpdateUserPassword(db, userID, string(hashedPassword)); err != nil {
+		return err
+	}
+	return RevokeUserCredentials(userID)
 }
 
 // ManageUserRoles 管理用户角色
 func (s *UserService) ManageUserRoles(userID uint, roleID uint, isAdd bool) error {
 	db := models.GetDB()
+	// 角色可能要求两步验证，认证状态需要重新计算
+	defer cache.ClearUserAuthState(userID)
 	if isAdd {
 		return dao.AssignRoleToUser(db, userID, roleID)
 	}
@@ -182,6 +253,7 @@ func (s *UserService) SearchUsers(keyword string, page, pageSize int) ([]models.
 func (s *UserService) AssignRoles(userID uint, roleNames []string) error {
 	fmt.Printf("开始分配角色: userID=%d, roles=%v\n", userID, roleNames)
 	db := models.GetDB()
+	defer cache.ClearUserAuthState(userID)
 
 	// 开启事务
 	return db.Transaction(func(tx *gorm.DB) error {
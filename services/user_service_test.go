@@ -0,0 +1,81 @@
+package services
+
+import (
+	"errors"
+	"img_hosting/dao"
+	"img_hosting/models"
+	"testing"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+func profileUpdates(user *models.UserInfo, email string) map[string]interface{} {
+	return map[string]interface{}{"name": user.Name, "email": email}
+}
+
+func TestUpdateProfileEmailMustBeUnique(t *testing.T) {
+	s := &UserService{}
+	user := createTestUser(t)
+	other := createTestUser(t)
+
+	if _, err := s.UpdateUserProfile(user.UserID, profileUpdates(user, other.Email)); !errors.Is(err, ErrEmailTaken) {
+		t.Fatalf("使用其他账号的邮箱应返回 ErrEmailTaken，got %v", err)
+	}
+	saved, err := dao.GetUserByID(models.GetDB(), user.UserID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if saved.Email != user.Email {
+		t.Errorf("邮箱不应被修改: %s", saved.Email)
+	}
+
+	// 修改为自己当前的邮箱不受影响
+	if _, err := s.UpdateUserProfile(user.UserID, profileUpdates(user, user.Email)); err != nil {
+		t.Errorf("保持原邮箱不应报错: %v", err)
+	}
+}
+
+func TestUserEmailUniqueIndex(t *testing.T) {
+	db := models.GetDB()
+	user := createTestUser(t)
+
+	// 绕过服务层直接写入时由唯一索引拦截
+	duplicate := &models.UserInfo{Name: user.Name + "_dup", Email: user.Email, Status: models.UserStatusActive}
+	if err := db.Create(duplicate).Error; !errors.Is(err, gorm.ErrDuplicatedKey) {
+		t.Fatalf("重复邮箱应被唯一索引拒绝，got %v", err)
+	}
+
+	// 已删除用户的邮箱可以重新注册
+	if err := db.Delete(&models.UserInfo{}, user.UserID).Error; err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Create(duplicate).Error; err != nil {
+		t.Errorf("已删除用户的邮箱应可以重新使用: %v", err)
+	}
+}
+
+func TestUpdateProfileEmailClearsVerification(t *testing.T) {
+	db := models.GetDB()
+	user := createTestUser(t)
+	now := time.Now()
+	if err := db.Model(user).Update("email_verified_at", &now).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	// 未开启邮箱验证时状态不变，但新邮箱未经验证，不能用于单点登录关联
+	reverify, err := (&UserService{}).UpdateUserProfile(user.UserID, profileUpdates(user, "changed-"+user.Email))
+	if err != nil || reverify {
+		t.Fatalf("修改邮箱失败: %v, %v", reverify, err)
+	}
+	saved, err := dao.GetUserByID(db, user.UserID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if saved.EmailVerifiedAt != nil || saved.Status != models.UserStatusActive {
+		t.Errorf("修改邮箱后应清除验证时间: %+v", saved)
+	}
+	if _, err := resolveOIDCUser(db, testOIDCProvider(), testOIDCClaims("sub-changed", saved.Email, true)); !errors.Is(err, ErrOIDCLinkUnverified) {
+		t.Errorf("未验证的新邮箱不应关联单点登录，got %v", err)
+	}
+}
@@ -0,0 +1,251 @@
+package services
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"image"
+	"img_hosting/config"
+	"img_hosting/dao"
+	"img_hosting/models"
+	"img_hosting/pkg/animation"
+	"img_hosting/pkg/imageenc"
+	"img_hosting/pkg/logger"
+	"img_hosting/pkg/watermark"
+	"path/filepath"
+	"strings"
+
+	"github.com/disintegration/imaging"
+	"github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+)
+
+// GetWatermarkSetting 获取用户的水印设置，用户未单独设置时返回全局设置
+func GetWatermarkSetting(userID uint) (*models.WatermarkSetting, error) {
+	setting, err := dao.GetWatermarkSetting(models.GetDB(), userID)
+	if err == nil {
+		return setting, nil
+	}
+	if !errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, err
+	}
+	return defaultWatermarkSetting(userID), nil
+}
+
+// defaultWatermarkSetting 配置文件中的全局水印设置
+func defaultWatermarkSetting(userID uint) *models.WatermarkSetting {
+	cfg := config.GetConfig().Watermark
+	return &models.WatermarkSetting{
+		UserID:          userID,
+		Enabled:         cfg.Enabled,
+		Type:            cfg.Type,
+		Text:            cfg.Text,
+		Color:           cfg.Color,
+		Position:        cfg.Position,
+		Opacity:         cfg.Opacity,
+		Scale:           cfg.Scale,
+		ApplyToOriginal: cfg.ApplyToOriginal,
+		IsDefault:       true,
+	}
+}
+
+// SaveWatermarkSetting 保存用户的水印设置，水印有变化时重新生成已上传图片的缩略图
+func SaveWatermarkSetting(userID uint, req *models.WatermarkSettingRequest) (*models.WatermarkSetting, error) {
+	db := models.GetDB()
+
+	if req.Type == "" {
+		req.Type = watermark.TypeText
+	}
+	if req.Position == "" {
+		req.Position = watermark.PositionBottomRight
+	}
+	switch req.Type {
+	case watermark.TypeText:
+		if strings.TrimSpace(req.Text) == "" {
+			return nil, errors.New("文字水印内容不能为空")
+		}
+		if req.Color != "" && !watermark.ValidColor(req.Color) {
+			return nil, watermark.ErrInvalidColor
+		}
+	case watermark.TypeImage:
+		if req.ImageID == 0 {
+			return nil, errors.New("图片水印需要指定 image_id")
+		}
+		img, err := dao.GetImageByID(db, req.ImageID)
+		if err != nil || img.UserID != userID {
+			return nil, errors.New("水印图片不存在或无权使用")
+		}
+	default:
+		return nil, errors.New("水印类型只能是 text 或 image")
+	}
+	if !watermark.ValidPosition(req.Position) {
+		return nil, watermark.ErrInvalidPosition
+	}
+	if req.Opacity < 0 || req.Opacity > 1 || req.Scale < 0 || req.Scale > 1 {
+		return nil, errors.New("opacity 和 scale 必须在 0 到 1 之间")
+	}
+
+	setting := &models.WatermarkSetting{
+		UserID:          userID,
+		Enabled:         req.Enabled,
+		Type:            req.Type,
+		Text:            req.Text,
+		Color:           req.Color,
+		ImageID:         req.ImageID,
+		Position:        req.Position,
+		Opacity:         req.Opacity,
+		Scale:           req.Scale,
+		ApplyToOriginal: req.ApplyToOriginal,
+	}
+	previous, err := GetWatermarkSetting(userID)
+	if err != nil {
+		return nil, err
+	}
+	err = db.Transaction(func(tx *gorm.DB) error {
+		if err := dao.SaveWatermarkSetting(tx, setting); err != nil {
+			return err
+		}
+		return regenerateWatermarkedThumbnails(tx, userID, previous, setting)
+	})
+	if err != nil {
+		return nil, err
+	}
+	NotifyJobWorkers()
+	return dao.GetWatermarkSetting(db, userID)
+}
+
+// DeleteWatermarkSetting 删除用户的水印设置，恢复使用全局设置，水印有变化时重新生成已上传图片的缩略图
+func DeleteWatermarkSetting(userID uint) error {
+	previous, err := GetWatermarkSetting(userID)
+	if err != nil {
+		return err
+	}
+	err = models.GetDB().Transaction(func(tx *gorm.DB) error {
+		if err := dao.DeleteWatermarkSetting(tx, userID); err != nil {
+			return err
+		}
+		return regenerateWatermarkedThumbnails(tx, userID, previous, defaultWatermarkSetting(userID))
+	})
+	if err != nil {
+		return err
+	}
+	NotifyJobWorkers()
+	return nil
+}
+
+// regenerateWatermarkedThumbnails 缩略图上的水印在生成时叠加，设置变化后为用户已上传的图片重新创建缩略图任务
+// 原图已加水印的图片缩略图直接由原图缩放，不受设置变化影响
+func regenerateWatermarkedThumbnails(tx *gorm.DB, userID uint, previous, current *models.WatermarkSetting) error {
+	if thumbnailWatermarkKey(previous) == thumbnailWatermarkKey(current) {
+		return nil
+	}
+
+	imageIDs, err := dao.ListImageIDsWithoutWatermarkedOriginal(tx, userID)
+	if err != nil {
+		return err
+	}
+	for _, imageID := range imageIDs {
+		if _, err := EnqueueJob(tx, JobTypeImageThumbnail, ImageJobPayload{ImageID: imageID}); err != nil {
+			return err
+		}
+	}
+
+	logger.GetLogger().WithFields(logrus.Fields{
+		"user_id": userID,
+		"count":   len(imageIDs),
+	}).Info("水印设置已变化，重新生成缩略图")
+	return nil
+}
+
+// thumbnailWatermarkKey 影响缩略图水印效果的设置项，未启用水印时都视为相同
+func thumbnailWatermarkKey(s *models.WatermarkSetting) string {
+	if !s.Enabled {
+		return ""
+	}
+	return fmt.Sprintf("%s|%s|%s|%d|%s|%g|%g", s.Type, s.Text, s.Color, s.ImageID, s.Position, s.Opacity, s.Scale)
+}
+
+// loadWatermark 根据用户的水印设置准备水印，未启用时返回 nil
+func loadWatermark(userID uint) (*watermark.Watermark, *models.WatermarkSetting, error) {
+	cfg := config.GetConfig()
+
+	setting, err := GetWatermarkSetting(userID)
+	if err != nil {
+		return nil, nil, err
+	}
+	if !setting.Enabled {
+		return nil, setting, nil
+	}
+
+	opts := watermark.Options{
+		Type:     setting.Type,
+		Text:     setting.Text,
+		FontPath: cfg.Watermark.FontPath,
+		Color:    setting.Color,
+		Position: setting.Position,
+		Opacity:  setting.Opacity,
+		Scale:    setting.Scale,
+		MinWidth: cfg.Watermark.MinWidth,
+	}
+	if setting.Type == watermark.TypeImage {
+		markPath := cfg.Watermark.ImagePath
+		if setting.ImageID != 0 {
+			markImg, err := dao.GetImageByID(models.GetDB(), setting.ImageID)
+			if err != nil {
+				return nil, setting, fmt.Errorf("获取水印图片失败: %w", err)
+			}
+			markPath = filepath.Join(cfg.Upload.Path, markImg.HashImage+markImg.Imageextenion)
+		}
+		mark, err := imaging.Open(markPath)
+		if err != nil {
+			return nil, setting, fmt.Errorf("读取水印图片失败: %w", err)
+		}
+		opts.Image = mark
+	}
+
+	wm, err := watermark.New(opts)
+	if err != nil {
+		return nil, setting, err
+	}
+	return wm, setting, nil
+}
+
+// originalFormats 可以在加水印后重新编码的原图格式
+var originalFormats = map[string]string{
+	".jpg":  imageenc.FormatJPEG,
+	".jpeg": imageenc.FormatJPEG,
+	".png":  imageenc.FormatPNG,
+	".webp": imageenc.FormatWebP,
+}
+
+// watermarkOriginal 用户设置了给原图加水印时，在保存前给上传的图片加水印
+// 上传流程在加水印之后才计算哈希，保存的文件、哈希和图片地址始终与内容一致
+// 动图和无法重新编码的格式原样返回，水印设置有误时不阻塞上传
+func watermarkOriginal(userID uint, data []byte, extension string) ([]byte, bool, error) {
+	format, ok := originalFormats[strings.ToLower(extension)]
+	if !ok {
+		return data, false, nil
+	}
+
+	wm, setting, err := loadWatermark(userID)
+	if err != nil {
+		logger.GetLogger().WithError(err).WithField("user_id", userID).Warn("加载水印失败，原图不加水印")
+		return data, false, nil
+	}
+	if wm == nil || !setting.ApplyToOriginal {
+		return data, false, nil
+	}
+	if info, err := animation.Probe(data); err == nil && info.TotalFrames > 1 {
+		return data, false, nil
+	}
+
+	img, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, false, fmt.Errorf("解码原图失败: %w", err)
+	}
+	var buf bytes.Buffer
+	if err := imageenc.Encode(&buf, wm.Apply(img), format); err != nil {
+		return nil, false, fmt.Errorf("原图加水印失败: %w", err)
+	}
+	return buf.Bytes(), true, nil
+}
@@ -0,0 +1,147 @@
+package services
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"image"
+	"image/color"
+	"image/png"
+	"img_hosting/config"
+	"img_hosting/dao"
+	"img_hosting/models"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// pendingThumbnailJobs 返回待执行的缩略图任务对应的图片ID
+func pendingThumbnailJobs(t *testing.T, imageIDs ...uint) map[uint]int {
+	t.Helper()
+	var jobs []models.Job
+	if err := models.GetDB().Where("type = ? AND status = ?", JobTypeImageThumbnail, models.JobStatusPending).Find(&jobs).Error; err != nil {
+		t.Fatal(err)
+	}
+	wanted := make(map[uint]bool)
+	for _, id := range imageIDs {
+		wanted[id] = true
+	}
+	counts := make(map[uint]int)
+	for _, job := range jobs {
+		var payload ImageJobPayload
+		if err := json.Unmarshal([]byte(job.Payload), &payload); err != nil {
+			t.Fatal(err)
+		}
+		if wanted[payload.ImageID] {
+			counts[payload.ImageID]++
+		}
+	}
+	return counts
+}
+
+func TestWatermarkSettingChangeRegeneratesThumbnails(t *testing.T) {
+	user := createTestUser(t)
+	db := models.GetDB()
+
+	var ids []uint
+	for i := 0; i < 2; i++ {
+		hash := fmt.Sprintf("wm-regen-%d-%d", user.UserID, i)
+		id, err := dao.CreateImage(db, user.UserID, "/uploads/"+hash+".png", "a.png", ".png", hash, 10, "image/png", "")
+		if err != nil {
+			t.Fatal(err)
+		}
+		ids = append(ids, id)
+	}
+	// 原图已加水印的图片不需要重新生成
+	if err := dao.MarkImageWatermarked(db, ids[1]); err != nil {
+		t.Fatal(err)
+	}
+
+	req := &models.WatermarkSettingRequest{Enabled: true, Type: "text", Text: "hello", Opacity: 0.5, Scale: 0.2}
+	if _, err := SaveWatermarkSetting(user.UserID, req); err != nil {
+		t.Fatalf("保存水印设置失败: %v", err)
+	}
+	if got := pendingThumbnailJobs(t, ids...); got[ids[0]] != 1 || got[ids[1]] != 0 {
+		t.Fatalf("修改水印后的缩略图任务 = %v", got)
+	}
+
+	// 设置没有变化时不重复生成
+	if _, err := SaveWatermarkSetting(user.UserID, req); err != nil {
+		t.Fatal(err)
+	}
+	if got := pendingThumbnailJobs(t, ids...); got[ids[0]] != 1 {
+		t.Fatalf("水印未变化时不应创建任务，got %v", got)
+	}
+
+	// 只修改 apply_to_original 不影响缩略图
+	req.ApplyToOriginal = true
+	if _, err := SaveWatermarkSetting(user.UserID, req); err != nil {
+		t.Fatal(err)
+	}
+	if got := pendingThumbnailJobs(t, ids...); got[ids[0]] != 1 {
+		t.Fatalf("apply_to_original 变化时不应创建任务，got %v", got)
+	}
+
+	// 重置后恢复为全局设置（未启用水印），缩略图需要去掉水印
+	if err := DeleteWatermarkSetting(user.UserID); err != nil {
+		t.Fatalf("重置水印设置失败: %v", err)
+	}
+	if got := pendingThumbnailJobs(t, ids...); got[ids[0]] != 2 || got[ids[1]] != 0 {
+		t.Fatalf("重置水印后的缩略图任务 = %v", got)
+	}
+	setting, err := GetWatermarkSetting(user.UserID)
+	if err != nil || !setting.IsDefault {
+		t.Errorf("重置后应使用全局设置: %+v, %v", setting, err)
+	}
+}
+
+func TestUploadWatermarksOriginalBeforeHashing(t *testing.T) {
+	user := createTestUser(t)
+	req := &models.WatermarkSettingRequest{Enabled: true, Type: "text", Text: "hello", Opacity: 1, Scale: 0.5, ApplyToOriginal: true}
+	if _, err := SaveWatermarkSetting(user.UserID, req); err != nil {
+		t.Fatal(err)
+	}
+
+	src := image.NewRGBA(image.Rect(0, 0, 640, 480))
+	for y := 0; y < 480; y++ {
+		for x := 0; x < 640; x++ {
+			src.Set(x, y, color.RGBA{R: uint8(x), G: uint8(y), B: byte(user.UserID), A: 255})
+		}
+	}
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, src); err != nil {
+		t.Fatal(err)
+	}
+	original := buf.Bytes()
+
+	imageID, imageURL, err := UploadImageReader(user.UserID, "photo.png", bytes.NewReader(original), "")
+	if err != nil {
+		t.Fatalf("上传失败: %v", err)
+	}
+	img, err := dao.GetImageByID(models.GetDB(), imageID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !img.Watermarked {
+		t.Error("原图应标记为已加水印")
+	}
+	if img.HashImage == HashFileName(original) {
+		t.Error("哈希应按加水印后的内容计算")
+	}
+
+	saved, err := os.ReadFile(filepath.Join(config.GetConfig().Upload.Path, img.HashImage+img.Imageextenion))
+	if err != nil {
+		t.Fatalf("读取保存的原图失败: %v", err)
+	}
+	if HashFileName(saved) != img.HashImage || int64(len(saved)) != img.ImageSize {
+		t.Errorf("保存的文件与记录不一致: hash %s/%s, size %d/%d", HashFileName(saved), img.HashImage, len(saved), img.ImageSize)
+	}
+	if imageURL != config.GetConfig().Url.Imgurl+img.HashImage+img.Imageextenion {
+		t.Errorf("图片地址 = %s", imageURL)
+	}
+
+	// 同一张图片再次上传时按加水印后的哈希去重
+	if _, _, err := UploadImageReader(user.UserID, "photo.png", bytes.NewReader(original), ""); err != ErrImageExists {
+		t.Errorf("重复上传应返回 ErrImageExists，got %v", err)
+	}
+}
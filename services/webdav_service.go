@@ -0,0 +1,606 @@
+package services
+
+import (
+	"context"
+	"crypto/md5"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash"
+	"img_hosting/config"
+	"img_hosting/dao"
+	"img_hosting/models"
+	"img_hosting/pkg/logger"
+	"io"
+	"io/fs"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"golang.org/x/net/webdav"
+	"gorm.io/gorm"
+)
+
+var (
+	ErrWebDAVEncrypted = errors.New("加密文件不能通过 WebDAV 读取")
+	ErrWebDAVTooLarge  = errors.New("文件大小超过限制")
+)
+
+// webdavFileSystem 以私人文件实现 webdav.FileSystem
+// 路径与 S3 接口 private bucket 的对象键一致（去掉开头的 /），目录由对象键隐含或由 PrivateFolder 保存
+type webdavFileSystem struct {
+	userID uint
+}
+
+// NewWebDAVFileSystem 返回用户私人文件的 WebDAV 文件系统
+func NewWebDAVFileSystem(userID uint) webdav.FileSystem {
+	return &webdavFileSystem{userID: userID}
+}
+
+// webdavKey 把 WebDAV 路径转换为对象键，根目录为空字符串
+func webdavKey(name string) string {
+	return strings.Trim(path.Clean("/"+name), "/")
+}
+
+func (wfs *webdavFileSystem) Mkdir(ctx context.Context, name string, perm os.FileMode) error {
+	key := webdavKey(name)
+	if key == "" {
+		return os.ErrExist
+	}
+	if err := validateS3Key(key); err != nil {
+		return err
+	}
+	if _, err := wfs.Stat(ctx, name); err == nil {
+		return os.ErrExist
+	} else if !os.IsNotExist(err) {
+		return err
+	}
+	if err := wfs.checkParent(key); err != nil {
+		return err
+	}
+
+	return dao.CreatePrivateFolder(models.GetDB(), &models.PrivateFolder{UserID: wfs.userID, Path: key})
+}
+
+func (wfs *webdavFileSystem) OpenFile(ctx context.Context, name string, flag int, perm os.FileMode) (webdav.File, error) {
+	key := webdavKey(name)
+
+	if flag&(os.O_WRONLY|os.O_RDWR|os.O_CREATE|os.O_TRUNC|os.O_APPEND) != 0 {
+		return wfs.create(ctx, key)
+	}
+
+	if key != "" {
+		file, err := findS3PrivateFile(wfs.userID, key)
+		if err != nil {
+			return nil, err
+		}
+		if file != nil {
+			return &webdavFile{file: file, info: webdavFileInfo(file, key)}, nil
+		}
+	}
+
+	dir, err := wfs.dirInfo(key)
+	if err != nil {
+		return nil, err
+	}
+	if dir == nil {
+		return nil, os.ErrNotExist
+	}
+	return &webdavDir{fs: wfs, key: key, info: dir}, nil
+}
+
+// create 打开一个写入的文件，内容先写入临时文件，关闭时保存为私人文件
+func (wfs *webdavFileSystem) create(ctx context.Context, key string) (webdav.File, error) {
+	if err := validateS3Key(key); err != nil {
+		return nil, err
+	}
+	dir, err := wfs.dirInfo(key)
+	if err != nil {
+		return nil, err
+	}
+	if dir != nil {
+		return nil, os.ErrExist
+	}
+	if err := wfs.checkParent(key); err != nil {
+		return nil, err
+	}
+
+	tmp, err := os.CreateTemp("", "webdav-upload-*")
+	if err != nil {
+		return nil, err
+	}
+	return &webdavWriteFile{
+		userID:  wfs.userID,
+		key:     key,
+		tmp:     tmp,
+		hash:    md5.New(),
+		maxSize: config.GetConfig().PrivateFiles.MaxSize,
+		body:    webdavRequestBody(ctx),
+	}, nil
+}
+
+// RemoveAll 删除文件或目录（包括目录下的所有文件），不允许删除根目录
+func (wfs *webdavFileSystem) RemoveAll(ctx context.Context, name string) error {
+	key := webdavKey(name)
+	if key == "" {
+		return os.ErrPermission
+	}
+
+	file, err := findS3PrivateFile(wfs.userID, key)
+	if err != nil {
+		return err
+	}
+	if file != nil {
+		return DeletePrivateFile(file.ID, wfs.userID)
+	}
+
+	db := models.GetDB()
+	files, err := dao.ListPrivateFilesByKeyPrefix(db, wfs.userID, key+"/")
+	if err != nil {
+		return err
+	}
+	for _, f := range files {
+		if err := DeletePrivateFile(f.ID, wfs.userID); err != nil {
+			return err
+		}
+	}
+	return dao.DeletePrivateFolderTree(db, wfs.userID, key)
+}
+
+// Rename 移动文件或目录，目录下的文件和子目录一起移动
+func (wfs *webdavFileSystem) Rename(ctx context.Context, oldName, newName string) error {
+	oldKey, newKey := webdavKey(oldName), webdavKey(newName)
+	if oldKey == "" || newKey == "" {
+		return os.ErrPermission
+	}
+	if err := validateS3Key(newKey); err != nil {
+		return err
+	}
+	if err := wfs.checkParent(newKey); err != nil {
+		return err
+	}
+
+	log := logger.GetLogger().WithFields(logrus.Fields{
+		"user_id": wfs.userID,
+		"from":    oldKey,
+		"to":      newKey,
+	})
+
+	file, err := findS3PrivateFile(wfs.userID, oldKey)
+	if err != nil {
+		return err
+	}
+	if file != nil {
+		// 与上传一致，只允许配置中的文件类型
+		ext := strings.ToLower(filepath.Ext(newKey))
+		if !isAllowedPrivateFileType(config.GetConfig().PrivateFiles.AllowedTypes, ext) {
+			return fmt.Errorf("%w: 不支持的文件类型", os.ErrPermission)
+		}
+		log.Info("WebDAV 移动文件")
+		return dao.RenamePrivateFileObject(models.GetDB(), file.ID, newKey, path.Base(newKey))
+	}
+
+	dir, err := wfs.dirInfo(oldKey)
+	if err != nil {
+		return err
+	}
+	if dir == nil {
+		return os.ErrNotExist
+	}
+	if strings.HasPrefix(newKey, oldKey+"/") {
+		return fmt.Errorf("%w: 不能把目录移动到自身之下", os.ErrInvalid)
+	}
+
+	log.Info("WebDAV 移动目录")
+	return models.GetDB().Transaction(func(tx *gorm.DB) error {
+		files, err := dao.ListPrivateFilesByKeyPrefix(tx, wfs.userID, oldKey+"/")
+		if err != nil {
+			return err
+		}
+		for _, f := range files {
+			key := newKey + strings.TrimPrefix(f.ObjectKey, oldKey)
+			if err := dao.RenamePrivateFileObject(tx, f.ID, key, path.Base(key)); err != nil {
+				return err
+			}
+		}
+
+		folders, err := dao.ListPrivateFolderTree(tx, wfs.userID, oldKey)
+		if err != nil {
+			return err
+		}
+		for _, folder := range folders {
+			if err := dao.UpdatePrivateFolderPath(tx, folder.ID, newKey+strings.TrimPrefix(folder.Path, oldKey)); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+func (wfs *webdavFileSystem) Stat(ctx context.Context, name string) (os.FileInfo, error) {
+	key := webdavKey(name)
+	if key != "" {
+		file, err := findS3PrivateFile(wfs.userID, key)
+		if err != nil {
+			return nil, err
+		}
+		if file != nil {
+			return webdavFileInfo(file, key), nil
+		}
+	}
+
+	dir, err := wfs.dirInfo(key)
+	if err != nil {
+		return nil, err
+	}
+	if dir == nil {
+		return nil, os.ErrNotExist
+	}
+	return dir, nil
+}
+
+// dirInfo 返回目录信息，目录不存在时返回 nil
+// 目录存在是指创建过该目录，或者有文件的对象键以它为前缀；修改时间取两者中较新的
+func (wfs *webdavFileSystem) dirInfo(key string) (*webdavInfo, error) {
+	db := models.GetDB()
+	prefix := ""
+	if key != "" {
+		prefix = key + "/"
+	}
+
+	folder, err := dao.GetPrivateFolder(db, wfs.userID, key)
+	if err != nil {
+		return nil, err
+	}
+	latest, err := dao.GetLatestPrivateFileByKeyPrefix(db, wfs.userID, prefix)
+	if err != nil {
+		return nil, err
+	}
+	if key != "" && folder == nil && latest == nil {
+		return nil, nil
+	}
+
+	info := webdavDirInfo(path.Base("/" + key))
+	if folder != nil {
+		info.modTime = folder.CreatedAt
+	}
+	if latest != nil && latest.UpdatedAt.After(info.modTime) {
+		info.modTime = latest.UpdatedAt
+	}
+	return info, nil
+}
+
+// checkParent 检查上级目录是否存在，不存在时返回 os.ErrNotExist（WebDAV 返回 409）
+func (wfs *webdavFileSystem) checkParent(key string) error {
+	parent := path.Dir(key)
+	if parent == "." {
+		return nil
+	}
+	dir, err := wfs.dirInfo(parent)
+	if err != nil {
+		return err
+	}
+	if dir == nil {
+		return os.ErrNotExist
+	}
+	return nil
+}
+
+// readDir 列出目录下的直接子项，同名的文件和目录只保留文件
+func (wfs *webdavFileSystem) readDir(key string) ([]os.FileInfo, error) {
+	db := models.GetDB()
+	prefix := ""
+	if key != "" {
+		prefix = key + "/"
+	}
+
+	files, err := dao.ListUserPrivateFileObjects(db, wfs.userID)
+	if err != nil {
+		return nil, err
+	}
+	folders, err := dao.ListUserPrivateFolders(db, wfs.userID)
+	if err != nil {
+		return nil, err
+	}
+
+	entries := make(map[string]os.FileInfo)
+	addDir := func(p string) {
+		rest, ok := strings.CutPrefix(p, prefix)
+		if !ok || rest == "" {
+			return
+		}
+		name, _, _ := strings.Cut(rest, "/")
+		if _, exists := entries[name]; !exists {
+			entries[name] = webdavDirInfo(name)
+		}
+	}
+
+	for i := range files {
+		objectKey := privateFileObjectKey(&files[i])
+		rest, ok := strings.CutPrefix(objectKey, prefix)
+		if !ok {
+			continue
+		}
+		if strings.Contains(rest, "/") {
+			addDir(objectKey)
+			continue
+		}
+		entries[rest] = webdavFileInfo(&files[i], objectKey)
+	}
+	for _, folder := range folders {
+		addDir(folder.Path)
+	}
+
+	infos := make([]os.FileInfo, 0, len(entries))
+	for _, info := range entries {
+		infos = append(infos, info)
+	}
+	sort.Slice(infos, func(i, j int) bool { return infos[i].Name() < infos[j].Name() })
+	return infos, nil
+}
+
+// webdavInfo 实现 os.FileInfo，并提供 ETag 和 Content-Type 以免 WebDAV 读取文件内容
+type webdavInfo struct {
+	name        string
+	size        int64
+	modTime     time.Time
+	dir         bool
+	etag        string
+	contentType string
+}
+
+func webdavDirInfo(name string) *webdavInfo {
+	return &webdavInfo{name: name, dir: true}
+}
+
+func webdavFileInfo(file *models.PrivateFile, key string) *webdavInfo {
+	return &webdavInfo{
+		name:        path.Base(key),
+		size:        file.FileSize,
+		modTime:     file.UpdatedAt,
+		etag:        file.FileHash,
+		contentType: file.FileType,
+	}
+}
+
+func (i *webdavInfo) Name() string       { return i.name }
+func (i *webdavInfo) Size() int64        { return i.size }
+func (i *webdavInfo) ModTime() time.Time { return i.modTime }
+func (i *webdavInfo) IsDir() bool        { return i.dir }
+func (i *webdavInfo) Sys() interface{}   { return nil }
+
+func (i *webdavInfo) Mode() os.FileMode {
+	if i.dir {
+		return fs.ModeDir | 0755
+	}
+	return 0644
+}
+
+func (i *webdavInfo) ETag(ctx context.Context) (string, error) {
+	if i.etag == "" {
+		return "", webdav.ErrNotImplemented
+	}
+	return `"` + i.etag + `"`, nil
+}
+
+func (i *webdavInfo) ContentType(ctx context.Context) (string, error) {
+	if i.contentType == "" {
+		return "", webdav.ErrNotImplemented
+	}
+	return i.contentType, nil
+}
+
+// webdavFile 只读打开的文件，第一次读取时才打开磁盘文件，PROPFIND 只需要 Stat
+type webdavFile struct {
+	file *models.PrivateFile
+	info *webdavInfo
+	f    *os.File
+}
+
+func (wf *webdavFile) open() error {
+	if wf.f != nil {
+		return nil
+	}
+	if wf.file.IsEncrypted {
+		return fmt.Errorf("%w: %w", os.ErrPermission, ErrWebDAVEncrypted)
+	}
+	f, err := os.Open(wf.file.StoragePath)
+	if err != nil {
+		return err
+	}
+	wf.f = f
+	return nil
+}
+
+func (wf *webdavFile) Read(p []byte) (int, error) {
+	if err := wf.open(); err != nil {
+		return 0, err
+	}
+	return wf.f.Read(p)
+}
+
+func (wf *webdavFile) Seek(offset int64, whence int) (int64, error) {
+	if err := wf.open(); err != nil {
+		return 0, err
+	}
+	return wf.f.Seek(offset, whence)
+}
+
+func (wf *webdavFile) Close() error {
+	if wf.f != nil {
+		return wf.f.Close()
+	}
+	return nil
+}
+
+func (wf *webdavFile) Readdir(count int) ([]os.FileInfo, error) {
+	return nil, os.ErrInvalid
+}
+
+func (wf *webdavFile) Stat() (os.FileInfo, error) {
+	return wf.info, nil
+}
+
+func (wf *webdavFile) Write(p []byte) (int, error) {
+	return 0, os.ErrPermission
+}
+
+// webdavDir 打开的目录
+type webdavDir struct {
+	fs      *webdavFileSystem
+	key     string
+	info    *webdavInfo
+	entries []os.FileInfo
+	loaded  bool
+}
+
+func (d *webdavDir) Readdir(count int) ([]os.FileInfo, error) {
+	if !d.loaded {
+		entries, err := d.fs.readDir(d.key)
+		if err != nil {
+			return nil, err
+		}
+		d.entries, d.loaded = entries, true
+	}
+
+	if count <= 0 {
+		entries := d.entries
+		d.entries = nil
+		return entries, nil
+	}
+	if len(d.entries) == 0 {
+		return nil, io.EOF
+	}
+	if count > len(d.entries) {
+		count = len(d.entries)
+	}
+	entries := d.entries[:count]
+	d.entries = d.entries[count:]
+	return entries, nil
+}
+
+func (d *webdavDir) Stat() (os.FileInfo, error)                   { return d.info, nil }
+func (d *webdavDir) Read(p []byte) (int, error)                   { return 0, os.ErrInvalid }
+func (d *webdavDir) Seek(offset int64, whence int) (int64, error) { return 0, os.ErrInvalid }
+func (d *webdavDir) Write(p []byte) (int, error)                  { return 0, os.ErrInvalid }
+func (d *webdavDir) Close() error                                 { return nil }
+
+// webdavBodyKey 请求上下文中保存 webdavBody 的键
+type webdavBodyKey struct{}
+
+// webdavBody 记录读取请求体时的错误
+// 客户端中途断开时 webdav.Handler 只是停止写入并照常调用 Close，文件本身无法知道内容不完整
+type webdavBody struct {
+	io.ReadCloser
+	err error
+}
+
+func (b *webdavBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	if err != nil && err != io.EOF && b.err == nil {
+		b.err = err
+	}
+	return n, err
+}
+
+// TrackWebDAVUpload 包装请求体，上传中途失败时不保存不完整的文件
+func TrackWebDAVUpload(r *http.Request) *http.Request {
+	if r.Body == nil || r.Body == http.NoBody {
+		return r
+	}
+	body := &webdavBody{ReadCloser: r.Body}
+	r = r.WithContext(context.WithValue(r.Context(), webdavBodyKey{}, body))
+	r.Body = body
+	return r
+}
+
+func webdavRequestBody(ctx context.Context) *webdavBody {
+	body, _ := ctx.Value(webdavBodyKey{}).(*webdavBody)
+	return body
+}
+
+// webdavWriteFile 写入中的文件，Close 时按对象键保存为私人文件（覆盖同名文件）
+// 写入失败、超过大小限制或请求体读取失败时 Close 不保存，避免不完整的内容覆盖已有文件
+type webdavWriteFile struct {
+	userID  uint
+	key     string
+	tmp     *os.File
+	hash    hash.Hash
+	size    int64
+	maxSize int64
+	body    *webdavBody
+	err     error // 第一次写入失败的错误
+	closed  bool
+}
+
+func (wf *webdavWriteFile) Write(p []byte) (int, error) {
+	if wf.err != nil {
+		return 0, wf.err
+	}
+	if wf.size+int64(len(p)) > wf.maxSize {
+		wf.err = ErrWebDAVTooLarge
+		return 0, wf.err
+	}
+	n, err := wf.tmp.Write(p)
+	wf.hash.Write(p[:n])
+	wf.size += int64(n)
+	if err != nil {
+		wf.err = err
+	}
+	return n, err
+}
+
+func (wf *webdavWriteFile) Close() error {
+	if wf.closed {
+		return nil
+	}
+	wf.closed = true
+	defer func() {
+		wf.tmp.Close()
+		os.Remove(wf.tmp.Name())
+	}()
+
+	err := wf.err
+	if err == nil && wf.body != nil {
+		err = wf.body.err
+	}
+	if err != nil {
+		logger.GetLogger().WithError(err).WithFields(logrus.Fields{
+			"user_id": wf.userID,
+			"key":     wf.key,
+			"size":    wf.size,
+		}).Warn("WebDAV 上传未完成，不保存文件")
+		return err
+	}
+
+	if _, err := wf.tmp.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+
+	logger.GetLogger().WithFields(logrus.Fields{
+		"user_id": wf.userID,
+		"key":     wf.key,
+		"size":    wf.size,
+	}).Info("WebDAV 上传文件")
+
+	_, err = savePrivateFileObject(wf.userID, wf.key, wf.tmp, wf.size, hex.EncodeToString(wf.hash.Sum(nil)))
+	return err
+}
+
+func (wf *webdavWriteFile) Stat() (os.FileInfo, error) {
+	return &webdavInfo{
+		name:    path.Base(wf.key),
+		size:    wf.size,
+		modTime: time.Now(),
+		etag:    hex.EncodeToString(wf.hash.Sum(nil)),
+	}, nil
+}
+
+func (wf *webdavWriteFile) Read(p []byte) (int, error)                   { return 0, os.ErrInvalid }
+func (wf *webdavWriteFile) Seek(offset int64, whence int) (int64, error) { return 0, os.ErrInvalid }
+func (wf *webdavWriteFile) Readdir(count int) ([]os.FileInfo, error)     { return nil, os.ErrInvalid }
@@ -0,0 +1,92 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+)
+
+// writeWebDAVFile 模拟 webdav.Handler 的 PUT：复制请求体后无论成功与否都调用 Close
+func writeWebDAVFile(t *testing.T, userID uint, key string, body io.Reader) error {
+	t.Helper()
+	r := TrackWebDAVUpload(httptest.NewRequest(http.MethodPut, "/webdav/"+key, body))
+	f, err := NewWebDAVFileSystem(userID).OpenFile(r.Context(), "/"+key, os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0666)
+	if err != nil {
+		t.Fatalf("打开文件失败: %v", err)
+	}
+	_, copyErr := io.Copy(f, r.Body)
+	closeErr := f.Close()
+	if copyErr != nil {
+		return copyErr
+	}
+	return closeErr
+}
+
+// brokenReader 返回部分内容后连接断开
+type brokenReader struct{ data io.Reader }
+
+func (b *brokenReader) Read(p []byte) (int, error) {
+	n, err := b.data.Read(p)
+	if err == io.EOF {
+		return n, io.ErrUnexpectedEOF
+	}
+	return n, err
+}
+
+func TestWebDAVWriteFileFailedUploadKeepsExistingFile(t *testing.T) {
+	user := createTestUser(t)
+	const key = "readme.txt"
+
+	if err := writeWebDAVFile(t, user.UserID, key, strings.NewReader("original content")); err != nil {
+		t.Fatalf("上传失败: %v", err)
+	}
+	original, err := findS3PrivateFile(user.UserID, key)
+	if err != nil || original == nil {
+		t.Fatalf("上传后找不到文件: %v", err)
+	}
+
+	// 客户端中途断开，不完整的内容不能覆盖已有文件
+	err = writeWebDAVFile(t, user.UserID, key, &brokenReader{data: strings.NewReader("trunc")})
+	if !errors.Is(err, io.ErrUnexpectedEOF) {
+		t.Fatalf("中途断开应返回错误，got %v", err)
+	}
+	current, err := findS3PrivateFile(user.UserID, key)
+	if err != nil || current == nil {
+		t.Fatalf("已有文件被删除: %v", err)
+	}
+	if current.ID != original.ID || current.FileHash != original.FileHash {
+		t.Errorf("已有文件被覆盖: %+v", current)
+	}
+}
+
+func TestWebDAVWriteFileTooLarge(t *testing.T) {
+	user := createTestUser(t)
+	fs := NewWebDAVFileSystem(user.UserID)
+	f, err := fs.OpenFile(context.Background(), "/big.txt", os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0666)
+	if err != nil {
+		t.Fatal(err)
+	}
+	wf := f.(*webdavWriteFile)
+	wf.maxSize = 8
+
+	if _, err := wf.Write([]byte("12345")); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := wf.Write([]byte("67890")); !errors.Is(err, ErrWebDAVTooLarge) {
+		t.Fatalf("超过大小限制应返回 ErrWebDAVTooLarge，got %v", err)
+	}
+	if err := wf.Close(); !errors.Is(err, ErrWebDAVTooLarge) {
+		t.Fatalf("Close 应返回写入时的错误，got %v", err)
+	}
+	if _, err := os.Stat(wf.tmp.Name()); !os.IsNotExist(err) {
+		t.Error("临时文件没有删除")
+	}
+	if file, _ := findS3PrivateFile(user.UserID, "big.txt"); file != nil {
+		t.Error("超过大小限制的文件不应保存")
+	}
+}